@@ -1,11 +1,16 @@
 package aws
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"regexp"
+	"strings"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws/arn"
 	"github.com/fatih/color"
 	"github.com/go-ini/ini"
 )
@@ -17,6 +22,20 @@ type Credentials struct {
 	SecretAccessKey string
 	SessionToken    string
 	Expiration      time.Time
+	// RoleARN is the ARN of the IAM role the credentials belong to, if known.
+	RoleARN string
+	// PrincipalARN is the ARN of the SAML provider the role is assumed with, if known.
+	PrincipalARN string
+}
+
+// AccountID returns the ID of the AWS account of the role the credentials belong to, or an empty
+// string if the role is unknown.
+func (c *Credentials) AccountID() string {
+	a, err := arn.Parse(c.RoleARN)
+	if err != nil {
+		return ""
+	}
+	return a.AccountID
 }
 
 // Profile represents an AWS profile
@@ -26,31 +45,182 @@ type Profile struct {
 	ExpireAtUnix int64
 }
 
-const expireKey = "aws_expiration"
+const (
+	expireKey = "aws_expiration"
+	// legacyTokenKey is the key which old SDKs, e.g. boto 2, read the session token from.
+	legacyTokenKey = "aws_security_token"
+)
+
+// credentialKeys are the keys of a profile which hold its credentials.
+var credentialKeys = []string{"aws_access_key_id", "aws_secret_access_key", "aws_session_token", legacyTokenKey, expireKey}
+
+// LegacyTokenKey makes WriteToFile, WriteToConfigFile and WriteViaCLI write the session token to
+// aws_security_token in addition to aws_session_token, if set.
+var LegacyTokenKey bool
+
+// Types of files which profiles can be written to.
+const (
+	// FileTypeCredentials is the shared credentials file of the AWS CLI, e.g. ~/.aws/credentials,
+	// whose sections are named after their profiles.
+	FileTypeCredentials = "credentials"
+	// FileTypeConfig is the config file of the AWS CLI, e.g. ~/.aws/config, in which the names of
+	// the sections of profiles other than the default profile are prefixed with "profile ".
+	FileTypeConfig = "config"
+)
+
+// ConfigSection returns the name of the section of profile in the AWS CLI config file.
+func ConfigSection(profile string) string {
+	if profile == "default" {
+		return profile
+	}
+	return configProfilePrefix + profile
+}
+
+// ProfileName returns the name of the profile of section, which is a section of either the AWS
+// CLI credentials file or its config file.
+func ProfileName(section string) string {
+	return strings.TrimPrefix(section, configProfilePrefix)
+}
+
+// markerPrefix starts the comment which WriteToFile writes into each profile it writes.
+const markerPrefix = "# clisso:"
+
+// Marker is the metadata WriteToFile records in a comment at the top of each profile, e.g.
+// "# clisso: account=123456789012 role=Admin written=2021-02-08T18:00:00Z". The comment is ignored
+// by the AWS CLI and SDKs.
+type Marker struct {
+	// AccountID is the ID of the AWS account the credentials belong to, if known.
+	AccountID string
+	// Role is the name of the IAM role the credentials belong to without its path, if known.
+	Role string
+	// Written is when the credentials were written.
+	Written time.Time
+}
+
+// newMarker returns the marker of c written at now.
+func newMarker(c *Credentials, now time.Time) Marker {
+	m := Marker{AccountID: c.AccountID(), Written: now.UTC().Truncate(time.Second)}
+	if a, err := arn.Parse(c.RoleARN); err == nil {
+		m.Role = a.Resource[strings.LastIndex(a.Resource, "/")+1:]
+	}
+	return m
+}
+
+// String returns the comment line of m.
+func (m Marker) String() string {
+	fields := []string{markerPrefix}
+	if m.AccountID != "" {
+		fields = append(fields, "account="+m.AccountID)
+	}
+	if m.Role != "" {
+		fields = append(fields, "role="+m.Role)
+	}
+	fields = append(fields, "written="+m.Written.Format(time.RFC3339))
+	return strings.Join(fields, " ")
+}
+
+// parseMarker parses the marker in comment, which may consist of several lines. ok is false if
+// comment doesn't contain a marker.
+func parseMarker(comment string) (m Marker, ok bool) {
+	for _, line := range strings.Split(comment, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, markerPrefix) {
+			continue
+		}
+
+		for _, f := range strings.Fields(strings.TrimPrefix(line, markerPrefix)) {
+			parts := strings.SplitN(f, "=", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			switch parts[0] {
+			case "account":
+				m.AccountID = parts[1]
+			case "role":
+				m.Role = parts[1]
+			case "written":
+				// A malformed timestamp leaves Written unset rather than discarding the marker.
+				m.Written, _ = time.Parse(time.RFC3339, parts[1])
+			}
+		}
+		return m, true
+	}
+
+	return Marker{}, false
+}
+
+// credentialProcessVersion is the version of the credential_process output format.
+const credentialProcessVersion = 1
+
+// credentialProcessOutput represents credentials in the format the AWS CLI and SDKs expect from a
+// credential_process
+// (https://docs.aws.amazon.com/cli/latest/userguide/cli-configure-sourcing-external.html).
+type credentialProcessOutput struct {
+	Version         int
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      time.Time
+	// RoleArn isn't part of the credential_process format and is ignored by the AWS CLI and SDKs.
+	RoleArn string `json:",omitempty"`
+}
+
+// configProfilePrefix is the prefix of named profile sections in the AWS CLI config file.
+const configProfilePrefix = "profile "
+
+// ValidateSectionName verifies name can be used as the header of a section in an AWS CLI
+// credentials or config file.
+func ValidateSectionName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return errors.New("section name must not be empty")
+	}
+	if strings.TrimSpace(name) != name {
+		return fmt.Errorf("section name %q must not begin or end with whitespace", name)
+	}
+	if strings.ContainsAny(name, "[]\r\n") {
+		return fmt.Errorf("section name %q must not contain brackets or line breaks", name)
+	}
+	if strings.TrimSpace(strings.TrimPrefix(name, configProfilePrefix)) == "" ||
+		name == strings.TrimSpace(configProfilePrefix) {
+		return fmt.Errorf("section name %q is missing a profile name", name)
+	}
+	return nil
+}
 
 // WriteToFile writes credentials to an AWS CLI credentials file
 // (https://docs.aws.amazon.com/cli/latest/userguide/cli-config-files.html). In addition, this
 // function removes expired temporary credentials from the credentials file.
 func WriteToFile(c *Credentials, filename string, section string) error {
-	cfg, err := ini.LooseLoad(filename)
-	if err != nil {
+	if err := ValidateSectionName(section); err != nil {
 		return err
 	}
-	cfg.DeleteSection(section)
-	_, err = cfg.Section(section).NewKey("aws_access_key_id", c.AccessKeyID)
-	if err != nil {
+	return writeProfile(c, filename, section, false)
+}
+
+// WriteToConfigFile writes credentials to the given profile of an AWS CLI config file, naming its
+// section using ConfigSection. Unlike WriteToFile, other settings of the profile, e.g. its region,
+// are kept, and only the credentials are removed from profiles whose credentials expired.
+func WriteToConfigFile(c *Credentials, filename string, profile string) error {
+	if err := ValidateSectionName(profile); err != nil {
 		return err
 	}
-	_, err = cfg.Section(section).NewKey("aws_secret_access_key", c.SecretAccessKey)
+	return writeProfile(c, filename, ConfigSection(profile), true)
+}
+
+// writeProfile writes credentials to section of the AWS CLI file at filename and removes expired
+// credentials from the file. If keepSettings is true, only the credential keys of sections are
+// replaced or removed instead of whole sections.
+func writeProfile(c *Credentials, filename string, section string, keepSettings bool) error {
+	cfg, err := ini.LooseLoad(filename)
 	if err != nil {
 		return err
 	}
-	_, err = cfg.Section(section).NewKey("aws_session_token", c.SessionToken)
-	if err != nil {
-		return err
+	if keepSettings {
+		deleteCredentials(cfg.Section(section))
+	} else {
+		cfg.DeleteSection(section)
 	}
-	_, err = cfg.Section(section).NewKey(expireKey, c.Expiration.UTC().Format(time.RFC3339))
-	if err != nil {
+	if err := setCredentials(cfg.Section(section), c); err != nil {
 		return err
 	}
 
@@ -66,36 +236,107 @@ func WriteToFile(c *Credentials, filename string, section string) error {
 			continue
 		}
 		if time.Now().UTC().Unix() > v.Unix() {
-			cfg.DeleteSection(s.Name())
+			if keepSettings {
+				deleteCredentials(s)
+			}
+			if !keepSettings || len(s.Keys()) == 0 {
+				cfg.DeleteSection(s.Name())
+			}
 		}
 	}
 
-	return cfg.SaveTo(filename)
+	// Write atomically to avoid leaving a corrupt file behind if clisso is interrupted.
+	return writeFileAtomic(filename, func(w io.Writer) error {
+		_, err := cfg.WriteTo(w)
+		return err
+	})
 }
 
-// WriteToShell writes (prints) credentials to stdout. If windows is true, Windows syntax will be
-// used.
+// setCredentials adds the keys holding the credentials c to s. A marker recording whose
+// credentials they are is added as a comment.
+func setCredentials(s *ini.Section, c *Credentials) error {
+	k, err := s.NewKey("aws_access_key_id", c.AccessKeyID)
+	if err != nil {
+		return err
+	}
+	k.Comment = newMarker(c, time.Now()).String()
+	_, err = s.NewKey("aws_secret_access_key", c.SecretAccessKey)
+	if err != nil {
+		return err
+	}
+	_, err = s.NewKey("aws_session_token", c.SessionToken)
+	if err != nil {
+		return err
+	}
+	if LegacyTokenKey {
+		_, err = s.NewKey(legacyTokenKey, c.SessionToken)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = s.NewKey(expireKey, c.Expiration.UTC().Format(time.RFC3339))
+	return err
+}
+
+// WriteINI writes credentials to w as an AWS CLI credentials file containing only section. Unlike
+// WriteToFile, nothing is read, so w may be a pipe.
+func WriteINI(c *Credentials, section string, w io.Writer) error {
+	cfg := ini.Empty()
+	s, err := cfg.NewSection(section)
+	if err != nil {
+		return err
+	}
+	if err := setCredentials(s, c); err != nil {
+		return err
+	}
+	_, err = cfg.WriteTo(w)
+	return err
+}
+
+// deleteCredentials removes the credential keys from s.
+func deleteCredentials(s *ini.Section) {
+	for _, k := range credentialKeys {
+		s.DeleteKey(k)
+	}
+}
+
+// WriteToShell writes (prints) credentials to w as shell variable assignments. If windows is true,
+// Windows syntax will be used. Nothing but the assignments is written to w.
 func WriteToShell(c *Credentials, windows bool, w io.Writer) {
-	log.Println(color.GreenString("Please paste the following in your shell:"))
+	WriteToShellWithPrefix(c, windows, "", w)
+}
+
+// WriteToShellWithPrefix is like WriteToShell, but prepends prefix to the names of the variables,
+// e.g. MYAPP_AWS_ACCESS_KEY_ID for the prefix MYAPP_.
+func WriteToShellWithPrefix(c *Credentials, windows bool, prefix string, w io.Writer) {
+	cmd := "export"
 	if windows {
-		fmt.Fprintf(
-			w,
-			"set AWS_ACCESS_KEY_ID=%v\nset AWS_SECRET_ACCESS_KEY=%v\nset AWS_SESSION_TOKEN=%v\n",
-			c.AccessKeyID,
-			c.SecretAccessKey,
-			c.SessionToken,
-		)
-	} else {
-		fmt.Fprintf(
-			w,
-			"export AWS_ACCESS_KEY_ID=%v\nexport AWS_SECRET_ACCESS_KEY=%v\nexport AWS_SESSION_TOKEN=%v\n",
-			c.AccessKeyID,
-			c.SecretAccessKey,
-			c.SessionToken,
-		)
+		cmd = "set"
+	}
+
+	for _, v := range []struct{ name, value string }{
+		{"AWS_ACCESS_KEY_ID", c.AccessKeyID},
+		{"AWS_SECRET_ACCESS_KEY", c.SecretAccessKey},
+		{"AWS_SESSION_TOKEN", c.SessionToken},
+	} {
+		fmt.Fprintf(w, "%s %s%s=%v\n", cmd, prefix, v.name, v.value)
 	}
 }
 
+// keyPrefixPattern matches prefixes which result in valid shell variable names when prepended to
+// the names of the variables written by WriteToShell.
+var keyPrefixPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidateKeyPrefix verifies prefix can be prepended to the names of the variables written by
+// WriteToShellWithPrefix.
+func ValidateKeyPrefix(prefix string) error {
+	if !keyPrefixPattern.MatchString(prefix) {
+		return fmt.Errorf("key prefix %q must start with a letter or an underscore and contain only "+
+			"letters, digits and underscores", prefix)
+	}
+	return nil
+}
+
 // GetValidCredentials returns profiles which have a aws_expiration key but are not yet expired.
 func GetValidCredentials(filename string) ([]Profile, error) {
 	var profiles []Profile
@@ -113,7 +354,7 @@ func GetValidCredentials(filename string) ([]Profile, error) {
 			}
 
 			if time.Now().UTC().Unix() < v.Unix() {
-				profile := Profile{Name: s.Name(), ExpireAtUnix: v.Unix(), LifetimeLeft: v.Sub(time.Now().UTC())}
+				profile := Profile{Name: ProfileName(s.Name()), ExpireAtUnix: v.Unix(), LifetimeLeft: v.Sub(time.Now().UTC())}
 				profiles = append(profiles, profile)
 			}
 
@@ -121,3 +362,151 @@ func GetValidCredentials(filename string) ([]Profile, error) {
 	}
 	return profiles, nil
 }
+
+// WriteCredentialProcess writes credentials to w as a JSON document which can be consumed by the
+// AWS CLI and SDKs when clisso is used as a credential_process.
+func WriteCredentialProcess(c *Credentials, w io.Writer) error {
+	out := credentialProcessOutput{
+		Version:         credentialProcessVersion,
+		AccessKeyID:     c.AccessKeyID,
+		SecretAccessKey: c.SecretAccessKey,
+		SessionToken:    c.SessionToken,
+		Expiration:      c.Expiration.UTC(),
+		RoleArn:         c.RoleARN,
+	}
+
+	return json.NewEncoder(w).Encode(&out)
+}
+
+// ParseCredentialProcess parses credentials written by WriteCredentialProcess.
+func ParseCredentialProcess(b []byte) (*Credentials, error) {
+	var in credentialProcessOutput
+	if err := json.Unmarshal(b, &in); err != nil {
+		return nil, fmt.Errorf("parsing credentials: %v", err)
+	}
+
+	if in.Version != credentialProcessVersion {
+		return nil, fmt.Errorf("unsupported credentials version %d", in.Version)
+	}
+
+	return &Credentials{
+		AccessKeyID:     in.AccessKeyID,
+		SecretAccessKey: in.SecretAccessKey,
+		SessionToken:    in.SessionToken,
+		Expiration:      in.Expiration,
+		RoleARN:         in.RoleArn,
+	}, nil
+}
+
+// containerCredentialsOutput represents credentials in the format the AWS SDKs expect from a
+// container credentials endpoint, e.g. the ECS task metadata endpoint.
+type containerCredentialsOutput struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string
+	Token           string
+	Expiration      time.Time
+	RoleArn         string `json:",omitempty"`
+}
+
+// WriteContainerCredentials writes credentials to w as a JSON document which can be consumed by
+// the AWS CLI and SDKs from a container credentials endpoint
+// (AWS_CONTAINER_CREDENTIALS_FULL_URI).
+func WriteContainerCredentials(c *Credentials, w io.Writer) error {
+	out := containerCredentialsOutput{
+		AccessKeyID:     c.AccessKeyID,
+		SecretAccessKey: c.SecretAccessKey,
+		Token:           c.SessionToken,
+		Expiration:      c.Expiration.UTC(),
+		RoleArn:         c.RoleARN,
+	}
+
+	return json.NewEncoder(w).Encode(&out)
+}
+
+// ReadFromFile reads the credentials in the given section of the AWS CLI credentials file at
+// filename, or in the section of the profile section if the file is an AWS CLI config file. The
+// expiration of the credentials is the zero time if the section has no aws_expiration key.
+func ReadFromFile(filename, section string) (*Credentials, error) {
+	cfg, err := ini.Load(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := cfg.GetSection(section)
+	if err != nil {
+		// The file may be an AWS CLI config file.
+		s, err = cfg.GetSection(ConfigSection(section))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("profile %s not found in %s", section, filename)
+	}
+	if !s.HasKey("aws_access_key_id") || !s.HasKey("aws_secret_access_key") {
+		return nil, fmt.Errorf("profile %s doesn't contain credentials", section)
+	}
+
+	c := Credentials{
+		AccessKeyID:     s.Key("aws_access_key_id").String(),
+		SecretAccessKey: s.Key("aws_secret_access_key").String(),
+		SessionToken:    s.Key("aws_session_token").String(),
+	}
+	if s.HasKey(expireKey) {
+		c.Expiration, err = s.Key(expireKey).TimeFormat(time.RFC3339)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s of profile %s: %v", expireKey, section, err)
+		}
+	}
+
+	return &c, nil
+}
+
+// ReadMarker returns the marker WriteToFile recorded in the given section of the AWS CLI
+// credentials file at filename. nil is returned if the file or the section doesn't exist or the
+// section has no marker, e.g. because it wasn't written by Clisso.
+func ReadMarker(filename, section string) (*Marker, error) {
+	cfg, err := ini.LooseLoad(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := cfg.GetSection(section)
+	if err != nil {
+		return nil, nil
+	}
+	for _, k := range s.Keys() {
+		if m, ok := parseMarker(k.Comment); ok {
+			return &m, nil
+		}
+	}
+	return nil, nil
+}
+
+// StoredAccountID returns the ID of the AWS account the credentials in the given section of the
+// AWS CLI credentials file at filename belong to according to the marker of the section. An empty
+// string is returned if the file or the section doesn't exist or the account isn't recorded.
+func StoredAccountID(filename, section string) (string, error) {
+	m, err := ReadMarker(filename, section)
+	if err != nil || m == nil {
+		return "", err
+	}
+	return m.AccountID, nil
+}
+
+// Fields are the names of the credential fields supported by Field, which match the keys of the
+// credential_process output.
+var Fields = []string{"AccessKeyId", "SecretAccessKey", "SessionToken", "Expiration"}
+
+// Field returns the value of the credential field name of c. name is one of Fields and is
+// matched case-insensitively. The expiration is formatted in RFC 3339 format.
+func Field(c *Credentials, name string) (string, error) {
+	switch strings.ToLower(name) {
+	case "accesskeyid":
+		return c.AccessKeyID, nil
+	case "secretaccesskey":
+		return c.SecretAccessKey, nil
+	case "sessiontoken":
+		return c.SessionToken, nil
+	case "expiration":
+		return c.Expiration.UTC().Format(time.RFC3339), nil
+	}
+	return "", fmt.Errorf("unknown field %q: must be one of %s", name, strings.Join(Fields, ", "))
+}
@@ -3,7 +3,11 @@ package aws
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 	"time"
 
@@ -260,3 +264,464 @@ func TestWriteToShellWindows(t *testing.T) {
 		t.Fatalf("Wrong info written to shell: got %v want %v", got, want)
 	}
 }
+
+func TestWriteToShellWithPrefix(t *testing.T) {
+	c := Credentials{
+		AccessKeyID:     "testkey",
+		SecretAccessKey: "testsecret",
+		SessionToken:    "testtoken",
+		Expiration:      time.Now(),
+	}
+
+	for _, test := range []struct {
+		name    string
+		windows bool
+		want    string
+	}{
+		{"Unix", false, "export MYAPP_AWS_ACCESS_KEY_ID=testkey\nexport MYAPP_AWS_SECRET_ACCESS_KEY=testsecret\nexport MYAPP_AWS_SESSION_TOKEN=testtoken\n"},
+		{"Windows", true, "set MYAPP_AWS_ACCESS_KEY_ID=testkey\nset MYAPP_AWS_SECRET_ACCESS_KEY=testsecret\nset MYAPP_AWS_SESSION_TOKEN=testtoken\n"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var b bytes.Buffer
+			WriteToShellWithPrefix(&c, test.windows, "MYAPP_", &b)
+			if got := b.String(); got != test.want {
+				t.Errorf("Wrong info written to shell: got %q want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateKeyPrefix(t *testing.T) {
+	for _, test := range []struct {
+		prefix      string
+		expectError bool
+	}{
+		{"MYAPP_", false},
+		{"_x", false},
+		{"app2_", false},
+		{"", true},
+		{"2APP_", true},
+		{"MY-APP_", true},
+		{"MY APP", true},
+		{"A=B", true},
+	} {
+		err := ValidateKeyPrefix(test.prefix)
+		if test.expectError && err == nil {
+			t.Errorf("expected error for %q", test.prefix)
+		}
+		if !test.expectError && err != nil {
+			t.Errorf("unexpected error for %q: %v", test.prefix, err)
+		}
+	}
+}
+
+func TestCredentialProcess(t *testing.T) {
+	c := Credentials{
+		AccessKeyID:     "testkey",
+		SecretAccessKey: "testsecret",
+		SessionToken:    "testtoken",
+		Expiration:      time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC),
+	}
+	var b bytes.Buffer
+
+	err := WriteCredentialProcess(&c, &b)
+	if err != nil {
+		t.Fatal("Could not write credentials: ", err)
+	}
+
+	got := b.String()
+	want := `{"Version":1,"AccessKeyId":"testkey","SecretAccessKey":"testsecret",` +
+		`"SessionToken":"testtoken","Expiration":"2021-02-03T04:05:06Z"}` + "\n"
+	if got != want {
+		t.Fatalf("Wrong credential_process output: got %v want %v", got, want)
+	}
+
+	parsed, err := ParseCredentialProcess(b.Bytes())
+	if err != nil {
+		t.Fatal("Could not parse credentials: ", err)
+	}
+	if *parsed != c {
+		t.Fatalf("Wrong parsed credentials: got %+v want %+v", *parsed, c)
+	}
+
+	c.RoleARN = "arn:aws:iam::123456789012:role/Test"
+	b.Reset()
+	if err := WriteCredentialProcess(&c, &b); err != nil {
+		t.Fatal("Could not write credentials: ", err)
+	}
+	if !strings.Contains(b.String(), `"RoleArn":"arn:aws:iam::123456789012:role/Test"`) {
+		t.Fatalf("Role ARN missing from credential_process output: %v", b.String())
+	}
+	parsed, err = ParseCredentialProcess(b.Bytes())
+	if err != nil {
+		t.Fatal("Could not parse credentials: ", err)
+	}
+	if *parsed != c {
+		t.Fatalf("Wrong parsed credentials: got %+v want %+v", *parsed, c)
+	}
+	if parsed.AccountID() != "123456789012" {
+		t.Fatalf("Wrong account ID: got %s want %s", parsed.AccountID(), "123456789012")
+	}
+
+	_, err = ParseCredentialProcess([]byte(`{"Version":2}`))
+	if err == nil {
+		t.Fatal("Unsupported version was parsed")
+	}
+}
+
+func TestValidateSectionName(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		section     string
+		expectError bool
+	}{
+		{"App name", "my-app", false},
+		{"Config file profile", "profile my-app", false},
+		{"Default profile", "default", false},
+		{"Empty", "", true},
+		{"Whitespace", "  ", true},
+		{"Leading whitespace", " my-app", true},
+		{"Brackets", "my]app", true},
+		{"Line break", "my\napp", true},
+		{"Profile prefix only", "profile ", true},
+		{"Profile keyword only", "profile", true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateSectionName(test.section)
+			if test.expectError && err == nil {
+				t.Errorf("expected error")
+			}
+			if !test.expectError && err != nil {
+				t.Errorf("unexpected error %+v", err)
+			}
+		})
+	}
+}
+
+func TestReadFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	want := &Credentials{
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+		Expiration:      time.Now().Add(time.Hour).UTC().Truncate(time.Second),
+	}
+	if err := WriteToFile(want, path, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadFromFile(path, "test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *got != *want {
+		t.Errorf("wrong credentials: got %+v, want %+v", got, want)
+	}
+
+	if _, err := ReadFromFile(path, "missing"); err == nil {
+		t.Error("expected an error for a missing profile")
+	}
+}
+
+func TestStoredAccountID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	c := &Credentials{
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+		Expiration:      time.Now().Add(time.Hour),
+		RoleARN:         "arn:aws:iam::123456789012:role/Test",
+	}
+	if err := WriteToFile(c, path, "with-role"); err != nil {
+		t.Fatal(err)
+	}
+	c.RoleARN = ""
+	if err := WriteToFile(c, path, "without-role"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		section string
+		expect  string
+	}{
+		{"with-role", "123456789012"},
+		{"without-role", ""},
+		{"missing", ""},
+	} {
+		t.Run(test.section, func(t *testing.T) {
+			got, err := StoredAccountID(path, test.section)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.expect {
+				t.Errorf("wrong account: got %q, want %q", got, test.expect)
+			}
+		})
+	}
+}
+
+func TestWriteToConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	existing := "[default]\nregion = eu-west-1\n\n" +
+		"[profile expired]\nregion = us-east-1\naws_access_key_id = old\naws_expiration = 2020-01-01T00:00:00Z\n\n" +
+		"[profile stale]\naws_access_key_id = old\naws_expiration = 2020-01-01T00:00:00Z\n\n" +
+		"[profile test]\nregion = eu-central-1\naws_access_key_id = old\n"
+	if err := ioutil.WriteFile(path, []byte(existing), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Credentials{
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+		Expiration:      time.Now().Add(time.Hour).UTC().Truncate(time.Second),
+	}
+	for _, profile := range []string{"test", "default"} {
+		if err := WriteToConfigFile(c, path, profile); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg, err := ini.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for section, region := range map[string]string{
+		"default":         "eu-west-1",
+		"profile test":    "eu-central-1",
+		"profile expired": "us-east-1",
+	} {
+		s, err := cfg.GetSection(section)
+		if err != nil {
+			t.Fatalf("section %s missing: %v", section, err)
+		}
+		if got := s.Key("region").String(); got != region {
+			t.Errorf("wrong region in %s: got %q, want %q", section, got, region)
+		}
+	}
+	if cfg.Section("profile expired").HasKey("aws_access_key_id") {
+		t.Error("expired credentials weren't removed")
+	}
+	if _, err := cfg.GetSection("profile stale"); err == nil {
+		t.Error("section with only expired credentials wasn't removed")
+	}
+
+	got, err := ReadFromFile(path, "test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *got != *c {
+		t.Errorf("wrong credentials: got %+v, want %+v", got, c)
+	}
+
+	profiles, err := GetValidCredentials(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, len(profiles))
+	for i, p := range profiles {
+		names[i] = p.Name
+	}
+	if strings.Join(names, ",") != "default,test" {
+		t.Errorf("wrong profiles with valid credentials: got %v", names)
+	}
+}
+
+func TestWriteToFileMissingDirectory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "home", ".aws")
+	path := filepath.Join(dir, "credentials")
+	c := &Credentials{
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+		Expiration:      time.Now().Add(time.Hour).UTC().Truncate(time.Second),
+	}
+
+	if err := WriteToFile(c, path, "test"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := ReadFromFile(path, "test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *got != *c {
+		t.Errorf("wrong credentials: got %+v, want %+v", got, c)
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != defaultDirPerm {
+		t.Errorf("wrong permissions of created directory: got %v, want %v", info.Mode().Perm(),
+			os.FileMode(defaultDirPerm))
+	}
+}
+
+func TestWriteLegacyTokenKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	c := &Credentials{
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+		Expiration:      time.Now().Add(time.Hour),
+	}
+
+	LegacyTokenKey = true
+	err := WriteToConfigFile(c, path, "test")
+	LegacyTokenKey = false
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := ini.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := cfg.Section("profile test")
+	for _, k := range []string{"aws_session_token", "aws_security_token"} {
+		if got := s.Key(k).String(); got != "token" {
+			t.Errorf("wrong %s: got %q, want %q", k, got, "token")
+		}
+	}
+
+	// The legacy key is removed when the option is turned off.
+	if err := WriteToConfigFile(c, path, "test"); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = ini.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Section("profile test").HasKey("aws_security_token") {
+		t.Error("aws_security_token wasn't removed")
+	}
+}
+
+func TestWriteINI(t *testing.T) {
+	c := &Credentials{
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+		Expiration:      time.Now().Add(time.Hour).UTC().Truncate(time.Second),
+	}
+	var b bytes.Buffer
+	if err := WriteINI(c, "test", &b); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "credentials")
+	if err := ioutil.WriteFile(path, b.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadFromFile(path, "test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *got != *c {
+		t.Errorf("wrong credentials: got %+v, want %+v", got, c)
+	}
+
+	if IsPipe(path) {
+		t.Error("regular file detected as a pipe")
+	}
+}
+
+func TestReadMarker(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	if err := ioutil.WriteFile(path, []byte("[manual]\n# a comment\naws_access_key_id = key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now().UTC().Truncate(time.Second)
+	c := &Credentials{
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+		Expiration:      time.Now().Add(time.Hour),
+		RoleARN:         "arn:aws:iam::123456789012:role/path/Admin",
+	}
+	if err := WriteToFile(c, path, "test"); err != nil {
+		t.Fatal(err)
+	}
+	// Writing another profile must preserve the marker of the first one.
+	if err := WriteToFile(c, path, "other"); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := ReadMarker(path, "test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m == nil {
+		t.Fatal("no marker found")
+	}
+	if m.AccountID != "123456789012" || m.Role != "Admin" {
+		t.Errorf("wrong marker: got %+v", m)
+	}
+	if m.Written.Before(before) || m.Written.After(time.Now()) {
+		t.Errorf("wrong write time: got %v", m.Written)
+	}
+
+	for _, section := range []string{"manual", "missing"} {
+		if m, err := ReadMarker(path, section); err != nil || m != nil {
+			t.Errorf("expected no marker for %s, got %+v, %v", section, m, err)
+		}
+	}
+}
+
+func TestParseMarker(t *testing.T) {
+	written := time.Date(2021, 2, 8, 18, 0, 0, 0, time.UTC)
+	for _, m := range []Marker{
+		{AccountID: "123456789012", Role: "Admin", Written: written},
+		{Written: written},
+	} {
+		got, ok := parseMarker("; other comment\n" + m.String())
+		if !ok {
+			t.Fatalf("marker %q not parsed", m)
+		}
+		if got != m {
+			t.Errorf("wrong marker: got %+v, want %+v", got, m)
+		}
+	}
+
+	if _, ok := parseMarker("# not a marker"); ok {
+		t.Error("unexpected marker")
+	}
+}
+
+func TestField(t *testing.T) {
+	c := &Credentials{
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+		Expiration:      time.Date(2020, 9, 13, 12, 26, 40, 0, time.UTC),
+	}
+
+	for _, test := range []struct {
+		field       string
+		expect      string
+		expectError bool
+	}{
+		{"AccessKeyId", "key", false},
+		{"SecretAccessKey", "secret", false},
+		{"sessiontoken", "token", false},
+		{"Expiration", "2020-09-13T12:26:40Z", false},
+		{"RoleArn", "", true},
+	} {
+		t.Run(test.field, func(t *testing.T) {
+			got, err := Field(c, test.field)
+			if test.expectError {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.expect {
+				t.Errorf("wrong value: got %q, want %q", got, test.expect)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package aws
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/go-ini/ini"
+)
+
+// awsCLI is the name of the AWS CLI executable. It is a variable to allow tests to simulate a
+// missing AWS CLI.
+var awsCLI = "aws"
+
+// FindCLI returns the path of the AWS CLI executable, or an error if it isn't in PATH.
+func FindCLI() (string, error) {
+	bin, err := exec.LookPath(awsCLI)
+	if err != nil {
+		return "", fmt.Errorf("the AWS CLI is required to write credentials using it, but '%s' "+
+			"wasn't found in PATH", awsCLI)
+	}
+	return bin, nil
+}
+
+// WriteViaCLI writes credentials to the given profile of the AWS CLI credentials file at filename
+// by running `aws configure set`, which leaves the format of the file to the AWS CLI. Since the
+// arguments of processes are visible to other users of the machine, e.g. through ps, only the
+// access key ID is passed to the AWS CLI. The secret access key and the session token are written
+// by editing the credentials file directly once the AWS CLI is done, as is aws_security_token,
+// which `aws configure set` would write to the config file. For the same reason, the expiration
+// of the credentials isn't written, and expired credentials aren't removed like WriteToFile does.
+func WriteViaCLI(c *Credentials, filename, profile string) error {
+	bin, err := FindCLI()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(bin, "configure", "set", "aws_access_key_id", c.AccessKeyID, "--profile", profile)
+	cmd.Env = append(os.Environ(), "AWS_SHARED_CREDENTIALS_FILE="+filename)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("running 'aws configure set aws_access_key_id': %v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	if err := writeSecretKeys(c, filename, profile); err != nil {
+		return fmt.Errorf("writing secret keys: %v", err)
+	}
+	return nil
+}
+
+// writeSecretKeys sets the secret access key and the session token of profile in the credentials
+// file at filename to those of c. aws_security_token is set to the session token as well if
+// LegacyTokenKey is set, or else removed.
+func writeSecretKeys(c *Credentials, filename, profile string) error {
+	cfg, err := ini.LooseLoad(filename)
+	if err != nil {
+		return err
+	}
+	s := cfg.Section(profile)
+	s.Key("aws_secret_access_key").SetValue(c.SecretAccessKey)
+	s.Key("aws_session_token").SetValue(c.SessionToken)
+	if LegacyTokenKey {
+		s.Key(legacyTokenKey).SetValue(c.SessionToken)
+	} else {
+		s.DeleteKey(legacyTokenKey)
+	}
+
+	return writeFileAtomic(filename, func(w io.Writer) error {
+		_, err := cfg.WriteTo(w)
+		return err
+	})
+}
@@ -0,0 +1,93 @@
+package aws
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/go-ini/ini"
+)
+
+func TestWriteViaCLI(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake AWS CLI is a shell script")
+	}
+
+	dir := t.TempDir()
+	log := filepath.Join(dir, "calls")
+	script := "#!/bin/sh\necho \"$AWS_SHARED_CREDENTIALS_FILE $*\" >> " + log + "\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "aws"), []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir)
+
+	creds := filepath.Join(dir, "credentials")
+	c := &Credentials{AccessKeyID: "key", SecretAccessKey: "secret", SessionToken: "token"}
+	if err := WriteViaCLI(c, creds, "my-app"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	b, err := ioutil.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.TrimSpace(string(b)), creds+" configure set aws_access_key_id key --profile my-app"; got != want {
+		t.Errorf("wrong calls:\ngot  %q\nwant %q", got, want)
+	}
+
+	// The secrets aren't passed to the AWS CLI, where they would be visible in the process list,
+	// but written to the credentials file directly.
+	cfg, err := ini.Load(creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := cfg.Section("my-app")
+	if got := s.Key("aws_secret_access_key").String(); got != "secret" {
+		t.Errorf("wrong secret access key: got %q, want %q", got, "secret")
+	}
+	if got := s.Key("aws_session_token").String(); got != "token" {
+		t.Errorf("wrong session token: got %q, want %q", got, "token")
+	}
+	if s.HasKey("aws_security_token") {
+		t.Error("legacy token key was written without LegacyTokenKey")
+	}
+
+	// The legacy token key is written to the credentials file rather than passed to the AWS CLI,
+	// which would write it to the config file, and a leftover one is removed.
+	for _, legacy := range []bool{true, false} {
+		if err := ioutil.WriteFile(creds, []byte("[my-app]\naws_security_token = old\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		LegacyTokenKey = legacy
+		err := WriteViaCLI(c, creds, "my-app")
+		LegacyTokenKey = false
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		cfg, err := ini.Load(creds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := cfg.Section("my-app")
+		if legacy && s.Key("aws_security_token").String() != "token" {
+			t.Errorf("wrong legacy token key: got %q, want %q", s.Key("aws_security_token").String(), "token")
+		}
+		if !legacy && s.HasKey("aws_security_token") {
+			t.Error("leftover legacy token key wasn't removed")
+		}
+	}
+	if b, err := ioutil.ReadFile(log); err != nil || strings.Contains(string(b), "token") || strings.Contains(string(b), "secret") {
+		t.Errorf("secrets were passed to the AWS CLI (%v):\n%s", err, b)
+	}
+
+	awsCLI = "clisso-test-missing-aws"
+	defer func() { awsCLI = "aws" }()
+	if err := WriteViaCLI(c, creds, "my-app"); err == nil || !strings.Contains(err.Error(), "wasn't found in PATH") {
+		t.Errorf("expected missing AWS CLI error, got %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package aws
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+const (
+	// ClockSkewMessage is a hint to show to the user when STS rejects a request in a way which
+	// suggests that the system clock is wrong.
+	ClockSkewMessage = "STS rejected the request due to a time validity problem. This usually " +
+		"means the system clock is wrong. Please verify the system clock is correct, e.g. by " +
+		"enabling time synchronization using NTP."
+
+	// defaultSTSURL is the URL of STS used if STSEndpoint isn't set.
+	defaultSTSURL = "https://sts.amazonaws.com"
+)
+
+// timeErrorMessages are fragments of STS error messages which indicate a time validity problem.
+var timeErrorMessages = []string{"expired", "not yet valid", "notbefore", "notonorafter"}
+
+// IsClockSkewError returns true if err is an STS error which indicates that the system clock may
+// be wrong, for example because a SAML assertion was rejected as expired or not yet valid.
+func IsClockSkewError(err error) bool {
+	var awsErr awserr.Error
+	if !errors.As(err, &awsErr) {
+		return false
+	}
+
+	switch awsErr.Code() {
+	case "ExpiredTokenException", "RequestExpired":
+		return true
+	case "InvalidIdentityToken", "SignatureDoesNotMatch", "InvalidClientTokenId":
+		msg := strings.ToLower(awsErr.Message())
+		for _, m := range timeErrorMessages {
+			if strings.Contains(msg, m) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// STSURL returns the URL of the STS endpoint requests are sent to if endpoint is passed to
+// STSConfig: endpoint, or STSEndpoint if endpoint is empty and STSEndpoint is set.
+func STSURL(endpoint string) string {
+	if endpoint != "" {
+		return endpoint
+	}
+	if STSEndpoint != "" {
+		return STSEndpoint
+	}
+	return defaultSTSURL
+}
+
+// ClockSkew returns the difference between the system clock and the clock of STS according to
+// the Date header of an STS response. A positive value means the system clock is ahead. The
+// result is accurate to about a second.
+func ClockSkew(hc *http.Client) (time.Duration, error) {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+
+	resp, err := hc.Head(STSURL(""))
+	if err != nil {
+		return 0, fmt.Errorf("sending HTTP request: %v", err)
+	}
+	resp.Body.Close()
+
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return 0, fmt.Errorf("parsing Date header: %v", err)
+	}
+
+	return time.Since(date), nil
+}
@@ -0,0 +1,52 @@
+package aws
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+func TestIsClockSkewError(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		err    error
+		expect bool
+	}{
+		{"Expired token", awserr.New("ExpiredTokenException", "Token must be redeemed within 5 minutes of issuance", nil), true},
+		{"Assertion not yet valid", awserr.New("InvalidIdentityToken", "Response is not yet valid", nil), true},
+		{"Invalid assertion", awserr.New("InvalidIdentityToken", "Invalid SAML assertion", nil), false},
+		{"Signature expired", awserr.New("SignatureDoesNotMatch", "Signature expired: 20210203T040506Z is now earlier than 20210203T041006Z", nil), true},
+		{"Access denied", awserr.New("AccessDenied", "Not authorized to perform sts:AssumeRoleWithSAML", nil), false},
+		{"Wrapped", fmt.Errorf("attaching session tags: %w", awserr.New("RequestExpired", "Request has expired", nil)), true},
+		{"Other error", errors.New("expired"), false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := IsClockSkewError(test.err); got != test.expect {
+				t.Errorf("got %v, want %v", got, test.expect)
+			}
+		})
+	}
+}
+
+func TestClockSkew(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+	}))
+	defer ts.Close()
+
+	STSEndpoint = ts.URL
+	defer func() { STSEndpoint = "" }()
+
+	skew, err := ClockSkew(ts.Client())
+	if err != nil {
+		t.Fatalf("unexpected error %+v", err)
+	}
+	if skew < time.Hour-2*time.Second || skew > time.Hour+2*time.Second {
+		t.Errorf("wrong skew: got %v, want about %v", skew, time.Hour)
+	}
+}
@@ -0,0 +1,86 @@
+package aws
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+const (
+	// DefaultExecCredentialAPIVersion is the version of the Kubernetes ExecCredential API used if
+	// kubectl doesn't request one.
+	DefaultExecCredentialAPIVersion = "client.authentication.k8s.io/v1beta1"
+
+	// eksTokenPrefix is the prefix of the bearer tokens accepted by EKS.
+	eksTokenPrefix = "k8s-aws-v1."
+	// eksClusterIDHeader is the signed header which binds a token to a cluster.
+	eksClusterIDHeader = "x-k8s-aws-id"
+	// eksPresignExpiry is how long the presigned request in a token is valid.
+	eksPresignExpiry = 15 * time.Minute
+	// eksTokenLifetime is how long a token is reported to be valid. EKS rejects tokens 15 minutes
+	// after they were created, so kubectl is told to get a new one shortly before.
+	eksTokenLifetime = 14 * time.Minute
+)
+
+// EKSToken returns a bearer token which authenticates the holder of c to the EKS cluster named
+// cluster, along with the time it expires at. Like 'aws eks get-token', the token is a presigned
+// STS GetCallerIdentity request for endpoint, or for the default endpoint of STS if endpoint is
+// empty (see STSConfig). No request is sent.
+func EKSToken(c *Credentials, cluster, endpoint string) (string, time.Time, error) {
+	cfg := STSConfig(endpoint, nil)
+	cfg.Credentials = credentials.NewStaticCredentials(c.AccessKeyID, c.SecretAccessKey, c.SessionToken)
+	svc, err := newSTS(cfg)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	req, _ := svc.GetCallerIdentityRequest(&sts.GetCallerIdentityInput{})
+	req.HTTPRequest.Header.Add(eksClusterIDHeader, cluster)
+	u, err := req.Presign(eksPresignExpiry)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("presigning request: %v", err)
+	}
+
+	exp := time.Now().Add(eksTokenLifetime)
+	if !c.Expiration.IsZero() && c.Expiration.Before(exp) {
+		exp = c.Expiration
+	}
+
+	return eksTokenPrefix + base64.RawURLEncoding.EncodeToString([]byte(u)), exp, nil
+}
+
+// execCredential is a Kubernetes ExecCredential object as expected from an exec credential
+// plugin by kubectl:
+// https://kubernetes.io/docs/reference/access-authn-authz/authentication/#client-go-credential-plugins
+type execCredential struct {
+	APIVersion string               `json:"apiVersion"`
+	Kind       string               `json:"kind"`
+	Status     execCredentialStatus `json:"status"`
+}
+
+type execCredentialStatus struct {
+	ExpirationTimestamp time.Time `json:"expirationTimestamp"`
+	Token               string    `json:"token"`
+}
+
+// WriteExecCredential writes token, which expires at exp, to w as a Kubernetes ExecCredential
+// object of the given API version.
+func WriteExecCredential(token string, exp time.Time, apiVersion string, w io.Writer) error {
+	out := execCredential{
+		APIVersion: apiVersion,
+		Kind:       "ExecCredential",
+		Status: execCredentialStatus{
+			// kubectl caches the token until this time. It must be in RFC 3339 format in UTC
+			// without fractional seconds.
+			ExpirationTimestamp: exp.UTC().Truncate(time.Second),
+			Token:               token,
+		},
+	}
+
+	return json.NewEncoder(w).Encode(&out)
+}
@@ -0,0 +1,90 @@
+package aws
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEKSToken(t *testing.T) {
+	region, hasRegion := os.LookupEnv("AWS_REGION")
+	os.Setenv("AWS_REGION", "us-east-1")
+	defer func() {
+		if hasRegion {
+			os.Setenv("AWS_REGION", region)
+		} else {
+			os.Unsetenv("AWS_REGION")
+		}
+	}()
+
+	for _, test := range []struct {
+		name       string
+		expiration time.Time
+		endpoint   string
+		expectMax  time.Duration
+	}{
+		{"Long lived credentials", time.Now().Add(time.Hour), "", eksTokenLifetime},
+		{"Credentials expire first", time.Now().Add(5 * time.Minute), "", 5 * time.Minute},
+		{"Regional endpoint", time.Now().Add(time.Hour), "https://sts-fips.us-east-2.amazonaws.com", eksTokenLifetime},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c := &Credentials{AccessKeyID: "testkey", SecretAccessKey: "testsecret", SessionToken: "testtoken",
+				Expiration: test.expiration}
+
+			token, exp, err := EKSToken(c, "my-cluster", test.endpoint)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if remaining := time.Until(exp); remaining > test.expectMax || remaining < test.expectMax-time.Minute {
+				t.Errorf("wrong expiration: %s remaining, want %s", remaining, test.expectMax)
+			}
+
+			if !strings.HasPrefix(token, eksTokenPrefix) {
+				t.Fatalf("token %q lacks prefix %q", token, eksTokenPrefix)
+			}
+			b, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, eksTokenPrefix))
+			if err != nil {
+				t.Fatalf("decoding token: %v", err)
+			}
+			u, err := url.Parse(string(b))
+			if err != nil {
+				t.Fatalf("parsing presigned URL: %v", err)
+			}
+			if test.endpoint != "" && u.Scheme+"://"+u.Host != test.endpoint {
+				t.Errorf("wrong endpoint: got %s, want %s", u.Host, test.endpoint)
+			}
+			q := u.Query()
+			if test.endpoint != "" && !strings.Contains(q.Get("X-Amz-Credential"), "/us-east-2/") {
+				t.Errorf("not signed for the region of the endpoint: %s", q.Get("X-Amz-Credential"))
+			}
+			if q.Get("Action") != "GetCallerIdentity" {
+				t.Errorf("wrong action: got %s", q.Get("Action"))
+			}
+			if !strings.Contains(q.Get("X-Amz-SignedHeaders"), eksClusterIDHeader) {
+				t.Errorf("cluster header isn't signed: %s", q.Get("X-Amz-SignedHeaders"))
+			}
+			if q.Get("X-Amz-Security-Token") != "testtoken" {
+				t.Errorf("wrong security token: got %s", q.Get("X-Amz-Security-Token"))
+			}
+		})
+	}
+}
+
+func TestWriteExecCredential(t *testing.T) {
+	var b bytes.Buffer
+	exp := time.Date(2021, 2, 8, 10, 14, 0, 123, time.FixedZone("CET", 3600))
+	if err := WriteExecCredential("k8s-aws-v1.token", exp, DefaultExecCredentialAPIVersion, &b); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"apiVersion":"client.authentication.k8s.io/v1beta1","kind":"ExecCredential",` +
+		`"status":{"expirationTimestamp":"2021-02-08T09:14:00Z","token":"k8s-aws-v1.token"}}` + "\n"
+	if b.String() != want {
+		t.Errorf("wrong output:\ngot  %s\nwant %s", b.String(), want)
+	}
+}
@@ -0,0 +1,38 @@
+package aws
+
+import (
+	"fmt"
+	"io"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// ParseRecipient parses an age X25519 recipient, i.e. a public key starting with "age1".
+func ParseRecipient(s string) (age.Recipient, error) {
+	r, err := age.ParseX25519Recipient(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid age recipient %q: %v", s, err)
+	}
+	return r, nil
+}
+
+// WriteEncrypted writes credentials to w in the format written by WriteCredentialProcess,
+// encrypted to recipient using age and ASCII-armored so that the output can be pasted as text.
+// The recipient decrypts it using e.g. "age --decrypt --identity key.txt".
+func WriteEncrypted(c *Credentials, recipient age.Recipient, w io.Writer) error {
+	aw := armor.NewWriter(w)
+
+	ew, err := age.Encrypt(aw, recipient)
+	if err != nil {
+		return fmt.Errorf("encrypting credentials: %v", err)
+	}
+	if err := WriteCredentialProcess(c, ew); err != nil {
+		return err
+	}
+	if err := ew.Close(); err != nil {
+		return fmt.Errorf("encrypting credentials: %v", err)
+	}
+
+	return aw.Close()
+}
@@ -0,0 +1,81 @@
+package aws
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// IsPipe returns true if the file at path is a named pipe (FIFO) or a character device such as
+// /dev/stdout. Such files can't be read back and replaced like regular files, so credentials must
+// be written to them directly.
+func IsPipe(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return info.Mode()&(os.ModeNamedPipe|os.ModeCharDevice) != 0
+}
+
+// defaultFilePerm is the permissions of files created by writeFileAtomic.
+const defaultFilePerm = 0600
+
+// defaultDirPerm is the permissions of directories created by writeFileAtomic.
+const defaultDirPerm = 0700
+
+// writeFileAtomic writes the data written by write to w to the file at path such that readers
+// never see a partially written file: the data is written to a temporary file in the same
+// directory which then replaces the file at path. The permissions of an existing file are
+// preserved. New files and missing parent directories, e.g. ~/.aws on a fresh machine, are only
+// accessible by the current user. If path is a symbolic link, the file it points to is replaced.
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+
+	perm := os.FileMode(defaultFilePerm)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	return writeFileAtomicPerm(path, perm, write)
+}
+
+// writeFileAtomicPerm is like writeFileAtomic, but the file has the permissions perm once it
+// replaces the file at path, whether it existed or not. The temporary file is only accessible by
+// the current user while it is written.
+func writeFileAtomicPerm(path string, perm os.FileMode, write func(w io.Writer) error) (err error) {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), defaultDirPerm); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if err = write(tmp); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,85 @@
+package aws
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "credentials")
+	if err := ioutil.WriteFile(path, []byte("original"), 0640); err != nil {
+		t.Fatalf("writing file: %v", err)
+	}
+
+	// Simulate an interruption after part of the data was written.
+	err := writeFileAtomic(path, func(w io.Writer) error {
+		if _, err := w.Write([]byte("parti")); err != nil {
+			return err
+		}
+		return errors.New("interrupted")
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	assertFile(t, path, "original")
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("reading directory: %v", err)
+	}
+	if len(files) != 1 {
+		t.Errorf("temporary file wasn't removed: %d files in directory", len(files))
+	}
+
+	err = writeFileAtomic(path, func(w io.Writer) error {
+		_, err := w.Write([]byte("updated"))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %+v", err)
+	}
+	assertFile(t, path, "updated")
+	assertPerm(t, path, 0640)
+
+	newPath := filepath.Join(dir, "new")
+	err = writeFileAtomic(newPath, func(w io.Writer) error {
+		_, err := w.Write([]byte("new"))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %+v", err)
+	}
+	assertFile(t, newPath, "new")
+	assertPerm(t, newPath, defaultFilePerm)
+}
+
+func assertFile(t *testing.T, path, want string) {
+	t.Helper()
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading file: %v", err)
+	}
+	if string(b) != want {
+		t.Errorf("wrong content: got %q, want %q", b, want)
+	}
+}
+
+func assertPerm(t *testing.T, path string, want os.FileMode) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if info.Mode().Perm() != want {
+		t.Errorf("wrong permissions: got %v, want %v", info.Mode().Perm(), want)
+	}
+}
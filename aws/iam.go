@@ -0,0 +1,47 @@
+package aws
+
+import (
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+)
+
+// IAMEndpoint overrides the endpoint IAM requests are sent to if set. This allows using a fake IAM
+// server in tests.
+var IAMEndpoint string
+
+// newIAM returns a client for the IAM API. It is a variable to allow replacing IAM with a mock in
+// tests.
+var newIAM = func(cfgs ...*aws.Config) (iamiface.IAMAPI, error) {
+	sess, err := newSession(IAMEndpoint, cfgs...)
+	if err != nil {
+		return nil, err
+	}
+	return iam.New(sess), nil
+}
+
+// AccountAlias returns the alias of the AWS account c belongs to, or an empty string if the
+// account has no alias. This requires the iam:ListAccountAliases permission. IAM requests are sent
+// using hc, or the default client of the AWS SDK if hc is nil.
+func AccountAlias(c *Credentials, hc *http.Client) (string, error) {
+	svc, err := newIAM(&aws.Config{
+		Credentials: credentials.NewStaticCredentials(c.AccessKeyID, c.SecretAccessKey, c.SessionToken),
+		HTTPClient:  hc,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := svc.ListAccountAliases(&iam.ListAccountAliasesInput{})
+	if err != nil {
+		return "", err
+	}
+	// An account has at most one alias.
+	if len(resp.AccountAliases) == 0 {
+		return "", nil
+	}
+	return aws.StringValue(resp.AccountAliases[0]), nil
+}
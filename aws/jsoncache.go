@@ -0,0 +1,105 @@
+package aws
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// Formats supported by WriteJSONCache and ReadJSONCache.
+const (
+	// JSONCacheFormatCLI is the format of the credentials cache of the AWS CLI and botocore
+	// (~/.aws/cli/cache), which wraps the credentials in a Credentials object like the response
+	// of STS.
+	JSONCacheFormatCLI = "cli"
+	// JSONCacheFormatProcess is the format expected from a credential_process.
+	JSONCacheFormatProcess = "process"
+)
+
+// cliCacheOutput represents credentials in the format of the AWS CLI credentials cache.
+type cliCacheOutput struct {
+	Credentials struct {
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string
+		SessionToken    string
+		Expiration      time.Time
+	}
+	// RoleArn isn't part of the cache format and is ignored by the AWS CLI.
+	RoleArn string `json:",omitempty"`
+}
+
+// WriteJSONCache writes credentials to the file at path as a JSON document in the given format.
+// The parent directory of path is created if it doesn't exist. Both are only accessible by the
+// current user.
+func WriteJSONCache(c *Credentials, path, format string) error {
+	var out interface{}
+	switch format {
+	case JSONCacheFormatCLI:
+		var o cliCacheOutput
+		o.Credentials.AccessKeyID = c.AccessKeyID
+		o.Credentials.SecretAccessKey = c.SecretAccessKey
+		o.Credentials.SessionToken = c.SessionToken
+		o.Credentials.Expiration = c.Expiration.UTC()
+		o.RoleArn = c.RoleARN
+		out = &o
+	case JSONCacheFormatProcess:
+		out = &credentialProcessOutput{
+			Version:         credentialProcessVersion,
+			AccessKeyID:     c.AccessKeyID,
+			SecretAccessKey: c.SecretAccessKey,
+			SessionToken:    c.SessionToken,
+			Expiration:      c.Expiration.UTC(),
+			RoleArn:         c.RoleARN,
+		}
+	default:
+		return fmt.Errorf("unsupported JSON cache format '%s'. Valid values: %s, %s", format,
+			JSONCacheFormatCLI, JSONCacheFormatProcess)
+	}
+
+	b, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return fmt.Errorf("serializing credentials: %v", err)
+	}
+
+	err = writeFileAtomic(path, func(w io.Writer) error {
+		_, err := w.Write(b)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("writing %s: %v", path, err)
+	}
+	// Cache files must not be readable by other users even if they already exist.
+	return os.Chmod(path, 0600)
+}
+
+// ReadJSONCache reads credentials written by WriteJSONCache in the given format from the file at
+// path. If the file doesn't exist, the error satisfies os.IsNotExist.
+func ReadJSONCache(path, format string) (*Credentials, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case JSONCacheFormatCLI:
+		var in cliCacheOutput
+		if err := json.Unmarshal(b, &in); err != nil {
+			return nil, fmt.Errorf("parsing %s: %v", path, err)
+		}
+		return &Credentials{
+			AccessKeyID:     in.Credentials.AccessKeyID,
+			SecretAccessKey: in.Credentials.SecretAccessKey,
+			SessionToken:    in.Credentials.SessionToken,
+			Expiration:      in.Credentials.Expiration,
+			RoleARN:         in.RoleArn,
+		}, nil
+	case JSONCacheFormatProcess:
+		return ParseCredentialProcess(b)
+	default:
+		return nil, fmt.Errorf("unsupported JSON cache format '%s'. Valid values: %s, %s", format,
+			JSONCacheFormatCLI, JSONCacheFormatProcess)
+	}
+}
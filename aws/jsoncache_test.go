@@ -0,0 +1,90 @@
+package aws
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteJSONCache(t *testing.T) {
+	c := Credentials{
+		AccessKeyID:     "testkey",
+		SecretAccessKey: "testsecret",
+		SessionToken:    "testtoken",
+		Expiration:      time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC),
+	}
+
+	for _, test := range []struct {
+		name        string
+		format      string
+		want        string
+		expectError bool
+	}{
+		{
+			"CLI format",
+			JSONCacheFormatCLI,
+			`{
+  "Credentials": {
+    "AccessKeyId": "testkey",
+    "SecretAccessKey": "testsecret",
+    "SessionToken": "testtoken",
+    "Expiration": "2021-02-03T04:05:06Z"
+  }
+}`,
+			false,
+		},
+		{
+			"Process format",
+			JSONCacheFormatProcess,
+			`{
+  "Version": 1,
+  "AccessKeyId": "testkey",
+  "SecretAccessKey": "testsecret",
+  "SessionToken": "testtoken",
+  "Expiration": "2021-02-03T04:05:06Z"
+}`,
+			false,
+		},
+		{"Unsupported format", "sso", "", true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "cache", "test.json")
+
+			err := WriteJSONCache(&c, path, test.format)
+			if test.expectError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %+v", err)
+			}
+
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatalf("reading cache file: %v", err)
+			}
+			if string(b) != test.want {
+				t.Errorf("wrong output: got %s want %s", b, test.want)
+			}
+
+			got, err := ReadJSONCache(path, test.format)
+			if err != nil {
+				t.Fatalf("unexpected error reading cache file: %v", err)
+			}
+			if *got != c {
+				t.Errorf("wrong credentials read back: got %+v, want %+v", *got, c)
+			}
+		})
+	}
+}
+
+func TestReadJSONCacheMissing(t *testing.T) {
+	_, err := ReadJSONCache(filepath.Join(t.TempDir(), "missing.json"), JSONCacheFormatCLI)
+	if !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package aws
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awsarn "github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+)
+
+// SSMEndpoint and SecretsManagerEndpoint override the endpoints SSM and Secrets Manager requests
+// are sent to if set. This allows using fake servers in tests.
+var (
+	SSMEndpoint            string
+	SecretsManagerEndpoint string
+)
+
+// newSSM returns a client for the SSM API. It is a variable to allow replacing SSM with a mock in
+// tests.
+var newSSM = func(cfgs ...*aws.Config) (ssmiface.SSMAPI, error) {
+	sess, err := newSession(SSMEndpoint, cfgs...)
+	if err != nil {
+		return nil, err
+	}
+	return ssm.New(sess), nil
+}
+
+// newSecretsManager returns a client for the Secrets Manager API. It is a variable to allow
+// replacing Secrets Manager with a mock in tests.
+var newSecretsManager = func(cfgs ...*aws.Config) (secretsmanageriface.SecretsManagerAPI, error) {
+	sess, err := newSession(SecretsManagerEndpoint, cfgs...)
+	if err != nil {
+		return nil, err
+	}
+	return secretsmanager.New(sess), nil
+}
+
+// regionConfig returns the config of requests concerning the resource named name, which is sent
+// using hc. If name is an ARN, requests are sent to the region of the resource. Otherwise the
+// region is taken from the environment, e.g. $AWS_REGION.
+func regionConfig(name string, hc *http.Client) *aws.Config {
+	cfg := &aws.Config{HTTPClient: hc}
+	if a, err := awsarn.Parse(name); err == nil {
+		cfg.Region = aws.String(a.Region)
+	}
+	return cfg
+}
+
+// Parameter returns the decrypted value of the SSM parameter named name, which may be an ARN.
+// Unlike other requests made by clisso, the request is signed using the credentials found by the
+// AWS SDK, e.g. those of an EC2 instance profile. It is sent using hc, or the default client of
+// the AWS SDK if hc is nil.
+func Parameter(name string, hc *http.Client) (string, error) {
+	svc, err := newSSM(regionConfig(name, hc))
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := svc.GetParameter(&ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", err
+	}
+	if resp.Parameter == nil {
+		return "", errors.New("the response contains no parameter")
+	}
+	return aws.StringValue(resp.Parameter.Value), nil
+}
+
+// Secret returns the string value of the current version of the Secrets Manager secret with the
+// given ID, which may be a name or an ARN. Like Parameter, the request is signed using the
+// credentials found by the AWS SDK and sent using hc.
+func Secret(id string, hc *http.Client) (string, error) {
+	svc, err := newSecretsManager(regionConfig(id, hc))
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := svc.GetSecretValue(&secretsmanager.GetSecretValueInput{SecretId: aws.String(id)})
+	if err != nil {
+		return "", err
+	}
+	if resp.SecretString == nil {
+		return "", errors.New("the secret has no string value")
+	}
+	return *resp.SecretString, nil
+}
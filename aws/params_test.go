@@ -0,0 +1,26 @@
+package aws
+
+import (
+	"os"
+	"testing"
+)
+
+// TestParameterSessionError verifies that failing to create a session is returned as an error.
+func TestParameterSessionError(t *testing.T) {
+	orig, ok := os.LookupEnv("AWS_CA_BUNDLE")
+	os.Setenv("AWS_CA_BUNDLE", "/nonexistent/ca-bundle.pem")
+	defer func() {
+		if ok {
+			os.Setenv("AWS_CA_BUNDLE", orig)
+		} else {
+			os.Unsetenv("AWS_CA_BUNDLE")
+		}
+	}()
+
+	if _, err := Parameter("/clisso/config", nil); err == nil {
+		t.Error("expected an error for parameters")
+	}
+	if _, err := Secret("clisso", nil); err == nil {
+		t.Error("expected an error for secrets")
+	}
+}
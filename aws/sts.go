@@ -2,11 +2,22 @@ package aws
 
 import (
 	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"github.com/fatih/color"
 )
 
 const (
@@ -24,32 +35,300 @@ const (
 	// A custom error which indicates that the requested duration exceeded the configured maximum.
 	// TODO Replace this with a custom error type.
 	ErrDurationExceeded = "DurationExceeded"
+
+	// ErrCredentialsExpired is returned when STS rejects credentials because they have expired.
+	ErrCredentialsExpired = "the credentials have expired"
+
+	// DefaultSessionName is the role session name used when the caller doesn't specify one.
+	DefaultSessionName = "clisso"
+
+	// MaxChainedDuration is the maximum duration in seconds STS allows for a session obtained
+	// through role chaining.
+	MaxChainedDuration = 3600
+
+	// Limits STS enforces on session tags:
+	// https://docs.aws.amazon.com/IAM/latest/UserGuide/id_session-tags.html#id_session-tags_know
+	maxSessionTags      = 50
+	maxSessionTagKey    = 128
+	maxSessionTagValue  = 256
+	reservedTagPrefix   = "aws:"
+	sessionTagCharsDesc = "letters, digits, spaces and _.:/=+-@"
 )
 
+// invalidSessionNameChars matches the characters STS doesn't allow in role session names.
+var invalidSessionNameChars = regexp.MustCompile(`[^\w+=,.@-]`)
+
+// maxSessionNameLength is the maximum length of a role session name.
+const maxSessionNameLength = 64
+
+// SanitizeSessionName returns name with the characters STS doesn't allow in role session names
+// replaced by "-", truncated to the maximum length STS allows. If the result is shorter than the
+// minimum of two characters, DefaultSessionName is returned.
+func SanitizeSessionName(name string) string {
+	name = invalidSessionNameChars.ReplaceAllString(name, "-")
+	if len(name) > maxSessionNameLength {
+		name = name[:maxSessionNameLength]
+	}
+	if len(name) < 2 {
+		return DefaultSessionName
+	}
+	return name
+}
+
+// sessionTagChars matches the characters STS allows in session tag keys and values.
+var sessionTagChars = regexp.MustCompile(`^[\p{L}\p{Z}\p{N}_.:/=+\-@]*$`)
+
+// STSEndpoint overrides the endpoint STS requests are sent to if set. This allows using a fake STS
+// server in tests.
+var STSEndpoint string
+
+// newSTS returns a client for the STS API. It is a variable to allow replacing STS with a mock
+// in tests.
+var newSTS = func(cfgs ...*aws.Config) (stsiface.STSAPI, error) {
+	sess, err := newSession(STSEndpoint, cfgs...)
+	if err != nil {
+		return nil, err
+	}
+	return sts.New(sess), nil
+}
+
+// stsRegionPattern matches the host names of regional STS endpoints, including FIPS and VPC
+// endpoints, e.g. sts-fips.us-east-1.amazonaws.com. The region is the first submatch.
+var stsRegionPattern = regexp.MustCompile(`(?:^|\.)sts(?:-fips)?\.([a-z0-9-]+)\.(?:vpce\.)?amazonaws\.com(?:\.cn)?$`)
+
+// STSConfig returns the config of STS requests sent to endpoint using hc. If endpoint is empty,
+// requests are sent to STSEndpoint or the default endpoint of STS. Since requests are signed for
+// the region of the endpoint, the region is taken from the host name of regional endpoints such
+// as https://sts-fips.us-east-1.amazonaws.com. For other endpoints, the region is taken from the
+// environment, e.g. $AWS_REGION.
+func STSConfig(endpoint string, hc *http.Client) *aws.Config {
+	cfg := &aws.Config{HTTPClient: hc}
+	if endpoint == "" {
+		return cfg
+	}
+
+	cfg.Endpoint = aws.String(endpoint)
+	host := strings.TrimPrefix(endpoint, "https://")
+	if m := stsRegionPattern.FindStringSubmatch(strings.SplitN(host, ":", 2)[0]); m != nil {
+		cfg.Region = aws.String(m[1])
+	}
+	return cfg
+}
+
+// newSession returns an AWS session using the given configs which sends requests to endpoint, or
+// to the default endpoint of the service if endpoint is empty. An error is returned if the session
+// can't be created, e.g. because the CA bundle in $AWS_CA_BUNDLE can't be read.
+func newSession(endpoint string, cfgs ...*aws.Config) (*session.Session, error) {
+	if endpoint != "" {
+		cfgs = append(cfgs, &aws.Config{Endpoint: aws.String(endpoint)})
+	}
+
+	// The SDK applies a custom CA bundle, e.g. one set using AWS_CA_BUNDLE, by modifying the
+	// *http.Transport of the HTTP client and fails if the client uses any other transport. If the
+	// transport wraps an *http.Transport, the SDK is given the wrapped transport and the wrapper
+	// is restored once the session is created.
+	for i, cfg := range cfgs {
+		if cfg.HTTPClient == nil {
+			continue
+		}
+		wrapper := cfg.HTTPClient.Transport
+		t, ok := baseTransport(wrapper)
+		if !ok || t == wrapper {
+			continue
+		}
+
+		hc := *cfg.HTTPClient
+		hc.Transport = t
+		c := cfg.Copy(&aws.Config{HTTPClient: &hc})
+		cfgs[i] = c
+		defer func() { hc.Transport = wrapper }()
+	}
+
+	sess, err := session.NewSession(cfgs...)
+	if err != nil {
+		return nil, fmt.Errorf("creating AWS session: %v", err)
+	}
+	return sess, nil
+}
+
+// baseTransport returns the *http.Transport t sends requests with, following RoundTrippers which
+// wrap another RoundTripper and expose it using an Unwrap method.
+func baseTransport(t http.RoundTripper) (*http.Transport, bool) {
+	for {
+		switch v := t.(type) {
+		case *http.Transport:
+			return v, true
+		case interface{ Unwrap() http.RoundTripper }:
+			t = v.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+}
+
+// ValidateSessionTags verifies the given session tags satisfy the constraints STS places on
+// session tags and returns a descriptive error otherwise.
+func ValidateSessionTags(tags map[string]string) error {
+	if len(tags) > maxSessionTags {
+		return fmt.Errorf("too many session tags: got %d, maximum is %d", len(tags), maxSessionTags)
+	}
+
+	// Tag keys are case-insensitive in STS.
+	seen := make(map[string]string, len(tags))
+	for _, k := range sortedKeys(tags) {
+		v := tags[k]
+		if k == "" || len(k) > maxSessionTagKey {
+			return fmt.Errorf("session tag key %q must be between 1 and %d characters long", k,
+				maxSessionTagKey)
+		}
+		if len(v) > maxSessionTagValue {
+			return fmt.Errorf("value of session tag %q must be at most %d characters long", k,
+				maxSessionTagValue)
+		}
+		if strings.HasPrefix(strings.ToLower(k), reservedTagPrefix) {
+			return fmt.Errorf("session tag key %q uses the reserved prefix %q", k, reservedTagPrefix)
+		}
+		if !sessionTagChars.MatchString(k) {
+			return fmt.Errorf("session tag key %q contains invalid characters. Allowed: %s", k,
+				sessionTagCharsDesc)
+		}
+		if !sessionTagChars.MatchString(v) {
+			return fmt.Errorf("value of session tag %q contains invalid characters. Allowed: %s", k,
+				sessionTagCharsDesc)
+		}
+		if other, ok := seen[strings.ToLower(k)]; ok {
+			return fmt.Errorf("session tag keys %q and %q differ only in case", other, k)
+		}
+		seen[strings.ToLower(k)] = k
+	}
+
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// checkDurationExceeded returns a custom error if err indicates that the requested session
+// duration is higher than the maximum allowed on the role. Otherwise err is returned unchanged.
+func checkDurationExceeded(err error) error {
+	// Verify error is an AWS error.
+	if awsErr, ok := err.(awserr.Error); ok {
+		// Check if error indicates exceeded duration.
+		if awsErr.Message() == ErrInvalidSessionDuration {
+			// Return a custom error to allow the caller to retry etc.
+			// TODO Return a custom error type instead of a special value:
+			// https://dave.cheney.net/2014/12/24/inspecting-errors
+			return errors.New(ErrDurationExceeded)
+		}
+	}
+	return err
+}
+
+// WriteSAMLAssertion writes the base64 encoded SAML assertion to the file at path, which is only
+// accessible by the current user, so that the assertion can be used to assume a role later.
+func WriteSAMLAssertion(path, assertion string) error {
+	// The assertion can be used to obtain credentials, so it must never be readable by other
+	// users, even if the file already exists.
+	err := writeFileAtomicPerm(path, 0600, func(w io.Writer) error {
+		_, err := io.WriteString(w, assertion)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("writing SAML assertion to %s: %v", path, err)
+	}
+	return nil
+}
+
+// unusedSessionNameWarning makes sure the warning about a session name which can't be applied is
+// only logged once, e.g. when refreshing many apps.
+var unusedSessionNameWarning sync.Once
+
 // AssumeSAMLRole assumes an AWS IAM role using a SAML assertion.
 // In cases where the requested session duration is higher than the maximum allowed on AWS, STS
 // returns a specific error message to indicate that. In this case we return a custom error to the
 // caller to allow special handling such as retrying with a lower duration.
-func AssumeSAMLRole(PrincipalArn, RoleArn, SAMLAssertion string, duration int64) (*Credentials, error) {
-	creds, err := assumeSAMLRole(PrincipalArn, RoleArn, SAMLAssertion, duration)
+//
+// AssumeRoleWithSAML only supports session tags which are embedded in the SAML assertion by the
+// IdP. If tags is non-empty, the role is therefore assumed a second time using AssumeRole with the
+// given tags attached. This requires the role's trust policy to allow sts:AssumeRole and
+// sts:TagSession by the role itself, and limits the session duration to MaxChainedDuration. A
+// warning is logged if the duration is reduced for that reason.
+//
+// The role session name of a session obtained using AssumeRoleWithSAML is set by the IdP. The
+// chained session is named sessionName instead, or DefaultSessionName if sessionName is empty.
+// Without tags, sessionName can't be applied, which is reported once using a warning.
+//
+// STS requests are sent to endpoint, or to the default endpoint of STS if endpoint is empty (see
+// STSConfig), using hc. If hc is nil, the default client of the AWS SDK is used.
+func AssumeSAMLRole(PrincipalArn, RoleArn, SAMLAssertion string, duration int64, tags map[string]string, sessionName, endpoint string, hc *http.Client) (*Credentials, error) {
+	if err := ValidateSessionTags(tags); err != nil {
+		return nil, fmt.Errorf("invalid session tags: %v", err)
+	}
+
+	creds, err := assumeSAMLRole(PrincipalArn, RoleArn, SAMLAssertion, duration, endpoint, hc)
 	if err != nil {
-		// Verify error is an AWS error.
-		if awsErr, ok := err.(awserr.Error); ok {
-			// Check if error indicates exceeded duration.
-			if awsErr.Message() == ErrInvalidSessionDuration {
-				// Return a custom error to allow the caller to retry etc.
-				// TODO Return a custom error type instead of a special value:
-				// https://dave.cheney.net/2014/12/24/inspecting-errors
-				return nil, errors.New(ErrDurationExceeded)
-			}
+		return nil, checkDurationExceeded(err)
+	}
+
+	if len(tags) == 0 {
+		if sessionName != "" {
+			unusedSessionNameWarning.Do(func() {
+				log.Printf(color.YellowString("Ignoring session name '%s': the session name of roles "+
+					"assumed using SAML is set by the identity provider unless session tags are "+
+					"attached"), sessionName)
+			})
 		}
-		return nil, err
+		return creds, nil
+	}
+
+	if duration > MaxChainedDuration {
+		log.Printf(color.YellowString("Reducing the session duration from %d to %d seconds: sessions "+
+			"with session tags are obtained through role chaining, which STS limits to %d seconds"),
+			duration, MaxChainedDuration, MaxChainedDuration)
+		duration = MaxChainedDuration
+	}
+	creds, err = assumeRoleWithTags(creds, RoleArn, duration, tags, sessionName, endpoint, hc)
+	if err != nil {
+		return nil, fmt.Errorf("attaching session tags: %w", err)
 	}
 
 	return creds, nil
 }
 
-func assumeSAMLRole(PrincipalArn, RoleArn, SAMLAssertion string, duration int64) (*Credentials, error) {
+// assumeRoleWithTags uses the given credentials to assume RoleArn with the given session tags
+// attached.
+func assumeRoleWithTags(c *Credentials, RoleArn string, duration int64, tags map[string]string, sessionName, endpoint string, hc *http.Client) (*Credentials, error) {
+	input := sts.AssumeRoleInput{
+		RoleArn:         aws.String(RoleArn),
+		RoleSessionName: aws.String(SanitizeSessionName(sessionName)),
+		DurationSeconds: aws.Int64(duration),
+	}
+	for _, k := range sortedKeys(tags) {
+		input.Tags = append(input.Tags, &sts.Tag{Key: aws.String(k), Value: aws.String(tags[k])})
+	}
+
+	cfg := STSConfig(endpoint, hc)
+	cfg.Credentials = credentials.NewStaticCredentials(c.AccessKeyID, c.SecretAccessKey, c.SessionToken)
+	svc, err := newSTS(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	aResp, err := svc.AssumeRole(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	return newCredentials(aResp.Credentials, RoleArn), nil
+}
+
+func assumeSAMLRole(PrincipalArn, RoleArn, SAMLAssertion string, duration int64, endpoint string, hc *http.Client) (*Credentials, error) {
 	input := sts.AssumeRoleWithSAMLInput{
 		PrincipalArn:    aws.String(PrincipalArn),
 		RoleArn:         aws.String(RoleArn),
@@ -57,25 +336,95 @@ func assumeSAMLRole(PrincipalArn, RoleArn, SAMLAssertion string, duration int64)
 		DurationSeconds: aws.Int64(duration),
 	}
 
-	sess := session.Must(session.NewSession())
-	svc := sts.New(sess)
+	svc, err := newSTS(STSConfig(endpoint, hc))
+	if err != nil {
+		return nil, err
+	}
 
 	aResp, err := svc.AssumeRoleWithSAML(&input)
 	if err != nil {
 		return nil, err
 	}
 
-	keyID := *aResp.Credentials.AccessKeyId
-	secretKey := *aResp.Credentials.SecretAccessKey
-	sessionToken := *aResp.Credentials.SessionToken
-	expiration := *aResp.Credentials.Expiration
+	return newCredentials(aResp.Credentials, RoleArn), nil
+}
+
+// AssumeRoleWithWebIdentity assumes an AWS IAM role using an OIDC token issued by a web identity
+// provider. sessionName is sanitized using SanitizeSessionName. If sessionName is empty,
+// DefaultSessionName is used. Like AssumeSAMLRole, a custom error is returned when the requested
+// duration exceeds the maximum allowed on the role. STS requests are sent to endpoint as by
+// AssumeSAMLRole using hc, or the default client of the AWS SDK if hc is nil.
+func AssumeRoleWithWebIdentity(token, roleArn, sessionName string, duration int64, endpoint string, hc *http.Client) (*Credentials, error) {
+	sessionName = SanitizeSessionName(sessionName)
+
+	input := sts.AssumeRoleWithWebIdentityInput{
+		RoleArn:          aws.String(roleArn),
+		RoleSessionName:  aws.String(sessionName),
+		WebIdentityToken: aws.String(token),
+		DurationSeconds:  aws.Int64(duration),
+	}
+
+	svc, err := newSTS(STSConfig(endpoint, hc))
+	if err != nil {
+		return nil, err
+	}
+
+	aResp, err := svc.AssumeRoleWithWebIdentity(&input)
+	if err != nil {
+		return nil, checkDurationExceeded(err)
+	}
+
+	return newCredentials(aResp.Credentials, roleArn), nil
+}
+
+// CallerIdentity represents the AWS identity a set of credentials belongs to.
+type CallerIdentity struct {
+	Account string
+	ARN     string
+	UserID  string
+}
+
+// GetCallerIdentity returns the identity c belongs to, which confirms STS accepts c. If STS
+// rejects c because it has expired, an ErrCredentialsExpired error is returned. STS requests are
+// sent to endpoint, or to the default endpoint of STS if endpoint is empty (see STSConfig), using
+// hc. If hc is nil, the default client of the AWS SDK is used.
+func GetCallerIdentity(c *Credentials, endpoint string, hc *http.Client) (*CallerIdentity, error) {
+	cfg := STSConfig(endpoint, hc)
+	cfg.Credentials = credentials.NewStaticCredentials(c.AccessKeyID, c.SecretAccessKey, c.SessionToken)
+	svc, err := newSTS(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := svc.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "ExpiredToken" {
+			return nil, errors.New(ErrCredentialsExpired)
+		}
+		return nil, err
+	}
+
+	return &CallerIdentity{
+		Account: aws.StringValue(resp.Account),
+		ARN:     aws.StringValue(resp.Arn),
+		UserID:  aws.StringValue(resp.UserId),
+	}, nil
+}
+
+// newCredentials converts STS credentials of the role roleArn to a Credentials struct.
+func newCredentials(c *sts.Credentials, roleArn string) *Credentials {
+	keyID := *c.AccessKeyId
+	secretKey := *c.SecretAccessKey
+	sessionToken := *c.SessionToken
+	expiration := *c.Expiration
 
 	creds := Credentials{
 		AccessKeyID:     keyID,
 		SecretAccessKey: secretKey,
 		SessionToken:    sessionToken,
 		Expiration:      expiration,
+		RoleARN:         roleArn,
 	}
 
-	return &creds, nil
+	return &creds
 }
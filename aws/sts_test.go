@@ -0,0 +1,416 @@
+package aws
+
+import (
+	"bytes"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/allcloud-io/clisso/internal/testserver"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+)
+
+// mockSTS is a fake STS client which records the last inputs it received and returns canned
+// responses.
+type mockSTS struct {
+	stsiface.STSAPI
+
+	err       error
+	input     *sts.AssumeRoleWithWebIdentityInput
+	roleInput *sts.AssumeRoleInput
+	samlInput *sts.AssumeRoleWithSAMLInput
+}
+
+func testSTSCredentials() *sts.Credentials {
+	return &sts.Credentials{
+		AccessKeyId:     aws.String("testkey"),
+		SecretAccessKey: aws.String("testsecret"),
+		SessionToken:    aws.String("testtoken"),
+		Expiration:      aws.Time(time.Unix(1600000000, 0)),
+	}
+}
+
+func (m *mockSTS) AssumeRoleWithSAML(in *sts.AssumeRoleWithSAMLInput) (*sts.AssumeRoleWithSAMLOutput, error) {
+	m.samlInput = in
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	return &sts.AssumeRoleWithSAMLOutput{Credentials: testSTSCredentials()}, nil
+}
+
+func (m *mockSTS) AssumeRole(in *sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error) {
+	m.roleInput = in
+
+	c := testSTSCredentials()
+	c.AccessKeyId = aws.String("taggedkey")
+	return &sts.AssumeRoleOutput{Credentials: c}, nil
+}
+
+func (m *mockSTS) AssumeRoleWithWebIdentity(in *sts.AssumeRoleWithWebIdentityInput) (*sts.AssumeRoleWithWebIdentityOutput, error) {
+	m.input = in
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	return &sts.AssumeRoleWithWebIdentityOutput{Credentials: testSTSCredentials()}, nil
+}
+
+// withMockSTS replaces the STS client with m for the duration of a test.
+func withMockSTS(t *testing.T, m stsiface.STSAPI) {
+	orig := newSTS
+	newSTS = func(...*aws.Config) (stsiface.STSAPI, error) { return m, nil }
+	t.Cleanup(func() { newSTS = orig })
+}
+
+func TestAssumeRoleWithWebIdentity(t *testing.T) {
+	for _, test := range []struct {
+		name              string
+		sessionName       string
+		err               error
+		expectSessionName string
+		expectError       string
+	}{
+		{"Custom session name", "alice", nil, "alice", ""},
+		{"Default session name", "", nil, DefaultSessionName, ""},
+		{
+			"Duration exceeded",
+			"",
+			awserr.New("ValidationError", ErrInvalidSessionDuration, nil),
+			DefaultSessionName,
+			ErrDurationExceeded,
+		},
+		{"Sanitized session name", "alice smith/clisso:prod", nil, "alice-smith-clisso-prod", ""},
+		{"Other error", "", errors.New("boom"), DefaultSessionName, "boom"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m := &mockSTS{err: test.err}
+			withMockSTS(t, m)
+
+			creds, err := AssumeRoleWithWebIdentity("fake_token", "arn:aws:iam::123456789012:role/Test",
+				test.sessionName, 3600, "", nil)
+			if test.expectError != "" {
+				if err == nil || err.Error() != test.expectError {
+					t.Fatalf("expected error %q, received %v", test.expectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %+v", err)
+			}
+
+			if *m.input.WebIdentityToken != "fake_token" {
+				t.Errorf("wrong token: got %s, want %s", *m.input.WebIdentityToken, "fake_token")
+			}
+			if *m.input.RoleSessionName != test.expectSessionName {
+				t.Errorf("wrong session name: got %s, want %s", *m.input.RoleSessionName,
+					test.expectSessionName)
+			}
+			if *m.input.DurationSeconds != 3600 {
+				t.Errorf("wrong duration: got %d, want %d", *m.input.DurationSeconds, 3600)
+			}
+			if creds.AccessKeyID != "testkey" || creds.SessionToken != "testtoken" {
+				t.Errorf("wrong credentials: %+v", creds)
+			}
+		})
+	}
+}
+
+func TestAssumeSAMLRoleCrossAccount(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		principal string
+		role      string
+	}{
+		{"Same account", "arn:aws:iam::111111111111:saml-provider/Test", "arn:aws:iam::111111111111:role/Test"},
+		{"Provider in management account", "arn:aws:iam::111111111111:saml-provider/Test", "arn:aws:iam::222222222222:role/Test"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m := &mockSTS{}
+			withMockSTS(t, m)
+
+			creds, err := AssumeSAMLRole(test.principal, test.role, "fake_assertion", 3600, nil, "", "", nil)
+			if err != nil {
+				t.Fatalf("unexpected error %+v", err)
+			}
+			if got := *m.samlInput.PrincipalArn; got != test.principal {
+				t.Errorf("wrong principal ARN: got %s, want %s", got, test.principal)
+			}
+			if got := *m.samlInput.RoleArn; got != test.role {
+				t.Errorf("wrong role ARN: got %s, want %s", got, test.role)
+			}
+			if creds.RoleARN != test.role {
+				t.Errorf("wrong role ARN of credentials: got %s, want %s", creds.RoleARN, test.role)
+			}
+		})
+	}
+}
+
+func TestWriteSAMLAssertion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "saml")
+	// An existing file which is readable by others must be restricted.
+	if err := ioutil.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteSAMLAssertion(path, "fake_assertion"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "fake_assertion" {
+		t.Errorf("wrong file content: got %q", b)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("wrong permissions: got %o, want 600", perm)
+	}
+}
+
+func TestAssumeSAMLRoleUnusedSessionName(t *testing.T) {
+	m := &mockSTS{}
+	withMockSTS(t, m)
+	unusedSessionNameWarning = sync.Once{}
+
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer log.SetOutput(os.Stderr)
+
+	for i := 0; i < 2; i++ {
+		_, err := AssumeSAMLRole("arn:aws:iam::123456789012:saml-provider/Test",
+			"arn:aws:iam::123456789012:role/Test", "fake_assertion", 3600, nil, "alice", "", nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if n := strings.Count(out.String(), "Ignoring session name 'alice'"); n != 1 {
+		t.Errorf("expected one warning about the session name, got %d:\n%s", n, out.String())
+	}
+}
+
+func TestAssumeSAMLRoleWithTags(t *testing.T) {
+	m := &mockSTS{}
+	withMockSTS(t, m)
+
+	creds, err := AssumeSAMLRole("arn:aws:iam::123456789012:saml-provider/Test",
+		"arn:aws:iam::123456789012:role/Test", "fake_assertion", 7200, nil, "", "", nil)
+	if err != nil {
+		t.Fatalf("unexpected error %+v", err)
+	}
+	if m.roleInput != nil || creds.AccessKeyID != "testkey" {
+		t.Fatal("role was chained although no session tags were given")
+	}
+	if creds.RoleARN != "arn:aws:iam::123456789012:role/Test" {
+		t.Errorf("wrong role ARN: got %s", creds.RoleARN)
+	}
+
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer log.SetOutput(os.Stderr)
+
+	tags := map[string]string{"team": "data", "cost-center": "1234"}
+	creds, err = AssumeSAMLRole("arn:aws:iam::123456789012:saml-provider/Test",
+		"arn:aws:iam::123456789012:role/Test", "fake_assertion", 7200, tags, "alice@laptop", "", nil)
+	if err != nil {
+		t.Fatalf("unexpected error %+v", err)
+	}
+	if !strings.Contains(out.String(), "from 7200 to 3600 seconds") {
+		t.Errorf("expected a warning about the reduced duration, got %q", out.String())
+	}
+	if creds.AccessKeyID != "taggedkey" {
+		t.Fatalf("wrong credentials: got %s, want %s", creds.AccessKeyID, "taggedkey")
+	}
+	if *m.roleInput.DurationSeconds != MaxChainedDuration {
+		t.Errorf("wrong duration: got %d, want %d", *m.roleInput.DurationSeconds, MaxChainedDuration)
+	}
+	if *m.roleInput.RoleSessionName != "alice@laptop" {
+		t.Errorf("wrong session name: got %s, want %s", *m.roleInput.RoleSessionName, "alice@laptop")
+	}
+	if len(m.roleInput.Tags) != 2 || *m.roleInput.Tags[0].Key != "cost-center" ||
+		*m.roleInput.Tags[1].Value != "data" {
+		t.Errorf("wrong tags: %v", m.roleInput.Tags)
+	}
+}
+
+func TestSanitizeSessionName(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		input  string
+		expect string
+	}{
+		{"Valid name", "alice@laptop-1", "alice@laptop-1"},
+		{"Invalid characters", "alice smith/prod:app", "alice-smith-prod-app"},
+		{"Too long", strings.Repeat("a", 70), strings.Repeat("a", 64)},
+		{"Too short", "a", DefaultSessionName},
+		{"Empty", "", DefaultSessionName},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := SanitizeSessionName(test.input); got != test.expect {
+				t.Errorf("wrong session name: got %q, want %q", got, test.expect)
+			}
+		})
+	}
+}
+
+func TestValidateSessionTags(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		tags        map[string]string
+		expectError bool
+	}{
+		{"No tags", nil, false},
+		{"Valid tags", map[string]string{"team": "data", "Project": "a b/c:d=e+f-g@h"}, false},
+		{"Empty value", map[string]string{"team": ""}, false},
+		{"Empty key", map[string]string{"": "data"}, true},
+		{"Key too long", map[string]string{strings.Repeat("k", 129): "data"}, true},
+		{"Value too long", map[string]string{"team": strings.Repeat("v", 257)}, true},
+		{"Reserved prefix", map[string]string{"AWS:team": "data"}, true},
+		{"Invalid key characters", map[string]string{"team!": "data"}, true},
+		{"Invalid value characters", map[string]string{"team": "da,ta"}, true},
+		{"Case-insensitive duplicate", map[string]string{"team": "a", "Team": "b"}, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateSessionTags(test.tags)
+			if test.expectError && err == nil {
+				t.Errorf("expected error")
+			}
+			if !test.expectError && err != nil {
+				t.Errorf("unexpected error %+v", err)
+			}
+		})
+	}
+}
+
+// countingTransport is a RoundTripper which wraps another one and counts the requests it sends.
+type countingTransport struct {
+	base     http.RoundTripper
+	requests int32
+}
+
+func (t *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.requests, 1)
+	return t.base.RoundTrip(r)
+}
+
+func (t *countingTransport) Unwrap() http.RoundTripper {
+	return t.base
+}
+
+func TestAssumeSAMLRoleCustomCABundle(t *testing.T) {
+	sts := testserver.NewSTS()
+	defer sts.Close()
+	srv := httptest.NewTLSServer(sts.Config.Handler)
+	defer srv.Close()
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := ioutil.WriteFile(bundle, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for k, v := range map[string]string{"AWS_CA_BUNDLE": bundle, "AWS_REGION": "us-east-1"} {
+		orig, ok := os.LookupEnv(k)
+		os.Setenv(k, v)
+		defer func(k string) {
+			if ok {
+				os.Setenv(k, orig)
+			} else {
+				os.Unsetenv(k)
+			}
+		}(k)
+	}
+	STSEndpoint = srv.URL
+	defer func() { STSEndpoint = "" }()
+
+	// The server is only trusted if the CA bundle is applied to the wrapped transport.
+	ct := &countingTransport{base: &http.Transport{}}
+	hc := &http.Client{Transport: ct}
+
+	assertion := testserver.SAMLAssertion(testserver.RoleARN, testserver.ProviderARN)
+	creds, err := AssumeSAMLRole(testserver.ProviderARN, testserver.RoleARN, assertion, 3600, nil, "", "", hc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if creds.AccessKeyID != testserver.AccessKeyID {
+		t.Errorf("wrong access key ID: got %q, want %q", creds.AccessKeyID, testserver.AccessKeyID)
+	}
+	if atomic.LoadInt32(&ct.requests) == 0 {
+		t.Error("expected requests to be sent using the wrapping transport")
+	}
+	if hc.Transport != ct {
+		t.Error("expected the transport of the client to be left unchanged")
+	}
+}
+
+func TestSTSConfig(t *testing.T) {
+	for _, test := range []struct {
+		endpoint     string
+		expectRegion string
+	}{
+		{"https://sts-fips.us-east-1.amazonaws.com", "us-east-1"},
+		{"https://sts.eu-central-1.amazonaws.com", "eu-central-1"},
+		{"https://sts.cn-north-1.amazonaws.com.cn", "cn-north-1"},
+		{"https://sts-fips.us-gov-west-1.amazonaws.com:443", "us-gov-west-1"},
+		{"https://vpce-0123-abcd.sts.us-west-2.vpce.amazonaws.com", "us-west-2"},
+		{"https://sts.amazonaws.com", ""},
+		{"https://sts.example.com", ""},
+	} {
+		t.Run(test.endpoint, func(t *testing.T) {
+			cfg := STSConfig(test.endpoint, nil)
+			if got := aws.StringValue(cfg.Endpoint); got != test.endpoint {
+				t.Errorf("wrong endpoint: got %q, want %q", got, test.endpoint)
+			}
+			if got := aws.StringValue(cfg.Region); got != test.expectRegion {
+				t.Errorf("wrong region: got %q, want %q", got, test.expectRegion)
+			}
+		})
+	}
+
+	if cfg := STSConfig("", nil); cfg.Endpoint != nil || cfg.Region != nil {
+		t.Errorf("expected the default endpoint, got %+v", cfg)
+	}
+}
+
+func TestAssumeSAMLRoleEndpoint(t *testing.T) {
+	sts := testserver.NewSTS()
+	defer sts.Close()
+	region, hasRegion := os.LookupEnv("AWS_REGION")
+	os.Setenv("AWS_REGION", "us-east-1")
+	defer func() {
+		if hasRegion {
+			os.Setenv("AWS_REGION", region)
+		} else {
+			os.Unsetenv("AWS_REGION")
+		}
+	}()
+
+	assertion := testserver.SAMLAssertion(testserver.RoleARN, testserver.ProviderARN)
+	creds, err := AssumeSAMLRole(testserver.ProviderARN, testserver.RoleARN, assertion, 3600, nil, "",
+		sts.URL, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if creds.AccessKeyID != testserver.AccessKeyID {
+		t.Errorf("wrong access key ID: got %q, want %q", creds.AccessKeyID, testserver.AccessKeyID)
+	}
+}
@@ -0,0 +1,228 @@
+// Package cache manages temporary credentials cached for use by the cred-process command.
+//
+// The credentials themselves are stored in the OS keychain. Since keychains can't be enumerated,
+// an index of the cached apps and the expiration of their credentials is kept in a file in the
+// cache directory.
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/allcloud-io/clisso/aws"
+	"github.com/allcloud-io/clisso/keychain"
+)
+
+const (
+	// indexFileName is the name of the index file within the cache directory.
+	indexFileName = "index.json"
+
+	dirPerm  = 0700
+	filePerm = 0600
+
+	// lockPollInterval is the interval at which Lock checks whether a lock was released.
+	lockPollInterval = 100 * time.Millisecond
+	// staleLockAge is the age after which a lock is considered abandoned, e.g. by a process which
+	// was killed while holding it, and is removed.
+	staleLockAge = 5 * time.Minute
+)
+
+// Entry describes the credentials cached for an app.
+type Entry struct {
+	App        string    `json:"app"`
+	Expiration time.Time `json:"expiration"`
+}
+
+// Expired returns true if the credentials described by e have expired.
+func (e Entry) Expired() bool {
+	return !e.Expiration.After(time.Now())
+}
+
+// Cache is a credentials cache whose index is stored in Dir.
+type Cache struct {
+	Dir string
+	// ExpiryBuffer is the time before their expiration at which cached credentials are no longer
+	// returned by Load.
+	ExpiryBuffer time.Duration
+}
+
+// DefaultDir returns the default cache directory, which is a directory named clisso within the
+// user's cache directory (e.g. ~/.cache/clisso on Linux).
+func DefaultDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("getting user cache directory: %v", err)
+	}
+	return filepath.Join(dir, "clisso"), nil
+}
+
+// New returns a Cache whose index is stored in dir.
+func New(dir string) *Cache {
+	return &Cache{Dir: dir}
+}
+
+// Store caches the given credentials for app.
+func (c *Cache) Store(app string, creds *aws.Credentials) error {
+	var b bytes.Buffer
+	if err := aws.WriteCredentialProcess(creds, &b); err != nil {
+		return err
+	}
+	if err := keychain.SetCredentials(app, b.Bytes()); err != nil {
+		return fmt.Errorf("storing credentials in keychain: %v", err)
+	}
+
+	entries, err := c.readIndex()
+	if err != nil {
+		return err
+	}
+	entries[app] = Entry{App: app, Expiration: creds.Expiration}
+	return c.writeIndex(entries)
+}
+
+// Load returns the credentials cached for app, or nil if no such credentials exist or they expire
+// within the expiry buffer of c.
+func (c *Cache) Load(app string) (*aws.Credentials, error) {
+	b, err := keychain.GetCredentials(app)
+	if err == keychain.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	creds, err := aws.ParseCredentialProcess(b)
+	if err != nil {
+		return nil, err
+	}
+
+	if !creds.Expiration.After(time.Now().Add(c.ExpiryBuffer)) {
+		return nil, nil
+	}
+	return creds, nil
+}
+
+// Delete removes the credentials cached for app. Deleting credentials which aren't cached isn't
+// an error.
+func (c *Cache) Delete(app string) error {
+	if err := keychain.DeleteCredentials(app); err != nil && err != keychain.ErrNotFound {
+		return fmt.Errorf("deleting credentials from keychain: %v", err)
+	}
+
+	entries, err := c.readIndex()
+	if err != nil {
+		return err
+	}
+	if _, ok := entries[app]; !ok {
+		return nil
+	}
+	delete(entries, app)
+	return c.writeIndex(entries)
+}
+
+// Lock acquires an exclusive lock on the credentials cached for app, which is held by at most one
+// process at a time. If another process holds the lock, Lock waits until it is released. The
+// returned function releases the lock.
+func (c *Cache) Lock(app string) (func(), error) {
+	if err := os.MkdirAll(c.Dir, dirPerm); err != nil {
+		return nil, fmt.Errorf("creating cache directory: %v", err)
+	}
+
+	path := c.lockPath(app)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, filePerm)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("creating lock file: %v", err)
+		}
+
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > staleLockAge {
+			os.Remove(path)
+			continue
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+func (c *Cache) lockPath(app string) string {
+	return filepath.Join(c.Dir, url.PathEscape(app)+".lock")
+}
+
+// List returns the entries of the cache sorted by app name.
+func (c *Cache) List() ([]Entry, error) {
+	entries, err := c.readIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	return sortedEntries(entries), nil
+}
+
+func sortedEntries(entries map[string]Entry) []Entry {
+	list := make([]Entry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].App < list[j].App })
+	return list
+}
+
+func (c *Cache) indexPath() string {
+	return filepath.Join(c.Dir, indexFileName)
+}
+
+// readIndex reads the index file. A missing index file is treated as an empty index.
+func (c *Cache) readIndex() (map[string]Entry, error) {
+	entries := make(map[string]Entry)
+
+	b, err := ioutil.ReadFile(c.indexPath())
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading cache index: %v", err)
+	}
+
+	var list []Entry
+	if err := json.Unmarshal(b, &list); err != nil {
+		return nil, fmt.Errorf("parsing cache index %s: %v", c.indexPath(), err)
+	}
+	for _, e := range list {
+		entries[e.App] = e
+	}
+
+	return entries, nil
+}
+
+// writeIndex writes the index file, creating the cache directory if needed. Both are only
+// accessible by the current user.
+func (c *Cache) writeIndex(entries map[string]Entry) error {
+	if err := os.MkdirAll(c.Dir, dirPerm); err != nil {
+		return fmt.Errorf("creating cache directory: %v", err)
+	}
+
+	b, err := json.MarshalIndent(sortedEntries(entries), "", "  ")
+	if err != nil {
+		return fmt.Errorf("serializing cache index: %v", err)
+	}
+
+	if err := ioutil.WriteFile(c.indexPath(), b, filePerm); err != nil {
+		return fmt.Errorf("writing cache index: %v", err)
+	}
+	// WriteFile doesn't change the permissions of existing files.
+	if err := os.Chmod(c.indexPath(), filePerm); err != nil {
+		return fmt.Errorf("setting permissions of cache index: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestIndex(t *testing.T) {
+	c := New(filepath.Join(t.TempDir(), "clisso"))
+
+	// A missing index is an empty index.
+	entries, err := c.List()
+	if err != nil {
+		t.Fatalf("unexpected error %+v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected empty index, got %v", entries)
+	}
+
+	exp := time.Unix(1600000000, 0).UTC()
+	err = c.writeIndex(map[string]Entry{
+		"b-app": {App: "b-app", Expiration: exp},
+		"a-app": {App: "a-app", Expiration: exp.Add(time.Hour)},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %+v", err)
+	}
+
+	entries, err = c.List()
+	if err != nil {
+		t.Fatalf("unexpected error %+v", err)
+	}
+	if len(entries) != 2 || entries[0].App != "a-app" || entries[1].App != "b-app" {
+		t.Fatalf("wrong entries: %v", entries)
+	}
+	if !entries[1].Expiration.Equal(exp) {
+		t.Errorf("wrong expiration: got %v, want %v", entries[1].Expiration, exp)
+	}
+	if !entries[1].Expired() {
+		t.Error("entry isn't expired")
+	}
+
+	if runtime.GOOS != "windows" {
+		for path, want := range map[string]os.FileMode{c.Dir: dirPerm, c.indexPath(): filePerm} {
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatalf("unexpected error %+v", err)
+			}
+			if info.Mode().Perm() != want {
+				t.Errorf("wrong permissions for %s: got %v, want %v", path, info.Mode().Perm(), want)
+			}
+		}
+	}
+}
+
+func TestLock(t *testing.T) {
+	c := New(filepath.Join(t.TempDir(), "clisso"))
+
+	unlock, err := c.Lock("test/app")
+	if err != nil {
+		t.Fatalf("unexpected error %+v", err)
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		unlockSecond, err := c.Lock("test/app")
+		if err != nil {
+			t.Errorf("unexpected error %+v", err)
+		} else {
+			unlockSecond()
+		}
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("lock acquired while held")
+	case <-time.After(3 * lockPollInterval):
+	}
+
+	unlock()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("lock not acquired after release")
+	}
+
+	// A lock left behind by a process which didn't release it is removed once stale.
+	if _, err := c.Lock("stale"); err != nil {
+		t.Fatalf("unexpected error %+v", err)
+	}
+	old := time.Now().Add(-staleLockAge - time.Minute)
+	if err := os.Chtimes(c.lockPath("stale"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err = c.Lock("stale")
+	if err != nil {
+		t.Fatalf("unexpected error %+v", err)
+	}
+	unlock()
+}
@@ -0,0 +1,228 @@
+// Package clisso obtains temporary AWS credentials for the apps in the clisso config, as
+// 'clisso get' does, for use by other Go programs.
+//
+// The configuration is read using viper, so the clisso config file must be loaded into viper
+// first, e.g. using viper.SetConfigFile and viper.ReadInConfig. Nothing is written, and no function
+// exits the process: all failures are returned as errors. Input needed during authentication, such
+// as usernames and OTPs, is read using the prompt package, which reads it from the terminal unless
+// a prompt.Prompter is set using prompt.SetPrompter. The spinner shown while waiting for identity
+// providers can be disabled using spinner.Disable.
+package clisso
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/allcloud-io/clisso/aws"
+	"github.com/allcloud-io/clisso/config"
+	"github.com/allcloud-io/clisso/jumpcloud"
+	"github.com/allcloud-io/clisso/okta"
+	"github.com/allcloud-io/clisso/onelogin"
+	"github.com/allcloud-io/clisso/rolesanywhere"
+	"github.com/allcloud-io/clisso/saml"
+	"github.com/fatih/color"
+	"github.com/spf13/viper"
+)
+
+// RoleARNEnv is the environment variable which specifies the role to assume if neither
+// Options.RoleARN nor the arn setting of the app is set, e.g. in ephemeral CI containers.
+const RoleARNEnv = "CLISSO_ROLE_ARN"
+
+// Options customizes how credentials are obtained. The zero value obtains credentials as configured
+// for the app.
+type Options struct {
+	// RoleARN is the ARN of the role to assume. It takes precedence over apps.<app>.arn.
+	RoleARN string
+	// Account and RoleName select the role to assume by account ID and name if the SAML assertion
+	// contains multiple roles.
+	Account  string
+	RoleName string
+	// SessionTags are attached to the session in addition to apps.<app>.session-tags, overriding
+	// configured tags with the same keys.
+	SessionTags map[string]string
+	// Overrides take precedence over the configuration of the app and its providers.
+	Overrides config.Overrides
+	// HTTPClient returns the HTTP client used for requests to the identity provider provider and
+	// to STS. A new client must be returned for each call. If HTTPClient is nil, NewHTTPClient is
+	// used.
+	HTTPClient func(provider string) (*http.Client, error)
+}
+
+// ConfigError is returned when credentials couldn't be obtained because the configuration of an
+// app or its providers is missing or invalid.
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// UnavailableError is returned when credentials couldn't be obtained because a provider seems to
+// be unavailable, as opposed to e.g. rejecting the credentials of the user.
+type UnavailableError struct {
+	Provider string
+	Err      error
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("provider '%s' is unavailable: %v", e.Provider, e.Err)
+}
+
+func (e *UnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// Get obtains temporary credentials for app from the identity provider of the app. If multiple
+// providers are configured for app, they are tried in order until one succeeds or fails for a
+// reason other than being unavailable.
+func Get(app string, opts Options) (*aws.Credentials, error) {
+	providers := AppProviders(app)
+	if len(providers) == 0 {
+		return nil, &ConfigError{fmt.Errorf("could not get provider for app '%s'", app)}
+	}
+
+	var err error
+	for i, provider := range providers {
+		var creds *aws.Credentials
+		creds, err = getFromProvider(app, provider, opts)
+		var ue *UnavailableError
+		if err == nil || !errors.As(err, &ue) {
+			return creds, err
+		}
+		if i < len(providers)-1 {
+			log.Printf(color.YellowString("%v - trying provider '%s'"), err, providers[i+1])
+		}
+	}
+
+	return nil, err
+}
+
+// getFromProvider obtains temporary credentials for app from the given provider. If the provider
+// seems to be unavailable, the returned error is an *UnavailableError.
+func getFromProvider(app, provider string, opts Options) (*aws.Credentials, error) {
+	pType := viper.GetString(fmt.Sprintf("providers.%s.type", provider))
+	if pType == "" {
+		return nil, &ConfigError{fmt.Errorf("could not get provider type for provider '%s'", provider)}
+	}
+
+	filter := saml.RoleFilter{
+		ARN:      RoleARN(app, opts.RoleARN),
+		Account:  opts.Account,
+		RoleName: opts.RoleName,
+		Allowed:  viper.GetStringSlice(fmt.Sprintf("apps.%s.allowed-roles", app)),
+		// A role given explicitly must exist, but the role configured for the app may have been
+		// removed since it was configured.
+		Reselect: opts.RoleARN == "" && viper.GetString(fmt.Sprintf("apps.%s.arn", app)) != "",
+	}
+
+	duration := SessionDuration(app, provider)
+
+	tags, err := SessionTags(app, opts.SessionTags)
+	if err != nil {
+		return nil, &ConfigError{fmt.Errorf("invalid session tags: %v", err)}
+	}
+
+	newClient := opts.HTTPClient
+	if newClient == nil {
+		newClient = NewHTTPClient
+	}
+	hc, err := newClient(provider)
+	if err != nil {
+		return nil, &ConfigError{err}
+	}
+	at := &availabilityTransport{base: hc.Transport}
+	if at.base == nil {
+		at.base = http.DefaultTransport
+	}
+	hc.Transport = at
+
+	var creds *aws.Credentials
+	switch pType {
+	case "onelogin":
+		creds, err = onelogin.Get(app, provider, filter, duration, tags, opts.Overrides, hc)
+	case "okta":
+		creds, err = okta.Get(app, provider, filter, duration, tags, opts.Overrides, hc)
+	case "jumpcloud":
+		creds, err = jumpcloud.Get(app, provider, filter, duration, tags, opts.Overrides, hc)
+	case "rolesanywhere":
+		if len(tags) > 0 {
+			log.Println(color.YellowString("Roles Anywhere doesn't support session tags; ignoring them"))
+		}
+		creds, err = rolesanywhere.Get(app, provider, duration, opts.Overrides, hc)
+	default:
+		return nil, &ConfigError{fmt.Errorf("unsupported identity provider type '%s' for app '%s'", pType, app)}
+	}
+
+	if err != nil && at.failed() {
+		return nil, &UnavailableError{Provider: provider, Err: err}
+	}
+	return creds, err
+}
+
+// AppProviders returns the providers of app in the order in which they should be tried. The list
+// in apps.<app>.providers takes precedence over the single provider in apps.<app>.provider.
+func AppProviders(app string) []string {
+	if providers := viper.GetStringSlice(fmt.Sprintf("apps.%s.providers", app)); len(providers) > 0 {
+		return providers
+	}
+	if provider := viper.GetString(fmt.Sprintf("apps.%s.provider", app)); provider != "" {
+		return []string{provider}
+	}
+	return nil
+}
+
+// RoleARN returns the ARN of the role to assume for app using the following order of preference:
+// override -> apps.<app>.arn -> CLISSO_ROLE_ARN. If none is set, an empty string is returned and
+// the role is selected from the SAML assertion.
+func RoleARN(app, override string) string {
+	if override != "" {
+		return override
+	}
+	if a := viper.GetString(fmt.Sprintf("apps.%s.arn", app)); a != "" {
+		return a
+	}
+	return os.Getenv(RoleARNEnv)
+}
+
+// SessionDuration returns a session duration using the following order of preference:
+// app.duration -> provider.duration -> hardcoded default of 3600
+func SessionDuration(app, provider string) int64 {
+	a := viper.GetInt64(fmt.Sprintf("apps.%s.duration", app))
+	p := viper.GetInt64(fmt.Sprintf("providers.%s.duration", provider))
+
+	if a != 0 {
+		return a
+	}
+
+	if p != 0 {
+		return p
+	}
+
+	return 3600
+}
+
+// SessionTags returns the session tags to attach to the credentials of app. Tags configured under
+// apps.<app>.session-tags are overridden by the given tags.
+func SessionTags(app string, overrides map[string]string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for k, v := range viper.GetStringMapString(fmt.Sprintf("apps.%s.session-tags", app)) {
+		tags[k] = v
+	}
+	for k, v := range overrides {
+		tags[k] = v
+	}
+
+	if err := aws.ValidateSessionTags(tags); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
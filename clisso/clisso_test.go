@@ -0,0 +1,119 @@
+package clisso
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/allcloud-io/clisso/aws"
+	"github.com/allcloud-io/clisso/internal/testserver"
+	"github.com/allcloud-io/clisso/spinner"
+	"github.com/spf13/viper"
+)
+
+func TestAppProviders(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+
+	viper.Set("apps.single.provider", "okta")
+	viper.Set("apps.multiple.provider", "okta")
+	viper.Set("apps.multiple.providers", []string{"okta-new", "okta"})
+
+	for app, want := range map[string][]string{
+		"single":   {"okta"},
+		"multiple": {"okta-new", "okta"},
+		"missing":  nil,
+	} {
+		if got := AppProviders(app); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected %v, got %v", app, want, got)
+		}
+	}
+}
+
+var testdata = []struct {
+	app      int64
+	provider int64
+	result   int64
+}{
+	{0, 0, 3600},
+	{7200, 0, 7200},
+	{0, 7200, 7200},
+	{7200, 14400, 7200},
+}
+
+func TestSessionDuration(t *testing.T) {
+	for _, tc := range testdata {
+		viper.Set("apps.test.duration", tc.app)
+		viper.Set("providers.test.duration", tc.provider)
+
+		res := SessionDuration("test", "test")
+		if res != tc.result {
+			t.Fatalf("Invalid duration: got %v, want: %v", res, tc.result)
+		}
+	}
+}
+
+func TestGet(t *testing.T) {
+	spinner.Disable()
+	viper.Reset()
+	defer viper.Reset()
+
+	idp := testserver.NewOkta()
+	defer idp.Close()
+	sts := testserver.NewSTS()
+	defer sts.Close()
+	testserver.TrustTLS(t)
+
+	aws.STSEndpoint = sts.URL
+	defer func() { aws.STSEndpoint = "" }()
+	region, hasRegion := os.LookupEnv("AWS_REGION")
+	os.Setenv("AWS_REGION", "us-east-1")
+	defer func() {
+		if hasRegion {
+			os.Setenv("AWS_REGION", region)
+		} else {
+			os.Unsetenv("AWS_REGION")
+		}
+	}()
+
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := ioutil.WriteFile(passwordFile, []byte(idp.Password), 0600); err != nil {
+		t.Fatalf("writing password file: %v", err)
+	}
+	viper.Set("providers.test-provider.type", "okta")
+	viper.Set("providers.test-provider.base-url", idp.URL)
+	viper.Set("providers.test-provider.username", "user@example.com")
+	viper.Set("providers.test-provider.password-file", passwordFile)
+	viper.Set("apps.test-app.provider", "test-provider")
+	viper.Set("apps.test-app.url", idp.AppURL())
+
+	var clients []string
+	creds, err := Get("test-app", Options{
+		HTTPClient: func(provider string) (*http.Client, error) {
+			clients = append(clients, provider)
+			return &http.Client{}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if creds.AccessKeyID != testserver.AccessKeyID {
+		t.Errorf("wrong access key ID: got %q, want %q", creds.AccessKeyID, testserver.AccessKeyID)
+	}
+	if want := []string{"test-provider"}; !reflect.DeepEqual(clients, want) {
+		t.Errorf("wrong HTTP clients: got %v, want %v", clients, want)
+	}
+
+	var ce *ConfigError
+	if _, err := Get("missing-app", Options{}); !errors.As(err, &ce) {
+		t.Errorf("expected ConfigError, got %v", err)
+	}
+	viper.Set("apps.test-app.session-tags", map[string]string{"aws:team": "data"})
+	if _, err := Get("test-app", Options{}); !errors.As(err, &ce) {
+		t.Errorf("expected ConfigError for invalid session tags, got %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package clisso
+
+import (
+	"crypto/tls"
+	"net/http"
+	"sync"
+
+	"github.com/allcloud-io/clisso/config"
+)
+
+// NewHTTPClient returns an HTTP client for requests to the identity provider provider and to STS,
+// which uses the timeout and minimum TLS version configured for provider. If provider is empty,
+// the global settings are used.
+func NewHTTPClient(provider string) (*http.Client, error) {
+	timeout, err := config.GetHTTPTimeout(provider)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsMinVersion, err := config.GetTLSMinVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	// The AWS SDK modifies the transport to apply a custom CA bundle, so the default transport
+	// mustn't be shared. The TLS settings of the default transport, if any, are kept.
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	if base.TLSClientConfig == nil {
+		base.TLSClientConfig = &tls.Config{}
+	}
+	base.TLSClientConfig.MinVersion = tlsMinVersion
+
+	return &http.Client{Timeout: timeout, Transport: base}, nil
+}
+
+// availabilityTransport is an http.RoundTripper which sends requests using base and records
+// whether any request failed due to an unavailable server: a network error, a timeout or a 5xx
+// response.
+type availabilityTransport struct {
+	base http.RoundTripper
+
+	mu          sync.Mutex
+	unavailable bool
+}
+
+func (t *availabilityTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(r)
+	if err != nil || resp.StatusCode >= http.StatusInternalServerError {
+		t.mu.Lock()
+		t.unavailable = true
+		t.mu.Unlock()
+	}
+	return resp, err
+}
+
+// Unwrap returns the RoundTripper t sends requests with.
+func (t *availabilityTransport) Unwrap() http.RoundTripper {
+	return t.base
+}
+
+// failed returns true if any request sent using t failed due to an unavailable server.
+func (t *availabilityTransport) failed() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.unavailable
+}
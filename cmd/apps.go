@@ -1,12 +1,21 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"os"
+	"regexp"
 	"sort"
 	"strconv"
+	"strings"
 
+	"github.com/allcloud-io/clisso/clisso"
+	"github.com/allcloud-io/clisso/config"
+	"github.com/allcloud-io/clisso/okta"
 	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -22,21 +31,57 @@ var appID string
 // URL holds the Okta URL
 var URL string
 
+// Discovery
+var saveDiscovered bool
+
+// Listing
+var appsListJSON bool
+var appsListTags []string
+
 func init() {
 	// OneLogin
 	cmdAppsCreateOneLogin.Flags().StringVar(&appID, "app-id", "", "OneLogin app ID")
+	cmdAppsCreateOneLogin.Flags().StringVar(&URL, "url", "",
+		"URL of the OneLogin app which contains its app ID, e.g. its issuer URL (instead of --app-id)")
 	cmdAppsCreateOneLogin.Flags().StringVar(&provider, "provider", "", "Name of the Clisso provider")
 	cmdAppsCreateOneLogin.Flags().IntVar(&duration, "duration", 0, "(Optional) Session duration in seconds")
 	cmdAppsCreateOneLogin.Flags().StringVar(&arn, "arn", "", "(Optional) preferred arn for app")
-	mandatoryFlag(cmdAppsCreateOneLogin, "app-id")
 	mandatoryFlag(cmdAppsCreateOneLogin, "provider")
 
 	// Okta
 	cmdAppsCreateOkta.Flags().StringVar(&provider, "provider", "", "Name of the Clisso provider")
 	cmdAppsCreateOkta.Flags().StringVar(&URL, "url", "", "Okta app URL")
+	cmdAppsCreateOkta.Flags().StringVar(&arn, "arn", "",
+		"ARN of the role to assume (required for providers which use device authorization)")
 	cmdAppsCreateOkta.Flags().IntVar(&duration, "duration", 0, "(Optional) Session duration in seconds")
 	mandatoryFlag(cmdAppsCreateOkta, "provider")
-	mandatoryFlag(cmdAppsCreateOkta, "url")
+
+	// JumpCloud
+	cmdAppsCreateJumpCloud.Flags().StringVar(&provider, "provider", "", "Name of the Clisso provider")
+	cmdAppsCreateJumpCloud.Flags().StringVar(&URL, "url", "",
+		"SSO URL of the JumpCloud app, e.g. https://sso.jumpcloud.com/saml2/aws")
+	cmdAppsCreateJumpCloud.Flags().StringVar(&arn, "arn", "", "(Optional) preferred arn for app")
+	cmdAppsCreateJumpCloud.Flags().IntVar(&duration, "duration", 0, "(Optional) Session duration in seconds")
+	mandatoryFlag(cmdAppsCreateJumpCloud, "provider")
+	mandatoryFlag(cmdAppsCreateJumpCloud, "url")
+
+	// Roles Anywhere
+	cmdAppsCreateRolesAnywhere.Flags().StringVar(&provider, "provider", "", "Name of the Clisso provider")
+	cmdAppsCreateRolesAnywhere.Flags().StringVar(&arn, "arn", "", "ARN of the role to assume")
+	cmdAppsCreateRolesAnywhere.Flags().IntVar(&duration, "duration", 0, "(Optional) Session duration in seconds")
+	mandatoryFlag(cmdAppsCreateRolesAnywhere, "provider")
+	mandatoryFlag(cmdAppsCreateRolesAnywhere, "arn")
+
+	// Listing
+	cmdAppsList.Flags().BoolVar(&appsListJSON, "json", false, "Print apps as a JSON array")
+	cmdAppsList.Flags().StringArrayVar(&appsListTags, "tag", nil,
+		"Only list apps which have this tag in apps.<app>.tags (can be repeated)")
+
+	// Discovery
+	cmdAppsDiscover.Flags().StringVar(&provider, "provider", "", "Name of the Clisso provider")
+	cmdAppsDiscover.Flags().BoolVar(&saveDiscovered, "save", false,
+		"Save discovered apps which don't exist yet into the config file")
+	mandatoryFlag(cmdAppsDiscover, "provider")
 
 	// Build command tree
 	RootCmd.AddCommand(cmdApps)
@@ -44,7 +89,26 @@ func init() {
 	cmdApps.AddCommand(cmdAppsCreate)
 	cmdAppsCreate.AddCommand(cmdAppsCreateOneLogin)
 	cmdAppsCreate.AddCommand(cmdAppsCreateOkta)
+	cmdAppsCreate.AddCommand(cmdAppsCreateJumpCloud)
+	cmdAppsCreate.AddCommand(cmdAppsCreateRolesAnywhere)
 	cmdApps.AddCommand(cmdAppsSelect)
+	cmdApps.AddCommand(cmdAppsDiscover)
+	cmdApps.AddCommand(cmdAppsAlias)
+}
+
+// nonAppNameChars matches sequences of characters which aren't allowed in generated app names.
+var nonAppNameChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// appNameFromLabel generates an app name from the label of an app at the identity provider. If
+// the label has no characters allowed in app names, e.g. because it is in a non-Latin script, the
+// name is generated from the app ID instead. An empty string is returned if neither yields a name.
+func appNameFromLabel(label, appID string) string {
+	for _, s := range []string{label, appID} {
+		if name := strings.Trim(nonAppNameChars.ReplaceAllString(strings.ToLower(s), "-"), "-"); name != "" {
+			return name
+		}
+	}
+	return ""
 }
 
 var cmdApps = &cobra.Command{
@@ -53,32 +117,111 @@ var cmdApps = &cobra.Command{
 	Long:  `View and change app configuration.`,
 }
 
+// appListEntry describes an app in the JSON output of apps ls.
+type appListEntry struct {
+	Name     string   `json:"name"`
+	Provider string   `json:"provider"`
+	Type     string   `json:"type"`
+	Selected bool     `json:"selected"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+// appNames returns the names of all configured apps sorted alphabetically.
+func appNames() []string {
+	apps := viper.GetStringMap("apps")
+
+	keys := make([]string, 0, len(apps))
+	for k := range apps {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// appTags returns the tags of app, which are used to operate on groups of apps.
+func appTags(app string) []string {
+	return viper.GetStringSlice(fmt.Sprintf("apps.%s.tags", app))
+}
+
+// appsWithTags returns the apps which have all of the given tags in apps.<app>.tags.
+func appsWithTags(apps, tags []string) []string {
+	var matching []string
+	for _, app := range apps {
+		has := make(map[string]bool)
+		for _, t := range appTags(app) {
+			has[t] = true
+		}
+
+		ok := true
+		for _, t := range tags {
+			if !has[t] {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			matching = append(matching, app)
+		}
+	}
+
+	return matching
+}
+
+// writeAppsJSON writes the given apps to w as a JSON array. The provider of an app with multiple
+// providers is the first one.
+func writeAppsJSON(w io.Writer, apps []string) error {
+	selected := viper.GetString("global.selected-app")
+
+	entries := []appListEntry{}
+	for _, name := range apps {
+		e := appListEntry{Name: name, Selected: name == selected, Tags: appTags(name)}
+		if providers := clisso.AppProviders(name); len(providers) > 0 {
+			e.Provider = providers[0]
+			e.Type = viper.GetString(fmt.Sprintf("providers.%s.type", e.Provider))
+		}
+		entries = append(entries, e)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(entries)
+}
+
 var cmdAppsList = &cobra.Command{
 	Use:   "ls",
 	Short: "List apps",
 	Long:  "List all configured apps.",
 	Run: func(cmd *cobra.Command, args []string) {
-		apps := viper.GetStringMap("apps")
+		keys := appsWithTags(appNames(), appsListTags)
 
-		if len(apps) == 0 {
-			fmt.Println("No apps configured")
+		if appsListJSON {
+			if err := writeAppsJSON(os.Stdout, keys); err != nil {
+				fatalf(codeOutputFailed, "Error printing apps: %v", err)
+			}
 			return
 		}
 
-		// Sort apps alphabetically
-		keys := make([]string, 0, len(apps))
-		for k := range apps {
-			keys = append(keys, k)
+		if len(keys) == 0 {
+			if len(appsListTags) > 0 {
+				fmt.Printf("No apps with tag(s) %s\n", strings.Join(appsListTags, ", "))
+			} else {
+				fmt.Println("No apps configured")
+			}
+			return
 		}
-		sort.Strings(keys)
 
 		selected := viper.GetString("global.selected-app")
 
 		for _, k := range keys {
+			label := k
+			if tags := appTags(k); len(tags) > 0 {
+				label = fmt.Sprintf("%s [%s]", k, strings.Join(tags, ", "))
+			}
 			if k == selected {
-				log.Printf(color.GreenString("* %s"), k)
+				log.Printf(color.GreenString("* %s"), label)
 			} else {
-				log.Printf("  %s", k)
+				log.Printf("  %s", label)
 			}
 		}
 	},
@@ -100,28 +243,41 @@ var cmdAppsCreateOneLogin = &cobra.Command{
 
 		// Verify app doesn't exist
 		if exists := viper.Get("apps." + name); exists != nil {
-			log.Fatalf(color.RedString("App '%s' already exists"), name)
+			fatalf(codeUsage, "App '%s' already exists", name)
 		}
 
 		// Verify provider exists
 		if exists := viper.Get("providers." + provider); exists == nil {
-			log.Fatalf(color.RedString("Provider '%s' doesn't exist"), provider)
+			fatalf(codeUsage, "Provider '%s' doesn't exist", provider)
 		}
 
 		// Verify provider type
 		pType := viper.GetString(fmt.Sprintf("providers.%s.type", provider))
 		if pType != "onelogin" {
-			log.Fatalf(
-				color.RedString("Invalid provider type '%s' for a OneLogin app. Type must be 'onelogin'."),
+			fatalf(
+				codeUsage,
+				"Invalid provider type '%s' for a OneLogin app. Type must be 'onelogin'.",
 				pType,
 			)
 		}
 
+		if (appID == "") == (URL == "") {
+			fatalf(codeUsage, "Exactly one of --app-id and --url must be specified")
+		}
+
 		conf := map[string]string{
-			"app-id":   appID,
 			"provider": provider,
 		}
 
+		if URL != "" {
+			if _, err := config.ParseAppURL(URL); err != nil {
+				fatalf(codeUsage, "%v", err)
+			}
+			conf["url"] = URL
+		} else {
+			conf["app-id"] = appID
+		}
+
 		if arn != "" {
 			conf["arn"] = arn
 		}
@@ -129,17 +285,17 @@ var cmdAppsCreateOneLogin = &cobra.Command{
 		if duration != 0 {
 			// Duration specified - validate value
 			if duration < 3600 || duration > 43200 {
-				log.Fatal(color.RedString("Invalid duration Specified. Valid values: 3600 - 43200"))
+				fatalf(codeUsage, "Invalid duration Specified. Valid values: 3600 - 43200")
 			}
 			conf["duration"] = strconv.Itoa(duration)
 		}
 
-		viper.Set(fmt.Sprintf("apps.%s", name), conf)
-
 		// Write config to file
-		err := viper.WriteConfig()
+		err := updateConfigFile(func(v *viper.Viper) {
+			v.Set(fmt.Sprintf("apps.%s", name), conf)
+		})
 		if err != nil {
-			log.Fatalf(color.RedString("Error writing config: %v"), err)
+			fatalf(codeConfig, "Error writing config: %v", err)
 		}
 		log.Printf(color.GreenString("App '%s' saved to config file"), name)
 	},
@@ -155,19 +311,91 @@ var cmdAppsCreateOkta = &cobra.Command{
 
 		// Verify app doesn't exist
 		if exists := viper.Get("apps." + name); exists != nil {
-			log.Fatalf(color.RedString("App '%s' already exists"), name)
+			fatalf(codeUsage, "App '%s' already exists", name)
 		}
 
 		// Verify provider exists
 		if exists := viper.Get("providers." + provider); exists == nil {
-			log.Fatalf(color.RedString("Provider '%s' doesn't exist"), provider)
+			fatalf(codeUsage, "Provider '%s' doesn't exist", provider)
 		}
 
 		// Verify provider type
 		pType := viper.GetString(fmt.Sprintf("providers.%s.type", provider))
 		if pType != "okta" {
-			log.Fatalf(
-				color.RedString("Invalid provider type '%s' for an Okta app. Type must be 'okta'."),
+			fatalf(
+				codeUsage,
+				"Invalid provider type '%s' for an Okta app. Type must be 'okta'.",
+				pType,
+			)
+		}
+
+		conf := map[string]string{
+			"provider": provider,
+		}
+
+		// Apps of providers which use device authorization assume a role directly instead of
+		// launching an Okta app.
+		if viper.GetString(fmt.Sprintf("providers.%s.auth-type", provider)) == config.OktaAuthTypeDevice {
+			if arn == "" {
+				fatalf(codeUsage, "--arn is required for apps of providers which use device authorization")
+			}
+			conf["arn"] = arn
+		} else {
+			if URL == "" {
+				fatalf(codeUsage, "--url is required")
+			}
+			if _, err := config.ParseAppURL(URL); err != nil {
+				fatalf(codeUsage, "%v", err)
+			}
+			conf["url"] = URL
+			if arn != "" {
+				conf["arn"] = arn
+			}
+		}
+
+		if duration != 0 {
+			// Duration specified - validate value
+			if duration < 3600 || duration > 43200 {
+				fatalf(codeUsage, "Invalid duration Specified. Valid values: 3600 - 43200")
+			}
+			conf["duration"] = strconv.Itoa(duration)
+		}
+
+		// Write config to file
+		err := updateConfigFile(func(v *viper.Viper) {
+			v.Set(fmt.Sprintf("apps.%s", name), conf)
+		})
+		if err != nil {
+			fatalf(codeConfig, "Error writing config: %v", err)
+		}
+		log.Printf(color.GreenString("App '%s' saved to config file"), name)
+	},
+}
+
+var cmdAppsCreateJumpCloud = &cobra.Command{
+	Use:   "jumpcloud [app name]",
+	Short: "Create a new JumpCloud app",
+	Long:  "Save a new JumpCloud app into the config file.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+
+		// Verify app doesn't exist
+		if exists := viper.Get("apps." + name); exists != nil {
+			fatalf(codeUsage, "App '%s' already exists", name)
+		}
+
+		// Verify provider exists
+		if exists := viper.Get("providers." + provider); exists == nil {
+			fatalf(codeUsage, "Provider '%s' doesn't exist", provider)
+		}
+
+		// Verify provider type
+		pType := viper.GetString(fmt.Sprintf("providers.%s.type", provider))
+		if pType != "jumpcloud" {
+			fatalf(
+				codeUsage,
+				"Invalid provider type '%s' for a JumpCloud app. Type must be 'jumpcloud'.",
 				pType,
 			)
 		}
@@ -176,21 +404,81 @@ var cmdAppsCreateOkta = &cobra.Command{
 			"provider": provider,
 			"url":      URL,
 		}
+		if arn != "" {
+			conf["arn"] = arn
+		}
 
 		if duration != 0 {
 			// Duration specified - validate value
 			if duration < 3600 || duration > 43200 {
-				log.Fatal(color.RedString("Invalid duration Specified. Valid values: 3600 - 43200"))
+				fatalf(codeUsage, "Invalid duration Specified. Valid values: 3600 - 43200")
 			}
 			conf["duration"] = strconv.Itoa(duration)
 		}
 
 		viper.Set(fmt.Sprintf("apps.%s", name), conf)
+		if _, err := config.GetJumpCloudApp(name); err != nil {
+			fatalf(codeUsage, "%v", err)
+		}
 
 		// Write config to file
-		err := viper.WriteConfig()
+		err := updateConfigFile(func(v *viper.Viper) {
+			v.Set(fmt.Sprintf("apps.%s", name), conf)
+		})
 		if err != nil {
-			log.Fatalf(color.RedString("Error writing config: %v"), err)
+			fatalf(codeConfig, "Error writing config: %v", err)
+		}
+		log.Printf(color.GreenString("App '%s' saved to config file"), name)
+	},
+}
+
+var cmdAppsCreateRolesAnywhere = &cobra.Command{
+	Use:   "rolesanywhere [app name]",
+	Short: "Create a new IAM Roles Anywhere app",
+	Long:  "Save a new IAM Roles Anywhere app into the config file.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+
+		// Verify app doesn't exist
+		if exists := viper.Get("apps." + name); exists != nil {
+			fatalf(codeUsage, "App '%s' already exists", name)
+		}
+
+		// Verify provider exists
+		if exists := viper.Get("providers." + provider); exists == nil {
+			fatalf(codeUsage, "Provider '%s' doesn't exist", provider)
+		}
+
+		// Verify provider type
+		pType := viper.GetString(fmt.Sprintf("providers.%s.type", provider))
+		if pType != "rolesanywhere" {
+			fatalf(
+				codeUsage,
+				"Invalid provider type '%s' for a Roles Anywhere app. Type must be 'rolesanywhere'.",
+				pType,
+			)
+		}
+
+		conf := map[string]string{
+			"provider": provider,
+			"arn":      arn,
+		}
+
+		if duration != 0 {
+			// Duration specified - validate value
+			if duration < 900 || duration > 43200 {
+				fatalf(codeUsage, "Invalid duration Specified. Valid values: 900 - 43200")
+			}
+			conf["duration"] = strconv.Itoa(duration)
+		}
+
+		// Write config to file
+		err := updateConfigFile(func(v *viper.Viper) {
+			v.Set(fmt.Sprintf("apps.%s", name), conf)
+		})
+		if err != nil {
+			fatalf(codeConfig, "Error writing config: %v", err)
 		}
 		log.Printf(color.GreenString("App '%s' saved to config file"), name)
 	},
@@ -205,20 +493,132 @@ var cmdAppsSelect = &cobra.Command{
 		app := args[0]
 
 		if app == "" {
-			viper.Set("global.selected-app", "")
 			log.Println(color.GreenString("Unsetting selected app"))
 		} else {
 			if exists := viper.Get("apps." + app); exists == nil {
-				log.Fatalf(color.RedString("App '%s' doesn't exist"), app)
+				fatalf(codeUsage, "App '%s' doesn't exist", app)
 			}
 			log.Printf(color.GreenString("Setting selected app to '%s'"), app)
-			viper.Set("global.selected-app", app)
 		}
 
 		// Write config to file
-		err := viper.WriteConfig()
+		err := updateConfigFile(func(v *viper.Viper) {
+			v.Set("global.selected-app", app)
+		})
+		if err != nil {
+			fatalf(codeConfig, "Error writing config: %v", err)
+		}
+	},
+}
+
+var cmdAppsDiscover = &cobra.Command{
+	Use:   "discover",
+	Short: "Discover the apps assigned to you at a provider",
+	Long: `Authenticate against the specified provider and list the AWS apps assigned to the
+user, along with the app URLs. Use --save to add discovered apps which don't exist yet to the
+config file. Only Okta providers are currently supported.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		pType := viper.GetString(fmt.Sprintf("providers.%s.type", provider))
+		if pType == "" {
+			fatalf(codeUsage, "Provider '%s' doesn't exist", provider)
+		}
+		if pType != "okta" {
+			fatalf(codeUsage, "App discovery isn't supported for provider type '%s'", pType)
+		}
+
+		hc, err := newHTTPClient(provider)
+		if err != nil {
+			fatalf(codeConfig, "%v", err)
+		}
+
+		apps, err := okta.Discover(provider, hc)
+		if err != nil {
+			fatalf(codeAuthFailed, "Could not discover apps: %v", err)
+		}
+
+		if len(apps) == 0 {
+			log.Printf("No AWS apps are assigned to you at provider '%s'", provider)
+			return
+		}
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Name", "Label", "URL"})
+		saved := make(map[string]map[string]string)
+		for _, a := range apps {
+			name := appNameFromLabel(a.Label, a.AppInstanceID)
+			if name == "" {
+				log.Printf(color.YellowString("Can't generate a name for app '%s' - skipping it"), a.Label)
+				continue
+			}
+			table.Append([]string{name, a.Label, a.LinkURL})
+
+			if !saveDiscovered {
+				continue
+			}
+			if exists := viper.Get("apps." + name); exists != nil || saved[name] != nil {
+				log.Printf(color.YellowString("App '%s' already exists - not saving it"), name)
+				continue
+			}
+			saved[name] = map[string]string{
+				"provider": provider,
+				"url":      a.LinkURL,
+			}
+		}
+		table.Render()
+
+		if len(saved) > 0 {
+			err = updateConfigFile(func(v *viper.Viper) {
+				for name, conf := range saved {
+					v.Set(fmt.Sprintf("apps.%s", name), conf)
+				}
+			})
+			if err != nil {
+				fatalf(codeConfig, "Error writing config: %v", err)
+			}
+			log.Printf(color.GreenString("%d apps saved to config file"), len(saved))
+		}
+	},
+}
+
+var cmdAppsAlias = &cobra.Command{
+	Use:   "alias [alias] [app name]",
+	Short: "Create an alias for an app",
+	Long: `Save an alias for an app into the config file. The alias can be used instead of the app
+name when obtaining credentials. If the app name is empty, the alias is removed.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		alias, app := args[0], args[1]
+
+		// Aliases which shadow apps would never be resolved.
+		if exists := viper.Get("apps." + alias); exists != nil {
+			fatalf(codeUsage, "An app named '%s' already exists", alias)
+		}
+
+		if app == "" {
+			if _, ok := viper.GetStringMapString("aliases")[alias]; !ok {
+				fatalf(codeUsage, "Alias '%s' doesn't exist", alias)
+			}
+			log.Printf(color.GreenString("Removing alias '%s'"), alias)
+		} else {
+			if exists := viper.Get("apps." + app); exists == nil {
+				fatalf(codeUsage, "App '%s' doesn't exist", app)
+			}
+			log.Printf(color.GreenString("Setting alias '%s' for app '%s'"), alias, app)
+		}
+
+		// Write config to file
+		err := updateConfigFile(func(v *viper.Viper) {
+			aliases := v.GetStringMapString("aliases")
+			if app == "" {
+				delete(aliases, alias)
+			} else {
+				aliases[alias] = app
+			}
+			v.Set("aliases", aliases)
+		})
 		if err != nil {
-			log.Fatalf(color.RedString("Error writing config: %v"), err)
+			fatalf(codeConfig, "Error writing config: %v", err)
 		}
 	},
 }
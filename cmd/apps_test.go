@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestAppNameFromLabel(t *testing.T) {
+	for _, test := range []struct {
+		label  string
+		appID  string
+		expect string
+	}{
+		{"AWS Production", "0oa1", "aws-production"},
+		{"aws-dev", "0oa1", "aws-dev"},
+		{"  AWS (Data) / Prod.EU ", "0oa1", "aws-data-prod-eu"},
+		{"本番", "0oa1B2", "0oa1b2"},
+		{"本番", "", ""},
+	} {
+		if got := appNameFromLabel(test.label, test.appID); got != test.expect {
+			t.Errorf("Wrong app name for label %q: got %q, want %q", test.label, got, test.expect)
+		}
+	}
+}
+
+func TestWriteAppsJSON(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+
+	var b bytes.Buffer
+	if err := writeAppsJSON(&b, appNames()); err != nil {
+		t.Fatalf("unexpected error %+v", err)
+	}
+	if got := strings.TrimSpace(b.String()); got != "[]" {
+		t.Errorf("expected an empty array without apps, got %s", got)
+	}
+
+	viper.Set("providers.okta-prod.type", "okta")
+	viper.Set("providers.onelogin-dev.type", "onelogin")
+	viper.Set("apps.prod.provider", "okta-prod")
+	viper.Set("apps.prod.tags", []string{"env:prod"})
+	viper.Set("apps.dev.provider", "onelogin-dev")
+	viper.Set("apps.migrating.providers", []string{"okta-prod", "onelogin-dev"})
+	viper.Set("global.selected-app", "prod")
+
+	b.Reset()
+	if err := writeAppsJSON(&b, appNames()); err != nil {
+		t.Fatalf("unexpected error %+v", err)
+	}
+
+	var got []appListEntry
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", b.String(), err)
+	}
+	want := []appListEntry{
+		{Name: "dev", Provider: "onelogin-dev", Type: "onelogin"},
+		{Name: "migrating", Provider: "okta-prod", Type: "okta"},
+		{Name: "prod", Provider: "okta-prod", Type: "okta", Selected: true, Tags: []string{"env:prod"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong apps: got %+v, want %+v", got, want)
+	}
+}
+
+func TestDescribeApp(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+
+	viper.Set("global.credentials-path", "/tmp/credentials")
+	viper.Set("global.selected-app", "prod")
+	viper.Set("providers.onelogin-dev.type", "onelogin")
+	viper.Set("providers.onelogin-dev.client-id", "clientid")
+	viper.Set("providers.onelogin-dev.client-secret", "topsecret")
+	viper.Set("providers.onelogin-dev.subdomain", "example")
+	viper.Set("providers.onelogin-dev.duration", 7200)
+	viper.Set("providers.okta-prod.type", "okta")
+	viper.Set("providers.okta-prod.base-url", "https://example.okta.com")
+	viper.Set("apps.dev.provider", "onelogin-dev")
+	viper.Set("apps.dev.app-id", "12345")
+	viper.Set("apps.prod.providers", []string{"okta-prod", "onelogin-dev"})
+	viper.Set("apps.prod.url", "https://example.okta.com/home/amazon_aws/abc/123")
+	viper.Set("apps.prod.duration", 14400)
+	viper.Set("apps.prod.arn", "arn:aws:iam::123456789012:role/Admin")
+	viper.Set("global.role-durations", map[string]string{"*admin*": "2h"})
+	viper.Set("apps.prod.credentials-path", "/tmp/prod-credentials")
+	viper.Set("aliases.p", "prod")
+
+	d, err := describeApp("dev")
+	if err != nil {
+		t.Fatalf("unexpected error %+v", err)
+	}
+	want := &appDetails{
+		Name:            "dev",
+		Provider:        "onelogin-dev",
+		Type:            "onelogin",
+		AppID:           "12345",
+		Duration:        7200,
+		Region:          "US",
+		Profile:         "dev",
+		CredentialsPath: "/tmp/credentials",
+		Inherited: map[string]string{
+			"duration":         originProvider,
+			"region":           originProvider,
+			"credentials-path": originGlobal,
+		},
+		ProviderSettings: d.ProviderSettings,
+	}
+	if !reflect.DeepEqual(d, want) {
+		t.Errorf("wrong details: got %+v, want %+v", d, want)
+	}
+	if got := d.ProviderSettings["client-secret"]; got != redacted {
+		t.Errorf("secret wasn't redacted: got %v", got)
+	}
+
+	d, err = describeApp("prod")
+	if err != nil {
+		t.Fatalf("unexpected error %+v", err)
+	}
+	var b bytes.Buffer
+	if err := writeAppDetails(&b, d); err != nil {
+		t.Fatalf("unexpected error %+v", err)
+	}
+	got := b.String()
+	for _, want := range []string{
+		"provider: okta-prod\n",
+		"fallback-providers: onelogin-dev\n",
+		"type: okta\n",
+		"url: https://example.okta.com/home/amazon_aws/abc/123\n",
+		"duration: 7200 (global.role-durations)\n",
+		"profile: prod\n",
+		"credentials-path: /tmp/prod-credentials\n",
+		"aliases: p\n",
+		"selected: true\n",
+		"provider.auth-type: password\n",
+		"provider.base-url: https://example.okta.com\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output doesn't contain %q:\n%s", want, got)
+		}
+	}
+
+	viper.Set("apps.dev.session-tags", map[string]string{"team": "data"})
+	d, err = describeApp("dev")
+	if err != nil {
+		t.Fatalf("unexpected error %+v", err)
+	}
+	if d.Duration != 3600 || d.Inherited["duration"] != originSessionTags {
+		t.Errorf("wrong duration with session tags: got %d (%s)", d.Duration, d.Inherited["duration"])
+	}
+}
@@ -0,0 +1,252 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/allcloud-io/clisso/aws"
+	"github.com/allcloud-io/clisso/clisso"
+	"github.com/allcloud-io/clisso/config"
+	"github.com/allcloud-io/clisso/saml"
+	awsarn "github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var appsShowJSON bool
+
+func init() {
+	cmdAppsShow.Flags().BoolVar(&appsShowJSON, "json", false, "Print the app as JSON")
+	cmdApps.AddCommand(cmdAppsShow)
+}
+
+// Origins of the settings of an app which aren't set for the app itself.
+const (
+	originProvider   = "provider"
+	originGlobal     = "global"
+	originDefault    = "default"
+	originAWSProfile = "AWS_PROFILE"
+	// originRoleDurations and originSessionTags mark durations which were changed due to the
+	// configured role matching global.role-durations or due to session tags, which limit the
+	// duration to aws.MaxChainedDuration.
+	originRoleDurations = "global.role-durations"
+	originSessionTags   = "session tags"
+)
+
+// appDetails describes an app in the output of apps show.
+type appDetails struct {
+	Name     string `json:"name"`
+	Provider string `json:"provider"`
+	// FallbackProviders are the providers tried after the first one fails.
+	FallbackProviders []string `json:"fallback_providers,omitempty"`
+	Type              string   `json:"type"`
+	AppID             string   `json:"app_id,omitempty"`
+	URL               string   `json:"url,omitempty"`
+	ARN               string   `json:"arn,omitempty"`
+	Duration          int64    `json:"duration"`
+	Region            string   `json:"region,omitempty"`
+	Profile           string   `json:"profile"`
+	CredentialsPath   string   `json:"credentials_path"`
+	SessionName       string   `json:"session_name,omitempty"`
+	STSEndpoint       string   `json:"sts_endpoint,omitempty"`
+	Tags              []string `json:"tags,omitempty"`
+	Aliases           []string `json:"aliases,omitempty"`
+	Selected          bool     `json:"selected"`
+	// Inherited maps the settings which aren't set for the app to where their values come from:
+	// the provider, the global settings, AWS_PROFILE or the defaults of clisso.
+	Inherited map[string]string `json:"inherited,omitempty"`
+	// ProviderSettings are the effective settings of the provider with secrets redacted.
+	ProviderSettings map[string]interface{} `json:"provider_settings"`
+}
+
+// describeApp returns the resolved details of app, which must exist.
+func describeApp(app string) (*appDetails, error) {
+	providers := clisso.AppProviders(app)
+	if len(providers) == 0 {
+		return nil, errors.New("provider config value must be set")
+	}
+	p := providers[0]
+	appKey := func(k string) string { return fmt.Sprintf("apps.%s.%s", app, k) }
+
+	d := &appDetails{
+		Name:              app,
+		Provider:          p,
+		FallbackProviders: providers[1:],
+		Type:              viper.GetString(fmt.Sprintf("providers.%s.type", p)),
+		AppID:             viper.GetString(appKey("app-id")),
+		URL:               viper.GetString(appKey("url")),
+		ARN:               viper.GetString(appKey("arn")),
+		Duration:          clisso.SessionDuration(app, p),
+		Profile:           app,
+		Tags:              appTags(app),
+		Selected:          viper.GetString("global.selected-app") == app,
+		Inherited:         make(map[string]string),
+	}
+	if len(d.FallbackProviders) == 0 {
+		d.FallbackProviders = nil
+	}
+
+	if !viper.IsSet(appKey("duration")) {
+		d.Inherited["duration"] = originDefault
+		if viper.GetInt64(fmt.Sprintf("providers.%s.duration", p)) != 0 {
+			d.Inherited["duration"] = originProvider
+		}
+	}
+	// Providers which use SAML adjust the duration like this once the role is known.
+	if usesSAML(p) {
+		if d.ARN != "" {
+			duration, err := saml.RoleDuration(d.ARN, d.Duration)
+			if err != nil {
+				return nil, err
+			}
+			if duration != d.Duration {
+				d.Duration = duration
+				d.Inherited["duration"] = originRoleDurations
+			}
+		}
+		tags, err := clisso.SessionTags(app, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(tags) > 0 && d.Duration > aws.MaxChainedDuration {
+			d.Duration = aws.MaxChainedDuration
+			d.Inherited["duration"] = originSessionTags
+		}
+	}
+
+	switch d.Type {
+	case "onelogin":
+		c, err := config.GetOneLoginProvider(p)
+		if err != nil {
+			return nil, fmt.Errorf("provider '%s': %v", p, err)
+		}
+		d.Region = c.Region
+		d.Inherited["region"] = originProvider
+	case "rolesanywhere":
+		c, err := config.GetRolesAnywhereProvider(p)
+		if err != nil {
+			return nil, fmt.Errorf("provider '%s': %v", p, err)
+		}
+		if ta, err := awsarn.Parse(c.TrustAnchorARN); err == nil {
+			d.Region = ta.Region
+			d.Inherited["region"] = originProvider
+		}
+	}
+
+	if profile := awsProfileSection(); profile != "" {
+		d.Profile = profile
+		d.Inherited["profile"] = originAWSProfile
+	}
+
+	var err error
+	if d.CredentialsPath, err = credentialsPath("", app); err != nil {
+		return nil, fmt.Errorf("expanding credentials path: %v", err)
+	}
+	if !viper.IsSet(appKey("credentials-path")) {
+		d.Inherited["credentials-path"] = originDefault
+		if viper.IsSet("global.credentials-path") {
+			d.Inherited["credentials-path"] = originGlobal
+		}
+	}
+
+	if d.SessionName, err = config.GetSessionName(app, ""); err != nil {
+		return nil, err
+	}
+	if d.STSEndpoint, err = config.GetSTSEndpoint(app, ""); err != nil {
+		return nil, err
+	}
+	if d.STSEndpoint != "" && !viper.IsSet(appKey("sts-endpoint")) {
+		d.Inherited["sts-endpoint"] = originGlobal
+	}
+
+	for alias, target := range viper.GetStringMapString("aliases") {
+		if target == app {
+			d.Aliases = append(d.Aliases, alias)
+		}
+	}
+	sort.Strings(d.Aliases)
+
+	settings, err := effectiveConfig(app)
+	if err != nil {
+		return nil, err
+	}
+	d.ProviderSettings = subMap(subMap(settings, "providers"), p)
+
+	return d, nil
+}
+
+// writeAppDetails writes d to w as key: value lines, marking settings which are inherited with
+// their origin. The settings of the provider follow, using dotted keys.
+func writeAppDetails(w io.Writer, d *appDetails) error {
+	var lines []string
+	add := func(k string, v interface{}) {
+		s := fmt.Sprint(v)
+		if s == "" {
+			return
+		}
+		if origin, ok := d.Inherited[k]; ok {
+			s = fmt.Sprintf("%s (%s)", s, origin)
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", k, s))
+	}
+
+	add("name", d.Name)
+	add("provider", d.Provider)
+	add("fallback-providers", strings.Join(d.FallbackProviders, ", "))
+	add("type", d.Type)
+	add("app-id", d.AppID)
+	add("url", d.URL)
+	add("arn", d.ARN)
+	add("duration", d.Duration)
+	add("region", d.Region)
+	add("profile", d.Profile)
+	add("credentials-path", d.CredentialsPath)
+	add("session-name", d.SessionName)
+	add("sts-endpoint", d.STSEndpoint)
+	add("tags", strings.Join(d.Tags, ", "))
+	add("aliases", strings.Join(d.Aliases, ", "))
+	add("selected", d.Selected)
+
+	provider := flattenConfig("provider.", d.ProviderSettings, nil)
+	sort.Strings(provider)
+
+	_, err := fmt.Fprintln(w, strings.Join(append(lines, provider...), "\n"))
+	return err
+}
+
+var cmdAppsShow = &cobra.Command{
+	Use:   "show [app name]",
+	Short: "Show the details of an app",
+	Long: `Print the details of an app as they are used when obtaining credentials: its provider, the
+session duration, the profile and file credentials are written to and the settings of the provider.
+Settings which aren't set for the app are marked with where their values come from. Secrets are
+redacted.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		app, err := checkAppExists(resolveAlias(args[0]), false)
+		if err != nil {
+			fatalf(codeUsage, "%v", err)
+		}
+
+		d, err := describeApp(app)
+		if err != nil {
+			fatalf(codeConfig, "Error resolving app '%s': %v", app, err)
+		}
+
+		if appsShowJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(d)
+		} else {
+			err = writeAppDetails(os.Stdout, d)
+		}
+		if err != nil {
+			fatalf(codeOutputFailed, "Error printing app: %v", err)
+		}
+	},
+}
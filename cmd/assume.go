@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/allcloud-io/clisso/aws"
+	"github.com/allcloud-io/clisso/clisso"
+	"github.com/allcloud-io/clisso/config"
+	"github.com/allcloud-io/clisso/saml"
+	"github.com/fatih/color"
+	"github.com/mitchellh/go-homedir"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var samlIn string
+var assumeRoleARN string
+var assumePrintToShell bool
+var assumeWriteToFile string
+var assumeCredentialsSection string
+
+func init() {
+	RootCmd.AddCommand(cmdAssume)
+	cmdAssume.Flags().StringVar(
+		&samlIn, "saml-in", "",
+		"File containing the base64 encoded SAML assertion, e.g. written by 'clisso get --saml-out'",
+	)
+	cmdAssume.Flags().StringVar(
+		&assumeRoleARN, "role", "",
+		"ARN of the IAM role to assume if the assertion contains multiple roles",
+	)
+	cmdAssume.Flags().BoolVarP(
+		&assumePrintToShell, "shell", "s", false,
+		"Print credentials to shell (combine with --write-to-file to also write them to a file)",
+	)
+	cmdAssume.Flags().StringVarP(
+		&assumeWriteToFile, "write-to-file", "w", "",
+		"Write credentials to this file instead of the default ($AWS_SHARED_CREDENTIALS_FILE or $HOME/.aws/credentials)",
+	)
+	cmdAssume.Flags().StringVar(
+		&assumeCredentialsSection, "credentials-section", "",
+		"Write credentials to this section of the credentials file instead of a section named after the app",
+	)
+	mandatoryFlag(cmdAssume, "saml-in")
+}
+
+// assumeWithAssertion assumes a role using the base64 encoded SAML assertion data. The role is
+// selected from the assertion as for app, which may be empty. An error is returned without
+// calling STS if the assertion has expired.
+func assumeWithAssertion(data, app string, hc *http.Client) (*aws.Credentials, error) {
+	data = strings.TrimSpace(data)
+
+	notAfter, err := saml.NotOnOrAfter(data)
+	if err != nil {
+		return nil, withCode(codeUsage, fmt.Errorf("reading SAML assertion: %v", err))
+	}
+	if !notAfter.IsZero() && !time.Now().Before(notAfter) {
+		return nil, withCode(codeAuthFailed, fmt.Errorf("the SAML assertion expired at %s; obtain a new one "+
+			"using 'clisso get --saml-out'", notAfter.Local().Format(time.RFC3339)))
+	}
+
+	filter := saml.RoleFilter{ARN: clisso.RoleARN(app, assumeRoleARN)}
+	var provider string
+	if app != "" {
+		filter.Allowed = viper.GetStringSlice(fmt.Sprintf("apps.%s.allowed-roles", app))
+		if providers := clisso.AppProviders(app); len(providers) > 0 {
+			provider = providers[0]
+		}
+	}
+	arn, err := saml.Get(data, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	duration, err := saml.RoleDuration(arn.Role, clisso.SessionDuration(app, provider))
+	if err != nil {
+		return nil, withCode(codeConfig, err)
+	}
+	endpoint, err := config.GetSTSEndpoint(app, "")
+	if err != nil {
+		return nil, withCode(codeConfig, err)
+	}
+	creds, err := aws.AssumeSAMLRole(arn.Provider, arn.Role, data, duration, nil, "", endpoint, hc)
+	if err != nil && err.Error() == aws.ErrDurationExceeded {
+		log.Println(color.YellowString(aws.DurationExceededMessage))
+		creds, err = aws.AssumeSAMLRole(arn.Provider, arn.Role, data, 3600, nil, "", endpoint, hc)
+	}
+	return creds, err
+}
+
+var cmdAssume = &cobra.Command{
+	Use:   "assume [app name]",
+	Short: "Assume a role using a saved SAML assertion",
+	Long: `Assume a role using the SAML assertion in the file given by --saml-in, e.g. one written by
+'clisso get --saml-out', and write the credentials as 'clisso get' does. The identity provider
+isn't contacted. Assertions are only accepted by STS for a few minutes after they were issued, and
+expired assertions are rejected without calling STS.
+
+If an app is specified, the role is selected using the arn and allowed-roles settings of the app
+and the credentials are written to the profile of the app. Otherwise, --credentials-section is
+required unless the credentials are only printed using --shell.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// processCredentials writes the credentials according to the flags of get.
+		printToShell, writeToFile, credentialsSection = assumePrintToShell, assumeWriteToFile, assumeCredentialsSection
+
+		var app string
+		if len(args) > 0 {
+			var err error
+			app, err = checkAppExists(resolveAlias(args[0]), true)
+			if err != nil {
+				fatalf(codeUsage, "%v", err)
+			}
+		}
+		if app == "" && credentialsSection == "" && writesToFile() {
+			fatalf(codeUsage, "Specify an app or --credentials-section to write the credentials to")
+		}
+		if credentialsSection != "" {
+			if err := aws.ValidateSectionName(credentialsSection); err != nil {
+				fatalf(codeUsage, "Invalid credentials section: %v", err)
+			}
+		}
+
+		path, err := homedir.Expand(samlIn)
+		if err != nil {
+			fatalf(codeUsage, "Failed to expand home: %s", err)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			fatalf(codeUsage, "Could not read SAML assertion: %v", err)
+		}
+		hc, err := newHTTPClient("")
+		if err != nil {
+			fatalf(codeConfig, "%v", err)
+		}
+
+		creds, err := assumeWithAssertion(string(data), app, hc)
+		if err != nil {
+			warnClockSkew(err)
+			fatalf(codeOf(err, codeAuthFailed), "Could not assume role: %v", err)
+		}
+
+		if err := processCredentials(creds, app); err != nil {
+			fatalf(codeOutputFailed, "Error processing credentials: %v", err)
+		}
+	},
+}
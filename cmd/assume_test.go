@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/allcloud-io/clisso/internal/testserver"
+	"github.com/spf13/viper"
+)
+
+func TestAssumeWithAssertion(t *testing.T) {
+	sts := testserver.NewSTS()
+	defer sts.Close()
+
+	for _, test := range []struct {
+		name        string
+		validUntil  time.Time
+		role        string
+		expectError string
+	}{
+		{name: "Valid assertion", validUntil: time.Now().Add(5 * time.Minute)},
+		{name: "Valid assertion with role", validUntil: time.Now().Add(5 * time.Minute), role: testserver.RoleARN},
+		{name: "Expired assertion", validUntil: time.Now().Add(-time.Minute), expectError: "the SAML assertion expired"},
+		{name: "Unavailable role", validUntil: time.Now().Add(5 * time.Minute),
+			role: "arn:aws:iam::123456789012:role/Other", expectError: "isn't available"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			viper.Reset()
+			defer viper.Reset()
+			setupTestSTS(t, sts)
+			assumeRoleARN = test.role
+			defer func() { assumeRoleARN = "" }()
+
+			data := testserver.SAMLAssertionValidUntil(testserver.RoleARN, testserver.ProviderARN, test.validUntil)
+			creds, err := assumeWithAssertion(data+"\n", "", nil)
+			if test.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expectError) {
+					t.Fatalf("expected error containing %q, got %v", test.expectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if creds.AccessKeyID != testserver.AccessKeyID {
+				t.Errorf("wrong access key ID: got %q, want %q", creds.AccessKeyID, testserver.AccessKeyID)
+			}
+		})
+	}
+}
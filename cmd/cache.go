@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	RootCmd.AddCommand(cmdCache)
+	cmdCache.AddCommand(cmdCacheList)
+	cmdCache.AddCommand(cmdCacheClear)
+}
+
+var cmdCache = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage cached credentials",
+	Long: `View and clear the credentials cached in the OS keychain by 'clisso get --to-keychain'
+and 'clisso cred-process'.`,
+}
+
+var cmdCacheList = &cobra.Command{
+	Use:   "ls",
+	Short: "List cached credentials",
+	Long:  "List the apps which have cached credentials along with the expiration of the credentials.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := openCache()
+		if err != nil {
+			fatalf(codeConfig, "Error opening cache: %v", err)
+		}
+
+		entries, err := c.List()
+		if err != nil {
+			fatalf(codeError, "Error listing cached credentials: %v", err)
+		}
+
+		if len(entries) == 0 {
+			fmt.Println("No cached credentials")
+			return
+		}
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"App", "Expire At", "Remaining"})
+		for _, e := range entries {
+			remaining := "expired"
+			if !e.Expired() {
+				remaining = time.Until(e.Expiration).Round(time.Second).String()
+			}
+			table.Append([]string{e.App, e.Expiration.Local().Format(time.RFC3339), remaining})
+		}
+		table.Render()
+	},
+}
+
+var cmdCacheClear = &cobra.Command{
+	Use:   "clear [app name]",
+	Short: "Clear cached credentials",
+	Long: `Delete the cached credentials of the specified app. If no app is specified, the cached
+credentials of all apps are deleted.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := openCache()
+		if err != nil {
+			fatalf(codeConfig, "Error opening cache: %v", err)
+		}
+
+		apps := args
+		if len(apps) == 0 {
+			entries, err := c.List()
+			if err != nil {
+				fatalf(codeError, "Error listing cached credentials: %v", err)
+			}
+			for _, e := range entries {
+				apps = append(apps, e.App)
+			}
+		}
+
+		for _, app := range apps {
+			if err := c.Delete(app); err != nil {
+				fatalf(codeError, "Error clearing cached credentials of app '%s': %v", app, err)
+			}
+			log.Printf(color.GreenString("Cleared cached credentials of app '%s'"), app)
+		}
+
+		if len(apps) == 0 {
+			fmt.Println("No cached credentials")
+		}
+	},
+}
@@ -0,0 +1,367 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/allcloud-io/clisso/clisso"
+	"github.com/allcloud-io/clisso/config"
+	"github.com/allcloud-io/clisso/prompt"
+	"github.com/fatih/color"
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var configShowApp string
+var configShowJSON bool
+var configImportFrom string
+var configImportYes bool
+
+func init() {
+	cmdConfigShow.Flags().StringVar(&configShowApp, "app", "",
+		"Only show the configuration used when obtaining credentials for this app")
+	cmdConfigShow.Flags().BoolVar(&configShowJSON, "json", false, "Print the configuration as JSON")
+
+	cmdConfigImport.Flags().StringVar(&configImportFrom, "from", "",
+		"Tool whose config file is imported (supported: saml2aws)")
+	cmdConfigImport.Flags().BoolVarP(&configImportYes, "yes", "y", false,
+		"Write the imported settings without asking for confirmation")
+	mandatoryFlag(cmdConfigImport, "from")
+
+	RootCmd.AddCommand(cmdConfig)
+	cmdConfig.AddCommand(cmdConfigShow)
+	cmdConfig.AddCommand(cmdConfigImport)
+}
+
+// defaultSAML2AWSConfig is the default location of the saml2aws config file.
+const defaultSAML2AWSConfig = "~/.saml2aws"
+
+// redacted replaces the values of secret settings in the output of config show.
+const redacted = "REDACTED"
+
+// secretKeys are the names of settings whose values are redacted by config show.
+var secretKeys = map[string]bool{
+	"client-secret": true,
+	"mfa-code":      true,
+	"password":      true,
+}
+
+// pathKeys are the names of settings which hold paths which are expanded before being used.
+var pathKeys = []string{"password-file", "certificate", "private-key"}
+
+// effectiveConfig returns the configuration as it is used when obtaining credentials, with
+// defaults filled in, paths expanded and secrets redacted. If app isn't empty, only the settings
+// of app and its providers are included.
+func effectiveConfig(app string) (map[string]interface{}, error) {
+	settings := viper.AllSettings()
+
+	global := subMap(settings, "global")
+	path, err := credentialsPath("", "")
+	if err != nil {
+		return nil, fmt.Errorf("expanding credentials path: %v", err)
+	}
+	global["credentials-path"] = path
+	timeout, err := config.GetHTTPTimeout("")
+	if err != nil {
+		return nil, err
+	}
+	global["http-timeout"] = timeout.String()
+	if dir := viper.GetString("global.cache-dir"); dir != "" {
+		if global["cache-dir"], err = homedir.Expand(dir); err != nil {
+			return nil, fmt.Errorf("expanding cache directory: %v", err)
+		}
+	}
+
+	providers := subMap(settings, "providers")
+	apps := subMap(settings, "apps")
+	if app != "" {
+		if _, ok := apps[app]; !ok {
+			return nil, fmt.Errorf("app '%s' doesn't exist", app)
+		}
+		apps = map[string]interface{}{app: apps[app]}
+
+		used := make(map[string]interface{})
+		for _, p := range clisso.AppProviders(app) {
+			if v, ok := providers[p]; ok {
+				used[p] = v
+			}
+		}
+		providers = used
+		settings = map[string]interface{}{"global": global}
+	}
+	settings["providers"] = providers
+	settings["apps"] = apps
+
+	for p := range providers {
+		if err := resolveProviderConfig(p, subMap(providers, p)); err != nil {
+			return nil, fmt.Errorf("provider '%s': %v", p, err)
+		}
+	}
+
+	for a := range apps {
+		if err := resolveAppConfig(a, subMap(apps, a)); err != nil {
+			return nil, fmt.Errorf("app '%s': %v", a, err)
+		}
+	}
+
+	redactSecrets(settings)
+
+	return settings, nil
+}
+
+// resolveProviderConfig fills in the defaults of the settings s of provider p and expands its
+// paths.
+func resolveProviderConfig(p string, s map[string]interface{}) error {
+	timeout, err := config.GetHTTPTimeout(p)
+	if err != nil {
+		return err
+	}
+	s["http-timeout"] = timeout.String()
+
+	switch viper.GetString(fmt.Sprintf("providers.%s.type", p)) {
+	case "okta":
+		if viper.GetString(fmt.Sprintf("providers.%s.auth-type", p)) == "" {
+			s["auth-type"] = config.OktaAuthTypePassword
+		}
+		fallthrough
+	case "onelogin", "jumpcloud":
+		interval, attempts, err := config.GetMFAPolling(p)
+		if err != nil {
+			return err
+		}
+		s["mfa-poll-interval"] = interval.String()
+		s["mfa-poll-attempts"] = attempts
+	}
+
+	for _, k := range pathKeys {
+		v, ok := s[k].(string)
+		if !ok || v == "" {
+			continue
+		}
+		if s[k], err = homedir.Expand(v); err != nil {
+			return fmt.Errorf("expanding %s: %v", k, err)
+		}
+	}
+
+	return nil
+}
+
+// resolveAppConfig fills in the settings s of app which are derived from other settings.
+func resolveAppConfig(app string, s map[string]interface{}) error {
+	if providers := clisso.AppProviders(app); len(providers) > 0 {
+		s["duration"] = clisso.SessionDuration(app, providers[0])
+	}
+
+	path, err := credentialsPath("", app)
+	if err != nil {
+		return fmt.Errorf("expanding credentials path: %v", err)
+	}
+	s["credentials-path"] = path
+
+	name, err := config.GetSessionName(app, "")
+	if err != nil {
+		return err
+	}
+	if name != "" {
+		s["session-name"] = name
+	}
+
+	return nil
+}
+
+// subMap returns the map stored under key in m, creating it if it doesn't exist.
+func subMap(m map[string]interface{}, key string) map[string]interface{} {
+	sub, ok := m[key].(map[string]interface{})
+	if !ok {
+		sub = make(map[string]interface{})
+		m[key] = sub
+	}
+	return sub
+}
+
+// redactSecrets replaces the values of secret settings in m and its nested maps.
+func redactSecrets(m map[string]interface{}) {
+	for k, v := range m {
+		if sub, ok := v.(map[string]interface{}); ok {
+			redactSecrets(sub)
+			continue
+		}
+		if secretKeys[k] && fmt.Sprint(v) != "" {
+			m[k] = redacted
+		}
+	}
+}
+
+// writeConfigText writes the settings in m to w as sorted key: value lines using dotted keys.
+func writeConfigText(w io.Writer, m map[string]interface{}) error {
+	lines := flattenConfig("", m, nil)
+	sort.Strings(lines)
+	_, err := fmt.Fprintln(w, strings.Join(lines, "\n"))
+	return err
+}
+
+func flattenConfig(prefix string, m map[string]interface{}, lines []string) []string {
+	for k, v := range m {
+		if sub, ok := v.(map[string]interface{}); ok {
+			lines = flattenConfig(prefix+k+".", sub, lines)
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s%s: %v", prefix, k, v))
+	}
+	return lines
+}
+
+// filterImport removes the providers and apps of imp which already exist in the config, as well as
+// the apps whose provider is removed, and returns warnings describing what was removed.
+func filterImport(imp *config.SAML2AWSImport) []string {
+	var warnings []string
+	for name := range imp.Providers {
+		if viper.Get("providers."+name) != nil {
+			delete(imp.Providers, name)
+			warnings = append(warnings, fmt.Sprintf("provider '%s' already exists and wasn't imported", name))
+		}
+	}
+	for name, a := range imp.Apps {
+		if viper.Get("apps."+name) != nil {
+			delete(imp.Apps, name)
+			warnings = append(warnings, fmt.Sprintf("app '%s' already exists and wasn't imported", name))
+		} else if _, ok := imp.Providers[fmt.Sprint(a["provider"])]; !ok {
+			delete(imp.Apps, name)
+			warnings = append(warnings, fmt.Sprintf("app '%s' wasn't imported since its provider wasn't", name))
+		}
+	}
+	sort.Strings(warnings)
+
+	return warnings
+}
+
+// importSettings returns the providers and apps of imp as config settings.
+func importSettings(imp *config.SAML2AWSImport) map[string]interface{} {
+	settings := map[string]interface{}{}
+	for name, p := range imp.Providers {
+		sub := subMap(subMap(settings, "providers"), name)
+		for k, v := range p {
+			sub[k] = v
+		}
+	}
+	for name, a := range imp.Apps {
+		sub := subMap(subMap(settings, "apps"), name)
+		for k, v := range a {
+			sub[k] = v
+		}
+	}
+	return settings
+}
+
+var cmdConfig = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the configuration",
+	Long:  "Inspect the configuration used by Clisso.",
+}
+
+var cmdConfigShow = &cobra.Command{
+	Use:   "show",
+	Short: "Show the effective configuration",
+	Long: `Print the configuration as it is used when obtaining credentials, including defaults and
+expanded paths. Secrets are redacted. If --app is specified, only the settings of the app and its
+providers are printed.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		app := configShowApp
+		if app != "" {
+			app = resolveAlias(app)
+		}
+
+		settings, err := effectiveConfig(app)
+		if err != nil {
+			fatalf(codeConfig, "Error resolving configuration: %v", err)
+		}
+
+		if configShowJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(settings)
+		} else {
+			err = writeConfigText(os.Stdout, settings)
+		}
+		if err != nil {
+			fatalf(codeOutputFailed, "Error printing configuration: %v", err)
+		}
+	},
+}
+
+var cmdConfigImport = &cobra.Command{
+	Use:   "import [path]",
+	Short: "Import providers and apps from another tool",
+	Long: `Translate the config file of another tool to Clisso providers and apps and add them to the
+config file. Only saml2aws is supported, whose config file is read from ~/.saml2aws unless a path
+is specified. Each saml2aws account becomes an app of the same name. Settings which can't be
+translated are reported as warnings, and providers and apps which already exist aren't changed.
+
+The settings to add are printed and written after confirmation, unless --yes is specified.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if configImportFrom != "saml2aws" {
+			fatalf(codeUsage, "Unsupported source '%s'. Supported sources: saml2aws", configImportFrom)
+		}
+
+		path := defaultSAML2AWSConfig
+		if len(args) > 0 {
+			path = args[0]
+		}
+		path, err := homedir.Expand(path)
+		if err != nil {
+			fatalf(codeConfig, "Failed to expand home: %s", err)
+		}
+
+		imp, err := config.ParseSAML2AWS(path)
+		if err != nil {
+			fatalf(codeConfig, "%v", err)
+		}
+		for _, w := range append(imp.Warnings, filterImport(imp)...) {
+			log.Println(color.YellowString("Warning: %s", w))
+		}
+		if len(imp.Apps) == 0 {
+			log.Println("Nothing to import")
+			return
+		}
+
+		preview := importSettings(imp)
+		redactSecrets(preview)
+		log.Printf("The following settings will be added to %s:", viper.ConfigFileUsed())
+		if err := writeConfigText(os.Stdout, preview); err != nil {
+			fatalf(codeOutputFailed, "Error printing settings: %v", err)
+		}
+
+		if !configImportYes {
+			answer, err := prompt.Line("Write these settings? [y/N]: ", "use --yes to write them without confirmation")
+			if errors.Is(err, prompt.ErrNonInteractive) {
+				fatalf(codeUsage, "%v", err)
+			}
+			if a := strings.ToLower(answer); a != "y" && a != "yes" {
+				log.Println("Import cancelled")
+				return
+			}
+		}
+
+		err = updateConfigFile(func(v *viper.Viper) {
+			for name, p := range imp.Providers {
+				v.Set("providers."+name, p)
+			}
+			for name, a := range imp.Apps {
+				v.Set("apps."+name, a)
+			}
+		})
+		if err != nil {
+			fatalf(codeConfig, "Error writing config: %v", err)
+		}
+		log.Printf(color.GreenString("Imported %d providers and %d apps"), len(imp.Providers), len(imp.Apps))
+	},
+}
@@ -0,0 +1,223 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/allcloud-io/clisso/config"
+	"github.com/allcloud-io/clisso/prompt"
+	"github.com/spf13/viper"
+)
+
+func TestEffectiveConfig(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+
+	viper.Set("global.credentials-path", "/tmp/credentials")
+	viper.Set("providers.onelogin-dev.type", "onelogin")
+	viper.Set("providers.onelogin-dev.client-secret", "topsecret")
+	viper.Set("providers.onelogin-dev.duration", 7200)
+	viper.Set("providers.okta-prod.type", "okta")
+	viper.Set("providers.okta-prod.http-timeout", "1m")
+	viper.Set("apps.dev.provider", "onelogin-dev")
+	viper.Set("apps.prod.provider", "okta-prod")
+	viper.Set("apps.prod.credentials-path", "/tmp/prod-credentials")
+
+	settings, err := effectiveConfig("")
+	if err != nil {
+		t.Fatalf("unexpected error %+v", err)
+	}
+
+	var b bytes.Buffer
+	if err := writeConfigText(&b, settings); err != nil {
+		t.Fatalf("unexpected error %+v", err)
+	}
+	got := b.String()
+	for _, want := range []string{
+		"global.credentials-path: /tmp/credentials\n",
+		"global.http-timeout: 30s\n",
+		"providers.onelogin-dev.client-secret: " + redacted + "\n",
+		"providers.onelogin-dev.mfa-poll-attempts: 30\n",
+		"providers.okta-prod.auth-type: password\n",
+		"providers.okta-prod.http-timeout: 1m0s\n",
+		"apps.dev.duration: 7200\n",
+		"apps.dev.credentials-path: /tmp/credentials\n",
+		"apps.prod.credentials-path: /tmp/prod-credentials\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output doesn't contain %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "topsecret") {
+		t.Errorf("secret wasn't redacted:\n%s", got)
+	}
+
+	settings, err = effectiveConfig("prod")
+	if err != nil {
+		t.Fatalf("unexpected error %+v", err)
+	}
+	if apps := settings["apps"].(map[string]interface{}); len(apps) != 1 || apps["prod"] == nil {
+		t.Errorf("wrong apps for --app: %v", apps)
+	}
+	if providers := settings["providers"].(map[string]interface{}); len(providers) != 1 ||
+		providers["okta-prod"] == nil {
+		t.Errorf("wrong providers for --app: %v", providers)
+	}
+
+	if _, err := effectiveConfig("missing"); err == nil {
+		t.Error("expected an error for a missing app")
+	}
+}
+
+func TestFilterImport(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	viper.Set("providers.existing.type", "okta")
+	viper.Set("apps.dev.provider", "existing")
+
+	imp := &config.SAML2AWSImport{
+		Providers: map[string]map[string]interface{}{
+			"existing": {"type": "okta"},
+			"new":      {"type": "okta"},
+		},
+		Apps: map[string]map[string]interface{}{
+			"dev":     {"provider": "new"},
+			"prod":    {"provider": "new"},
+			"staging": {"provider": "existing"},
+		},
+	}
+
+	warnings := filterImport(imp)
+	if len(warnings) != 3 {
+		t.Errorf("wrong number of warnings: got %v", warnings)
+	}
+	if _, ok := imp.Providers["new"]; !ok || len(imp.Providers) != 1 {
+		t.Errorf("wrong providers: %v", imp.Providers)
+	}
+	if _, ok := imp.Apps["prod"]; !ok || len(imp.Apps) != 1 {
+		t.Errorf("wrong apps: %v", imp.Apps)
+	}
+}
+
+// answeringPrompter answers every line prompt with answer.
+type answeringPrompter struct {
+	prompt.Terminal
+	answer string
+}
+
+func (p answeringPrompter) Line(msg, hint string) (string, error) {
+	return p.answer, nil
+}
+
+func TestEditConfig(t *testing.T) {
+	const valid = "providers:\n  okta:\n    type: okta\n    base-url: https://example.okta.com\n"
+	const invalid = "providers:\n  okta:\n    type: unknown\n"
+	const edited = valid + "apps:\n  my-app:\n    provider: okta\n" +
+		"    url: https://example.okta.com/home/amazon_aws/abc/272\n"
+
+	for _, test := range []struct {
+		name         string
+		edits        []string
+		retry        string
+		expectConfig string
+		expectError  bool
+	}{
+		{name: "Valid", edits: []string{edited}, expectConfig: edited},
+		{name: "Unchanged", edits: []string{valid}, expectConfig: valid},
+		{name: "Invalid", edits: []string{invalid}, retry: "n", expectConfig: valid, expectError: true},
+		{name: "Fixed after retry", edits: []string{invalid, edited}, retry: "y", expectConfig: edited},
+		{name: "Invalid syntax", edits: []string{"providers: ["}, retry: "n", expectConfig: valid,
+			expectError: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			viper.Reset()
+			defer viper.Reset()
+
+			path := filepath.Join(t.TempDir(), "clisso.yaml")
+			if err := ioutil.WriteFile(path, []byte(valid), 0600); err != nil {
+				t.Fatal(err)
+			}
+			viper.SetConfigFile(path)
+			if err := readConfig(); err != nil {
+				t.Fatal(err)
+			}
+
+			edits := test.edits
+			orig := runEditor
+			runEditor = func(editor, p string) error {
+				if len(edits) == 0 {
+					t.Fatal("editor opened too often")
+				}
+				err := ioutil.WriteFile(p, []byte(edits[0]), 0600)
+				edits = edits[1:]
+				return err
+			}
+			defer func() { runEditor = orig }()
+			prompt.SetPrompter(answeringPrompter{answer: test.retry})
+			defer prompt.SetPrompter(nil)
+
+			changed, err := editConfig(path, "vi")
+			if test.expectError != (err != nil) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if expectChanged := test.expectConfig != valid; changed != expectChanged {
+				t.Errorf("wrong changed: got %t, want %t", changed, expectChanged)
+			}
+
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != test.expectConfig {
+				t.Errorf("wrong config file:\n%s\nwant:\n%s", b, test.expectConfig)
+			}
+			if changed {
+				if b, _ := ioutil.ReadFile(path + ".bak"); string(b) != valid {
+					t.Errorf("wrong backup:\n%s", b)
+				}
+			}
+			if got := viper.GetString("providers.okta.type"); got != "okta" {
+				t.Errorf("config wasn't read again: got type %q", got)
+			}
+
+			// Only the copy of an invalid config is kept.
+			matches, _ := filepath.Glob(filepath.Join(filepath.Dir(path), ".clisso.yaml.edit-*"))
+			if expectCopies := map[bool]int{true: 1, false: 0}[test.expectError]; len(matches) != expectCopies {
+				t.Errorf("wrong number of copies: got %v", matches)
+			}
+		})
+	}
+}
+
+func TestEditor(t *testing.T) {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		v, ok := os.LookupEnv(env)
+		defer func(env string) {
+			if ok {
+				os.Setenv(env, v)
+			} else {
+				os.Unsetenv(env)
+			}
+		}(env)
+	}
+
+	os.Unsetenv("VISUAL")
+	os.Unsetenv("EDITOR")
+	if _, err := editor(); err == nil {
+		t.Error("expected error without an editor")
+	}
+
+	os.Setenv("EDITOR", "vi")
+	if e, _ := editor(); e != "vi" {
+		t.Errorf("wrong editor: got %q, want vi", e)
+	}
+
+	os.Setenv("VISUAL", "code --wait")
+	if e, _ := editor(); e != "code --wait" {
+		t.Errorf("wrong editor: got %q, want code --wait", e)
+	}
+}
@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/allcloud-io/clisso/prompt"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	cmdConfig.AddCommand(cmdConfigEdit)
+}
+
+// editor returns the editor command configured in $VISUAL or $EDITOR.
+func editor() (string, error) {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if e := strings.TrimSpace(os.Getenv(env)); e != "" {
+			return e, nil
+		}
+	}
+	return "", errors.New("no editor configured - set $EDITOR or $VISUAL, e.g. export EDITOR=vim")
+}
+
+// runEditor opens the file at path using the editor command editor, which may include arguments,
+// and waits for it to exit. It is a variable to allow replacing the editor in tests.
+var runEditor = func(editor, path string) error {
+	args := strings.Fields(editor)
+	c := exec.Command(args[0], append(args[1:], path)...)
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	return c.Run()
+}
+
+// validateConfigFile returns the problems of the config file at path when it is used instead of
+// the config file at original, together with the partial config files of original. The config
+// file at original is read again afterwards.
+func validateConfigFile(path, original string) (errs []error) {
+	defer func() {
+		viper.SetConfigFile(original)
+		if err := readConfig(); err != nil {
+			errs = append(errs, fmt.Errorf("reading %s: %v", original, err))
+		}
+	}()
+
+	viper.SetConfigFile(path)
+	if err := viper.ReadInConfig(); err != nil {
+		return []error{err}
+	}
+	if err := mergeConfigDir(configDir(original)); err != nil {
+		return []error{err}
+	}
+	return validateConfig()
+}
+
+// editConfig lets the user edit a copy of the config file at path using editor. If the edited
+// config is valid, it replaces the config file and the previous config file is kept as a backup
+// named path.bak. Otherwise the problems are printed and the user may edit the copy again. If the
+// user doesn't, the config file is left untouched and an error naming the copy is returned. It
+// returns false if the config file wasn't changed.
+func editConfig(path, editor string) (bool, error) {
+	orig, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("reading config file: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+
+	// The copy is created next to the config file so that it can replace it atomically, and
+	// keeps its extension so that the format is detected.
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+strings.TrimPrefix(filepath.Base(path), ".")+".edit-*"+filepath.Ext(path))
+	if err != nil {
+		return false, fmt.Errorf("creating copy of config file: %v", err)
+	}
+	tmp := f.Name()
+	_, err = f.Write(orig)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return false, fmt.Errorf("writing copy of config file: %v", err)
+	}
+
+	for {
+		if err := runEditor(editor, tmp); err != nil {
+			return false, fmt.Errorf("running editor '%s': %v; your changes were kept in %s", editor, err, tmp)
+		}
+
+		edited, err := ioutil.ReadFile(tmp)
+		if err != nil {
+			return false, fmt.Errorf("reading edited config: %v", err)
+		}
+		if bytes.Equal(edited, orig) {
+			os.Remove(tmp)
+			return false, nil
+		}
+
+		errs := validateConfigFile(tmp, path)
+		if len(errs) == 0 {
+			break
+		}
+
+		log.Println(color.RedString("The edited config is invalid:"))
+		for _, err := range errs {
+			log.Println(color.RedString("  %v", err))
+		}
+		answer, err := prompt.Line("Edit again? [y/N]: ", "fix the config manually")
+		if a := strings.ToLower(answer); err != nil || a != "y" && a != "yes" {
+			return false, fmt.Errorf("the edited config is invalid and %s wasn't changed; your changes were "+
+				"kept in %s", path, tmp)
+		}
+	}
+
+	if err := ioutil.WriteFile(path+".bak", orig, 0600); err != nil {
+		return false, fmt.Errorf("backing up config file: %v; your changes were kept in %s", err, tmp)
+	}
+	if err := os.Chmod(tmp, info.Mode().Perm()); err != nil {
+		return false, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return false, fmt.Errorf("replacing config file: %v; your changes were kept in %s", err, tmp)
+	}
+
+	// Use the new config from now on.
+	return true, readConfig()
+}
+
+var cmdConfigEdit = &cobra.Command{
+	Use:   "edit",
+	Short: "Edit the config file",
+	Long: `Open the config file in the editor set in $VISUAL or $EDITOR. A copy of the config file is
+edited, and it only replaces the config file if it is valid. The previous config file is kept next
+to it with a .bak suffix. If the edited config is invalid, the problems are printed and the copy
+can be edited again; otherwise the config file is left untouched.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		e, err := editor()
+		if err != nil {
+			fatalf(codeUsage, "%v", err)
+		}
+
+		path := viper.ConfigFileUsed()
+		changed, err := editConfig(path, e)
+		if err != nil {
+			fatalf(codeConfig, "%v", err)
+		}
+		if !changed {
+			log.Println("No changes made")
+			return
+		}
+		log.Printf(color.GreenString("Saved %s; the previous version was kept in %s.bak"), path, path)
+	},
+}
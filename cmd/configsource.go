@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/allcloud-io/clisso/aws"
+	"github.com/allcloud-io/clisso/cache"
+	"github.com/fatih/color"
+	"github.com/spf13/viper"
+)
+
+// maxConfigSize is the maximum size of a config fetched from global.config-source.
+const maxConfigSize = 1 << 20
+
+// configSourceCacheName is the prefix of the names of the files in the cache directory configs
+// fetched from global.config-source are cached in.
+const configSourceCacheName = "config-source"
+
+// configSourceTTL is how long a config fetched from global.config-source is used without
+// fetching it again. Commands such as cred-process run whenever an AWS SDK needs credentials, so
+// fetching the config every time would slow them down and load the source.
+const configSourceTTL = 5 * time.Minute
+
+// configFetchers map the schemes of global.config-source to functions which fetch the config
+// identified by ref using hc. For https, ref is the whole URL.
+var configFetchers = map[string]func(ref string, hc *http.Client) ([]byte, error){
+	"https": fetchConfigHTTPS,
+	"ssm": func(ref string, hc *http.Client) ([]byte, error) {
+		v, err := aws.Parameter(ref, hc)
+		return []byte(v), err
+	},
+	"secretsmanager": func(ref string, hc *http.Client) ([]byte, error) {
+		v, err := aws.Secret(ref, hc)
+		return []byte(v), err
+	},
+}
+
+// parseConfigSource splits the value of global.config-source into its scheme and the reference
+// passed to the fetcher of the scheme, e.g. "ssm" and "/clisso/config" for "ssm:/clisso/config".
+func parseConfigSource(src string) (string, string, error) {
+	i := strings.Index(src, ":")
+	if i <= 0 {
+		return "", "", fmt.Errorf("invalid global.config-source '%s': must be an HTTPS URL, "+
+			"ssm:<parameter> or secretsmanager:<secret>", src)
+	}
+	scheme, ref := src[:i], src[i+1:]
+	if _, ok := configFetchers[scheme]; !ok {
+		return "", "", fmt.Errorf("invalid global.config-source '%s': unsupported scheme '%s'", src, scheme)
+	}
+	if scheme == "https" {
+		ref = src
+	}
+	if ref == "" {
+		return "", "", fmt.Errorf("invalid global.config-source '%s': missing %s name", src, scheme)
+	}
+	return scheme, ref, nil
+}
+
+// configSourceType returns the format of the config referenced by ref, which is given by its
+// extension. Configs without a supported extension are assumed to be YAML, which also covers JSON.
+func configSourceType(ref string) string {
+	if u, err := url.Parse(ref); err == nil && u.Path != "" {
+		ref = u.Path
+	}
+	if ext := strings.TrimPrefix(path.Ext(ref), "."); stringInSlice(ext, configExts) {
+		return ext
+	}
+	return "yaml"
+}
+
+// fetchConfigHTTPS fetches the config at the HTTPS URL u using hc.
+func fetchConfigHTTPS(u string, hc *http.Client) ([]byte, error) {
+	resp, err := hc.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server responded with HTTP %d", resp.StatusCode)
+	}
+
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxConfigSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %v", err)
+	}
+	if len(b) > maxConfigSize {
+		return nil, fmt.Errorf("config is larger than %d bytes", maxConfigSize)
+	}
+	return b, nil
+}
+
+// parseFetchedConfig parses the config b of the given type, returning an error if b isn't a
+// valid config or is empty.
+func parseFetchedConfig(b []byte, configType string) (map[string]interface{}, error) {
+	v := viper.New()
+	v.SetConfigType(configType)
+	if err := v.ReadConfig(bytes.NewReader(b)); err != nil {
+		return nil, err
+	}
+	settings := v.AllSettings()
+	if len(settings) == 0 {
+		return nil, errors.New("config is empty")
+	}
+	return settings, nil
+}
+
+// loadConfigSource fetches the config from src using hc, caches it in dir and returns its
+// settings. A config cached less than ttl ago is returned without fetching it. If the config can't
+// be fetched or is invalid, a warning is printed and the config cached by a previous invocation is
+// returned instead. If there is none either, an error is returned.
+func loadConfigSource(src, dir string, ttl time.Duration, hc *http.Client) (map[string]interface{}, error) {
+	scheme, ref, err := parseConfigSource(src)
+	if err != nil {
+		return nil, err
+	}
+	configType := configSourceType(ref)
+	// The cache is specific to src, so that a config cached for a previous source isn't used.
+	cached := filepath.Join(dir, fmt.Sprintf("%s-%x.%s", configSourceCacheName,
+		sha256.Sum256([]byte(src)), configType))
+
+	if info, err := os.Stat(cached); err == nil && time.Since(info.ModTime()) < ttl {
+		if b, err := ioutil.ReadFile(cached); err == nil {
+			if settings, err := parseFetchedConfig(b, configType); err == nil {
+				return settings, nil
+			}
+		}
+	}
+
+	b, err := configFetchers[scheme](ref, hc)
+	var settings map[string]interface{}
+	if err == nil {
+		settings, err = parseFetchedConfig(b, configType)
+	}
+	if err == nil {
+		if err := writeCachedConfig(cached, b); err != nil {
+			log.Printf(color.YellowString("Could not cache config fetched from '%s': %v"), src, err)
+		}
+		return settings, nil
+	}
+
+	log.Printf(color.YellowString("Could not load config from '%s': %v"), src, err)
+	info, statErr := os.Stat(cached)
+	if statErr != nil {
+		return nil, errors.New("no cached config available")
+	}
+	b, err = ioutil.ReadFile(cached)
+	if err != nil {
+		return nil, fmt.Errorf("reading cached config: %v", err)
+	}
+	settings, err = parseFetchedConfig(b, configType)
+	if err != nil {
+		return nil, fmt.Errorf("parsing cached config: %v", err)
+	}
+	log.Printf(color.YellowString("Using the config cached at %s"), info.ModTime().Format(time.RFC3339))
+	return settings, nil
+}
+
+// writeCachedConfig writes the fetched config b to path. Configs may contain e.g. OneLogin client
+// secrets, so the file is only accessible by the current user.
+func writeCachedConfig(path string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		return err
+	}
+	// WriteFile doesn't change the permissions of existing files.
+	return os.Chmod(path, 0600)
+}
+
+// mergeConfigSource merges the config fetched from global.config-source, if it is set, on top of
+// the config read so far. If neither the config nor a cached copy of it can be loaded, e.g.
+// because global.config-source is invalid, a warning is printed and the local config is used on
+// its own, so that the local config can still be fixed. The merged settings are never written to
+// the config file by updateConfigFile, so that secrets in the shared config stay off disk and
+// settings removed from it don't live on locally.
+func mergeConfigSource() error {
+	src := viper.GetString("global.config-source")
+	if src == "" {
+		return nil
+	}
+
+	dir, err := cache.DefaultDir()
+	var hc *http.Client
+	if err == nil {
+		hc, err = newHTTPClient("")
+	}
+	var settings map[string]interface{}
+	if err == nil {
+		settings, err = loadConfigSource(src, dir, configSourceTTL, hc)
+	}
+	if err != nil {
+		log.Printf(color.YellowString("Using only the local config: %v"), err)
+		return nil
+	}
+	return viper.MergeConfigMap(settings)
+}
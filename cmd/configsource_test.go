@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestParseConfigSource(t *testing.T) {
+	for _, test := range []struct {
+		src         string
+		expectType  string
+		expectRef   string
+		expectError bool
+	}{
+		{"https://example.com/clisso.yaml", "https", "https://example.com/clisso.yaml", false},
+		{"ssm:/clisso/config", "ssm", "/clisso/config", false},
+		{"secretsmanager:arn:aws:secretsmanager:eu-west-1:123456789012:secret:clisso", "secretsmanager",
+			"arn:aws:secretsmanager:eu-west-1:123456789012:secret:clisso", false},
+		{"http://example.com/clisso.yaml", "", "", true},
+		{"ssm:", "", "", true},
+		{"/etc/clisso.yaml", "", "", true},
+	} {
+		t.Run(test.src, func(t *testing.T) {
+			scheme, ref, err := parseConfigSource(test.src)
+			if test.expectError {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %+v", err)
+			}
+			if scheme != test.expectType || ref != test.expectRef {
+				t.Errorf("wrong source: got %s and %s, want %s and %s", scheme, ref, test.expectType,
+					test.expectRef)
+			}
+		})
+	}
+}
+
+func TestConfigSourceType(t *testing.T) {
+	for ref, expect := range map[string]string{
+		"https://example.com/clisso.json?version=2": "json",
+		"https://example.com/clisso.toml":           "toml",
+		"https://example.com/config":                "yaml",
+		"/clisso/config":                            "yaml",
+	} {
+		if got := configSourceType(ref); got != expect {
+			t.Errorf("wrong type of %s: got %s, want %s", ref, got, expect)
+		}
+	}
+}
+
+func TestLoadConfigSource(t *testing.T) {
+	config := "providers:\n  central:\n    type: okta\n"
+	status := http.StatusOK
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		fmt.Fprint(w, config)
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+	src := srv.URL + "/clisso.yaml"
+
+	for _, test := range []struct {
+		name        string
+		status      int
+		config      string
+		expectType  string
+		expectError bool
+	}{
+		{"Fetched", http.StatusOK, config, "okta", false},
+		{"Updated", http.StatusOK, "providers:\n  central:\n    type: onelogin\n", "onelogin", false},
+		{"Fetch failure uses cache", http.StatusInternalServerError, "", "onelogin", false},
+		{"Invalid config uses cache", http.StatusOK, "providers: [", "onelogin", false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			status, config = test.status, test.config
+
+			settings, err := loadConfigSource(src, dir, 0, srv.Client())
+			if err != nil {
+				t.Fatalf("unexpected error %+v", err)
+			}
+			p := settings["providers"].(map[string]interface{})["central"].(map[string]interface{})
+			if p["type"] != test.expectType {
+				t.Errorf("wrong provider type: got %v, want %s", p["type"], test.expectType)
+			}
+		})
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dir, configSourceCacheName+"-*.yaml"))
+	if err != nil || len(matches) != 1 {
+		t.Fatalf("expected one cached config, got %v (%v)", matches, err)
+	}
+	info, err := os.Stat(matches[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("wrong permissions of cached config: got %o, want 600", perm)
+	}
+
+	// A recently cached config is used without fetching it.
+	status, config = http.StatusOK, "providers:\n  central:\n    type: jumpcloud\n"
+	settings, err := loadConfigSource(src, dir, time.Hour, srv.Client())
+	if err != nil {
+		t.Fatalf("unexpected error %+v", err)
+	}
+	p := settings["providers"].(map[string]interface{})["central"].(map[string]interface{})
+	if p["type"] != "onelogin" {
+		t.Errorf("expected the cached config within the TTL, got provider type %v", p["type"])
+	}
+
+	status = http.StatusNotFound
+	if _, err := loadConfigSource(srv.URL+"/other.yaml", dir, 0, srv.Client()); err == nil {
+		t.Error("expected an error without a cached config")
+	}
+}
+
+// TestConfigSourceNotWritten verifies that settings fetched from global.config-source aren't
+// written to the config file.
+func TestConfigSourceNotWritten(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "providers:\n  shared:\n    type: onelogin\n    client-secret: TOPSECRET\n")
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "clisso.yaml")
+	if err := ioutil.WriteFile(path, []byte("global:\n  config-source: "+srv.URL+"/clisso.yaml\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	viper.SetConfigFile(path)
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+	settings, err := loadConfigSource(viper.GetString("global.config-source"), t.TempDir(), 0, srv.Client())
+	if err != nil {
+		t.Fatalf("unexpected error %+v", err)
+	}
+	if err := viper.MergeConfigMap(settings); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := updateConfigFile(func(v *viper.Viper) { v.Set("global.selected-app", "app") }); err != nil {
+		t.Fatalf("unexpected error %+v", err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "TOPSECRET") || strings.Contains(string(b), "shared") {
+		t.Errorf("fetched settings were written to the config file:\n%s", b)
+	}
+}
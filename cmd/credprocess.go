@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/allcloud-io/clisso/aws"
+	"github.com/allcloud-io/clisso/cache"
+	"github.com/allcloud-io/clisso/config"
+	"github.com/fatih/color"
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Output formats of cred-process.
+const (
+	formatCredentialProcess = "credential-process"
+	formatExecCredential    = "exec-credential"
+)
+
+var (
+	credProcessFormat string
+	eksCluster        string
+)
+
+func init() {
+	RootCmd.AddCommand(cmdCredProcess)
+	cmdCredProcess.Flags().StringVar(
+		&credProcessFormat, "format", formatCredentialProcess,
+		"Output format: credential-process, or exec-credential for use as a kubectl credential plugin",
+	)
+	cmdCredProcess.Flags().StringVar(
+		&eksCluster, "cluster", "",
+		"Name of the EKS cluster to print a token for (required with --format exec-credential)",
+	)
+}
+
+// execCredentialAPIVersion returns the version of the ExecCredential API requested by kubectl in
+// the KUBERNETES_EXEC_INFO environment variable, or the default version if none was requested.
+func execCredentialAPIVersion() (string, error) {
+	info := os.Getenv("KUBERNETES_EXEC_INFO")
+	if info == "" {
+		return aws.DefaultExecCredentialAPIVersion, nil
+	}
+
+	var v struct {
+		APIVersion string `json:"apiVersion"`
+	}
+	if err := json.Unmarshal([]byte(info), &v); err != nil {
+		return "", fmt.Errorf("parsing KUBERNETES_EXEC_INFO: %v", err)
+	}
+	if v.APIVersion == "" {
+		return aws.DefaultExecCredentialAPIVersion, nil
+	}
+	return v.APIVersion, nil
+}
+
+// openCache returns the credentials cache. Its index is stored in global.cache-dir, or in the
+// default cache directory if global.cache-dir isn't set. Credentials are considered expired within
+// global.expiry-buffer of their expiration.
+func openCache() (*cache.Cache, error) {
+	buffer, err := config.GetExpiryBuffer()
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := homedir.Expand(viper.GetString("global.cache-dir"))
+	if err != nil {
+		return nil, err
+	}
+	if dir == "" {
+		dir, err = cache.DefaultDir()
+		if err != nil {
+			return nil, err
+		}
+	}
+	c := cache.New(dir)
+	c.ExpiryBuffer = buffer
+	return c, nil
+}
+
+// storeInCache stores the given credentials for app in the credentials cache.
+func storeInCache(creds *aws.Credentials, app string) error {
+	c, err := openCache()
+	if err != nil {
+		return err
+	}
+	return c.Store(app, creds)
+}
+
+// loadFromCache returns the usable credentials stored for app in the credentials cache, or nil if
+// no such credentials exist.
+func loadFromCache(app string) (*aws.Credentials, error) {
+	c, err := openCache()
+	if err != nil {
+		return nil, err
+	}
+	return c.Load(app)
+}
+
+// credProcessCredentials returns the non-expired credentials cached for app, or obtains new
+// credentials and caches them if there are none. The AWS CLI and SDKs may run many credential
+// processes at once, so the cache of app is locked meanwhile. Concurrent invocations therefore wait
+// for a single authentication and use the credentials it cached.
+func credProcessCredentials(cmd *cobra.Command, app string) (*aws.Credentials, error) {
+	c, err := openCache()
+	if err != nil {
+		// Not fatal - we can still get fresh credentials.
+		log.Printf(color.YellowString("Could not open credentials cache: %v"), err)
+		return getCredentials(cmd, app, config.Overrides{})
+	}
+
+	unlock, err := c.Lock(app)
+	if err != nil {
+		log.Printf(color.YellowString("Could not lock credentials cache: %v"), err)
+	} else {
+		defer unlock()
+	}
+
+	creds, err := c.Load(app)
+	if err != nil {
+		// Not fatal - we can still get fresh credentials.
+		log.Printf(color.YellowString("Could not read credentials from keychain: %v"), err)
+	}
+	if creds != nil {
+		return creds, nil
+	}
+
+	creds, err = getCredentials(cmd, app, config.Overrides{})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.Store(app, creds); err != nil {
+		log.Printf(color.YellowString("Could not store credentials in keychain: %v"), err)
+	}
+
+	return creds, nil
+}
+
+var cmdCredProcess = &cobra.Command{
+	Use:   "cred-process [app name]",
+	Short: "Print credentials for use as an AWS credential_process",
+	Long: `Print the credentials stored in the OS keychain for the specified app in the JSON
+format expected from a credential_process by the AWS CLI and SDKs. If no credentials are stored
+for the app or the stored credentials have expired, new credentials are obtained from the
+identity provider and stored in the keychain. Concurrent invocations for the same app wait for
+each other, so that only one of them authenticates.
+
+If no app is specified, the selected app (if configured) will be assumed.
+
+To use clisso as a credential_process, add the following to ~/.aws/config:
+
+[profile my-app]
+credential_process = clisso cred-process my-app
+
+With --format exec-credential, an EKS token for the cluster given by --cluster is printed instead,
+as a Kubernetes ExecCredential object. This allows using clisso as a kubectl credential plugin.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// The AWS CLI parses stdout, so everything else must go to stderr.
+		reserveStdout()
+
+		switch credProcessFormat {
+		case formatCredentialProcess:
+			if eksCluster != "" {
+				fatalf(codeUsage, "--cluster can only be used with --format %s", formatExecCredential)
+			}
+		case formatExecCredential:
+			if eksCluster == "" {
+				fatalf(codeUsage, "--cluster is required with --format %s", formatExecCredential)
+			}
+		default:
+			fatalf(codeUsage, "Invalid format '%s': must be %s or %s", credProcessFormat,
+				formatCredentialProcess, formatExecCredential)
+		}
+
+		app, err := selectedApp(args)
+		if err != nil {
+			fatalf(codeUsage, "%v", err)
+		}
+		// Prompting could block the AWS CLI, so suggestions are only printed.
+		app, err = checkAppExists(app, false)
+		if err != nil {
+			fatalf(codeUsage, "%v", err)
+		}
+
+		creds, err := credProcessCredentials(cmd, app)
+		if err != nil {
+			warnClockSkew(err)
+			fatalf(codeOf(err, codeAuthFailed), "Could not get temporary credentials: %v", err)
+		}
+
+		if credProcessFormat == formatExecCredential {
+			apiVersion, err := execCredentialAPIVersion()
+			if err != nil {
+				fatalf(codeUsage, "%v", err)
+			}
+			endpoint, err := config.GetSTSEndpoint(app, "")
+			if err != nil {
+				fatalf(codeConfig, "%v", err)
+			}
+			token, exp, err := aws.EKSToken(creds, eksCluster, endpoint)
+			if err != nil {
+				fatalf(codeOutputFailed, "Error creating EKS token: %v", err)
+			}
+			if err := aws.WriteExecCredential(token, exp, apiVersion, os.Stdout); err != nil {
+				fatalf(codeOutputFailed, "Error printing credentials: %v", err)
+			}
+			return
+		}
+
+		if err := aws.WriteCredentialProcess(creds, os.Stdout); err != nil {
+			fatalf(codeOutputFailed, "Error printing credentials: %v", err)
+		}
+	},
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/allcloud-io/clisso/aws"
+	"github.com/allcloud-io/clisso/internal/testserver"
+	"github.com/allcloud-io/clisso/spinner"
+	"github.com/spf13/viper"
+	"github.com/zalando/go-keyring"
+)
+
+// TestCredProcessConcurrent verifies that concurrent cred-process invocations for an app
+// authenticate only once and share the resulting credentials.
+func TestCredProcessConcurrent(t *testing.T) {
+	spinner.Disable()
+	keyring.MockInit()
+	viper.Reset()
+	defer viper.Reset()
+
+	idp := testserver.NewOkta()
+	defer idp.Close()
+
+	sts := testserver.NewSTS()
+	defer sts.Close()
+	setupTestSTS(t, sts)
+
+	setupTestOktaProvider(t, "test-provider", idp.URL, idp.Password)
+	viper.Set("apps.test-app.provider", "test-provider")
+	viper.Set("apps.test-app.url", idp.AppURL())
+	viper.Set("global.cache-dir", t.TempDir())
+
+	const invocations = 5
+	creds := make([]*aws.Credentials, invocations)
+	errs := make([]error, invocations)
+
+	var wg sync.WaitGroup
+	for i := 0; i < invocations; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			creds[i], errs[i] = credProcessCredentials(cmdCredProcess, "test-app")
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range creds {
+		if errs[i] != nil {
+			t.Fatalf("unexpected error: %v", errs[i])
+		}
+		if creds[i].AccessKeyID != testserver.AccessKeyID {
+			t.Errorf("wrong access key ID: got %q, want %q", creds[i].AccessKeyID, testserver.AccessKeyID)
+		}
+	}
+	if idp.Authentications != 1 {
+		t.Errorf("wrong number of authentications: got %d, want 1", idp.Authentications)
+	}
+}
+
+func TestExecCredentialAPIVersion(t *testing.T) {
+	defer os.Unsetenv("KUBERNETES_EXEC_INFO")
+
+	for _, test := range []struct {
+		name        string
+		info        string
+		expect      string
+		expectError bool
+	}{
+		{"Not set", "", aws.DefaultExecCredentialAPIVersion, false},
+		{"Requested by kubectl", `{"kind":"ExecCredential","apiVersion":"client.authentication.k8s.io/v1",` +
+			`"spec":{"interactive":false}}`, "client.authentication.k8s.io/v1", false},
+		{"No version", `{"kind":"ExecCredential"}`, aws.DefaultExecCredentialAPIVersion, false},
+		{"Invalid", "{", "", true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			os.Setenv("KUBERNETES_EXEC_INFO", test.info)
+
+			v, err := execCredentialAPIVersion()
+			if (err != nil) != test.expectError {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if v != test.expect {
+				t.Errorf("wrong version: got %q, want %q", v, test.expect)
+			}
+		})
+	}
+}
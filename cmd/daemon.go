@@ -0,0 +1,320 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/allcloud-io/clisso/aws"
+	"github.com/allcloud-io/clisso/config"
+	"github.com/allcloud-io/clisso/redact"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	// daemonRetryInterval is how long the daemon waits after a failed refresh before retrying. It
+	// is also the shortest time between two refreshes of the same app.
+	daemonRetryInterval = time.Minute
+
+	// daemonTick is the longest time the daemon sleeps before checking whether an app is due.
+	// Timers don't advance while the machine is suspended, so sleeping until the next refresh
+	// could oversleep after a resume.
+	daemonTick = time.Minute
+)
+
+var daemonRefreshBefore time.Duration
+var daemonLogFile string
+
+func init() {
+	RootCmd.AddCommand(cmdDaemon)
+	cmdDaemon.Flags().DurationVar(
+		&daemonRefreshBefore, "refresh-before", config.DefaultExpiryBuffer,
+		"Refresh credentials this long before they expire (default is global.expiry-buffer)",
+	)
+	cmdDaemon.Flags().StringVar(
+		&daemonLogFile, "log-file", "",
+		"Append refresh events to this file instead of writing them to stderr",
+	)
+}
+
+// daemonApp is an app whose credentials are kept fresh by the daemon.
+type daemonApp struct {
+	name string
+	// next is when the credentials of the app are refreshed next.
+	next time.Time
+}
+
+// daemon refreshes the credentials of a set of apps, each shortly before its credentials expire.
+type daemon struct {
+	apps          []*daemonApp
+	refreshBefore time.Duration
+	// refresh obtains new credentials for an app and writes them to its profile.
+	refresh func(app string) (*aws.Credentials, error)
+	// stored returns the expiration of the credentials stored for an app, or the zero time if
+	// there are none.
+	stored func(app string) (time.Time, error)
+	// load reloads the config and returns the apps to keep fresh.
+	load func() ([]string, error)
+	// events receives a message for each refresh.
+	events *log.Logger
+}
+
+// schedule schedules the first refresh of app, which is due right away unless the credentials
+// stored for app are still valid.
+func (d *daemon) schedule(app string) {
+	a := &daemonApp{name: app}
+	exp, err := d.stored(app)
+	if err != nil {
+		d.events.Printf("Could not read stored credentials for '%s': %v", app, err)
+	}
+	if !exp.IsZero() {
+		a.next = exp.Add(-d.refreshBefore)
+		d.events.Printf("Credentials for '%s' expire at %s, refreshing at %s", app,
+			exp.Format(time.RFC3339), a.next.Format(time.RFC3339))
+	}
+	d.apps = append(d.apps, a)
+}
+
+// update makes apps the apps kept fresh. The schedules of apps which are already kept fresh are
+// kept, so that their credentials aren't refreshed before they are due.
+func (d *daemon) update(apps []string) {
+	keep := make(map[string]bool, len(apps))
+	for _, app := range apps {
+		keep[app] = true
+	}
+
+	current := make(map[string]bool, len(d.apps))
+	kept := d.apps[:0]
+	for _, a := range d.apps {
+		current[a.name] = true
+		if keep[a.name] {
+			kept = append(kept, a)
+		} else {
+			d.events.Printf("Stopped keeping credentials fresh for '%s'", a.name)
+		}
+	}
+	d.apps = kept
+
+	for _, app := range apps {
+		if !current[app] {
+			current[app] = true
+			d.events.Printf("Started keeping credentials fresh for '%s'", app)
+			d.schedule(app)
+		}
+	}
+}
+
+// reload reloads the config and updates the apps kept fresh. If the config can't be read, the
+// current apps are kept.
+func (d *daemon) reload() {
+	apps, err := d.load()
+	if err != nil {
+		d.events.Printf("Could not reload config, keeping the current apps: %v", err)
+		return
+	}
+	d.events.Printf("Reloaded config")
+	d.update(apps)
+}
+
+// due returns the app which is refreshed next, or nil if there are no apps.
+func (d *daemon) due() *daemonApp {
+	var next *daemonApp
+	for _, a := range d.apps {
+		if next == nil || a.next.Before(next.next) {
+			next = a
+		}
+	}
+	return next
+}
+
+// refreshApp refreshes the credentials of a at now and schedules the next refresh of a.
+func (d *daemon) refreshApp(a *daemonApp, now time.Time) {
+	creds, err := d.refresh(a.name)
+	if err != nil {
+		a.next = now.Add(daemonRetryInterval)
+		d.events.Printf("Could not refresh credentials for '%s', retrying at %s: %v", a.name,
+			a.next.Format(time.RFC3339), err)
+		return
+	}
+
+	a.next = creds.Expiration.Add(-d.refreshBefore)
+	if min := now.Add(daemonRetryInterval); a.next.Before(min) {
+		// The credentials are shorter lived than --refresh-before.
+		a.next = min
+	}
+	d.events.Printf("Refreshed credentials for '%s'%s, expiring at %s, refreshing at %s", a.name,
+		roleInfo(creds), creds.Expiration.Format(time.RFC3339), a.next.Format(time.RFC3339))
+}
+
+// run refreshes apps as they become due until stop is closed. The config is reloaded whenever a
+// value is received on reload. Reloads are handled between refreshes, so that the config doesn't
+// change while an app is refreshed.
+func (d *daemon) run(stop, reload <-chan struct{}) {
+	for {
+		// Without apps, wait for a reload which adds some.
+		var wait <-chan time.Time
+		if a := d.due(); a != nil {
+			w := time.Until(a.next)
+			if w <= 0 {
+				d.refreshApp(a, time.Now())
+				continue
+			}
+			if w > daemonTick {
+				w = daemonTick
+			}
+			wait = time.After(w)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-reload:
+			d.reload()
+		case <-wait:
+		}
+	}
+}
+
+// daemonAppNames returns the apps given in args, or in global.daemon-apps if args is empty.
+func daemonAppNames(args []string) []string {
+	if len(args) == 0 {
+		return viper.GetStringSlice("global.daemon-apps")
+	}
+	return args
+}
+
+// daemonApps returns the apps given in args, or in global.daemon-apps if args is empty. An error
+// is returned if an app doesn't exist.
+func daemonApps(args []string) ([]string, error) {
+	names := daemonAppNames(args)
+	if len(names) == 0 {
+		return nil, fmt.Errorf("No apps specified and global.daemon-apps isn't set")
+	}
+
+	apps := make([]string, 0, len(names))
+	for _, name := range names {
+		app, err := checkAppExists(resolveAlias(name), true)
+		if err != nil {
+			return nil, err
+		}
+		apps = append(apps, app)
+	}
+
+	return apps, nil
+}
+
+// reloadDaemonApps reloads the config and returns the apps given in args, or in global.daemon-apps
+// if args is empty. Apps which don't exist anymore are left out.
+func reloadDaemonApps(args []string, events *log.Logger) ([]string, error) {
+	if err := readConfig(); err != nil {
+		return nil, err
+	}
+
+	var apps []string
+	for _, name := range daemonAppNames(args) {
+		app := resolveAlias(name)
+		if !viper.IsSet("apps." + app) {
+			events.Printf("App '%s' doesn't exist", name)
+			continue
+		}
+		apps = append(apps, app)
+	}
+
+	return apps, nil
+}
+
+var cmdDaemon = &cobra.Command{
+	Use:   "daemon [app name...]",
+	Short: "Keep the credentials of apps fresh in the background",
+	Long: `Run until interrupted and keep the credentials of each of the specified apps fresh by
+refreshing them --refresh-before their expiration and writing them to the profile of the app. Each
+app is refreshed on its own schedule. Failed refreshes are retried every minute.
+
+Apps whose stored credentials are still valid are first refreshed shortly before they expire; all
+other apps are refreshed on startup, which may prompt for passwords and MFA. Okta sessions are
+reused, so that later refreshes don't prompt again while the Okta session is valid.
+
+If no app is specified, the apps listed in global.daemon-apps are refreshed.
+
+On SIGHUP, the config is reloaded. Apps which were added to global.daemon-apps are kept fresh from
+then on, and apps which were removed from it or from the config aren't refreshed anymore. The
+schedules of the remaining apps aren't changed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		apps, err := daemonApps(args)
+		if err != nil {
+			fatalf(codeUsage, "%v", err)
+		}
+		if daemonRefreshBefore < 0 {
+			fatalf(codeUsage, "--refresh-before must not be negative")
+		}
+		// Credentials are refreshed when other commands would stop using them by default.
+		if !cmd.Flags().Changed("refresh-before") {
+			if daemonRefreshBefore, err = config.GetExpiryBuffer(); err != nil {
+				fatalf(codeConfig, "%v", err)
+			}
+		}
+
+		var out io.Writer = os.Stderr
+		if daemonLogFile != "" {
+			if err := os.MkdirAll(filepath.Dir(daemonLogFile), 0700); err != nil {
+				fatalf(codeError, "Could not create log directory: %v", err)
+			}
+			f, err := os.OpenFile(daemonLogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+			if err != nil {
+				fatalf(codeError, "Could not open log file: %v", err)
+			}
+			defer f.Close()
+			out = f
+		}
+		events := log.New(redact.NewWriter(out), "", log.LstdFlags)
+
+		d := &daemon{
+			refreshBefore: daemonRefreshBefore,
+			events:        events,
+			refresh: func(app string) (*aws.Credentials, error) {
+				creds, err := getCredentials(cmd, app, config.Overrides{ReuseOktaSessions: true})
+				if err == nil {
+					err = processCredentials(creds, app)
+				}
+				if err != nil {
+					warnClockSkew(err)
+					return nil, err
+				}
+				if hook := viper.GetString("global.post-hook"); hook != "" {
+					runPostHook(hook, app, sectionName(app), creds)
+				}
+				return creds, nil
+			},
+			stored: storedExpiration,
+			load:   func() ([]string, error) { return reloadDaemonApps(args, events) },
+		}
+		d.update(apps)
+
+		stop := make(chan struct{})
+		reload := make(chan struct{}, 1)
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+		go func() {
+			for sig := range signals {
+				if sig != syscall.SIGHUP {
+					close(stop)
+					return
+				}
+				// A reload which is already pending picks up the latest config as well.
+				select {
+				case reload <- struct{}{}:
+				default:
+				}
+			}
+		}()
+
+		d.run(stop, reload)
+		events.Printf("Stopped")
+	},
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/allcloud-io/clisso/aws"
+)
+
+func TestDaemonRefreshApp(t *testing.T) {
+	now := time.Now()
+
+	for _, test := range []struct {
+		name       string
+		expiration time.Time
+		err        error
+		expectNext time.Time
+	}{
+		{"Refreshed before expiration", now.Add(time.Hour), nil, now.Add(50 * time.Minute)},
+		{"Short lived credentials", now.Add(5 * time.Minute), nil, now.Add(daemonRetryInterval)},
+		{"Failure is retried", time.Time{}, errors.New("failed"), now.Add(daemonRetryInterval)},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			d := &daemon{
+				refreshBefore: 10 * time.Minute,
+				events:        log.New(ioutil.Discard, "", 0),
+				refresh: func(app string) (*aws.Credentials, error) {
+					if test.err != nil {
+						return nil, test.err
+					}
+					return &aws.Credentials{Expiration: test.expiration}, nil
+				},
+			}
+			a := &daemonApp{name: "app"}
+
+			d.refreshApp(a, now)
+			if !a.next.Equal(test.expectNext) {
+				t.Errorf("wrong next refresh: got %v, want %v", a.next, test.expectNext)
+			}
+		})
+	}
+}
+
+func TestDaemonDue(t *testing.T) {
+	now := time.Now()
+	stored := map[string]time.Time{"later": now.Add(2 * time.Hour), "sooner": now.Add(time.Hour)}
+	d := &daemon{
+		refreshBefore: 10 * time.Minute,
+		events:        log.New(ioutil.Discard, "", 0),
+		stored:        func(app string) (time.Time, error) { return stored[app], nil },
+	}
+
+	if a := d.due(); a != nil {
+		t.Errorf("wrong app due: got %s, want none", a.name)
+	}
+
+	d.update([]string{"later", "sooner"})
+	if a := d.due(); a.name != "sooner" {
+		t.Errorf("wrong app due: got %s, want sooner", a.name)
+	}
+
+	d.update([]string{"later", "sooner", "unknown"})
+	if a := d.due(); a.name != "unknown" {
+		t.Errorf("wrong app due: got %s, want unknown", a.name)
+	}
+}
+
+func TestDaemonReload(t *testing.T) {
+	now := time.Now()
+	var loaded []string
+	d := &daemon{
+		refreshBefore: 10 * time.Minute,
+		events:        log.New(ioutil.Discard, "", 0),
+		stored:        func(app string) (time.Time, error) { return now.Add(time.Hour), nil },
+		load: func() ([]string, error) {
+			if loaded == nil {
+				return nil, errors.New("invalid config")
+			}
+			return loaded, nil
+		},
+	}
+	d.update([]string{"kept", "removed"})
+	// The schedule of kept apps must survive reloads.
+	d.apps[0].next = now.Add(time.Minute)
+
+	d.reload()
+	if len(d.apps) != 2 {
+		t.Fatalf("apps changed by failed reload: got %d apps, want 2", len(d.apps))
+	}
+
+	loaded = []string{"added", "kept"}
+	d.reload()
+
+	next := make(map[string]time.Time)
+	for _, a := range d.apps {
+		next[a.name] = a.next
+	}
+	expect := map[string]time.Time{"added": now.Add(50 * time.Minute), "kept": now.Add(time.Minute)}
+	if !reflect.DeepEqual(next, expect) {
+		t.Errorf("wrong schedule after reload: got %v, want %v", next, expect)
+	}
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/allcloud-io/clisso/redact"
+	"github.com/fatih/color"
+)
+
+// Supported values for the --output-format flag.
+const (
+	outputFormatText = "text"
+	outputFormatJSON = "json"
+)
+
+// errorCode identifies a class of failures independently of the wording of error messages.
+type errorCode string
+
+const (
+	// codeError is used for failures which don't fall under any other code.
+	codeError errorCode = "error"
+	// codeUsage indicates invalid arguments or flags.
+	codeUsage errorCode = "usage"
+	// codeConfig indicates a missing, unreadable or invalid configuration.
+	codeConfig errorCode = "config_error"
+	// codeAuthFailed indicates a failure to obtain credentials from the identity provider or STS.
+	codeAuthFailed errorCode = "auth_failed"
+	// codeOutputFailed indicates a failure to write or print credentials.
+	codeOutputFailed errorCode = "output_failed"
+)
+
+// exitCodes maps error codes to process exit codes.
+var exitCodes = map[errorCode]int{
+	codeError:        1,
+	codeUsage:        2,
+	codeConfig:       3,
+	codeAuthFailed:   4,
+	codeOutputFailed: 5,
+}
+
+// codedError associates an error with an error code.
+type codedError struct {
+	code errorCode
+	err  error
+}
+
+func (e *codedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *codedError) Unwrap() error {
+	return e.err
+}
+
+// withCode returns an error which carries the given error code.
+func withCode(code errorCode, err error) error {
+	return &codedError{code: code, err: err}
+}
+
+// codeOf returns the error code carried by err, or def if err doesn't carry one.
+func codeOf(err error, def errorCode) errorCode {
+	var ce *codedError
+	if errors.As(err, &ce) {
+		return ce.code
+	}
+	return def
+}
+
+// errorOutput is the JSON document printed for errors when --output-format is json.
+type errorOutput struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// fatalf prints an error message built from format and v and exits with the exit code mapped to
+// code. The message is printed as red text, or as a JSON document if --output-format is json.
+func fatalf(code errorCode, format string, v ...interface{}) {
+	// Error messages may echo responses of identity providers, which contain secrets.
+	msg := redact.String(fmt.Sprintf(format, v...))
+
+	if outputFormat == outputFormatJSON {
+		err := json.NewEncoder(os.Stderr).Encode(&errorOutput{Error: msg, Code: string(code)})
+		if err != nil {
+			log.Print(msg)
+		}
+	} else {
+		log.Print(color.RedString(msg))
+	}
+
+	os.Exit(exitCodes[code])
+}
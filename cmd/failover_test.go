@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/allcloud-io/clisso/aws"
+	"github.com/allcloud-io/clisso/config"
+	"github.com/allcloud-io/clisso/internal/testserver"
+	"github.com/allcloud-io/clisso/spinner"
+	"github.com/spf13/viper"
+)
+
+func TestGetCredentialsFailover(t *testing.T) {
+	spinner.Disable()
+
+	idp := testserver.NewOkta()
+	defer idp.Close()
+
+	sts := testserver.NewSTS()
+	defer sts.Close()
+
+	// A server which refuses connections.
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "maintenance", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	for _, test := range []struct {
+		name        string
+		providers   []string
+		expectError string
+	}{
+		{name: "First provider available", providers: []string{"up", "down"}},
+		{name: "Connection refused", providers: []string{"down", "up"}},
+		{name: "Server error", providers: []string{"failing", "up"}},
+		{name: "All unavailable", providers: []string{"down", "failing"}, expectError: "is unavailable"},
+		{name: "Wrong password", providers: []string{"wrong-password", "up"}, expectError: "401 Unauthorized"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			viper.Reset()
+			defer viper.Reset()
+			setupTestSTS(t, sts)
+
+			setupTestOktaProvider(t, "up", idp.URL, idp.Password)
+			setupTestOktaProvider(t, "down", down.URL, idp.Password)
+			setupTestOktaProvider(t, "failing", failing.URL, idp.Password)
+			setupTestOktaProvider(t, "wrong-password", idp.URL, "wrong")
+			viper.Set("apps.test-app.providers", test.providers)
+			viper.Set("apps.test-app.url", idp.AppURL())
+
+			creds, err := getCredentials(cmdGet, "test-app", config.Overrides{})
+			if test.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expectError) {
+					t.Fatalf("expected error containing %q, got %v", test.expectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if creds.AccessKeyID != testserver.AccessKeyID {
+				t.Errorf("wrong access key ID: got %q, want %q", creds.AccessKeyID, testserver.AccessKeyID)
+			}
+		})
+	}
+}
+
+// setupTestOktaProvider configures an Okta provider whose base URL is url and whose user
+// authenticates using password. The HTTP clients of the test trust the fake Okta servers.
+func setupTestOktaProvider(t *testing.T, provider, url, password string) {
+	testserver.TrustTLS(t)
+
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := ioutil.WriteFile(passwordFile, []byte(password), 0600); err != nil {
+		t.Fatalf("writing password file: %v", err)
+	}
+
+	viper.Set("providers."+provider+".type", "okta")
+	viper.Set("providers."+provider+".base-url", url)
+	viper.Set("providers."+provider+".username", "user@example.com")
+	viper.Set("providers."+provider+".password-file", passwordFile)
+}
+
+// setupTestSTS points the aws package at sts for the duration of a test.
+func setupTestSTS(t *testing.T, sts *testserver.STS) {
+	aws.STSEndpoint = sts.URL
+	region, hasRegion := os.LookupEnv("AWS_REGION")
+	os.Setenv("AWS_REGION", "us-east-1")
+
+	t.Cleanup(func() {
+		aws.STSEndpoint = ""
+		if hasRegion {
+			os.Setenv("AWS_REGION", region)
+		} else {
+			os.Unsetenv("AWS_REGION")
+		}
+	})
+}
@@ -1,86 +1,820 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/mitchellh/go-homedir"
 
 	"github.com/allcloud-io/clisso/aws"
-	"github.com/allcloud-io/clisso/okta"
-	"github.com/allcloud-io/clisso/onelogin"
+	"github.com/allcloud-io/clisso/clisso"
+	"github.com/allcloud-io/clisso/config"
+	"github.com/allcloud-io/clisso/prompt"
+	"github.com/allcloud-io/clisso/redact"
+	"github.com/allcloud-io/clisso/spinner"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 var printToShell bool
+var evalMode bool
+var toKeychain bool
+var toJSONCache bool
+var credentialsSection string
 var writeToFile string
+var sessionTagFlags []string
+var mfaPollInterval time.Duration
+var mfaPollAttempts int
+var getUsername string
+var passwordFile string
+var mfaCode string
+var postHook string
+var roleAccount string
+var roleName string
+var roleARN string
+var viaAWSCLI bool
+var legacyTokenKey bool
+var pipeFormatFlag string
+var credentialsFileFlag string
+var noSaveOnMismatch bool
+var refreshSession bool
+var keyPrefix string
+var useAWSProfile bool
+var encryptTo string
+var expirationOnly bool
+var expirationEpoch bool
+var sessionName string
+var credentialField string
+var samlOut string
+var ifExpired bool
+var stsEndpointFlag string
 
 func init() {
 	RootCmd.AddCommand(cmdGet)
 	cmdGet.Flags().BoolVarP(
-		&printToShell, "shell", "s", false, "Print credentials to shell",
+		&printToShell, "shell", "s", false,
+		"Print credentials to shell (combine with --write-to-file to also write them to a file)",
+	)
+	cmdGet.Flags().BoolVar(
+		&evalMode, "eval", false,
+		"Print only shell commands to stdout, suitable for eval (implies --shell --quiet --no-color)",
+	)
+	cmdGet.Flags().StringVar(
+		&keyPrefix, "key-prefix", "",
+		"Prefix to prepend to the names of the variables printed by --shell, e.g. MYAPP_",
+	)
+	cmdGet.Flags().StringVar(
+		&credentialsSection, "credentials-section", "",
+		"Write credentials to this section of the credentials file instead of a section named after the app",
+	)
+	cmdGet.Flags().BoolVar(
+		&useAWSProfile, "use-aws-profile", false,
+		"Write credentials to the section named in $AWS_PROFILE unless --credentials-section is specified",
+	)
+	cmdGet.Flags().BoolVar(
+		&toKeychain, "to-keychain", false,
+		"Store credentials in the OS keychain for use with cred-process instead of writing them to a file",
+	)
+	cmdGet.Flags().StringVar(
+		&encryptTo, "encrypt-to", "",
+		"Print credentials encrypted to this age recipient (age1...) instead of writing them to a file",
+	)
+	cmdGet.Flags().StringVar(
+		&credentialField, "field", "",
+		"Print only this credential field instead of writing the credentials to a file: "+
+			strings.Join(aws.Fields, ", "),
+	)
+	cmdGet.Flags().BoolVar(
+		&toJSONCache, "to-json-cache", false,
+		"Write credentials to a JSON cache file (see global.json-cache) instead of the credentials file",
+	)
+	cmdGet.Flags().StringVar(
+		&samlOut, "saml-out", "",
+		"Write the base64 encoded SAML assertion to this file instead of obtaining credentials",
+	)
+	cmdGet.Flags().BoolVar(
+		&expirationOnly, "output-expiration-only", false,
+		"Print the expiration of the stored credentials without obtaining new ones",
+	)
+	cmdGet.Flags().BoolVar(
+		&ifExpired, "if-expired", false,
+		"Do nothing if valid credentials are already stored where they would be written",
+	)
+	cmdGet.Flags().BoolVar(
+		&expirationEpoch, "epoch", false,
+		"Print the expiration printed by --output-expiration-only in seconds since the epoch",
 	)
 	cmdGet.Flags().StringVarP(
 		&writeToFile, "write-to-file", "w", "",
-		"Write credentials to this file instead of the default ($HOME/.aws/credentials)",
+		"Write credentials to this file instead of the default ($AWS_SHARED_CREDENTIALS_FILE or $HOME/.aws/credentials)",
+	)
+	cmdGet.Flags().BoolVar(
+		&viaAWSCLI, "via-aws-cli", false,
+		"Write the access key ID to the credentials file using 'aws configure set' instead of editing it directly. "+
+			"The secrets are still written directly since the arguments of the AWS CLI are visible in the process list",
+	)
+	cmdGet.Flags().BoolVar(
+		&legacyTokenKey, "legacy-token-key", false,
+		"Also write the session token to aws_security_token in the credentials file for old SDKs",
+	)
+	cmdGet.Flags().StringVar(
+		&pipeFormatFlag, "pipe-format", "",
+		"Format of credentials written to a named pipe or device: ini, json or env (default: ini)",
+	)
+	cmdGet.Flags().StringVar(
+		&credentialsFileFlag, "credentials-file-type", "",
+		"Type of the file credentials are written to: credentials or config (default: detected from the file name)",
+	)
+	cmdGet.Flags().BoolVar(
+		&noSaveOnMismatch, "no-save-on-mismatch", false,
+		"Fail without asking if the profile holds credentials of a different AWS account",
 	)
-	err := viper.BindPFlag("global.credentials-path", cmdGet.Flags().Lookup("write-to-file"))
+	cmdGet.Flags().StringArrayVar(
+		&sessionTagFlags, "session-tag", nil,
+		"Session tag to attach to the credentials in key=value format (can be repeated)",
+	)
+	cmdGet.Flags().StringVar(
+		&roleAccount, "account", "",
+		"ID or name (see global.accounts) of the AWS account to use if multiple accounts are available",
+	)
+	cmdGet.Flags().StringVar(
+		&roleName, "role-name", "", "Name of the IAM role to assume if multiple roles are available",
+	)
+	cmdGet.Flags().StringVar(
+		&roleARN, "role", "",
+		"ARN of the IAM role to assume instead of apps.<app>.arn or $CLISSO_ROLE_ARN",
+	)
+	cmdGet.Flags().StringVar(
+		&stsEndpointFlag, "sts-endpoint", "",
+		"STS endpoint to use instead of apps.<app>.sts-endpoint or global.sts-endpoint, e.g. a FIPS endpoint",
+	)
+	cmdGet.Flags().StringVar(
+		&sessionName, "session-name", "",
+		"Role session name to use instead of apps.<app>.session-name, $AWS_ROLE_SESSION_NAME or the default",
+	)
+	cmdGet.Flags().StringVar(
+		&getUsername, "username", "", "Username to authenticate with instead of the configured one",
+	)
+	cmdGet.Flags().StringVar(
+		&passwordFile, "password-file", "", "Read the password from this file (- for stdin) instead of prompting for it",
+	)
+	cmdGet.Flags().StringVar(
+		&mfaCode, "mfa-code", "", "One-time password to use for MFA instead of prompting for it",
+	)
+	cmdGet.Flags().BoolVar(
+		&refreshSession, "refresh", false,
+		"Reuse a stored identity provider session instead of prompting for a password and MFA (Okta only)",
+	)
+	cmdGet.Flags().DurationVar(
+		&mfaPollInterval, "mfa-poll-interval", config.DefaultMFAPollInterval,
+		"Interval at which push MFA verification is polled",
+	)
+	cmdGet.Flags().IntVar(
+		&mfaPollAttempts, "mfa-poll-attempts", config.DefaultMFAPollAttempts,
+		"Number of times push MFA verification is polled before giving up",
+	)
+	cmdGet.Flags().StringVar(
+		&postHook, "post-hook", "",
+		"Command to run using the shell after credentials were obtained successfully",
+	)
+	err := viper.BindPFlag("global.post-hook", cmdGet.Flags().Lookup("post-hook"))
+	if err != nil {
+		log.Fatalf(color.RedString("Error binding flag global.post-hook: %v"), err)
+	}
+	err = viper.BindPFlag("global.key-prefix", cmdGet.Flags().Lookup("key-prefix"))
+	if err != nil {
+		log.Fatalf(color.RedString("Error binding flag global.key-prefix: %v"), err)
+	}
+	err = viper.BindPFlag("global.use-aws-profile", cmdGet.Flags().Lookup("use-aws-profile"))
 	if err != nil {
-		log.Fatalf(color.RedString("Error binding flag global.credentials-path: %v"), err)
+		log.Fatalf(color.RedString("Error binding flag global.use-aws-profile: %v"), err)
 	}
+	err = viper.BindPFlag("global.legacy-token-key", cmdGet.Flags().Lookup("legacy-token-key"))
+	if err != nil {
+		log.Fatalf(color.RedString("Error binding flag global.legacy-token-key: %v"), err)
+	}
+}
+
+// writesToFile returns true if processCredentials writes credentials to the credentials file,
+// which it does if --write-to-file is specified or no other output is selected.
+func writesToFile() bool {
+	if encryptTo != "" || credentialField != "" {
+		return false
+	}
+	return writeToFile != "" || (!printToShell && !toKeychain && !toJSONCache)
 }
 
-// processCredentials prints the given Credentials to a file and/or to the shell.
+// checkIfExpired returns an error if --if-expired is specified along with outputs which don't store
+// the credentials where storedExpiration finds them, since the stored credentials would be reused
+// without printing or writing them to those outputs.
+func checkIfExpired() error {
+	if !ifExpired {
+		return nil
+	}
+	if printToShell || encryptTo != "" || credentialField != "" || samlOut != "" {
+		return errors.New("--if-expired can't be used with outputs which print the credentials or " +
+			"the SAML assertion")
+	}
+	if !writesToFile() && !toKeychain && !toJSONCache {
+		return errors.New("--if-expired requires writing the credentials to a file, the keychain or the JSON cache")
+	}
+	return nil
+}
+
+// processCredentials writes the given Credentials to each of the selected outputs: the shell, the
+// keychain, the JSON cache and the credentials file. Encrypted credentials or a single field are
+// printed instead of writing the credentials to any other output.
 func processCredentials(creds *aws.Credentials, app string) error {
+	if encryptTo != "" {
+		recipient, err := aws.ParseRecipient(encryptTo)
+		if err != nil {
+			return err
+		}
+		if err := aws.WriteEncrypted(creds, recipient, os.Stdout); err != nil {
+			return fmt.Errorf("printing encrypted credentials: %v", err)
+		}
+		return nil
+	}
+	if credentialField != "" {
+		v, err := aws.Field(creds, credentialField)
+		if err != nil {
+			return err
+		}
+		fmt.Println(v)
+		return nil
+	}
+
 	if printToShell {
+		if !quiet {
+			log.Printf(color.GreenString("Please paste the following in your shell%s:"), roleInfo(creds))
+		}
 		// Print credentials to shell using the correct syntax for the OS.
-		aws.WriteToShell(creds, runtime.GOOS == "windows", os.Stdout)
-	} else {
-		path, err := homedir.Expand(viper.GetString("global.credentials-path"))
+		aws.WriteToShellWithPrefix(creds, runtime.GOOS == "windows", viper.GetString("global.key-prefix"), os.Stdout)
+	}
+	if toKeychain {
+		if err := storeInCache(creds, app); err != nil {
+			return fmt.Errorf("storing credentials in keychain: %v", err)
+		}
+		if !quiet {
+			log.Printf(color.GreenString("Credentials for '%s'%s stored in keychain"), app, roleInfo(creds))
+		}
+	}
+	if toJSONCache {
+		path, err := jsonCachePath(app)
+		if err != nil {
+			return err
+		}
+
+		if err := aws.WriteJSONCache(creds, path, viper.GetString("global.json-cache.format")); err != nil {
+			return fmt.Errorf("writing credentials to JSON cache: %v", err)
+		}
+		if !quiet {
+			log.Printf(color.GreenString("Credentials%s written successfully to '%s'"), roleInfo(creds), path)
+		}
+	}
+	if writesToFile() {
+		path, err := credentialsPath(writeToFile, app)
 		if err != nil {
 			return fmt.Errorf("expanding config file path: %v", err)
 		}
 
-		// Create the `global.credentials-path` directory if it doesn't exist.
+		if aws.IsPipe(path) {
+			// A pipe can't be read and merged with, so the credentials are written to it as is.
+			if err := writeToPipe(creds, path, sectionName(app)); err != nil {
+				return fmt.Errorf("writing credentials to pipe: %v", err)
+			}
+			if !quiet {
+				log.Printf(color.GreenString("Credentials%s written successfully to '%s'"), roleInfo(creds), path)
+			}
+			return nil
+		}
+
+		// Create the credentials directory if it doesn't exist.
 		credsFileParentDir := filepath.Dir(path)
 		if _, err := os.Stat(credsFileParentDir); os.IsNotExist(err) {
 			log.Printf(color.YellowString("Credentials directory '%s' does not exist - creating it"), credsFileParentDir)
 
-			err = os.MkdirAll(credsFileParentDir, 0755)
+			err = os.MkdirAll(credsFileParentDir, 0700)
 			if err != nil {
 				return fmt.Errorf("creating credentials directory: %v", err)
 			}
 		}
 
-		if err = aws.WriteToFile(creds, path, app); err != nil {
+		fileType, err := credentialsFileType(path)
+		if err != nil {
+			return err
+		}
+		section := sectionName(app)
+		if fileType == aws.FileTypeConfig {
+			section = aws.ConfigSection(section)
+		}
+		if err := checkAccountChange(creds, path, section); err != nil {
+			return err
+		}
+
+		aws.LegacyTokenKey = viper.GetBool("global.legacy-token-key")
+		switch {
+		case viaAWSCLI:
+			err = aws.WriteViaCLI(creds, path, sectionName(app))
+		case fileType == aws.FileTypeConfig:
+			err = aws.WriteToConfigFile(creds, path, sectionName(app))
+		default:
+			err = aws.WriteToFile(creds, path, sectionName(app))
+		}
+		if err != nil {
 			return fmt.Errorf("writing credentials to file: %v", err)
 		}
-		log.Printf(color.GreenString("Credentials written successfully to '%s'"), path)
+		if !quiet {
+			log.Printf(color.GreenString("Credentials%s written successfully to '%s'"), roleInfo(creds), path)
+		}
+	}
+
+	return nil
+}
+
+// Formats of credentials written to pipes.
+const (
+	pipeFormatINI  = "ini"
+	pipeFormatJSON = "json"
+	pipeFormatEnv  = "env"
+)
+
+// pipeFormat returns the format of credentials written to pipes as given by --pipe-format or
+// global.pipe-format.
+func pipeFormat() (string, error) {
+	f := pipeFormatFlag
+	if f == "" {
+		f = viper.GetString("global.pipe-format")
+	}
+	switch f {
+	case "":
+		return pipeFormatINI, nil
+	case pipeFormatINI, pipeFormatJSON, pipeFormatEnv:
+		return f, nil
+	default:
+		return "", fmt.Errorf("invalid pipe format '%s': must be %s, %s or %s", f, pipeFormatINI,
+			pipeFormatJSON, pipeFormatEnv)
+	}
+}
+
+// writeToPipe writes creds to the named pipe or device at path in the format given by pipeFormat.
+// The ini format contains only section. Opening a named pipe blocks until it is opened for reading.
+func writeToPipe(creds *aws.Credentials, path, section string) error {
+	format, err := pipeFormat()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	switch format {
+	case pipeFormatJSON:
+		err = aws.WriteCredentialProcess(creds, f)
+	case pipeFormatEnv:
+		aws.WriteToShellWithPrefix(creds, runtime.GOOS == "windows", viper.GetString("global.key-prefix"), f)
+	default:
+		err = aws.WriteINI(creds, section, f)
+	}
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// checkAccountChange returns an error if section of the credentials file at path holds
+// credentials of a different AWS account than creds, unless the user confirms overwriting them.
+// The check is skipped if global.confirm-account-change is false.
+func checkAccountChange(creds *aws.Credentials, path, section string) error {
+	if viper.IsSet("global.confirm-account-change") && !viper.GetBool("global.confirm-account-change") {
+		return nil
+	}
+
+	id := creds.AccountID()
+	stored, err := aws.StoredAccountID(path, section)
+	if err != nil || id == "" || stored == "" || stored == id {
+		// Errors reading the file are reported when writing it.
+		return nil
+	}
+
+	mismatch := fmt.Errorf("profile '%s' holds credentials of account %s, not %s", section, stored, id)
+	if noSaveOnMismatch {
+		return mismatch
+	}
+
+	answer, err := prompt.Line(fmt.Sprintf(
+		"Profile '%s' holds credentials of account %s. Overwrite them with credentials of account %s? [y/N]: ",
+		section, stored, id), "set global.confirm-account-change to false to overwrite without asking")
+	if err != nil {
+		return fmt.Errorf("%v: %v", mismatch, err)
+	}
+	if !strings.EqualFold(strings.TrimSpace(answer), "y") {
+		return fmt.Errorf("%v; not overwriting them", mismatch)
 	}
 
 	return nil
 }
 
-// sessionDuration returns a session duration using the following order of preference:
-// app.duration -> provider.duration -> hardcoded default of 3600
-func sessionDuration(app, provider string) int64 {
-	a := viper.GetInt64(fmt.Sprintf("apps.%s.duration", app))
-	p := viper.GetInt64(fmt.Sprintf("providers.%s.duration", provider))
+// jsonCachePath returns the path of the JSON cache file of app in global.json-cache.dir.
+func jsonCachePath(app string) (string, error) {
+	dir, err := homedir.Expand(viper.GetString("global.json-cache.dir"))
+	if err != nil {
+		return "", fmt.Errorf("expanding JSON cache directory: %v", err)
+	}
+	return filepath.Join(dir, sectionName(app)+".json"), nil
+}
+
+// storedExpiration returns the earliest expiration of the usable credentials of app stored in the
+// outputs get writes them to: the keychain if --to-keychain is specified, the JSON cache if
+// --to-json-cache is specified and the credentials file if writesToFile. If no credentials are
+// stored in any of them or they expire within global.expiry-buffer, the zero time is returned.
+func storedExpiration(app string) (time.Time, error) {
+	buffer, err := config.GetExpiryBuffer()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var stored []time.Time
+	if toKeychain {
+		creds, err := loadFromCache(app)
+		if err != nil || creds == nil {
+			return time.Time{}, err
+		}
+		stored = append(stored, creds.Expiration)
+	}
+	if toJSONCache {
+		path, err := jsonCachePath(app)
+		if err != nil {
+			return time.Time{}, err
+		}
+		creds, err := aws.ReadJSONCache(path, viper.GetString("global.json-cache.format"))
+		if os.IsNotExist(err) {
+			return time.Time{}, nil
+		}
+		if err != nil {
+			return time.Time{}, err
+		}
+		stored = append(stored, creds.Expiration)
+	}
+	if writesToFile() {
+		path, err := credentialsPath(writeToFile, app)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("expanding config file path: %v", err)
+		}
+		if aws.IsPipe(path) {
+			// Credentials written to a pipe can't be read back.
+			return time.Time{}, nil
+		}
+		exp, err := validExpiration(path, sectionName(app))
+		if err != nil {
+			return time.Time{}, err
+		}
+		stored = append(stored, exp)
+	}
+
+	var earliest time.Time
+	for _, exp := range stored {
+		if !exp.After(time.Now().Add(buffer)) {
+			return time.Time{}, nil
+		}
+		if earliest.IsZero() || exp.Before(earliest) {
+			earliest = exp
+		}
+	}
+	return earliest, nil
+}
+
+// formatExpiration formats the expiration t as an RFC 3339 timestamp, or as seconds since the epoch
+// if epoch is true.
+func formatExpiration(t time.Time, epoch bool) string {
+	if epoch {
+		return strconv.FormatInt(t.Unix(), 10)
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// roleInfo describes the role and account the given credentials belong to for use in log
+// messages, or returns an empty string if the role is unknown.
+func roleInfo(creds *aws.Credentials) string {
+	if creds.RoleARN == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (role '%s', account %s)", creds.RoleARN, creds.AccountID())
+}
+
+// credentialsPath returns the path of the credentials file for app using the following order of
+// preference: flag -> apps.<app>.credentials-path -> global.credentials-path ->
+// AWS_SHARED_CREDENTIALS_FILE -> $HOME/.aws/credentials. flag is the value of the command's flag
+// which overrides the path. If app is empty, the app setting is skipped.
+func credentialsPath(flag, app string) (string, error) {
+	path := flag
+	if path == "" && app != "" {
+		path = viper.GetString(fmt.Sprintf("apps.%s.credentials-path", app))
+	}
+	if path == "" {
+		path = viper.GetString("global.credentials-path")
+	}
+	if path == "" && configuredFileType() == aws.FileTypeConfig {
+		path = os.Getenv("AWS_CONFIG_FILE")
+		if path == "" {
+			path = filepath.Join("~", ".aws", "config")
+		}
+	}
+	if path == "" {
+		// Write where the AWS CLI and SDKs read credentials from.
+		path = os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	}
+	if path == "" {
+		path = filepath.Join("~", ".aws", "credentials")
+	}
+	return homedir.Expand(path)
+}
+
+// configuredFileType returns the type of the file credentials are written to as given by
+// --credentials-file-type or global.credentials-file-type, or an empty string if neither is set.
+func configuredFileType() string {
+	if credentialsFileFlag != "" {
+		return credentialsFileFlag
+	}
+	return viper.GetString("global.credentials-file-type")
+}
+
+// credentialsFileType returns the type of the file at path which credentials are written to. If
+// the type isn't configured, files named "config" are assumed to be AWS CLI config files.
+func credentialsFileType(path string) (string, error) {
+	switch t := configuredFileType(); t {
+	case aws.FileTypeCredentials, aws.FileTypeConfig:
+		return t, nil
+	case "":
+		if filepath.Base(path) == "config" {
+			return aws.FileTypeConfig, nil
+		}
+		return aws.FileTypeCredentials, nil
+	default:
+		return "", fmt.Errorf("invalid credentials file type '%s': must be %s or %s", t,
+			aws.FileTypeCredentials, aws.FileTypeConfig)
+	}
+}
+
+// sectionName returns the name of the section the credentials of app are written to.
+func sectionName(app string) string {
+	if credentialsSection != "" {
+		return credentialsSection
+	}
+	return app
+}
+
+// preferredRoleARN returns the ARN of the role to assume for app using the following order of
+// preference: --role -> apps.<app>.arn -> CLISSO_ROLE_ARN. If none is set, an empty string is
+// returned and the role is selected from the SAML assertion.
+func preferredRoleARN(app string) string {
+	return clisso.RoleARN(app, roleARN)
+}
+
+// awsProfileSection returns the section named in the AWS_PROFILE env var if global.use-aws-profile
+// is enabled, or an empty string otherwise.
+func awsProfileSection() string {
+	if !viper.GetBool("global.use-aws-profile") {
+		return ""
+	}
+	return os.Getenv("AWS_PROFILE")
+}
+
+// enableEvalMode guarantees that stdout contains only the shell commands printed by
+// processCredentials.
+func enableEvalMode() {
+	printToShell = true
+	reserveStdout()
+}
+
+// reserveStdout ensures nothing but the output of a command is written to stdout, so that the
+// output can be consumed by other programs.
+func reserveStdout() {
+	quiet = true
+	color.NoColor = true
+	spinner.Disable()
+	// On Windows the log output is redirected to stdout to support colors.
+	log.SetOutput(redact.NewWriter(os.Stderr))
+}
+
+// parseSessionTags parses session tags specified in key=value format using the --session-tag
+// flag.
+func parseSessionTags(flags []string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, f := range flags {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid session tag '%s': must be in key=value format", f)
+		}
+		tags[kv[0]] = kv[1]
+	}
+	return tags, nil
+}
+
+// sessionTags returns the session tags to attach to the credentials of app. Tags configured under
+// apps.<app>.session-tags are overridden by tags specified using the --session-tag flag.
+func sessionTags(app string, flags []string) (map[string]string, error) {
+	overrides, err := parseSessionTags(flags)
+	if err != nil {
+		return nil, err
+	}
+	return clisso.SessionTags(app, overrides)
+}
+
+// resolveAlias returns the app name the alias name refers to. If name is the name of an app or
+// isn't an alias, it is returned unchanged.
+func resolveAlias(name string) string {
+	if viper.IsSet("apps." + name) {
+		return name
+	}
+	if app := viper.GetString("aliases." + name); app != "" {
+		return app
+	}
+	return name
+}
+
+// appFileName is the name of the file which names the app to use in the directory containing it
+// and its subdirectories.
+const appFileName = ".clisso"
+
+// workingDir returns the directory the app file is looked up from. It is a variable to allow
+// changing it in tests.
+var workingDir = os.Getwd
+
+// appFromFile returns the app named in the app file in dir or the closest of its parent
+// directories which contains one, along with the path of the file. The first line of the file
+// which isn't empty or a comment starting with # is the name of the app. If no app file is found,
+// empty strings are returned. The config file is never treated as an app file, even if it is
+// named .clisso.
+func appFromFile(dir string) (string, string, error) {
+	cfgPath, _ := filepath.Abs(viper.ConfigFileUsed())
+
+	for {
+		path := filepath.Join(dir, appFileName)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() && path != cfgPath {
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				return "", "", fmt.Errorf("reading %s: %v", path, err)
+			}
+			for _, line := range strings.Split(string(b), "\n") {
+				if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+					return line, path, nil
+				}
+			}
+			return "", "", fmt.Errorf("%s doesn't name an app", path)
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", "", nil
+		}
+		dir = parent
+	}
+}
+
+// selectedApp returns the app specified in args or, if args is empty, the app named in the app
+// file of the working directory or the selected app. Aliases are resolved to the app they refer
+// to.
+func selectedApp(args []string) (string, error) {
+	if len(args) > 0 {
+		// App specified - use it.
+		return resolveAlias(args[0]), nil
+	}
+
+	// No app specified.
+	if dir, err := workingDir(); err == nil {
+		app, _, err := appFromFile(dir)
+		if err != nil {
+			return "", err
+		}
+		if app != "" {
+			return resolveAlias(app), nil
+		}
+	}
+
+	selected := viper.GetString("global.selected-app")
+	if selected == "" {
+		// No default app configured.
+		return "", errors.New("no app specified and no default app configured")
+	}
+	return selected, nil
+}
+
+// getCredentials obtains temporary credentials for app from the identity provider of the app,
+// falling back to the next provider of the app if one is unavailable. The overrides o take
+// precedence over the configuration of the app and its providers. If cmd is nil, a role selected
+// instead of the configured one isn't stored, which allows obtaining credentials for several apps
+// concurrently.
+func getCredentials(cmd *cobra.Command, app string, o config.Overrides) (*aws.Credentials, error) {
+	tags, err := parseSessionTags(sessionTagFlags)
+	if err == nil {
+		_, err = clisso.SessionTags(app, tags)
+	}
+	if err != nil {
+		return nil, withCode(codeUsage, fmt.Errorf("invalid session tags: %v", err))
+	}
+
+	creds, err := clisso.Get(app, clisso.Options{
+		RoleARN:     roleARN,
+		Account:     roleAccount,
+		RoleName:    roleName,
+		SessionTags: tags,
+		Overrides:   o,
+		HTTPClient:  newHTTPClient,
+	})
+	var ce *clisso.ConfigError
+	if errors.As(err, &ce) {
+		return nil, withCode(codeConfig, err)
+	}
+	if err == nil && cmd != nil {
+		updateRoleARN(app, creds)
+	}
+	return creds, err
+}
 
-	if a != 0 {
-		return a
+// updateRoleARN replaces the role configured for app in the config file with the role of creds if
+// the configured role was unavailable and another role was selected instead. A role specified
+// using --role is never stored.
+func updateRoleARN(app string, creds *aws.Credentials) {
+	key := fmt.Sprintf("apps.%s.arn", app)
+	configured := viper.GetString(key)
+	if roleARN != "" || configured == "" || creds.RoleARN == "" || creds.RoleARN == configured {
+		return
 	}
 
-	if p != 0 {
-		return p
+	if err := updateConfigFile(func(v *viper.Viper) { v.Set(key, creds.RoleARN) }); err != nil {
+		log.Printf(color.YellowString("Could not store role %s for app '%s': %v"), creds.RoleARN, app, err)
+		return
 	}
+	log.Printf(color.GreenString("Stored role %s for app '%s' instead of %s"), creds.RoleARN, app, configured)
+}
 
-	return 3600
+// usesSAML returns true if provider obtains credentials using a SAML assertion.
+func usesSAML(provider string) bool {
+	switch viper.GetString(fmt.Sprintf("providers.%s.type", provider)) {
+	case "onelogin", "jumpcloud":
+		return true
+	case "okta":
+		return viper.GetString(fmt.Sprintf("providers.%s.auth-type", provider)) != config.OktaAuthTypeDevice
+	default:
+		return false
+	}
+}
+
+// defaultShortSessionWarning is the session length below which the user is warned about a short
+// session if global.short-session-warning isn't set.
+const defaultShortSessionWarning = 30 * time.Minute
+
+// shortSessionWarning returns a warning if the given credentials are valid for less than
+// threshold, or an empty string otherwise. A threshold of 0 disables the warning.
+func shortSessionWarning(creds *aws.Credentials, threshold time.Duration) string {
+	remaining := time.Until(creds.Expiration)
+	if threshold <= 0 || remaining >= threshold {
+		return ""
+	}
+	return fmt.Sprintf("Session valid for only %s. The maximum session duration of the role may "+
+		"be lower than expected.", remaining.Round(time.Minute))
+}
+
+// maxClockSkew is the difference between the system clock and the clock of STS above which the
+// user is warned about clock skew.
+const maxClockSkew = time.Minute
+
+// warnClockSkew prints a hint about checking the system clock if err indicates that STS rejected a
+// request due to a time validity problem. If the system clock differs from the clock of STS, the
+// difference is printed as well.
+func warnClockSkew(err error) {
+	if !aws.IsClockSkewError(err) {
+		return
+	}
+
+	log.Println(color.YellowString(aws.ClockSkewMessage))
+
+	hc, err := newHTTPClient("")
+	if err != nil {
+		return
+	}
+	skew, err := aws.ClockSkew(hc)
+	if err != nil {
+		// The hint above is still useful on its own.
+		return
+	}
+	if skew > maxClockSkew || skew < -maxClockSkew {
+		log.Printf(color.YellowString("The system clock differs from the clock of STS by %s"),
+			skew.Round(time.Second))
+	}
 }
 
 var cmdGet = &cobra.Command{
@@ -90,61 +824,175 @@ var cmdGet = &cobra.Command{
 assertion at the identity provider and using this assertion to retrieve
 temporary credentials from the cloud provider.
 
-If no app is specified, the selected app (if configured) will be assumed.`,
+If no app is specified, the selected app (if configured) will be assumed.
+
+When --eval is specified, stdout contains nothing but the shell commands which set the
+credentials, so that the output can be passed to eval. All other output, including prompts, goes
+to stderr.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		var app string
-		if len(args) == 0 {
-			// No app specified.
-			selected := viper.GetString("global.selected-app")
-			if selected == "" {
-				// No default app configured.
-				log.Fatal(color.RedString("No app specified and no default app configured"))
+		if evalMode {
+			enableEvalMode()
+		}
+		if encryptTo != "" {
+			if _, err := aws.ParseRecipient(encryptTo); err != nil {
+				fatalf(codeUsage, "%v", err)
 			}
-			app = selected
-		} else {
-			// App specified - use it.
-			app = args[0]
+			// Only the encrypted credentials may be written to stdout.
+			reserveStdout()
 		}
-
-		provider := viper.GetString(fmt.Sprintf("apps.%s.provider", app))
-		if provider == "" {
-			log.Fatalf(color.RedString("Could not get provider for app '%s'"), app)
+		if credentialField != "" {
+			if _, err := aws.Field(&aws.Credentials{}, credentialField); err != nil {
+				fatalf(codeUsage, "%v", err)
+			}
+			reserveStdout()
 		}
 
-		pType := viper.GetString(fmt.Sprintf("providers.%s.type", provider))
-		if pType == "" {
-			log.Fatalf(color.RedString("Could not get provider type for provider '%s'"), provider)
+		app, err := selectedApp(args)
+		if err != nil {
+			fatalf(codeUsage, "%v", err)
+		}
+		app, err = checkAppExists(app, true)
+		if err != nil {
+			fatalf(codeUsage, "%v", err)
 		}
 
-		// allow preferred "arn" to be specified in the config file for each app
-		// if this is not specified the value will be empty ("")
-		pArn := viper.GetString(fmt.Sprintf("apps.%s.arn", app))
+		if cmd.Flags().Changed("credentials-section") {
+			if err := aws.ValidateSectionName(credentialsSection); err != nil {
+				fatalf(codeUsage, "Invalid credentials section: %v", err)
+			}
+		} else if profile := awsProfileSection(); profile != "" {
+			if err := aws.ValidateSectionName(profile); err != nil {
+				fatalf(codeUsage, "Invalid AWS_PROFILE: %v", err)
+			}
+			credentialsSection = profile
+		}
 
-		duration := sessionDuration(app, provider)
+		if expirationOnly {
+			reserveStdout()
+			exp, err := storedExpiration(app)
+			if err != nil {
+				fatalf(codeConfig, "Could not read stored credentials: %v", err)
+			}
+			if exp.IsZero() {
+				fatalf(codeError, "No valid credentials stored for '%s'", app)
+			}
+			fmt.Println(formatExpiration(exp, expirationEpoch))
+			return
+		}
 
-		if pType == "onelogin" {
-			creds, err := onelogin.Get(app, provider, pArn, duration)
+		if viaAWSCLI {
+			// Fail before authenticating rather than after.
+			if _, err := aws.FindCLI(); err != nil {
+				fatalf(codeUsage, "%v", err)
+			}
+		}
+		if writesToFile() {
+			path, err := credentialsPath(writeToFile, app)
 			if err != nil {
-				log.Fatal(color.RedString("Could not get temporary credentials: "), err)
+				fatalf(codeConfig, "Failed to expand home: %s", err)
 			}
-			// Process credentials
-			err = processCredentials(creds, app)
+			fileType, err := credentialsFileType(path)
 			if err != nil {
-				log.Fatalf(color.RedString("Error processing credentials: %v"), err)
+				fatalf(codeUsage, "%v", err)
+			}
+			if viaAWSCLI && fileType == aws.FileTypeConfig {
+				fatalf(codeUsage, "--via-aws-cli can't write credentials to the AWS CLI config file")
 			}
-		} else if pType == "okta" {
-			creds, err := okta.Get(app, provider, pArn, duration)
+			if aws.IsPipe(path) {
+				if viaAWSCLI {
+					fatalf(codeUsage, "--via-aws-cli can't write credentials to a pipe")
+				}
+				if _, err := pipeFormat(); err != nil {
+					fatalf(codeUsage, "%v", err)
+				}
+			}
+		}
+
+		// Fail before authenticating rather than after.
+		o, err := flagOverrides(cmd)
+		if err != nil {
+			fatalf(codeUsage, "%v", err)
+		}
+		if _, err := config.GetSTSEndpoint(app, o.STSEndpoint); err != nil {
+			fatalf(codeConfig, "%v", err)
+		}
+
+		if err := checkIfExpired(); err != nil {
+			fatalf(codeUsage, "%v", err)
+		}
+		if ifExpired {
+			exp, err := storedExpiration(app)
 			if err != nil {
-				log.Fatal(color.RedString("Could not get temporary credentials: "), err)
+				fatalf(codeConfig, "Could not read stored credentials: %v", err)
+			}
+			if !exp.IsZero() {
+				if !quiet {
+					log.Printf(color.GreenString("Credentials for '%s' are valid until %s - not obtaining new ones"),
+						app, exp.Local().Format(time.RFC3339))
+				}
+				return
+			}
+		}
+
+		if prefix := viper.GetString("global.key-prefix"); prefix != "" {
+			if err := aws.ValidateKeyPrefix(prefix); err != nil {
+				fatalf(codeUsage, "Invalid key prefix: %v", err)
+			}
+		}
+
+		if samlOut != "" {
+			for _, p := range clisso.AppProviders(app) {
+				if !usesSAML(p) {
+					fatalf(codeUsage, "--saml-out can't be used with provider '%s', which doesn't use SAML", p)
+				}
 			}
-			// Process credentials
-			err = processCredentials(creds, app)
+		}
+
+		creds, err := getCredentials(cmd, app, o)
+		if err != nil {
+			warnClockSkew(err)
+			fatalf(codeOf(err, codeAuthFailed), "Could not get temporary credentials: %v", err)
+		}
+		if o.SAMLOutput != "" {
+			log.Println(color.YellowString("The SAML assertion can be used to obtain credentials " +
+				"until it expires. Keep the file safe and delete it once it isn't needed anymore."))
+			if !quiet {
+				log.Printf(color.GreenString("SAML assertion for role %s written to '%s'. To assume the role, run:\n\n"+
+					"aws sts assume-role-with-saml --role-arn %s --principal-arn %s --saml-assertion file://%s"),
+					creds.RoleARN, o.SAMLOutput, creds.RoleARN, creds.PrincipalARN, o.SAMLOutput)
+			}
+			return
+		}
+
+		threshold := defaultShortSessionWarning
+		if viper.IsSet("global.short-session-warning") {
+			threshold = viper.GetDuration("global.short-session-warning")
+		}
+		if w := shortSessionWarning(creds, threshold); w != "" && !quiet {
+			log.Println(color.YellowString(w))
+		}
+
+		// Process credentials
+		err = processCredentials(creds, app)
+		if err != nil {
+			fatalf(codeOutputFailed, "Error processing credentials: %v", err)
+		}
+
+		if hook := viper.GetString("global.post-hook"); hook != "" {
+			profile := ""
+			if writesToFile() {
+				profile = sectionName(app)
+			}
+			runPostHook(hook, app, profile, creds)
+		}
+		if !quiet {
+			path, err := credentialsPath(writeToFile, app)
 			if err != nil {
-				log.Fatalf(color.RedString("Error processing credentials: %v"), err)
+				fatalf(codeConfig, "Failed to expand home: %s", err)
+			}
+			if !aws.IsPipe(path) {
+				printStatus(path)
 			}
-		} else {
-			log.Fatalf(color.RedString("Unsupported identity provider type '%s' for app '%s'"), pType, app)
 		}
-		printStatus()
 	},
 }
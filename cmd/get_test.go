@@ -1,30 +1,822 @@
 package cmd
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/allcloud-io/clisso/aws"
+	"github.com/allcloud-io/clisso/clisso"
+	"github.com/allcloud-io/clisso/config"
+	"github.com/allcloud-io/clisso/internal/testserver"
+	"github.com/allcloud-io/clisso/spinner"
+	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/viper"
+	"github.com/zalando/go-keyring"
 )
 
-var testdata = []struct {
-	app      int64
-	provider int64
-	result   int64
-}{
-	{0, 0, 3600},
-	{7200, 0, 7200},
-	{0, 7200, 7200},
-	{7200, 14400, 7200},
+func TestSessionTags(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		config      map[string]string
+		flags       []string
+		expect      map[string]string
+		expectError bool
+	}{
+		{"No tags", nil, nil, map[string]string{}, false},
+		{"Config only", map[string]string{"team": "data"}, nil, map[string]string{"team": "data"}, false},
+		{
+			"Flag overrides config",
+			map[string]string{"team": "data", "env": "dev"},
+			[]string{"team=ops"},
+			map[string]string{"team": "ops", "env": "dev"},
+			false,
+		},
+		{"Value containing equals sign", nil, []string{"k=a=b"}, map[string]string{"k": "a=b"}, false},
+		{"Missing value", nil, []string{"team"}, nil, true},
+		{"Invalid key", nil, []string{"aws:team=data"}, nil, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			viper.Set("apps.tagged.session-tags", test.config)
+
+			tags, err := sessionTags("tagged", test.flags)
+			if test.expectError {
+				if err == nil {
+					t.Errorf("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %+v", err)
+			}
+			if !reflect.DeepEqual(tags, test.expect) {
+				t.Errorf("wrong tags: got %v, want %v", tags, test.expect)
+			}
+		})
+	}
+}
+
+func TestSelectedApp(t *testing.T) {
+	viper.Set("apps.aws-prod-account-1234567890.provider", "test")
+	viper.Set("apps.dev.provider", "test")
+	viper.Set("aliases.prod", "aws-prod-account-1234567890")
+	viper.Set("aliases.dev", "aws-prod-account-1234567890")
+	viper.Set("global.selected-app", "dev")
+
+	project := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(project, appFileName), []byte("prod\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { workingDir = os.Getwd }()
+
+	for _, test := range []struct {
+		name   string
+		args   []string
+		dir    string
+		expect string
+	}{
+		{"App name", []string{"aws-prod-account-1234567890"}, "", "aws-prod-account-1234567890"},
+		{"Alias", []string{"prod"}, "", "aws-prod-account-1234567890"},
+		{"App shadows alias", []string{"dev"}, "", "dev"},
+		{"Unknown name", []string{"unknown"}, "", "unknown"},
+		{"Selected app", nil, "", "dev"},
+		{"App file", nil, project, "aws-prod-account-1234567890"},
+		{"Argument overrides app file", []string{"dev"}, project, "dev"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir := test.dir
+			if dir == "" {
+				dir = t.TempDir()
+			}
+			workingDir = func() (string, error) { return dir, nil }
+
+			app, err := selectedApp(test.args)
+			if err != nil {
+				t.Fatalf("unexpected error %+v", err)
+			}
+			if app != test.expect {
+				t.Errorf("wrong app: got %s, want %s", app, test.expect)
+			}
+		})
+	}
+}
+
+func TestAppFromFile(t *testing.T) {
+	root := t.TempDir()
+	nested := filepath.Join(root, "a", "b")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(root, appFileName)
+	if err := ioutil.WriteFile(path, []byte("# AWS access of this repo\n\n  my-app  \n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dir := range []string{root, nested} {
+		app, found, err := appFromFile(dir)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if app != "my-app" || found != path {
+			t.Errorf("wrong app from %s: got %s in %s, want my-app in %s", dir, app, found, path)
+		}
+	}
+
+	if err := ioutil.WriteFile(path, []byte("# no app\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := appFromFile(nested); err == nil {
+		t.Error("expected error for app file without an app")
+	}
+
+	// The config file isn't an app file.
+	viper.SetConfigFile(path)
+	defer viper.Reset()
+	if app, _, err := appFromFile(nested); err != nil || app != "" {
+		t.Errorf("config file used as app file: got %q, %v", app, err)
+	}
+}
+
+func TestCredentialsPath(t *testing.T) {
+	home, err := homedir.Dir()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env, hadEnv := os.LookupEnv("AWS_SHARED_CREDENTIALS_FILE")
+	defer func() {
+		if hadEnv {
+			os.Setenv("AWS_SHARED_CREDENTIALS_FILE", env)
+		} else {
+			os.Unsetenv("AWS_SHARED_CREDENTIALS_FILE")
+		}
+		viper.Set("apps.paths.credentials-path", "")
+		viper.Set("global.credentials-path", "")
+	}()
+
+	for _, test := range []struct {
+		name   string
+		flag   string
+		app    string
+		global string
+		env    string
+		expect string
+	}{
+		{"Default", "", "", "", "", filepath.Join(home, ".aws", "credentials")},
+		{"Env var", "", "", "", "/env/credentials", "/env/credentials"},
+		{"Global overrides env var", "", "", "/global/credentials", "/env/credentials", "/global/credentials"},
+		{"App overrides global", "", "/app/credentials", "/global/credentials", "/env/credentials", "/app/credentials"},
+		{"Flag overrides app", "/flag/credentials", "/app/credentials", "/global/credentials", "", "/flag/credentials"},
+		{"Home is expanded", "~/credentials", "", "", "", filepath.Join(home, "credentials")},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			viper.Set("apps.paths.credentials-path", test.app)
+			viper.Set("global.credentials-path", test.global)
+			os.Setenv("AWS_SHARED_CREDENTIALS_FILE", test.env)
+
+			path, err := credentialsPath(test.flag, "paths")
+			if err != nil {
+				t.Fatalf("unexpected error %+v", err)
+			}
+			if path != test.expect {
+				t.Errorf("wrong path: got %s, want %s", path, test.expect)
+			}
+		})
+	}
+}
+
+func TestCredentialsFileType(t *testing.T) {
+	home, err := homedir.Dir()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env, hadEnv := os.LookupEnv("AWS_CONFIG_FILE")
+	defer func() {
+		if hadEnv {
+			os.Setenv("AWS_CONFIG_FILE", env)
+		} else {
+			os.Unsetenv("AWS_CONFIG_FILE")
+		}
+		credentialsFileFlag = ""
+		viper.Set("global.credentials-file-type", "")
+	}()
+	os.Unsetenv("AWS_CONFIG_FILE")
+
+	for _, test := range []struct {
+		name        string
+		flag        string
+		global      string
+		path        string
+		expectType  string
+		expectError bool
+	}{
+		{"Detected credentials file", "", "", "/aws/credentials", "credentials", false},
+		{"Detected config file", "", "", "/aws/config", "config", false},
+		{"Global overrides detection", "", "credentials", "/aws/config", "credentials", false},
+		{"Flag overrides global", "config", "credentials", "/aws/credentials", "config", false},
+		{"Invalid type", "profiles", "", "/aws/credentials", "", true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			credentialsFileFlag = test.flag
+			viper.Set("global.credentials-file-type", test.global)
+
+			got, err := credentialsFileType(test.path)
+			if test.expectError && err == nil {
+				t.Error("expected error")
+			}
+			if !test.expectError && err != nil {
+				t.Errorf("unexpected error %+v", err)
+			}
+			if got != test.expectType {
+				t.Errorf("wrong type: got %q, want %q", got, test.expectType)
+			}
+		})
+	}
+
+	// The config file is the default file of the config file type.
+	credentialsFileFlag = "config"
+	viper.Set("global.credentials-file-type", "")
+	for env, expect := range map[string]string{
+		"":            filepath.Join(home, ".aws", "config"),
+		"/env/config": "/env/config",
+	} {
+		os.Setenv("AWS_CONFIG_FILE", env)
+		if path, err := credentialsPath("", ""); err != nil || path != expect {
+			t.Errorf("wrong path for AWS_CONFIG_FILE=%q: got %s, %v, want %s", env, path, err, expect)
+		}
+	}
+}
+
+func TestShortSessionWarning(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		remaining time.Duration
+		threshold time.Duration
+		expect    string
+	}{
+		{"Long session", time.Hour, 30 * time.Minute, ""},
+		{"Short session", 15*time.Minute + 10*time.Second, 30 * time.Minute,
+			"Session valid for only 15m0s. The maximum session duration of the role may be lower than expected."},
+		{"Disabled", 15 * time.Minute, 0, ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			creds := &aws.Credentials{Expiration: time.Now().Add(test.remaining)}
+			if got := shortSessionWarning(creds, test.threshold); got != test.expect {
+				t.Errorf("got %q, want %q", got, test.expect)
+			}
+		})
+	}
+}
+
+func TestPreferredRoleARN(t *testing.T) {
+	defer viper.Reset()
+	defer os.Setenv(clisso.RoleARNEnv, os.Getenv(clisso.RoleARNEnv))
+
+	const (
+		flagARN   = "arn:aws:iam::111111111111:role/Flag"
+		configARN = "arn:aws:iam::111111111111:role/Config"
+		envARN    = "arn:aws:iam::111111111111:role/Env"
+	)
+
+	for _, test := range []struct {
+		name   string
+		flag   string
+		config string
+		env    string
+		expect string
+	}{
+		{"Flag", flagARN, configARN, envARN, flagARN},
+		{"Config", "", configARN, envARN, configARN},
+		{"Environment", "", "", envARN, envARN},
+		{"None", "", "", "", ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			viper.Reset()
+			roleARN = test.flag
+			defer func() { roleARN = "" }()
+			if test.config != "" {
+				viper.Set("apps.test-app.arn", test.config)
+			}
+			os.Setenv(clisso.RoleARNEnv, test.env)
+
+			if got := preferredRoleARN("test-app"); got != test.expect {
+				t.Errorf("wrong role ARN: got %q, want %q", got, test.expect)
+			}
+		})
+	}
+}
+
+func TestAWSProfileSection(t *testing.T) {
+	env, hadEnv := os.LookupEnv("AWS_PROFILE")
+	defer func() {
+		if hadEnv {
+			os.Setenv("AWS_PROFILE", env)
+		} else {
+			os.Unsetenv("AWS_PROFILE")
+		}
+		viper.Set("global.use-aws-profile", false)
+	}()
+
+	for _, test := range []struct {
+		name    string
+		enabled bool
+		env     string
+		expect  string
+	}{
+		{"Disabled", false, "my-profile", ""},
+		{"Enabled", true, "my-profile", "my-profile"},
+		{"Enabled without env var", true, "", ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			viper.Set("global.use-aws-profile", test.enabled)
+			os.Setenv("AWS_PROFILE", test.env)
+
+			if got := awsProfileSection(); got != test.expect {
+				t.Errorf("wrong section: got %q, want %q", got, test.expect)
+			}
+		})
+	}
+}
+
+func TestStoredExpiration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	expiration := time.Now().Add(time.Hour).Truncate(time.Second)
+	for section, exp := range map[string]time.Time{
+		"valid":    expiration,
+		"expired":  time.Now().Add(-time.Minute),
+		"expiring": time.Now().Add(time.Minute),
+	} {
+		creds := &aws.Credentials{AccessKeyID: "key", SecretAccessKey: "secret", Expiration: exp}
+		if err := aws.WriteToFile(creds, path, section); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeToFile = path
+	defer func() { writeToFile = "" }()
+
+	for _, test := range []struct {
+		app    string
+		expect time.Time
+	}{
+		{"valid", expiration},
+		{"expired", time.Time{}},
+		{"expiring", time.Time{}},
+		{"missing", time.Time{}},
+	} {
+		t.Run(test.app, func(t *testing.T) {
+			got, err := storedExpiration(test.app)
+			if err != nil {
+				t.Fatalf("unexpected error %+v", err)
+			}
+			if !got.Equal(test.expect) {
+				t.Errorf("wrong expiration: got %v, want %v", got, test.expect)
+			}
+		})
+	}
+}
+
+// TestStoredExpirationAllOutputs verifies that stored credentials are only reused if every output
+// they would be written to holds valid credentials.
+func TestStoredExpirationAllOutputs(t *testing.T) {
+	keyring.MockInit()
+	viper.Reset()
+	defer viper.Reset()
+	viper.Set("global.cache-dir", t.TempDir())
+	viper.Set("global.json-cache.dir", t.TempDir())
+	viper.Set("global.json-cache.format", aws.JSONCacheFormatCLI)
+
+	path := filepath.Join(t.TempDir(), "credentials")
+	fileExp := time.Now().Add(time.Hour).Truncate(time.Second)
+	keychainExp := time.Now().Add(2 * time.Hour).Truncate(time.Second)
+	for _, app := range []string{"all", "no-json-cache", "file-only"} {
+		creds := &aws.Credentials{AccessKeyID: "key", SecretAccessKey: "secret", Expiration: fileExp}
+		if err := aws.WriteToFile(creds, path, app); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, app := range []string{"all", "no-json-cache", "keychain-only"} {
+		creds := &aws.Credentials{AccessKeyID: "key", SecretAccessKey: "secret", Expiration: keychainExp}
+		if err := storeInCache(creds, app); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	creds := &aws.Credentials{AccessKeyID: "key", SecretAccessKey: "secret", Expiration: keychainExp}
+	jsonPath, err := jsonCachePath("all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := aws.WriteJSONCache(creds, jsonPath, aws.JSONCacheFormatCLI); err != nil {
+		t.Fatal(err)
+	}
+
+	toKeychain, toJSONCache, writeToFile = true, true, path
+	defer func() { toKeychain, toJSONCache, writeToFile = false, false, "" }()
+
+	for _, test := range []struct {
+		app    string
+		expect time.Time
+	}{
+		{"all", fileExp},
+		{"no-json-cache", time.Time{}},
+		{"file-only", time.Time{}},
+		{"keychain-only", time.Time{}},
+	} {
+		t.Run(test.app, func(t *testing.T) {
+			got, err := storedExpiration(test.app)
+			if err != nil {
+				t.Fatalf("unexpected error %+v", err)
+			}
+			if !got.Equal(test.expect) {
+				t.Errorf("wrong expiration: got %v, want %v", got, test.expect)
+			}
+		})
+	}
+}
+
+func TestCheckIfExpired(t *testing.T) {
+	defer func() {
+		ifExpired, printToShell, toKeychain, toJSONCache = false, false, false, false
+		writeToFile, credentialField = "", ""
+	}()
+
+	for _, test := range []struct {
+		name        string
+		shell       bool
+		keychain    bool
+		jsonCache   bool
+		file        string
+		field       string
+		expectError bool
+	}{
+		{"Credentials file", false, false, false, "", "", false},
+		{"Keychain", false, true, false, "", "", false},
+		{"JSON cache and file", false, false, true, "/tmp/credentials", "", false},
+		{"Only JSON cache", false, false, true, "", "", false},
+		{"Shell", true, false, false, "", "", true},
+		{"Shell and file", true, false, false, "/tmp/credentials", "", true},
+		{"Field", false, false, false, "", "SessionToken", true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ifExpired = true
+			printToShell, toKeychain, toJSONCache = test.shell, test.keychain, test.jsonCache
+			writeToFile, credentialField = test.file, test.field
+
+			err := checkIfExpired()
+			if test.expectError && err == nil {
+				t.Error("expected an error")
+			}
+			if !test.expectError && err != nil {
+				t.Errorf("unexpected error %+v", err)
+			}
+		})
+	}
+}
+
+func TestCheckAccountChange(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+
+	path := filepath.Join(t.TempDir(), "credentials")
+	stored := &aws.Credentials{
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+		Expiration:      time.Now().Add(time.Hour),
+		RoleARN:         "arn:aws:iam::111111111111:role/Test",
+	}
+	if err := aws.WriteToFile(stored, path, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name        string
+		roleARN     string
+		section     string
+		noSave      bool
+		disabled    bool
+		expectError bool
+	}{
+		{"Same account", "arn:aws:iam::111111111111:role/Other", "test", false, false, false},
+		{"New profile", "arn:aws:iam::222222222222:role/Test", "other", false, false, false},
+		{"Unknown account", "", "test", false, false, false},
+		// stdin isn't a terminal in tests, so there is no one to confirm overwriting.
+		{"Different account", "arn:aws:iam::222222222222:role/Test", "test", false, false, true},
+		{"No save on mismatch", "arn:aws:iam::222222222222:role/Test", "test", true, false, true},
+		{"Check disabled", "arn:aws:iam::222222222222:role/Test", "test", true, true, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			noSaveOnMismatch = test.noSave
+			defer func() { noSaveOnMismatch = false }()
+			if test.disabled {
+				viper.Set("global.confirm-account-change", false)
+				defer viper.Set("global.confirm-account-change", nil)
+			}
+
+			creds := &aws.Credentials{RoleARN: test.roleARN}
+			err := checkAccountChange(creds, path, test.section)
+			if test.expectError && err == nil {
+				t.Error("expected error")
+			}
+			if !test.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestFormatExpiration(t *testing.T) {
+	exp := time.Date(2021, 2, 8, 18, 0, 0, 0, time.UTC)
+	if got := formatExpiration(exp, false); got != "2021-02-08T18:00:00Z" {
+		t.Errorf("wrong timestamp: got %s", got)
+	}
+	if got := formatExpiration(exp, true); got != "1612807200" {
+		t.Errorf("wrong epoch: got %s", got)
+	}
+}
+
+func TestProcessCredentialsShellAndFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	defer func() {
+		writeToFile = ""
+		printToShell = false
+	}()
+
+	creds := &aws.Credentials{
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+		Expiration:      time.Now().Add(time.Hour),
+	}
+
+	for _, test := range []struct {
+		name        string
+		shell       bool
+		file        string
+		expectFile  bool
+		expectShell bool
+	}{
+		{"Default", false, "", true, false},
+		{"Shell only", true, "", false, true},
+		{"Shell and file", true, path, true, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			os.Remove(path)
+			printToShell = test.shell
+			writeToFile = test.file
+			// The default credentials file is redirected to path as well.
+			viper.Set("global.credentials-path", path)
+			defer viper.Reset()
+
+			out := captureStdout(t, func() {
+				if err := processCredentials(creds, "test-app"); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			})
+
+			if got := strings.Contains(out, "AWS_ACCESS_KEY_ID"); got != test.expectShell {
+				t.Errorf("shell output: got %v, want %v", got, test.expectShell)
+			}
+			exp, err := validExpiration(path, "test-app")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := !exp.IsZero(); got != test.expectFile {
+				t.Errorf("credentials written to file: got %v, want %v", got, test.expectFile)
+			}
+		})
+	}
+}
+
+// captureStdout returns what f writes to os.Stdout.
+func captureStdout(t *testing.T, f func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = orig }()
+
+	f()
+	w.Close()
+
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
 }
 
-func TestSessionDuration(t *testing.T) {
-	for _, tc := range testdata {
-		viper.Set("apps.test.duration", tc.app)
-		viper.Set("providers.test.duration", tc.provider)
+func TestUsesSAML(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
 
-		res := sessionDuration("test", "test")
-		if res != tc.result {
-			t.Fatalf("Invalid duration: got %v, want: %v", res, tc.result)
+	viper.Set("providers.okta.type", "okta")
+	viper.Set("providers.okta-device.type", "okta")
+	viper.Set("providers.okta-device.auth-type", "device")
+	viper.Set("providers.onelogin.type", "onelogin")
+	viper.Set("providers.jumpcloud.type", "jumpcloud")
+	viper.Set("providers.rolesanywhere.type", "rolesanywhere")
+
+	for provider, want := range map[string]bool{
+		"okta":          true,
+		"okta-device":   false,
+		"onelogin":      true,
+		"jumpcloud":     true,
+		"rolesanywhere": false,
+		"missing":       false,
+	} {
+		if got := usesSAML(provider); got != want {
+			t.Errorf("%s: expected %v, got %v", provider, want, got)
 		}
 	}
 }
+
+func TestGetCredentialsSAMLOutput(t *testing.T) {
+	spinner.Disable()
+	viper.Reset()
+	defer viper.Reset()
+
+	idp := testserver.NewOkta()
+	defer idp.Close()
+	sts := testserver.NewSTS()
+	defer sts.Close()
+	setupTestSTS(t, sts)
+
+	setupTestOktaProvider(t, "test-provider", idp.URL, idp.Password)
+	viper.Set("apps.test-app.provider", "test-provider")
+	viper.Set("apps.test-app.url", idp.AppURL())
+
+	path := filepath.Join(t.TempDir(), "saml")
+	if err := cmdGet.Flags().Set("saml-out", path); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		samlOut = ""
+		cmdGet.Flags().Lookup("saml-out").Changed = false
+	}()
+
+	o, err := flagOverrides(cmdGet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds, err := getCredentials(cmdGet, "test-app", o)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if creds.RoleARN != testserver.RoleARN || creds.PrincipalARN != testserver.ProviderARN {
+		t.Errorf("wrong ARNs: got %s and %s", creds.RoleARN, creds.PrincipalARN)
+	}
+	if creds.AccessKeyID != "" {
+		t.Error("role was assumed although the assertion was written to a file")
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) == 0 {
+		t.Error("SAML assertion file is empty")
+	}
+}
+
+// TestGetCredentialsRemovedRole verifies that another role is selected and stored if the role
+// configured for an app was removed.
+func TestGetCredentialsRemovedRole(t *testing.T) {
+	spinner.Disable()
+	viper.Reset()
+	defer viper.Reset()
+
+	idp := testserver.NewOkta()
+	defer idp.Close()
+	sts := testserver.NewSTS()
+	defer sts.Close()
+	setupTestSTS(t, sts)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := ioutil.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	viper.SetConfigFile(path)
+
+	const removed = "arn:aws:iam::123456789012:role/Removed"
+	setupTestOktaProvider(t, "test-provider", idp.URL, idp.Password)
+	viper.Set("apps.test-app.provider", "test-provider")
+	viper.Set("apps.test-app.url", idp.AppURL())
+	viper.Set("apps.test-app.arn", removed)
+
+	// The role is required if it's specified explicitly.
+	roleARN = removed
+	_, err := getCredentials(cmdGet, "test-app", config.Overrides{})
+	roleARN = ""
+	if err == nil || !strings.Contains(err.Error(), "isn't available") {
+		t.Fatalf("expected unavailable role error, got %v", err)
+	}
+
+	creds, err := getCredentials(cmdGet, "test-app", config.Overrides{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if creds.RoleARN != testserver.RoleARN {
+		t.Errorf("wrong role: got %s, want %s", creds.RoleARN, testserver.RoleARN)
+	}
+
+	viper.Reset()
+	viper.SetConfigFile(path)
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if got := viper.GetString("apps.test-app.arn"); got != testserver.RoleARN {
+		t.Errorf("wrong stored role: got %s, want %s", got, testserver.RoleARN)
+	}
+}
+
+// TestGetCredentialsFlagOverrides verifies that flags take precedence over the configuration of
+// the provider without changing it.
+func TestGetCredentialsFlagOverrides(t *testing.T) {
+	spinner.Disable()
+	viper.Reset()
+	defer viper.Reset()
+
+	idp := testserver.NewOkta()
+	defer idp.Close()
+	sts := testserver.NewSTS()
+	defer sts.Close()
+	setupTestSTS(t, sts)
+
+	setupTestOktaProvider(t, "test-provider", idp.URL, idp.Password)
+	viper.Set("providers.test-provider.username", "someone-else@example.com")
+	viper.Set("apps.test-app.provider", "test-provider")
+	viper.Set("apps.test-app.url", idp.AppURL())
+
+	if err := cmdGet.Flags().Set("username", idp.Username); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		getUsername = ""
+		cmdGet.Flags().Lookup("username").Changed = false
+	}()
+
+	o, err := flagOverrides(cmdGet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := getCredentials(cmdGet, "test-app", o); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := viper.GetString("providers.test-provider.username"); got != "someone-else@example.com" {
+		t.Errorf("configured username changed to %s", got)
+	}
+
+	// Without the flags the configured username is used.
+	if _, err := getCredentials(nil, "test-app", config.Overrides{}); err == nil {
+		t.Error("expected an error authenticating as the configured user")
+	}
+}
+
+// TestUpdateRoleARN verifies that only the role of the app is written to the config file when
+// another role is stored, and not e.g. flags or defaults.
+func TestUpdateRoleARN(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+
+	const removed = "arn:aws:iam::123456789012:role/Removed"
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "providers:\n  test-provider:\n    type: okta\n    username: user@example.com\n" +
+		"apps:\n  test-app:\n    provider: test-provider\n    arn: " + removed + "\n"
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	viper.SetConfigFile(path)
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+	viper.SetDefault("global.json-cache.format", aws.JSONCacheFormatCLI)
+	viper.Set("providers.test-provider.reuse-session", true)
+	viper.Set("providers.test-provider.username", "other@example.com")
+
+	updateRoleARN("test-app", &aws.Credentials{RoleARN: testserver.RoleARN})
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"providers": map[string]interface{}{
+			"test-provider": map[string]interface{}{"type": "okta", "username": "user@example.com"},
+		},
+		"apps": map[string]interface{}{
+			"test-app": map[string]interface{}{"provider": "test-provider", "arn": testserver.RoleARN},
+		},
+	}
+	if got := v.AllSettings(); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong config file: got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,62 @@
+// +build !windows
+
+package cmd
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/allcloud-io/clisso/aws"
+	"github.com/spf13/viper"
+)
+
+func TestWriteToPipe(t *testing.T) {
+	creds := &aws.Credentials{
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+		Expiration:      time.Now().Add(time.Hour),
+	}
+
+	for _, test := range []struct {
+		format string
+		expect string
+	}{
+		{"", "[test]"},
+		{"ini", "aws_session_token"},
+		{"json", `"SessionToken":"token"`},
+		{"env", "export AWS_SESSION_TOKEN=token"},
+	} {
+		t.Run(test.format, func(t *testing.T) {
+			viper.Reset()
+			defer viper.Reset()
+			viper.Set("global.pipe-format", test.format)
+
+			path := filepath.Join(t.TempDir(), "fifo")
+			if err := syscall.Mkfifo(path, 0600); err != nil {
+				t.Fatal(err)
+			}
+			if !aws.IsPipe(path) {
+				t.Fatal("fifo not detected as a pipe")
+			}
+
+			errs := make(chan error, 1)
+			go func() { errs <- writeToPipe(creds, path, "test") }()
+
+			out, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := <-errs; err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !strings.Contains(string(out), test.expect) {
+				t.Errorf("output doesn't contain %q: %s", test.expect, out)
+			}
+		})
+	}
+}
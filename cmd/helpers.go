@@ -1,15 +1,69 @@
 package cmd
 
 import (
+	"fmt"
 	"log"
 
+	"github.com/allcloud-io/clisso/config"
 	"github.com/fatih/color"
+	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
 )
 
-func mandatoryFlag(cmd *cobra.Command, name string)  {
+func mandatoryFlag(cmd *cobra.Command, name string) {
 	err := cmd.MarkFlagRequired(name)
 	if err != nil {
 		log.Fatalf(color.RedString("Error marking flag %s as required: %v"), name, err)
 	}
-}
\ No newline at end of file
+}
+
+// flagOverrides returns the settings given using the flags of cmd which take precedence over the
+// configuration of apps and providers. Flags which cmd doesn't have or which weren't specified on
+// the command line don't override anything. If cmd is nil, nothing is overridden.
+func flagOverrides(cmd *cobra.Command) (config.Overrides, error) {
+	var o config.Overrides
+	if cmd == nil {
+		return o, nil
+	}
+
+	f := cmd.Flags()
+	if f.Changed("username") {
+		o.Username = getUsername
+	}
+	if f.Changed("password-file") {
+		o.PasswordFile = passwordFile
+	}
+	if f.Changed("mfa-code") {
+		o.MFACode = mfaCode
+	}
+	if f.Changed("refresh") {
+		reuse := refreshSession
+		o.ReuseSession = &reuse
+	}
+	if f.Changed("mfa-poll-interval") {
+		if mfaPollInterval <= 0 {
+			return o, fmt.Errorf("invalid --mfa-poll-interval '%v': must be a positive duration such as 2s", mfaPollInterval)
+		}
+		o.MFAPollInterval = mfaPollInterval
+	}
+	if f.Changed("mfa-poll-attempts") {
+		if mfaPollAttempts <= 0 {
+			return o, fmt.Errorf("invalid --mfa-poll-attempts '%d': must be a positive integer", mfaPollAttempts)
+		}
+		o.MFAPollAttempts = mfaPollAttempts
+	}
+	if f.Changed("session-name") {
+		o.SessionName = sessionName
+	}
+	if f.Changed("sts-endpoint") {
+		o.STSEndpoint = stsEndpointFlag
+	}
+	if f.Changed("saml-out") {
+		path, err := homedir.Expand(samlOut)
+		if err != nil {
+			return o, fmt.Errorf("expanding --saml-out: %v", err)
+		}
+		o.SAMLOutput = path
+	}
+	return o, nil
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"github.com/allcloud-io/clisso/aws"
+	"github.com/fatih/color"
+)
+
+// shellCommand returns a command which runs command using the user's shell.
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	return exec.Command(shell, "-c", command)
+}
+
+// runPostHook runs hook using the user's shell after credentials for app were obtained. The hook
+// receives the following environment variables:
+//
+//	CLISSO_APP         the name of the app
+//	CLISSO_PROFILE     the section the credentials were written to, if written to a file
+//	CLISSO_EXPIRATION  the expiration time of the credentials in RFC 3339 format
+//
+// The output of the hook is written to stderr to keep stdout free for credentials. Failures of the
+// hook are reported as warnings.
+func runPostHook(hook, app, profile string, creds *aws.Credentials) {
+	c := shellCommand(hook)
+	c.Env = append(os.Environ(),
+		"CLISSO_APP="+app,
+		"CLISSO_PROFILE="+profile,
+		"CLISSO_EXPIRATION="+creds.Expiration.UTC().Format(time.RFC3339),
+	)
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stderr
+	c.Stderr = os.Stderr
+
+	if err := c.Run(); err != nil {
+		log.Printf(color.YellowString("Post hook '%s' failed: %v"), hook, err)
+	}
+}
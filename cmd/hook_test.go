@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/allcloud-io/clisso/aws"
+)
+
+func TestRunPostHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the hook uses POSIX shell syntax")
+	}
+
+	out := filepath.Join(t.TempDir(), "out")
+	creds := &aws.Credentials{Expiration: time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC)}
+
+	runPostHook(`echo "$CLISSO_APP $CLISSO_PROFILE $CLISSO_EXPIRATION" > `+out, "my-app", "my-profile", creds)
+
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatalf("hook didn't run: %v", err)
+	}
+	want := "my-app my-profile 2021-02-03T04:05:06Z\n"
+	if string(b) != want {
+		t.Errorf("wrong hook environment: got %q, want %q", b, want)
+	}
+
+	// A failing hook must not abort.
+	runPostHook("exit 3", "my-app", "my-profile", creds)
+}
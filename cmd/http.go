@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+
+	"github.com/allcloud-io/clisso/clisso"
+	"github.com/spf13/viper"
+)
+
+// newHTTPClient returns the HTTP client used for requests to the identity provider provider and to
+// STS. If provider is empty, the global settings are used. The --timeout flag takes precedence over
+// the timeout of provider if it was specified on the command line.
+func newHTTPClient(provider string) (*http.Client, error) {
+	hc, err := clisso.NewHTTPClient(provider)
+	if err != nil {
+		return nil, err
+	}
+	if RootCmd.PersistentFlags().Changed("timeout") {
+		if httpTimeout <= 0 {
+			return nil, fmt.Errorf("invalid --timeout '%v': must be a positive duration such as 30s", httpTimeout)
+		}
+		hc.Timeout = httpTimeout
+	}
+	hc.Transport = &userAgentTransport{base: hc.Transport, userAgent: userAgent()}
+	return hc, nil
+}
+
+// userAgent returns the value of global.user-agent, or a User-Agent which identifies the version
+// and platform of clisso if global.user-agent isn't set.
+func userAgent() string {
+	if ua := viper.GetString("global.user-agent"); ua != "" {
+		return ua
+	}
+	return fmt.Sprintf("clisso/%s (%s; %s)", VERSION, runtime.GOOS, runtime.GOARCH)
+}
+
+// userAgentTransport is an http.RoundTripper which sets the User-Agent header of requests before
+// sending them using base. A User-Agent which is already set on a request, such as the one set by
+// the AWS SDK, is appended to userAgent.
+type userAgentTransport struct {
+	base      http.RoundTripper
+	userAgent string
+}
+
+func (t *userAgentTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	// A RoundTripper must not modify the given request.
+	r = r.Clone(r.Context())
+
+	ua := t.userAgent
+	if existing := r.Header.Get("User-Agent"); existing != "" {
+		ua += " " + existing
+	}
+	r.Header.Set("User-Agent", ua)
+
+	return t.base.RoundTrip(r)
+}
+
+// Unwrap returns the RoundTripper t sends requests with.
+func (t *userAgentTransport) Unwrap() http.RoundTripper {
+	return t.base
+}
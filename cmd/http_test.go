@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/allcloud-io/clisso/config"
+	"github.com/spf13/viper"
+)
+
+func TestNewHTTPClient(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		global      string
+		provider    string
+		expect      time.Duration
+		expectError bool
+	}{
+		{"Default", "", "", config.DefaultHTTPTimeout, false},
+		{"Global", "10s", "", 10 * time.Second, false},
+		{"Provider overrides global", "10s", "2m", 2 * time.Minute, false},
+		{"Invalid provider timeout", "", "soon", 0, true},
+		{"Negative global timeout", "-5s", "", 0, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			viper.Reset()
+			defer viper.Reset()
+			if test.global != "" {
+				viper.Set("global.http-timeout", test.global)
+			}
+			if test.provider != "" {
+				viper.Set("providers.slow.http-timeout", test.provider)
+			}
+
+			hc, err := newHTTPClient("slow")
+			if test.expectError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %+v", err)
+			}
+			if hc.Timeout != test.expect {
+				t.Errorf("wrong timeout: got %v, want %v", hc.Timeout, test.expect)
+			}
+		})
+	}
+}
+
+func TestTLSMinVersion(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		version     string
+		expect      uint16
+		expectError bool
+	}{
+		{"Default", "", tls.VersionTLS12, false},
+		{"TLS 1.3", "1.3", tls.VersionTLS13, false},
+		{"Unknown version", "1.4", 0, true},
+		{"Invalid format", "TLSv1.2", 0, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			viper.Reset()
+			defer viper.Reset()
+			if test.version != "" {
+				viper.Set("global.tls-min-version", test.version)
+			}
+
+			hc, err := newHTTPClient("")
+			if test.expectError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %+v", err)
+			}
+
+			base := hc.Transport.(*userAgentTransport).base.(*http.Transport)
+			if got := base.TLSClientConfig.MinVersion; got != test.expect {
+				t.Errorf("wrong minimum TLS version: got %x, want %x", got, test.expect)
+			}
+		})
+	}
+
+	// A server which doesn't support the minimum version is rejected.
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	ts.StartTLS()
+	defer ts.Close()
+
+	rootCAs := ts.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+
+	viper.Reset()
+	defer viper.Reset()
+	for _, version := range []string{"1.2", "1.3"} {
+		viper.Set("global.tls-min-version", version)
+
+		hc, err := newHTTPClient("")
+		if err != nil {
+			t.Fatalf("unexpected error %+v", err)
+		}
+		hc.Transport.(*userAgentTransport).base.(*http.Transport).TLSClientConfig.RootCAs = rootCAs
+
+		_, err = hc.Get(ts.URL)
+		if version == "1.2" && err != nil {
+			t.Errorf("unexpected error with minimum version %s: %v", version, err)
+		}
+		if version == "1.3" && err == nil {
+			t.Errorf("expected the TLS 1.2 server to be rejected with minimum version %s", version)
+		}
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	var got []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("User-Agent"))
+	}))
+	defer ts.Close()
+
+	viper.Reset()
+	defer viper.Reset()
+	VERSION = "1.4.0"
+	defer func() { VERSION = "" }()
+
+	hc, err := newHTTPClient("")
+	if err != nil {
+		t.Fatalf("unexpected error %+v", err)
+	}
+
+	if _, err := hc.Get(ts.URL); err != nil {
+		t.Fatalf("unexpected error %+v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	req.Header.Set("User-Agent", "aws-sdk-go/1.37.8")
+	if _, err := hc.Do(req); err != nil {
+		t.Fatalf("unexpected error %+v", err)
+	}
+	if req.Header.Get("User-Agent") != "aws-sdk-go/1.37.8" {
+		t.Error("request was modified")
+	}
+
+	viper.Set("global.user-agent", "custom-agent")
+	hc, err = newHTTPClient("")
+	if err != nil {
+		t.Fatalf("unexpected error %+v", err)
+	}
+	if _, err := hc.Get(ts.URL); err != nil {
+		t.Fatalf("unexpected error %+v", err)
+	}
+
+	def := fmt.Sprintf("clisso/1.4.0 (%s; %s)", runtime.GOOS, runtime.GOARCH)
+	want := []string{def, def + " aws-sdk-go/1.37.8", "custom-agent"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong User-Agent headers: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/allcloud-io/clisso/aws"
+	"github.com/allcloud-io/clisso/config"
+	"github.com/spf13/cobra"
+)
+
+// defaultProfile is the profile the AWS CLI uses if no profile is specified.
+const defaultProfile = "default"
+
+var inspectProfile string
+var inspectFile string
+
+func init() {
+	RootCmd.AddCommand(cmdInspect)
+	cmdInspect.Flags().StringVar(
+		&inspectProfile, "profile", "",
+		"Profile to inspect (default is $AWS_PROFILE or \"default\")",
+	)
+	cmdInspect.Flags().StringVarP(
+		&inspectFile, "read-from-file", "r", "",
+		"Read credentials from this file instead of the default ($AWS_SHARED_CREDENTIALS_FILE or $HOME/.aws/credentials)",
+	)
+}
+
+var cmdInspect = &cobra.Command{
+	Use:   "inspect",
+	Short: "Show who the credentials of a profile belong to",
+	Long: `Read the credentials of a profile from the credentials file and call STS GetCallerIdentity
+using them. This confirms the credentials work and shows the account, ARN and user ID they belong
+to along with their expiration. The identity provider isn't contacted.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		profile := targetProfile(inspectProfile)
+		path, err := credentialsPath(inspectFile, "")
+		if err != nil {
+			fatalf(codeConfig, "Failed to expand home: %s", err)
+		}
+		hc, err := newHTTPClient("")
+		if err != nil {
+			fatalf(codeConfig, "%v", err)
+		}
+
+		creds, id, err := inspectCredentials(path, profile, hc)
+		if err != nil {
+			fatalf(codeOf(err, codeError), "Could not inspect profile '%s': %v", profile, err)
+		}
+		printInspection(os.Stdout, profile, creds, id)
+	},
+}
+
+// targetProfile returns the profile to inspect using the following order of preference: flag ->
+// AWS_PROFILE -> defaultProfile.
+func targetProfile(flag string) string {
+	if flag != "" {
+		return flag
+	}
+	if p := os.Getenv("AWS_PROFILE"); p != "" {
+		return p
+	}
+	return defaultProfile
+}
+
+// inspectCredentials reads the credentials of profile from the credentials file at path and
+// returns them along with the identity STS reports for them. Expired credentials are reported
+// without contacting STS. If profile is named after an app, the STS endpoint of the app is used.
+func inspectCredentials(path, profile string, hc *http.Client) (*aws.Credentials, *aws.CallerIdentity, error) {
+	creds, err := aws.ReadFromFile(path, profile)
+	if err != nil {
+		return nil, nil, withCode(codeConfig, err)
+	}
+	endpoint, err := config.GetSTSEndpoint(profile, "")
+	if err != nil {
+		return nil, nil, withCode(codeConfig, err)
+	}
+
+	if !creds.Expiration.IsZero() && time.Now().After(creds.Expiration) {
+		return nil, nil, withCode(codeAuthFailed, fmt.Errorf("the credentials expired at %s; get new "+
+			"credentials using 'clisso get'", creds.Expiration.Local().Format(time.RFC3339)))
+	}
+
+	id, err := aws.GetCallerIdentity(creds, endpoint, hc)
+	if err != nil {
+		if err.Error() == aws.ErrCredentialsExpired {
+			err = fmt.Errorf("%v; get new credentials using 'clisso get'", err)
+		}
+		return nil, nil, withCode(codeAuthFailed, fmt.Errorf("calling STS: %v", err))
+	}
+
+	return creds, id, nil
+}
+
+// printInspection writes the identity of the credentials of profile to w.
+func printInspection(w io.Writer, profile string, creds *aws.Credentials, id *aws.CallerIdentity) {
+	expiration := "unknown"
+	if !creds.Expiration.IsZero() {
+		expiration = fmt.Sprintf("%s (%s remaining)", creds.Expiration.Local().Format(time.RFC3339),
+			time.Until(creds.Expiration).Round(time.Second))
+	}
+
+	fmt.Fprintf(w, "Profile:    %s\n", profile)
+	fmt.Fprintf(w, "Account:    %s\n", id.Account)
+	fmt.Fprintf(w, "ARN:        %s\n", id.ARN)
+	fmt.Fprintf(w, "User ID:    %s\n", id.UserID)
+	fmt.Fprintf(w, "Expiration: %s\n", expiration)
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/allcloud-io/clisso/aws"
+	"github.com/allcloud-io/clisso/internal/testserver"
+)
+
+func TestInspectCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	for section, creds := range map[string]*aws.Credentials{
+		"valid": {AccessKeyID: testserver.AccessKeyID, SecretAccessKey: testserver.SecretAccessKey,
+			SessionToken: testserver.SessionToken, Expiration: time.Now().Add(time.Hour)},
+		"revoked": {AccessKeyID: "ASIAREVOKED", SecretAccessKey: "secret", SessionToken: "token",
+			Expiration: time.Now().Add(time.Hour)},
+	} {
+		if err := aws.WriteToFile(creds, path, section); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// WriteToFile removes expired credentials, so expired credentials are appended directly.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(f, "\n[expired]\naws_access_key_id = %s\naws_secret_access_key = %s\naws_expiration = %s\n",
+		testserver.AccessKeyID, testserver.SecretAccessKey, time.Now().Add(-time.Minute).UTC().Format(time.RFC3339))
+	f.Close()
+
+	for _, test := range []struct {
+		name        string
+		profile     string
+		stsExpired  bool
+		expectError string
+		expectCode  errorCode
+	}{
+		{name: "Valid", profile: "valid"},
+		{name: "Expired at STS", profile: "valid", stsExpired: true, expectError: aws.ErrCredentialsExpired,
+			expectCode: codeAuthFailed},
+		{name: "Rejected by STS", profile: "revoked", expectError: "InvalidClientTokenId",
+			expectCode: codeAuthFailed},
+		{name: "Expired", profile: "expired", expectError: "expired at", expectCode: codeAuthFailed},
+		{name: "Missing profile", profile: "missing", expectError: "not found", expectCode: codeConfig},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			sts := testserver.NewSTS()
+			defer sts.Close()
+			sts.Expired = test.stsExpired
+			setupTestSTS(t, sts)
+
+			creds, id, err := inspectCredentials(path, test.profile, nil)
+			if test.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expectError) {
+					t.Fatalf("expected error containing %q, got %v", test.expectError, err)
+				}
+				if code := codeOf(err, codeError); code != test.expectCode {
+					t.Errorf("wrong error code: got %q, want %q", code, test.expectCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if creds.AccessKeyID != testserver.AccessKeyID {
+				t.Errorf("wrong access key ID: got %q, want %q", creds.AccessKeyID, testserver.AccessKeyID)
+			}
+			if id.ARN != testserver.CallerARN {
+				t.Errorf("wrong ARN: got %q, want %q", id.ARN, testserver.CallerARN)
+			}
+			if id.Account != "123456789012" {
+				t.Errorf("wrong account: got %q, want %q", id.Account, "123456789012")
+			}
+		})
+	}
+}
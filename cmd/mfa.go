@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/allcloud-io/clisso/okta"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	cmdMFAList.Flags().StringVar(&provider, "provider", "", "Name of the Clisso provider")
+	mandatoryFlag(cmdMFAList, "provider")
+
+	RootCmd.AddCommand(cmdMFA)
+	cmdMFA.AddCommand(cmdMFAList)
+}
+
+var cmdMFA = &cobra.Command{
+	Use:   "mfa",
+	Short: "Inspect MFA factors",
+	Long:  "View the MFA factors enrolled at identity providers.",
+}
+
+var cmdMFAList = &cobra.Command{
+	Use:   "list",
+	Short: "List the MFA factors enrolled at a provider",
+	Long: `Authenticate against the specified provider using a username and password only and
+list the MFA factors offered for verification, along with their types and IDs. No credentials are
+obtained. Only Okta providers are currently supported.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		pType := viper.GetString(fmt.Sprintf("providers.%s.type", provider))
+		if pType == "" {
+			fatalf(codeUsage, "Provider '%s' doesn't exist", provider)
+		}
+		if pType != "okta" {
+			fatalf(codeUsage, "Listing MFA factors isn't supported for provider type '%s'", pType)
+		}
+
+		hc, err := newHTTPClient(provider)
+		if err != nil {
+			fatalf(codeConfig, "%v", err)
+		}
+
+		factors, err := okta.Factors(provider, hc)
+		if err != nil {
+			fatalf(codeAuthFailed, "Could not list MFA factors: %v", err)
+		}
+
+		if len(factors) == 0 {
+			log.Printf("MFA isn't required by provider '%s'", provider)
+			return
+		}
+
+		// Factor profiles contain details such as phone numbers, so only non-sensitive
+		// attributes are printed.
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"ID", "Type", "Vendor"})
+		for _, f := range factors {
+			table.Append([]string{f.ID, f.FactorType, f.Provider})
+		}
+		table.Render()
+	},
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var prewarmTags []string
+var prewarmConcurrency int
+
+func init() {
+	RootCmd.AddCommand(cmdPrewarm)
+	cmdPrewarm.Flags().StringArrayVar(
+		&prewarmTags, "tag", nil,
+		"Only pre-warm apps which have this tag in apps.<app>.tags (can be repeated)",
+	)
+	cmdPrewarm.Flags().IntVar(
+		&prewarmConcurrency, "concurrency", defaultRefreshConcurrency,
+		"Maximum number of apps to refresh at once once the identity provider sessions are established",
+	)
+}
+
+// staleApps returns the apps which have no stored credentials which are still usable, i.e. which
+// don't expire within global.expiry-buffer. Apps whose stored credentials can't be read are
+// considered stale.
+func staleApps(apps []string) []string {
+	var stale []string
+	for _, app := range apps {
+		if exp, err := storedExpiration(app); err != nil || exp.IsZero() {
+			stale = append(stale, app)
+		}
+	}
+	return stale
+}
+
+// prewarmSummary returns a one-line summary of pre-warming total apps, of which the apps in
+// results were refreshed.
+func prewarmSummary(total int, results []refreshResult) string {
+	var failed []string
+	for _, r := range results {
+		if r.err != nil {
+			failed = append(failed, r.app)
+		}
+	}
+
+	summary := fmt.Sprintf("%d refreshed, %d already fresh, %d failed", len(results)-len(failed),
+		total-len(results), len(failed))
+	if len(failed) > 0 {
+		summary += ": " + strings.Join(failed, ", ")
+	}
+	return summary
+}
+
+var cmdPrewarm = &cobra.Command{
+	Use:   "prewarm",
+	Short: "Get temporary credentials for the day for all tagged apps",
+	Long: `Obtain temporary credentials for every configured app, or for the apps which have all
+of the tags given using --tag, e.g. from a login hook at the start of the day. Apps whose stored
+credentials are still usable are skipped, and a one-line summary is printed at the end. The command
+fails if any app failed.
+
+Okta sessions are always reused, and the first app of each provider is refreshed before any other
+app, one provider at a time, so that the user authenticates and approves MFA once per provider
+when prompted one after another. The remaining apps are then refreshed using the established
+sessions, up to --concurrency at once. Providers which can't reuse sessions authenticate for each
+of their apps.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if prewarmConcurrency < 1 {
+			fatalf(codeUsage, "--concurrency must be at least 1")
+		}
+		apps := appsWithTags(appNames(), prewarmTags)
+		if len(apps) == 0 {
+			fatalf(codeUsage, "No apps to pre-warm")
+		}
+
+		stale := staleApps(apps)
+		var results []refreshResult
+		if len(stale) > 0 {
+			results = refreshApps(stale, true, 1, prewarmConcurrency)
+		}
+
+		summary := prewarmSummary(len(apps), results)
+		for _, r := range results {
+			if r.err != nil {
+				fatalf(codeAuthFailed, "Could not pre-warm credentials: %s", summary)
+			}
+		}
+		if !quiet {
+			log.Println(color.GreenString(summary))
+		}
+	},
+}
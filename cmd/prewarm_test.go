@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/allcloud-io/clisso/aws"
+	"github.com/spf13/viper"
+)
+
+func TestStaleApps(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+
+	path := filepath.Join(t.TempDir(), "credentials")
+	writeToFile = path
+	defer func() { writeToFile = "" }()
+
+	for app, expiration := range map[string]time.Time{
+		"fresh":    time.Now().Add(time.Hour),
+		"expiring": time.Now().Add(time.Minute),
+	} {
+		creds := &aws.Credentials{AccessKeyID: "key", SecretAccessKey: "secret", Expiration: expiration}
+		if err := aws.WriteToFile(creds, path, app); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := staleApps([]string{"expiring", "fresh", "missing"})
+	if want := []string{"expiring", "missing"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong stale apps: got %v, want %v", got, want)
+	}
+}
+
+func TestPrewarmSummary(t *testing.T) {
+	results := []refreshResult{{app: "a"}, {app: "b", err: errors.New("failed")}, {app: "c"}}
+	if got, want := prewarmSummary(5, results), "2 refreshed, 2 already fresh, 1 failed: b"; got != want {
+		t.Errorf("wrong summary: got %q, want %q", got, want)
+	}
+	if got, want := prewarmSummary(2, nil), "0 refreshed, 2 already fresh, 0 failed"; got != want {
+		t.Errorf("wrong summary: got %q, want %q", got, want)
+	}
+}
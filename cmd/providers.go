@@ -5,13 +5,15 @@ import (
 	"log"
 	"sort"
 	"strconv"
-	"syscall"
+	"time"
 
+	"github.com/allcloud-io/clisso/config"
 	"github.com/allcloud-io/clisso/keychain"
+	"github.com/allcloud-io/clisso/prompt"
+	"github.com/allcloud-io/clisso/totp"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"golang.org/x/term"
 )
 
 // OneLogin
@@ -22,8 +24,21 @@ var username string
 var region string
 var providerDuration int
 
+// Password
+var passwdUsername string
+
 // Okta
 var baseURL string
+var oktaAuthType string
+
+// JumpCloud
+var jumpCloudBaseURL string
+
+// Roles Anywhere
+var trustAnchorARN string
+var profileARN string
+var certificate string
+var privateKey string
 
 func init() {
 	// OneLogin
@@ -47,16 +62,50 @@ func init() {
 	cmdProvidersCreateOkta.Flags().StringVar(&username, "username", "",
 		"Don't ask for a username and use this instead")
 	cmdProvidersCreateOkta.Flags().IntVar(&providerDuration, "duration", 0, "(Optional) Default session duration in seconds")
+	cmdProvidersCreateOkta.Flags().StringVar(&oktaAuthType, "auth-type", config.OktaAuthTypePassword,
+		"How users authenticate: password or device")
+	cmdProvidersCreateOkta.Flags().StringVar(&clientID, "client-id", "",
+		"Client ID of the OIDC app used for device authorization (required with --auth-type device)")
 
 	mandatoryFlag(cmdProvidersCreateOkta, "base-url")
 
+	// JumpCloud
+	cmdProvidersCreateJumpCloud.Flags().StringVar(&username, "username", "",
+		"Don't ask for an email and use this instead")
+	cmdProvidersCreateJumpCloud.Flags().StringVar(&jumpCloudBaseURL, "base-url", "",
+		"(Optional) Base URL of the JumpCloud user console (default "+config.DefaultJumpCloudBaseURL+")")
+	cmdProvidersCreateJumpCloud.Flags().IntVar(&providerDuration, "duration", 0, "(Optional) Default session duration in seconds")
+
+	// Roles Anywhere
+	cmdProvidersCreateRolesAnywhere.Flags().StringVar(&trustAnchorARN, "trust-anchor-arn", "",
+		"ARN of the Roles Anywhere trust anchor")
+	cmdProvidersCreateRolesAnywhere.Flags().StringVar(&profileARN, "profile-arn", "",
+		"ARN of the Roles Anywhere profile")
+	cmdProvidersCreateRolesAnywhere.Flags().StringVar(&certificate, "certificate", "",
+		"Path of the PEM-encoded X.509 certificate")
+	cmdProvidersCreateRolesAnywhere.Flags().StringVar(&privateKey, "private-key", "",
+		"Path of the PEM-encoded private key of the certificate")
+	cmdProvidersCreateRolesAnywhere.Flags().IntVar(&providerDuration, "duration", 0, "(Optional) Default session duration in seconds")
+
+	mandatoryFlag(cmdProvidersCreateRolesAnywhere, "trust-anchor-arn")
+	mandatoryFlag(cmdProvidersCreateRolesAnywhere, "profile-arn")
+	mandatoryFlag(cmdProvidersCreateRolesAnywhere, "certificate")
+	mandatoryFlag(cmdProvidersCreateRolesAnywhere, "private-key")
+
+	// Password
+	cmdProvidersPassword.Flags().StringVar(&passwdUsername, "username", "",
+		"Username the password belongs to instead of the configured one")
+
 	// Build command tree
 	RootCmd.AddCommand(cmdProviders)
 	cmdProviders.AddCommand(cmdProvidersList)
 	cmdProviders.AddCommand(cmdProvidersPassword)
+	cmdProviders.AddCommand(cmdProvidersTOTPSecret)
 	cmdProviders.AddCommand(cmdProvidersCreate)
 	cmdProvidersCreate.AddCommand(cmdProvidersCreateOneLogin)
 	cmdProvidersCreate.AddCommand(cmdProvidersCreateOkta)
+	cmdProvidersCreate.AddCommand(cmdProvidersCreateJumpCloud)
+	cmdProvidersCreate.AddCommand(cmdProvidersCreateRolesAnywhere)
 }
 
 var cmdProviders = &cobra.Command{
@@ -65,54 +114,114 @@ var cmdProviders = &cobra.Command{
 	Long:  `View and change provider configuration.`,
 }
 
+// providerNames returns the names of all configured providers in alphabetical order.
+func providerNames() []string {
+	providers := viper.GetStringMap("providers")
+
+	keys := make([]string, 0, len(providers))
+	for k := range providers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
 var cmdProvidersList = &cobra.Command{
 	Use:   "ls",
 	Short: "List providers",
 	Long:  "List all configured providers.",
 	Run: func(cmd *cobra.Command, args []string) {
-		providers := viper.GetStringMap("providers")
+		providers := providerNames()
 
 		if len(providers) == 0 {
 			log.Println("No providers configured")
 			return
 		}
 
-		// Sort apps alphabetically
-		keys := make([]string, 0, len(providers))
-		for k := range providers {
-			keys = append(keys, k)
-		}
-		sort.Strings(keys)
-		for _, k := range keys {
-			log.Println(k)
+		for _, p := range providers {
+			log.Println(p)
 		}
 	},
 }
 
+// passwordUsername returns the username the password of provider is stored for: the username
+// given by --username or configured for provider, or else the username entered by the user. The
+// username suffix of provider is appended as when authenticating.
+func passwordUsername(provider string) (string, error) {
+	user := passwdUsername
+	if user == "" {
+		user = viper.GetString(fmt.Sprintf("providers.%s.username", provider))
+	}
+	if user == "" {
+		var err error
+		user, err = prompt.Username("Username", "use --username to specify the username")
+		if err != nil {
+			return "", err
+		}
+	}
+	return config.AddUsernameSuffix(user, viper.GetString(fmt.Sprintf("providers.%s.username-suffix", provider))), nil
+}
+
 var cmdProvidersPassword = &cobra.Command{
 	Use:   "passwd",
 	Short: "Save password in KeyChain for provider",
-	Long:  "Save password in KeyChain for provider, see github.com/tmc/keyring for supported stores.",
-	Args:  cobra.ExactArgs(1),
+	Long: `Save password in KeyChain for provider, see github.com/tmc/keyring for supported stores.
+
+The username the password belongs to is stored along with it, so that Clisso can warn when
+authenticating as a different user with the stored password.`,
+	Args: cobra.ExactArgs(1),
 
 	Run: func(cmd *cobra.Command, args []string) {
 		provider := args[0]
-		fmt.Printf("Please enter the password for the '%s' provider: ", provider)
-		pass, err := term.ReadPassword(int(syscall.Stdin))
+		user, err := passwordUsername(provider)
 		if err != nil {
-			log.Fatalf(color.RedString("Could not read password"))
+			fatalf(codeError, "Could not read username: %v", err)
+		}
+		pass, err := prompt.Password(provider, "run the command in a terminal")
+		if err != nil {
+			fatalf(codeError, "Could not read password: %v", err)
 		}
 
 		keyChain := keychain.DefaultKeychain{}
 
 		err = keyChain.Set(provider, pass)
 		if err != nil {
-			log.Fatalf("Could not save to keychain: %+v", err)
+			fatalf(codeError, "Could not save to keychain: %+v", err)
+		}
+		if err := keychain.SetUsername(provider, user); err != nil {
+			fatalf(codeError, "Could not save username to keychain: %v", err)
 		}
 		log.Printf(color.GreenString("Saved password for Provider '%s'"), provider)
 	},
 }
 
+var cmdProvidersTOTPSecret = &cobra.Command{
+	Use:   "totp-secret [ref]",
+	Short: "Save a TOTP secret in the keychain",
+	Long: `Save the base32 encoded TOTP secret shown by the identity provider when enrolling an
+authenticator app in the keychain under the name ref. The secret is read without echoing it.
+
+To generate MFA codes from the secret, set totp-secret-ref to ref for the provider.`,
+	Args: cobra.ExactArgs(1),
+
+	Run: func(cmd *cobra.Command, args []string) {
+		ref := args[0]
+		secret, err := prompt.Secret("Please enter the TOTP secret: ", "run the command in a terminal")
+		if err != nil {
+			fatalf(codeError, "Could not read TOTP secret: %v", err)
+		}
+		if _, err := totp.Code(string(secret), time.Now()); err != nil {
+			fatalf(codeUsage, "Invalid TOTP secret: %v", err)
+		}
+
+		if err := keychain.SetTOTPSecret(ref, secret); err != nil {
+			fatalf(codeError, "Could not save TOTP secret to keychain: %v", err)
+		}
+		log.Printf(color.GreenString("Saved TOTP secret '%s'"), ref)
+	},
+}
+
 var cmdProvidersCreate = &cobra.Command{
 	Use:   "create",
 	Short: "Create a new provider",
@@ -129,13 +238,13 @@ var cmdProvidersCreateOneLogin = &cobra.Command{
 
 		// Verify provider doesn't exist
 		if exists := viper.Get("providers." + name); exists != nil {
-			log.Fatalf(color.RedString("Provider '%s' already exists"), name)
+			fatalf(codeUsage, "Provider '%s' already exists", name)
 		}
 
 		switch region {
 		case "US", "EU":
 		default:
-			log.Fatal(color.RedString("Region must be either US or EU"))
+			fatalf(codeUsage, "Region must be either US or EU")
 		}
 
 		conf := map[string]string{
@@ -149,16 +258,16 @@ var cmdProvidersCreateOneLogin = &cobra.Command{
 		if providerDuration != 0 {
 			// Duration specified - validate value
 			if providerDuration < 3600 || providerDuration > 43200 {
-				log.Fatal(color.RedString("Invalid duration Specified. Valid values: 3600 - 43200"))
+				fatalf(codeUsage, "Invalid duration Specified. Valid values: 3600 - 43200")
 			}
 			conf["duration"] = strconv.Itoa(providerDuration)
 		}
-		viper.Set(fmt.Sprintf("providers.%s", name), conf)
-
 		// Write config to file
-		err := viper.WriteConfig()
+		err := updateConfigFile(func(v *viper.Viper) {
+			v.Set(fmt.Sprintf("providers.%s", name), conf)
+		})
 		if err != nil {
-			log.Fatalf(color.RedString("Error writing config: %v"), err)
+			fatalf(codeConfig, "Error writing config: %v", err)
 		}
 		log.Printf(color.GreenString("Provider '%s' saved to config file"), name)
 	},
@@ -174,7 +283,7 @@ var cmdProvidersCreateOkta = &cobra.Command{
 
 		// Verify provider doesn't exist
 		if exists := viper.Get("providers." + name); exists != nil {
-			log.Fatalf(color.RedString("Provider '%s' already exists"), name)
+			fatalf(codeUsage, "Provider '%s' already exists", name)
 		}
 
 		conf := map[string]string{
@@ -182,19 +291,109 @@ var cmdProvidersCreateOkta = &cobra.Command{
 			"type":     "okta",
 			"username": username,
 		}
+		switch oktaAuthType {
+		case config.OktaAuthTypePassword:
+		case config.OktaAuthTypeDevice:
+			if clientID == "" {
+				fatalf(codeUsage, "--client-id is required for device authorization")
+			}
+			conf["auth-type"] = oktaAuthType
+			conf["client-id"] = clientID
+		default:
+			fatalf(codeUsage, "Invalid auth type '%s'. Valid values: %s, %s", oktaAuthType,
+				config.OktaAuthTypePassword, config.OktaAuthTypeDevice)
+		}
 		if providerDuration != 0 {
 			// Duration specified - validate value
 			if providerDuration < 3600 || providerDuration > 43200 {
-				log.Fatal(color.RedString("Invalid duration Specified. Valid values: 3600 - 43200"))
+				fatalf(codeUsage, "Invalid duration Specified. Valid values: 3600 - 43200")
 			}
 			conf["duration"] = strconv.Itoa(providerDuration)
 		}
-		viper.Set(fmt.Sprintf("providers.%s", name), conf)
+		// Write config to file
+		err := updateConfigFile(func(v *viper.Viper) {
+			v.Set(fmt.Sprintf("providers.%s", name), conf)
+		})
+		if err != nil {
+			fatalf(codeConfig, "Error writing config: %v", err)
+		}
+		log.Printf(color.GreenString("Provider '%s' saved to config file"), name)
+	},
+}
+
+var cmdProvidersCreateJumpCloud = &cobra.Command{
+	Use:   "jumpcloud [provider name]",
+	Short: "Create a new JumpCloud provider",
+	Long:  "Save a new JumpCloud provider into the config file.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+
+		// Verify provider doesn't exist
+		if exists := viper.Get("providers." + name); exists != nil {
+			fatalf(codeUsage, "Provider '%s' already exists", name)
+		}
+
+		conf := map[string]string{
+			"type":     "jumpcloud",
+			"username": username,
+		}
+		if jumpCloudBaseURL != "" {
+			conf["base-url"] = jumpCloudBaseURL
+		}
+		if providerDuration != 0 {
+			// Duration specified - validate value
+			if providerDuration < 3600 || providerDuration > 43200 {
+				fatalf(codeUsage, "Invalid duration Specified. Valid values: 3600 - 43200")
+			}
+			conf["duration"] = strconv.Itoa(providerDuration)
+		}
+		// Write config to file
+		err := updateConfigFile(func(v *viper.Viper) {
+			v.Set(fmt.Sprintf("providers.%s", name), conf)
+		})
+		if err != nil {
+			fatalf(codeConfig, "Error writing config: %v", err)
+		}
+		log.Printf(color.GreenString("Provider '%s' saved to config file"), name)
+	},
+}
+
+var cmdProvidersCreateRolesAnywhere = &cobra.Command{
+	Use:   "rolesanywhere [provider name]",
+	Short: "Create a new IAM Roles Anywhere provider",
+	Long: `Save a new IAM Roles Anywhere provider into the config file. The provider obtains
+credentials using an X.509 certificate trusted by the given trust anchor instead of a SAML
+assertion.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+
+		// Verify provider doesn't exist
+		if exists := viper.Get("providers." + name); exists != nil {
+			fatalf(codeUsage, "Provider '%s' already exists", name)
+		}
 
+		conf := map[string]string{
+			"trust-anchor-arn": trustAnchorARN,
+			"profile-arn":      profileARN,
+			"certificate":      certificate,
+			"private-key":      privateKey,
+			"type":             "rolesanywhere",
+		}
+		if providerDuration != 0 {
+			// Duration specified - validate value
+			if providerDuration < 900 || providerDuration > 43200 {
+				fatalf(codeUsage, "Invalid duration Specified. Valid values: 900 - 43200")
+			}
+			conf["duration"] = strconv.Itoa(providerDuration)
+		}
 		// Write config to file
-		err := viper.WriteConfig()
+		err := updateConfigFile(func(v *viper.Viper) {
+			v.Set(fmt.Sprintf("providers.%s", name), conf)
+		})
 		if err != nil {
-			log.Fatalf(color.RedString("Error writing config: %v"), err)
+			fatalf(codeConfig, "Error writing config: %v", err)
 		}
 		log.Printf(color.GreenString("Provider '%s' saved to config file"), name)
 	},
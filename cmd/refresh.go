@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/allcloud-io/clisso/aws"
+	"github.com/allcloud-io/clisso/clisso"
+	"github.com/allcloud-io/clisso/config"
+	"github.com/allcloud-io/clisso/spinner"
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// defaultRefreshConcurrency is the number of apps refreshed at once by default. It is kept low to
+// avoid tripping rate limits of identity providers.
+const defaultRefreshConcurrency = 4
+
+var refreshTags []string
+var refreshReuseSession bool
+var refreshConcurrency int
+
+func init() {
+	RootCmd.AddCommand(cmdRefreshAll)
+	cmdRefreshAll.Flags().StringArrayVar(
+		&refreshTags, "tag", nil,
+		"Only refresh apps which have this tag in apps.<app>.tags (can be repeated)",
+	)
+	cmdRefreshAll.Flags().BoolVar(
+		&refreshReuseSession, "reuse-session", true,
+		"Reuse identity provider sessions across apps instead of authenticating for each app (Okta only)",
+	)
+	cmdRefreshAll.Flags().IntVar(
+		&refreshConcurrency, "concurrency", defaultRefreshConcurrency,
+		"Maximum number of apps to refresh at once",
+	)
+}
+
+// refreshResult is the outcome of refreshing the credentials of an app.
+type refreshResult struct {
+	app   string
+	creds *aws.Credentials
+	err   error
+}
+
+// refreshApps obtains credentials for each of the given apps and writes them to the profile of the
+// app, refreshing up to leadConcurrency apps at once in the first round of refreshJobs and up to
+// concurrency apps at once in the second. If reuse is true, Okta sessions are reused for all Okta
+// providers, so that refreshing several apps only authenticates once. Failures don't stop the
+// remaining apps from being refreshed. The results are in the order of apps.
+func refreshApps(apps []string, reuse bool, leadConcurrency, concurrency int) []refreshResult {
+	if leadConcurrency > 1 || concurrency > 1 {
+		// Spinners of concurrent refreshes would garble the output.
+		spinner.Disable()
+	}
+
+	hook := viper.GetString("global.post-hook")
+
+	results := make([]refreshResult, len(apps))
+	// mu serializes writing credentials, running the post-hook and reporting progress.
+	var mu sync.Mutex
+	done := 0
+	refresh := func(i int) {
+		app := apps[i]
+		if !quiet {
+			log.Printf("Refreshing credentials for '%s'", app)
+		}
+
+		creds, err := getCredentials(nil, app, config.Overrides{ReuseOktaSessions: reuse})
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err == nil {
+			err = processCredentials(creds, app)
+		}
+		done++
+		if err != nil {
+			log.Printf(color.RedString("Could not refresh credentials for '%s' (%d/%d): %v"), app, done, len(apps), err)
+			results[i] = refreshResult{app: app, err: err}
+			return
+		}
+
+		if hook != "" {
+			runPostHook(hook, app, sectionName(app), creds)
+		}
+		if !quiet {
+			log.Printf("Refreshed credentials for '%s' (%d/%d)", app, done, len(apps))
+		}
+		results[i] = refreshResult{app: app, creds: creds}
+	}
+
+	leads, rest := refreshJobs(apps, reuse)
+	runJobs(leads, leadConcurrency, refresh)
+	runJobs(rest, concurrency, refresh)
+
+	return results
+}
+
+// refreshJobs splits apps into the jobs refreshApps runs in two rounds. Each job is a list of
+// indexes of apps which are refreshed one after another, while jobs run concurrently.
+//
+// The first round refreshes the first app of each provider, so that a reused session is
+// established only once per provider. In the second round, the remaining apps of providers whose
+// sessions are reused are refreshed concurrently, while the apps of other providers, which
+// authenticate for every app, are refreshed one after another to avoid concurrent prompts and MFA
+// requests. reuse is whether Okta sessions are reused regardless of the configuration.
+func refreshJobs(apps []string, reuse bool) (leads, rest [][]int) {
+	led := make(map[string]bool)
+	sequential := make(map[string]int)
+	for i, app := range apps {
+		var provider string
+		if providers := clisso.AppProviders(app); len(providers) > 0 {
+			provider = providers[0]
+		}
+
+		switch j, ok := sequential[provider]; {
+		case !led[provider]:
+			led[provider] = true
+			leads = append(leads, []int{i})
+		case reusesSession(provider, reuse):
+			rest = append(rest, []int{i})
+		case ok:
+			rest[j] = append(rest[j], i)
+		default:
+			sequential[provider] = len(rest)
+			rest = append(rest, []int{i})
+		}
+	}
+	return leads, rest
+}
+
+// reusesSession returns true if provider reuses identity provider sessions across apps, which Okta
+// providers do if reuse is true or if reuse-session is set.
+func reusesSession(provider string, reuse bool) bool {
+	return viper.GetString(fmt.Sprintf("providers.%s.type", provider)) == "okta" &&
+		(reuse || viper.GetBool(fmt.Sprintf("providers.%s.reuse-session", provider)))
+}
+
+// runJobs calls f for each index of each of jobs using up to workers goroutines. The indexes of a
+// job are handled one after another.
+func runJobs(jobs [][]int, workers int, f func(int)) {
+	ch := make(chan []int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(jobs); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range ch {
+				for _, i := range job {
+					f(i)
+				}
+			}
+		}()
+	}
+
+	for _, job := range jobs {
+		ch <- job
+	}
+	close(ch)
+	wg.Wait()
+}
+
+// printRefreshSummary prints the outcome of refreshing each app and returns the number of apps
+// which failed.
+func printRefreshSummary(results []refreshResult) int {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"App", "Result", "Remaining"})
+
+	failed := 0
+	for _, r := range results {
+		if r.err != nil {
+			failed++
+			table.Append([]string{r.app, "failed: " + r.err.Error(), ""})
+			continue
+		}
+		table.Append([]string{r.app, "ok", time.Until(r.creds.Expiration).Round(time.Second).String()})
+	}
+
+	table.Render()
+
+	return failed
+}
+
+var cmdRefreshAll = &cobra.Command{
+	Use:   "refresh-all",
+	Short: "Get temporary credentials for all apps",
+	Long: `Obtain temporary credentials for every configured app, or for the apps which have all
+of the tags given using --tag, and write them to the profile of each app. Apps which fail don't
+stop the remaining apps from being refreshed. A summary is printed at the end, and the command
+fails if any app failed.
+
+Up to --concurrency apps are refreshed at once. The first app of each provider is refreshed before
+the other apps of the provider, so that a reused Okta session is established only once. Apps of
+providers which don't reuse sessions are refreshed one after another, so that only one prompt or
+MFA request per provider is pending at a time.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if refreshConcurrency < 1 {
+			fatalf(codeUsage, "--concurrency must be at least 1")
+		}
+		apps := appsWithTags(appNames(), refreshTags)
+		if len(apps) == 0 {
+			fatalf(codeUsage, "No apps to refresh")
+		}
+
+		results := refreshApps(apps, refreshReuseSession, refreshConcurrency, refreshConcurrency)
+		if failed := printRefreshSummary(results); failed > 0 {
+			fatalf(codeAuthFailed, "Could not refresh credentials for %d of %d apps", failed, len(results))
+		}
+	},
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/allcloud-io/clisso/aws"
+	"github.com/allcloud-io/clisso/internal/testserver"
+	"github.com/allcloud-io/clisso/spinner"
+	"github.com/spf13/viper"
+	"github.com/zalando/go-keyring"
+)
+
+func TestAppsWithTags(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+
+	viper.Set("apps.dev.tags", []string{"team-a", "dev"})
+	viper.Set("apps.prod.tags", []string{"team-a", "prod"})
+	viper.Set("apps.other.provider", "okta")
+	apps := []string{"dev", "other", "prod"}
+
+	for _, test := range []struct {
+		name   string
+		tags   []string
+		expect []string
+	}{
+		{"No tags", nil, apps},
+		{"Single tag", []string{"team-a"}, []string{"dev", "prod"}},
+		{"All tags must match", []string{"team-a", "prod"}, []string{"prod"}},
+		{"No match", []string{"team-b"}, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := appsWithTags(apps, test.tags); !reflect.DeepEqual(got, test.expect) {
+				t.Errorf("wrong apps: got %v, want %v", got, test.expect)
+			}
+		})
+	}
+}
+
+func TestRefreshApps(t *testing.T) {
+	spinner.Disable()
+	keyring.MockInit()
+	viper.Reset()
+	defer viper.Reset()
+
+	idp := testserver.NewOkta()
+	defer idp.Close()
+
+	sts := testserver.NewSTS()
+	defer sts.Close()
+	setupTestSTS(t, sts)
+
+	setupTestOktaProvider(t, "up", idp.URL, idp.Password)
+	setupTestOktaProvider(t, "wrong-password", idp.URL, "wrong")
+	for app, provider := range map[string]string{"a": "up", "b": "wrong-password", "c": "up", "d": "up"} {
+		viper.Set("apps."+app+".provider", provider)
+		viper.Set("apps."+app+".url", idp.AppURL())
+	}
+
+	path := filepath.Join(t.TempDir(), "credentials")
+	writeToFile = path
+	defer func() { writeToFile = "" }()
+
+	results := refreshApps([]string{"a", "b", "c", "d"}, true, defaultRefreshConcurrency, defaultRefreshConcurrency)
+
+	if len(results) != 4 {
+		t.Fatalf("wrong number of results: got %d, want 4", len(results))
+	}
+	if results[0].err != nil || results[2].err != nil || results[3].err != nil {
+		t.Errorf("unexpected errors: %v, %v, %v", results[0].err, results[2].err, results[3].err)
+	}
+	if results[1].err == nil {
+		t.Error("expected an error for app with wrong password")
+	}
+
+	// The session of the first app is reused by the others, which are refreshed concurrently.
+	if idp.Authentications != 1 {
+		t.Errorf("wrong number of authentications: got %d, want 1", idp.Authentications)
+	}
+
+	profiles, err := aws.GetValidCredentials(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profiles) != 3 {
+		t.Errorf("wrong number of profiles: got %v, want 3", profiles)
+	}
+}
+
+func TestRefreshJobs(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+
+	viper.Set("providers.okta.type", "okta")
+	viper.Set("providers.okta.reuse-session", true)
+	viper.Set("providers.onelogin.type", "onelogin")
+	for app, provider := range map[string]string{
+		"okta-1": "okta", "okta-2": "okta", "okta-3": "okta",
+		"onelogin-1": "onelogin", "onelogin-2": "onelogin", "onelogin-3": "onelogin",
+	} {
+		viper.Set("apps."+app+".provider", provider)
+	}
+
+	leads, rest := refreshJobs([]string{"okta-1", "onelogin-1", "okta-2", "onelogin-2", "okta-3", "onelogin-3"}, false)
+	if want := [][]int{{0}, {1}}; !reflect.DeepEqual(leads, want) {
+		t.Errorf("wrong first round: got %v, want %v", leads, want)
+	}
+	if want := [][]int{{2}, {3, 5}, {4}}; !reflect.DeepEqual(rest, want) {
+		t.Errorf("wrong second round: got %v, want %v", rest, want)
+	}
+
+	// Okta sessions are reused if requested even if reuse-session isn't set.
+	viper.Set("providers.okta.reuse-session", false)
+	_, rest = refreshJobs([]string{"okta-1", "okta-2", "okta-3"}, true)
+	if want := [][]int{{1}, {2}}; !reflect.DeepEqual(rest, want) {
+		t.Errorf("wrong second round with reuse: got %v, want %v", rest, want)
+	}
+}
@@ -1,10 +1,18 @@
 package cmd
 
 import (
+	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/allcloud-io/clisso/aws"
+	"github.com/allcloud-io/clisso/config"
+	"github.com/allcloud-io/clisso/keychain"
+	"github.com/allcloud-io/clisso/spinner"
 	"github.com/fatih/color"
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
@@ -14,51 +22,213 @@ import (
 var VERSION string
 
 var cfgFile string
+var quiet bool
+var noColor bool
+var noProgress bool
+var outputFormat string
+var httpTimeout time.Duration
 
 var RootCmd = &cobra.Command{Use: "clisso"}
 
 func init() {
-	cobra.OnInitialize(initConfig)
+	cobra.OnInitialize(initOutput, initConfig)
 	RootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", "",
-		"config file (default is $HOME/.clisso.yaml)",
+		"config file in YAML, TOML or JSON format (default is $HOME/.clisso.yaml)",
 	)
+	RootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false,
+		"Don't print informational messages",
+	)
+	RootCmd.PersistentFlags().BoolVar(&noColor, "no-color", false, "Disable colored output")
+	RootCmd.PersistentFlags().BoolVar(&noProgress, "no-progress", false,
+		"Don't show a progress indicator while waiting",
+	)
+	RootCmd.PersistentFlags().StringVar(&outputFormat, "output-format", outputFormatText,
+		"Format of error messages: text or json",
+	)
+	RootCmd.PersistentFlags().DurationVar(&httpTimeout, "timeout", config.DefaultHTTPTimeout,
+		"Maximum time an HTTP request may take",
+	)
+	err := viper.BindPFlag("global.http-timeout", RootCmd.PersistentFlags().Lookup("timeout"))
+	if err != nil {
+		log.Fatalf(color.RedString("Error binding flag global.http-timeout: %v"), err)
+	}
 }
 
 func Execute(version string) {
 	VERSION = version
 	err := RootCmd.Execute()
 	if err != nil {
-		log.Fatalf("Failed to execute: %v", err)
+		fatalf(codeUsage, "Failed to execute: %v", err)
 	}
 }
 
+func initOutput() {
+	if noColor {
+		color.NoColor = true
+	}
+	if noProgress {
+		spinner.Disable()
+	}
+
+	switch outputFormat {
+	case outputFormatText, outputFormatJSON:
+	default:
+		format := outputFormat
+		outputFormat = outputFormatText
+		fatalf(codeUsage, "Invalid output format '%s'. Valid values: %s, %s", format,
+			outputFormatText, outputFormatJSON)
+	}
+}
+
+// configExts are the extensions of the supported config file formats in order of preference when
+// looking for the default config file.
+var configExts = []string{"yaml", "yml", "toml", "json"}
+
+// defaultConfigFile returns the path of the first .clisso config file with a supported extension
+// which exists in home, or the path of .clisso.yaml if none exists.
+func defaultConfigFile(home string) string {
+	for _, ext := range configExts {
+		file := filepath.Join(home, ".clisso."+ext)
+		if _, err := os.Stat(file); err == nil {
+			return file
+		}
+	}
+	return filepath.Join(home, ".clisso.yaml")
+}
+
 func initConfig() {
+	home, err := homedir.Dir()
+	if err != nil {
+		fatalf(codeConfig, "Error getting home directory: %v", err)
+	}
+
 	if cfgFile != "" {
 		viper.SetConfigFile(cfgFile)
-	} else {
-		home, err := homedir.Dir()
-		if err != nil {
-			log.Fatalf(color.RedString("Error getting home directory: %v"), err)
+		// The format is detected using the file extension. Files without one are assumed to be
+		// YAML.
+		if filepath.Ext(cfgFile) == "" {
+			viper.SetConfigType("yaml")
 		}
-
-		viper.SetConfigType("yaml")
-		viper.AddConfigPath(home)
-		viper.SetConfigName(".clisso")
+	} else {
+		file := defaultConfigFile(home)
+		viper.SetConfigFile(file)
 
 		// Create config file if it doesn't exist
-		file := filepath.Join(home, ".clisso.yaml")
 		if _, err := os.Stat(file); os.IsNotExist(err) {
 			_, err := os.Create(file)
 			if err != nil {
-				log.Fatalf(color.RedString("Error creating config file: %v"), err)
+				fatalf(codeConfig, "Error creating config file: %v", err)
 			}
 		}
+	}
 
-		// Set default config values
-		viper.SetDefault("global.credentials-path", filepath.Join(home, ".aws", "credentials"))
+	// Set default config values
+	viper.SetDefault("global.json-cache.dir", filepath.Join(home, ".aws", "cli", "cache"))
+	viper.SetDefault("global.json-cache.format", aws.JSONCacheFormatCLI)
+
+	if err := readConfig(); err != nil {
+		fatalf(codeConfig, "Can't read config: %v", err)
 	}
 
+	// An invalid setting doesn't prevent fixing it using e.g. 'clisso config edit'.
+	if retries, delay, err := config.GetKeychainRetry(); err != nil {
+		log.Printf(color.YellowString("Ignoring keychain retry settings: %v"), err)
+	} else {
+		keychain.Retries, keychain.RetryDelay = retries, delay
+	}
+	if backend, err := config.GetKeychainBackend(); err != nil {
+		log.Printf(color.YellowString("Ignoring keychain backend setting: %v"), err)
+		keychain.AutoDetect = true
+	} else {
+		keychain.AutoDetect = backend == config.KeychainBackendAuto
+	}
+}
+
+// readConfig reads the config file, merges the config fetched from global.config-source and then
+// the partial config files of its config directory on top of it, replacing any config read before.
+func readConfig() error {
 	if err := viper.ReadInConfig(); err != nil {
-		log.Fatalf(color.RedString("Can't read config: %v"), err)
+		return err
+	}
+	if err := mergeConfigSource(); err != nil {
+		return err
+	}
+	return mergeConfigDir(configDir(viper.ConfigFileUsed()))
+}
+
+// updateConfigFile applies update to the settings of the config file and writes them back. The
+// settings are read from the file alone, so that defaults, flags and the settings merged from
+// global.config-source and the config directory are never written to it. update is also applied to
+// the settings in use, so that the change takes effect for the rest of the command.
+func updateConfigFile(update func(v *viper.Viper)) error {
+	path := viper.ConfigFileUsed()
+	v := viper.New()
+	v.SetConfigFile(path)
+	if filepath.Ext(path) == "" {
+		v.SetConfigType("yaml")
+	}
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("reading config file: %v", err)
+	}
+
+	update(v)
+	if err := v.WriteConfig(); err != nil {
+		return err
+	}
+	update(viper.GetViper())
+	return nil
+}
+
+// configDir returns the directory of partial config files which are merged on top of the config
+// file at path, which is named after the config file without its extension, e.g. ~/.clisso.d for
+// ~/.clisso.yaml.
+func configDir(path string) string {
+	// The extension of e.g. ".clisso" is the whole name, so it isn't an extension.
+	if ext := filepath.Ext(path); ext != filepath.Base(path) {
+		path = strings.TrimSuffix(path, ext)
+	}
+	return path + ".d"
+}
+
+// mergeConfigDir merges the config files with a supported extension in dir on top of the config
+// read so far, in lexical order of their names, so that later files override earlier ones. A
+// missing directory isn't an error. The merged settings are never written to the config file by
+// updateConfigFile.
+func mergeConfigDir(dir string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading config directory: %v", err)
+	}
+
+	// ReadDir sorts entries by name.
+	for _, e := range entries {
+		ext := strings.TrimPrefix(filepath.Ext(e.Name()), ".")
+		if e.IsDir() || !stringInSlice(ext, configExts) {
+			continue
+		}
+
+		path := filepath.Join(dir, e.Name())
+		v := viper.New()
+		v.SetConfigFile(path)
+		if err := v.ReadInConfig(); err != nil {
+			return fmt.Errorf("reading %s: %v", path, err)
+		}
+		if err := viper.MergeConfigMap(v.AllSettings()); err != nil {
+			return fmt.Errorf("merging %s: %v", path, err)
+		}
+	}
+
+	return nil
+}
+
+func stringInSlice(s string, list []string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
 	}
+	return false
 }
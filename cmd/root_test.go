@@ -0,0 +1,246 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/allcloud-io/clisso/config"
+	"github.com/allcloud-io/clisso/keychain"
+	"github.com/spf13/viper"
+)
+
+// Equivalent configs in each of the supported formats.
+var configs = map[string]string{
+	"yaml": `global:
+  accounts:
+    "123456789012": Production
+providers:
+  my-provider:
+    type: okta
+    base-url: https://example.okta.com
+    username: user@example.com
+apps:
+  my-app:
+    provider: my-provider
+    url: https://example.okta.com/home/amazon_aws/abc/272
+`,
+	"toml": `[global.accounts]
+"123456789012" = "Production"
+
+[providers.my-provider]
+type = "okta"
+base-url = "https://example.okta.com"
+username = "user@example.com"
+
+[apps.my-app]
+provider = "my-provider"
+url = "https://example.okta.com/home/amazon_aws/abc/272"
+`,
+	"json": `{
+  "global": {"accounts": {"123456789012": "Production"}},
+  "providers": {
+    "my-provider": {
+      "type": "okta",
+      "base-url": "https://example.okta.com",
+      "username": "user@example.com"
+    }
+  },
+  "apps": {
+    "my-app": {
+      "provider": "my-provider",
+      "url": "https://example.okta.com/home/amazon_aws/abc/272"
+    }
+  }
+}
+`,
+}
+
+func TestConfigFormats(t *testing.T) {
+	// initConfig enables keychain detection, which would hide the mock keychain.
+	defer func() { keychain.AutoDetect = false }()
+
+	for _, ext := range []string{"yaml", "yml", "toml", "json"} {
+		t.Run(ext, func(t *testing.T) {
+			content := configs[ext]
+			if ext == "yml" {
+				content = configs["yaml"]
+			}
+
+			path := filepath.Join(t.TempDir(), "clisso."+ext)
+			if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			viper.Reset()
+			defer viper.Reset()
+			cfgFile = path
+			defer func() { cfgFile = "" }()
+
+			initConfig()
+			checkConfig(t)
+			if viper.GetString("global.json-cache.dir") == "" {
+				t.Error("no default JSON cache directory")
+			}
+
+			// Changes must be written back in the same format.
+			err := updateConfigFile(func(v *viper.Viper) {
+				v.Set("apps.other-app.provider", "my-provider")
+				v.Set("apps.other-app.url", "https://example.okta.com/home/amazon_aws/def/272")
+			})
+			if err != nil {
+				t.Fatalf("unexpected error writing config: %+v", err)
+			}
+
+			viper.Reset()
+			initConfig()
+			checkConfig(t)
+
+			app, err := config.GetOktaApp("other-app")
+			if err != nil {
+				t.Fatalf("unexpected error reading written config: %+v", err)
+			}
+			if app.URL != "https://example.okta.com/home/amazon_aws/def/272" {
+				t.Errorf("expected written app URL, received %q", app.URL)
+			}
+		})
+	}
+}
+
+func checkConfig(t *testing.T) {
+	t.Helper()
+
+	p, err := config.GetOktaProvider("my-provider")
+	if err != nil {
+		t.Fatalf("unexpected error %+v", err)
+	}
+	if p.BaseURL != "https://example.okta.com" || p.Username != "user@example.com" {
+		t.Errorf("unexpected provider config %+v", p)
+	}
+
+	app, err := config.GetOktaApp("my-app")
+	if err != nil {
+		t.Fatalf("unexpected error %+v", err)
+	}
+	if app.Provider != "my-provider" || app.URL != "https://example.okta.com/home/amazon_aws/abc/272" {
+		t.Errorf("unexpected app config %+v", app)
+	}
+
+	if name := viper.GetStringMap("global.accounts")["123456789012"]; name != "Production" {
+		t.Errorf("expected account name %q, received %v", "Production", name)
+	}
+}
+
+func TestDefaultConfigFile(t *testing.T) {
+	home := t.TempDir()
+
+	if got, want := defaultConfigFile(home), filepath.Join(home, ".clisso.yaml"); got != want {
+		t.Errorf("expected %q when no config file exists, received %q", want, got)
+	}
+
+	for _, name := range []string{".clisso.json", ".clisso.toml"} {
+		if err := ioutil.WriteFile(filepath.Join(home, name), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := defaultConfigFile(home), filepath.Join(home, ".clisso.toml"); got != want {
+		t.Errorf("expected %q, received %q", want, got)
+	}
+
+	if err := os.Remove(filepath.Join(home, ".clisso.toml")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := defaultConfigFile(home), filepath.Join(home, ".clisso.json"); got != want {
+		t.Errorf("expected %q, received %q", want, got)
+	}
+}
+
+func TestMergeConfigDir(t *testing.T) {
+	// initConfig enables keychain detection, which would hide the mock keychain.
+	defer func() { keychain.AutoDetect = false }()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "clisso.yaml")
+	if err := ioutil.WriteFile(path, []byte(configs["yaml"]), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	confDir := filepath.Join(dir, "clisso.d")
+	if err := os.Mkdir(confDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"20-personal.json": `{"providers": {"my-provider": {"username": "me@example.com"}},
+			"apps": {"personal-app": {"provider": "my-provider", "url": "https://example.okta.com/home/amazon_aws/ghi/272"}}}`,
+		"10-base.yaml": "providers:\n  my-provider:\n    base-url: https://corp.okta.com\n    username: base@example.com\n",
+		"README.md":    "not a config file",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(confDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	viper.Reset()
+	defer viper.Reset()
+	cfgFile = path
+	defer func() { cfgFile = "" }()
+
+	initConfig()
+
+	p, err := config.GetOktaProvider("my-provider")
+	if err != nil {
+		t.Fatalf("unexpected error %+v", err)
+	}
+	if p.BaseURL != "https://corp.okta.com" {
+		t.Errorf("expected base URL from 10-base.yaml, received %q", p.BaseURL)
+	}
+	if p.Username != "me@example.com" {
+		t.Errorf("expected username from 20-personal.json, received %q", p.Username)
+	}
+	for _, app := range []string{"my-app", "personal-app"} {
+		if _, err := config.GetOktaApp(app); err != nil {
+			t.Errorf("unexpected error reading app %s: %+v", app, err)
+		}
+	}
+
+	// Writing the config file must keep the settings of the config directory out of it.
+	if err := updateConfigFile(func(v *viper.Viper) { v.Set("global.selected-app", "my-app") }); err != nil {
+		t.Fatalf("unexpected error writing config: %+v", err)
+	}
+	if got := viper.GetString("global.selected-app"); got != "my-app" {
+		t.Errorf("change wasn't applied to the settings in use: got %q", got)
+	}
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if got := v.GetString("global.selected-app"); got != "my-app" {
+		t.Errorf("change wasn't written: got %q", got)
+	}
+	for _, k := range []string{"apps.personal-app", "global.json-cache", "global.http-timeout"} {
+		if v.IsSet(k) {
+			t.Errorf("%s was written to the config file: %v", k, v.Get(k))
+		}
+	}
+	p = &config.OktaProviderConfig{
+		BaseURL:  v.GetString("providers.my-provider.base-url"),
+		Username: v.GetString("providers.my-provider.username"),
+	}
+	if p.BaseURL != "https://example.okta.com" || p.Username != "user@example.com" {
+		t.Errorf("settings of the config directory were written to the config file: %+v", p)
+	}
+}
+
+func TestConfigDir(t *testing.T) {
+	for path, want := range map[string]string{
+		"/home/user/.clisso.yaml": "/home/user/.clisso.d",
+		"/etc/clisso.toml":        "/etc/clisso.d",
+		"/home/user/.clisso":      "/home/user/.clisso.d",
+	} {
+		if got := configDir(path); got != want {
+			t.Errorf("wrong config directory for %s: got %q, want %q", path, got, want)
+		}
+	}
+}
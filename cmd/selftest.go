@@ -0,0 +1,319 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/allcloud-io/clisso/aws"
+	"github.com/allcloud-io/clisso/clisso"
+	"github.com/allcloud-io/clisso/config"
+	"github.com/allcloud-io/clisso/keychain"
+	"github.com/allcloud-io/clisso/onelogin"
+	"github.com/allcloud-io/clisso/rolesanywhere"
+	"github.com/allcloud-io/clisso/saml"
+	awsarn "github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Statuses of self-test checks.
+const (
+	checkOK     = "ok"
+	checkFailed = "failed"
+)
+
+var selftestJSON bool
+
+func init() {
+	RootCmd.AddCommand(cmdSelftest)
+	cmdSelftest.Flags().BoolVar(&selftestJSON, "json", false, "Print the report as JSON")
+}
+
+// checkResult is the outcome of a self-test check.
+type checkResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	// LatencyMS is how long the check took in milliseconds.
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// selftestReport is the outcome of all self-test checks.
+type selftestReport struct {
+	Status string        `json:"status"`
+	Checks []checkResult `json:"checks"`
+}
+
+// runCheck runs the check named name and records its outcome and latency.
+func runCheck(name string, check func() error) checkResult {
+	start := time.Now()
+	err := check()
+	r := checkResult{Name: name, Status: checkOK, LatencyMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		r.Status = checkFailed
+		r.Error = err.Error()
+	}
+	return r
+}
+
+// validateProvider verifies the configuration of provider p.
+func validateProvider(p string) (err error) {
+	switch pType := viper.GetString(fmt.Sprintf("providers.%s.type", p)); pType {
+	case "okta":
+		_, err = config.GetOktaProvider(p)
+	case "onelogin":
+		_, err = config.GetOneLoginProvider(p)
+	case "jumpcloud":
+		_, err = config.GetJumpCloudProvider(p)
+	case "rolesanywhere":
+		_, err = config.GetRolesAnywhereProvider(p)
+	default:
+		err = fmt.Errorf("unknown provider type '%s'", pType)
+	}
+	return err
+}
+
+// validateApp verifies the configuration of app according to the type of its first provider.
+func validateApp(app string) (err error) {
+	providers := clisso.AppProviders(app)
+	if len(providers) == 0 {
+		return errors.New("provider config value must be set")
+	}
+
+	switch viper.GetString(fmt.Sprintf("providers.%s.type", providers[0])) {
+	case "okta":
+		if viper.GetString(fmt.Sprintf("providers.%s.auth-type", providers[0])) == config.OktaAuthTypeDevice {
+			_, err = config.GetOktaDeviceApp(app)
+		} else {
+			_, err = config.GetOktaApp(app)
+		}
+	case "onelogin":
+		_, err = config.GetOneLoginApp(app, providers[0])
+	case "jumpcloud":
+		_, err = config.GetJumpCloudApp(app)
+	case "rolesanywhere":
+		_, err = config.GetRolesAnywhereApp(app)
+	default:
+		err = fmt.Errorf("provider '%s' doesn't exist or has an unknown type", providers[0])
+	}
+	// Invalid global settings are reported once by validateConfig.
+	if err == nil && viper.GetString(fmt.Sprintf("apps.%s.sts-endpoint", app)) != "" {
+		_, err = config.GetSTSEndpoint(app, "")
+	}
+	return err
+}
+
+// validateConfig verifies the global settings and the configuration of all providers and apps,
+// and returns the problems found.
+func validateConfig() []error {
+	var errs []error
+	if _, err := config.GetExpiryBuffer(); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := config.GetTLSMinVersion(); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := config.GetHTTPTimeout(""); err != nil {
+		errs = append(errs, err)
+	}
+	if _, _, err := config.GetKeychainRetry(); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := config.GetKeychainBackend(); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := config.GetSTSEndpoint("", ""); err != nil {
+		errs = append(errs, err)
+	}
+	if src := viper.GetString("global.config-source"); src != "" {
+		if _, _, err := parseConfigSource(src); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if _, err := saml.RoleDurations(); err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, p := range providerNames() {
+		if err := validateProvider(p); err != nil {
+			errs = append(errs, fmt.Errorf("provider '%s': %v", p, err))
+		}
+	}
+	for _, app := range appNames() {
+		if err := validateApp(app); err != nil {
+			errs = append(errs, fmt.Errorf("app '%s': %v", app, err))
+		}
+	}
+
+	return errs
+}
+
+// providerEndpoint returns the URL which Clisso sends the first request to when authenticating
+// using provider p.
+func providerEndpoint(p string) (string, error) {
+	switch pType := viper.GetString(fmt.Sprintf("providers.%s.type", p)); pType {
+	case "okta":
+		c, err := config.GetOktaProvider(p)
+		if err != nil {
+			return "", err
+		}
+		return c.BaseURL, nil
+	case "onelogin":
+		c, err := config.GetOneLoginProvider(p)
+		if err != nil {
+			return "", err
+		}
+		return onelogin.BaseURL(c.Region)
+	case "jumpcloud":
+		c, err := config.GetJumpCloudProvider(p)
+		if err != nil {
+			return "", err
+		}
+		return c.BaseURL, nil
+	case "rolesanywhere":
+		c, err := config.GetRolesAnywhereProvider(p)
+		if err != nil {
+			return "", err
+		}
+		ta, err := awsarn.Parse(c.TrustAnchorARN)
+		if err != nil {
+			return "", fmt.Errorf("parsing trust anchor ARN: %v", err)
+		}
+		return rolesanywhere.EndpointURL(ta.Region), nil
+	default:
+		return "", fmt.Errorf("unknown provider type '%s'", pType)
+	}
+}
+
+// checkReachable sends a request to u using hc. Any HTTP response counts as success, since only
+// connectivity is checked and no credentials are sent.
+func checkReachable(hc *http.Client, u string) error {
+	resp, err := hc.Get(u)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	return nil
+}
+
+// selftest runs all self-test checks.
+func selftest() selftestReport {
+	checks := []checkResult{
+		runCheck("config", func() error {
+			errs := validateConfig()
+			if len(errs) == 0 {
+				return nil
+			}
+			msgs := make([]string, len(errs))
+			for i, err := range errs {
+				msgs[i] = err.Error()
+			}
+			return errors.New(strings.Join(msgs, "; "))
+		}),
+		runCheck("keychain", keychain.Check),
+	}
+
+	for _, p := range providerNames() {
+		checks = append(checks, runCheck(fmt.Sprintf("provider '%s'", p), func() error {
+			u, err := providerEndpoint(p)
+			if err != nil {
+				return err
+			}
+			hc, err := newHTTPClient(p)
+			if err != nil {
+				return err
+			}
+			return checkReachable(hc, u)
+		}))
+	}
+
+	checks = append(checks, runCheck("sts", func() error {
+		endpoint, err := config.GetSTSEndpoint("", "")
+		if err != nil {
+			return err
+		}
+		hc, err := newHTTPClient("")
+		if err != nil {
+			return err
+		}
+		return checkReachable(hc, aws.STSURL(endpoint))
+	}))
+	// Apps may use other endpoints, e.g. FIPS endpoints. Invalid ones are reported by the config
+	// check.
+	seen := map[string]bool{}
+	for _, app := range appNames() {
+		endpoint := viper.GetString(fmt.Sprintf("apps.%s.sts-endpoint", app))
+		if endpoint == "" || seen[endpoint] {
+			continue
+		}
+		seen[endpoint] = true
+		checks = append(checks, runCheck(fmt.Sprintf("sts '%s'", endpoint), func() error {
+			endpoint, err := config.GetSTSEndpoint(app, "")
+			if err != nil {
+				return err
+			}
+			hc, err := newHTTPClient("")
+			if err != nil {
+				return err
+			}
+			return checkReachable(hc, aws.STSURL(endpoint))
+		}))
+	}
+
+	report := selftestReport{Status: checkOK, Checks: checks}
+	for _, c := range checks {
+		if c.Status != checkOK {
+			report.Status = checkFailed
+		}
+	}
+	return report
+}
+
+// printSelftestReport prints r as a table.
+func printSelftestReport(r selftestReport, w io.Writer) {
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"Check", "Status", "Latency", "Error"})
+	for _, c := range r.Checks {
+		latency := (time.Duration(c.LatencyMS) * time.Millisecond).String()
+		table.Append([]string{c.Name, c.Status, latency, c.Error})
+	}
+	table.Render()
+}
+
+var cmdSelftest = &cobra.Command{
+	Use:   "selftest",
+	Short: "Check the configuration, the keychain and connectivity",
+	Long: `Check that the configuration is valid, that the keychain is accessible and that the
+identity provider of each provider and STS are reachable, and report the outcome and latency of
+each check. No passwords are needed and nobody is authenticated, so the command is suitable for
+monitoring.
+
+The exit code is non-zero if any check failed.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		report := selftest()
+
+		if selftestJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(report); err != nil {
+				fatalf(codeOutputFailed, "Error printing report: %v", err)
+			}
+		} else {
+			printSelftestReport(report, os.Stdout)
+		}
+
+		if report.Status != checkOK {
+			os.Exit(exitCodes[codeError])
+		}
+	},
+}
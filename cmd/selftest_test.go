@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/allcloud-io/clisso/internal/testserver"
+	"github.com/spf13/viper"
+	"github.com/zalando/go-keyring"
+)
+
+func TestSelftest(t *testing.T) {
+	keyring.MockInit()
+	viper.Reset()
+	defer viper.Reset()
+
+	idp := testserver.NewOkta()
+	defer idp.Close()
+	down := testserver.NewOkta()
+	down.Close()
+
+	sts := testserver.NewSTS()
+	defer sts.Close()
+	setupTestSTS(t, sts)
+
+	setupTestOktaProvider(t, "up", idp.URL, idp.Password)
+	viper.Set("apps.ok.provider", "up")
+	viper.Set("apps.ok.url", idp.AppURL())
+
+	report := selftest()
+	if report.Status != checkOK {
+		t.Fatalf("unexpected failure: %+v", report)
+	}
+	var names []string
+	for _, c := range report.Checks {
+		names = append(names, c.Name)
+	}
+	if got, want := strings.Join(names, ","), "config,keychain,provider 'up',sts"; got != want {
+		t.Errorf("wrong checks: got %s, want %s", got, want)
+	}
+
+	setupTestOktaProvider(t, "down", down.URL, "")
+	viper.Set("apps.broken.provider", "missing")
+
+	report = selftest()
+	if report.Status != checkFailed {
+		t.Fatalf("expected failure: %+v", report)
+	}
+	for _, c := range report.Checks {
+		expectFailure := c.Name == "config" || c.Name == "provider 'down'"
+		if failed := c.Status == checkFailed; failed != expectFailure {
+			t.Errorf("wrong status of check %s: got %s (%s)", c.Name, c.Status, c.Error)
+		}
+	}
+}
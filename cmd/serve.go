@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/allcloud-io/clisso/aws"
+	"github.com/allcloud-io/clisso/config"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+// defaultServeAddress is the address the credentials server listens on by default. Port 0 picks a
+// random free port.
+const defaultServeAddress = "127.0.0.1:0"
+
+var serveAddress string
+
+func init() {
+	RootCmd.AddCommand(cmdServe)
+	cmdServe.Flags().StringVar(
+		&serveAddress, "address", defaultServeAddress,
+		"Loopback address and port to listen on",
+	)
+}
+
+// credentialServer serves the credentials of an app in the format of the ECS container credentials
+// endpoint. Requests must carry token in the Authorization header.
+type credentialServer struct {
+	token  string
+	buffer time.Duration
+	// get obtains new credentials.
+	get func() (*aws.Credentials, error)
+
+	mu    sync.Mutex
+	creds *aws.Credentials
+}
+
+// credentials returns the current credentials, obtaining new ones if there are none or they expire
+// within the expiry buffer.
+func (s *credentialServer) credentials() (*aws.Credentials, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.creds != nil && s.creds.Expiration.After(time.Now().Add(s.buffer)) {
+		return s.creds, nil
+	}
+
+	creds, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	s.creds = creds
+	return creds, nil
+}
+
+func (s *credentialServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(s.token)) != 1 {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	creds, err := s.credentials()
+	if err != nil {
+		log.Printf(color.RedString("Could not get temporary credentials: %v"), err)
+		http.Error(w, "could not get temporary credentials", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := aws.WriteContainerCredentials(creds, w); err != nil {
+		log.Printf(color.RedString("Error writing credentials: %v"), err)
+	}
+}
+
+// listenLoopback listens on address, which must be a loopback address since the credentials
+// must not be reachable from other hosts.
+func listenLoopback(address string) (net.Listener, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if host != "localhost" {
+		if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+			return nil, fmt.Errorf("%s isn't a loopback address", host)
+		}
+	}
+
+	return net.Listen("tcp", address)
+}
+
+// newToken returns a random token to authorize requests with.
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating token: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+var cmdServe = &cobra.Command{
+	Use:   "serve [app name]",
+	Short: "Serve credentials over HTTP like the ECS container credentials endpoint",
+	Long: `Run an HTTP server on a loopback address which responds to GET requests with the
+credentials of the specified app in the format of the ECS container credentials endpoint. New
+credentials are obtained from the identity provider when the current ones expire within
+global.expiry-buffer.
+
+Requests must carry a random token, which is generated on startup, in the Authorization header.
+To use the server, set the environment variables which are printed on startup, e.g.:
+
+export AWS_CONTAINER_CREDENTIALS_FULL_URI=http://127.0.0.1:38161/
+export AWS_CONTAINER_AUTHORIZATION_TOKEN=<token>
+
+If no app is specified, the selected app (if configured) will be assumed.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		app, err := selectedApp(args)
+		if err != nil {
+			fatalf(codeUsage, "%v", err)
+		}
+		app, err = checkAppExists(app, true)
+		if err != nil {
+			fatalf(codeUsage, "%v", err)
+		}
+
+		buffer, err := config.GetExpiryBuffer()
+		if err != nil {
+			fatalf(codeConfig, "%v", err)
+		}
+		token, err := newToken()
+		if err != nil {
+			fatalf(codeError, "%v", err)
+		}
+
+		l, err := listenLoopback(serveAddress)
+		if err != nil {
+			fatalf(codeUsage, "Could not listen on %s: %v", serveAddress, err)
+		}
+
+		s := &credentialServer{
+			token:  token,
+			buffer: buffer,
+			get:    func() (*aws.Credentials, error) { return getCredentials(cmd, app, config.Overrides{}) },
+		}
+		// Authenticate up front, so that prompts aren't interleaved with requests.
+		if _, err := s.credentials(); err != nil {
+			warnClockSkew(err)
+			fatalf(codeOf(err, codeAuthFailed), "Could not get temporary credentials: %v", err)
+		}
+
+		log.Printf(color.GreenString("Serving credentials for '%s' on %s"), app, l.Addr())
+		fmt.Printf("export AWS_CONTAINER_CREDENTIALS_FULL_URI=http://%s/\n", l.Addr())
+		fmt.Printf("export AWS_CONTAINER_AUTHORIZATION_TOKEN=%s\n", token)
+
+		if err := http.Serve(l, s); err != nil {
+			fatalf(codeError, "Error serving credentials: %v", err)
+		}
+	},
+}
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/allcloud-io/clisso/aws"
+)
+
+func TestCredentialServer(t *testing.T) {
+	calls := 0
+	var fail bool
+	s := &credentialServer{
+		token:  "secret-token",
+		buffer: 5 * time.Minute,
+		get: func() (*aws.Credentials, error) {
+			calls++
+			if fail {
+				return nil, errors.New("authentication failed")
+			}
+			// The first credentials expire within the buffer and must be refreshed.
+			exp := time.Now().Add(time.Minute)
+			if calls > 1 {
+				exp = time.Now().Add(time.Hour)
+			}
+			return &aws.Credentials{AccessKeyID: "key", SecretAccessKey: "secret", SessionToken: "token", Expiration: exp}, nil
+		},
+	}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	request := func(method, token string) *http.Response {
+		req, err := http.NewRequest(method, srv.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	for _, test := range []struct {
+		name       string
+		method     string
+		token      string
+		expectCode int
+	}{
+		{"Missing token", http.MethodGet, "", http.StatusUnauthorized},
+		{"Wrong token", http.MethodGet, "wrong", http.StatusUnauthorized},
+		{"Wrong method", http.MethodPost, "secret-token", http.StatusMethodNotAllowed},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			resp := request(test.method, test.token)
+			resp.Body.Close()
+			if resp.StatusCode != test.expectCode {
+				t.Errorf("wrong status: got %d, want %d", resp.StatusCode, test.expectCode)
+			}
+		})
+	}
+	if calls != 0 {
+		t.Fatalf("credentials obtained for unauthorized requests")
+	}
+
+	for i := 0; i < 3; i++ {
+		resp := request(http.MethodGet, "secret-token")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("wrong status: got %d", resp.StatusCode)
+		}
+		var out map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		for k, want := range map[string]string{"AccessKeyId": "key", "SecretAccessKey": "secret", "Token": "token"} {
+			if out[k] != want {
+				t.Errorf("wrong %s: got %v, want %s", k, out[k], want)
+			}
+		}
+	}
+	if calls != 2 {
+		t.Errorf("wrong number of authentications: got %d, want 2", calls)
+	}
+
+	s.mu.Lock()
+	fail = true
+	s.creds = nil
+	s.mu.Unlock()
+	resp := request(http.MethodGet, "secret-token")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("wrong status on failure: got %d", resp.StatusCode)
+	}
+}
+
+func TestListenLoopback(t *testing.T) {
+	for _, test := range []struct {
+		address     string
+		expectError bool
+	}{
+		{"127.0.0.1:0", false},
+		{"localhost:0", false},
+		{"0.0.0.0:0", true},
+		{"192.0.2.1:0", true},
+		{"127.0.0.1", true},
+	} {
+		t.Run(test.address, func(t *testing.T) {
+			l, err := listenLoopback(test.address)
+			if test.expectError {
+				if err == nil {
+					l.Close()
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			l.Close()
+		})
+	}
+}
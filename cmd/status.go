@@ -7,45 +7,77 @@ import (
 	"time"
 
 	"github.com/allcloud-io/clisso/aws"
-	"github.com/fatih/color"
-	homedir "github.com/mitchellh/go-homedir"
 	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var readFromFile string
+var statusPrompt string
+var statusCredentialsSection string
 
 func init() {
 	RootCmd.AddCommand(cmdStatus)
 	cmdStatus.Flags().StringVarP(
 		&readFromFile, "read-from-file", "r", "",
-		"Read credentials from this file instead of the default ($HOME/.aws/credentials)",
+		"Read credentials from this file instead of the default ($AWS_SHARED_CREDENTIALS_FILE or $HOME/.aws/credentials)",
+	)
+	cmdStatus.Flags().StringVar(
+		&statusPrompt, "prompt", "",
+		"Print only the remaining validity of this app's credentials in a compact format for use in a shell prompt",
+	)
+	cmdStatus.Flags().StringVar(
+		&statusCredentialsSection, "credentials-section", "",
+		"Read the credentials of the --prompt app from this section instead of the one 'clisso get' writes them to",
 	)
-	err := viper.BindPFlag("global.credentials-path", cmdStatus.Flags().Lookup("read-from-file"))
-	 if err != nil {
-		log.Fatalf(color.RedString("Error binding flag global.credentials-path: %v"), err)
-	}
 }
 
 var cmdStatus = &cobra.Command{
 	Use:   "status",
 	Short: "Show active (non-expired) credentials",
-	Long:  `Show active (non-expired) credentials`,
+	Long: `Show active (non-expired) credentials
+
+When --prompt is specified, only the app and the remaining validity of its credentials are
+printed, e.g. "prod 42m". The credentials are read from the section 'clisso get' writes them to,
+i.e. the one named in AWS_PROFILE if global.use-aws-profile is enabled, or else the one named after
+the app. Nothing is printed and the exit code is 1 if the app has no valid credentials. No network
+requests are made.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		printStatus()
+		if statusPrompt != "" {
+			app := resolveAlias(statusPrompt)
+			path, err := credentialsPath(readFromFile, app)
+			if err != nil {
+				os.Exit(exitCodes[codeConfig])
+			}
+			// Look up the section like get does.
+			if cmd.Flags().Changed("credentials-section") {
+				credentialsSection = statusCredentialsSection
+			} else {
+				credentialsSection = awsProfileSection()
+			}
+			status, err := promptStatus(path, app, sectionName(app))
+			if err != nil {
+				os.Exit(exitCodes[codeConfig])
+			}
+			if status == "" {
+				os.Exit(exitCodes[codeError])
+			}
+			fmt.Println(status)
+			return
+		}
+
+		configfile, err := credentialsPath(readFromFile, "")
+		if err != nil {
+			fatalf(codeConfig, "Failed to expand home: %s", err)
+		}
+		printStatus(configfile)
 	},
 }
 
-func printStatus() {
-	configfile, err := homedir.Expand(viper.GetString("global.credentials-path"))
-	if err != nil {
-		log.Fatalf(color.RedString("Failed to expand home: %s"), err)
-	}
-
+// printStatus prints the non-expired credentials in the credentials file at configfile.
+func printStatus(configfile string) {
 	profiles, err := aws.GetValidCredentials(configfile)
 	if err != nil {
-		log.Fatalf(color.RedString("Failed to retrieve non-expired credentials: %s"), err)
+		fatalf(codeError, "Failed to retrieve non-expired credentials: %s", err)
 	}
 
 	if len(profiles) == 0 {
@@ -63,3 +95,44 @@ func printStatus() {
 
 	table.Render()
 }
+
+// promptStatus returns the app and the remaining validity of its credentials in the given section
+// of the credentials file at path in a compact format, or an empty string if the app has no valid
+// credentials.
+func promptStatus(path, app, section string) (string, error) {
+	exp, err := validExpiration(path, section)
+	if err != nil || exp.IsZero() {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s %s", app, compactDuration(time.Until(exp))), nil
+}
+
+// validExpiration returns the expiration of the non-expired credentials in the given section of
+// the credentials file at path, or the zero time if the section has no valid credentials.
+func validExpiration(path, section string) (time.Time, error) {
+	profiles, err := aws.GetValidCredentials(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	for _, p := range profiles {
+		if p.Name == section {
+			return time.Unix(p.ExpireAtUnix, 0), nil
+		}
+	}
+
+	return time.Time{}, nil
+}
+
+// compactDuration formats d in whole minutes, e.g. 42m or 1h5m.
+func compactDuration(d time.Duration) string {
+	if d < time.Minute {
+		return "<1m"
+	}
+	m := int(d / time.Minute)
+	if m < 60 {
+		return fmt.Sprintf("%dm", m)
+	}
+	return fmt.Sprintf("%dh%dm", m/60, m%60)
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/allcloud-io/clisso/aws"
+)
+
+func TestPromptStatus(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	for section, expiration := range map[string]time.Time{
+		"prod":       time.Now().Add(42*time.Minute + 30*time.Second),
+		"expired":    time.Now().Add(-time.Minute),
+		"my-profile": time.Now().Add(10*time.Minute + 30*time.Second),
+	} {
+		creds := &aws.Credentials{AccessKeyID: "key", SecretAccessKey: "secret", Expiration: expiration}
+		if err := aws.WriteToFile(creds, path, section); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		app     string
+		section string
+		expect  string
+	}{
+		{"prod", "prod", "prod 42m"},
+		{"expired", "expired", ""},
+		{"missing", "missing", ""},
+		{"other", "my-profile", "other 10m"},
+	} {
+		t.Run(test.app, func(t *testing.T) {
+			got, err := promptStatus(path, test.app, test.section)
+			if err != nil {
+				t.Fatalf("unexpected error %+v", err)
+			}
+			if got != test.expect {
+				t.Errorf("wrong status: got %q, want %q", got, test.expect)
+			}
+		})
+	}
+}
+
+func TestCompactDuration(t *testing.T) {
+	for _, test := range []struct {
+		d      time.Duration
+		expect string
+	}{
+		{30 * time.Second, "<1m"},
+		{42*time.Minute + 59*time.Second, "42m"},
+		{time.Hour, "1h0m"},
+		{3*time.Hour + 5*time.Minute, "3h5m"},
+	} {
+		if got := compactDuration(test.d); got != test.expect {
+			t.Errorf("wrong duration for %s: got %q, want %q", test.d, got, test.expect)
+		}
+	}
+}
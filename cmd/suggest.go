@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/allcloud-io/clisso/prompt"
+	"github.com/spf13/viper"
+)
+
+// maxSuggestions is the maximum number of app names suggested for an unknown app.
+const maxSuggestions = 3
+
+// editDistance returns the Levenshtein distance between a and b, i.e. the number of
+// single-character insertions, deletions and substitutions required to turn a into b, except that
+// swapping two adjacent characters counts as a single edit since it is a common typo.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	// d[i][j] is the distance between the first i runes of a and the first j runes of b.
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min3(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] && d[i-2][j-2]+1 < d[i][j] {
+				d[i][j] = d[i-2][j-2] + 1
+			}
+		}
+	}
+
+	return d[len(ra)][len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// suggestApps returns up to maxSuggestions of the given candidates which are close to name, closest
+// first. A candidate is close if it differs from name by at most a third of the length of name,
+// which catches typos without suggesting unrelated names.
+func suggestApps(name string, candidates []string) []string {
+	maxDistance := len([]rune(name)) / 3
+	if maxDistance < 1 {
+		maxDistance = 1
+	}
+
+	distances := make(map[string]int)
+	var matches []string
+	for _, c := range candidates {
+		d := editDistance(strings.ToLower(name), strings.ToLower(c))
+		if d <= maxDistance {
+			distances[c] = d
+			matches = append(matches, c)
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if distances[matches[i]] != distances[matches[j]] {
+			return distances[matches[i]] < distances[matches[j]]
+		}
+		return matches[i] < matches[j]
+	})
+	if len(matches) > maxSuggestions {
+		matches = matches[:maxSuggestions]
+	}
+
+	return matches
+}
+
+// checkAppExists returns app if it is configured. Otherwise, the closest app names and aliases are
+// suggested, and if offer is true and stdin is a terminal, the user is offered to use the closest
+// one. An error is returned if app doesn't exist and the user didn't accept a suggestion.
+func checkAppExists(app string, offer bool) (string, error) {
+	if viper.IsSet("apps." + app) {
+		return app, nil
+	}
+
+	candidates := appNames()
+	for alias := range viper.GetStringMapString("aliases") {
+		candidates = append(candidates, alias)
+	}
+
+	suggestions := suggestApps(app, candidates)
+	if len(suggestions) == 0 {
+		return "", fmt.Errorf("app '%s' doesn't exist", app)
+	}
+
+	if offer {
+		answer, err := prompt.Line(fmt.Sprintf("App '%s' doesn't exist. Did you mean '%s'? [y/N]: ",
+			app, suggestions[0]), "")
+		if err == nil && strings.EqualFold(strings.TrimSpace(answer), "y") {
+			return resolveAlias(suggestions[0]), nil
+		}
+	}
+
+	return "", fmt.Errorf("app '%s' doesn't exist. Did you mean: %s?", app,
+		strings.Join(suggestions, ", "))
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestEditDistance(t *testing.T) {
+	for _, test := range []struct {
+		a, b   string
+		expect int
+	}{
+		{"", "", 0},
+		{"prod", "prod", 0},
+		{"prdo", "prod", 1},
+		{"prod", "prd", 1},
+		{"kitten", "sitting", 3},
+		{"", "dev", 3},
+	} {
+		if got := editDistance(test.a, test.b); got != test.expect {
+			t.Errorf("editDistance(%q, %q): got %d, want %d", test.a, test.b, got, test.expect)
+		}
+	}
+}
+
+func TestSuggestApps(t *testing.T) {
+	candidates := []string{"prod", "prod-eu", "dev", "staging", "production"}
+
+	for _, test := range []struct {
+		name   string
+		expect []string
+	}{
+		{"prdo", []string{"prod"}},
+		{"PROD-E", []string{"prod-eu", "prod"}},
+		{"stagign", []string{"staging"}},
+		{"qa", nil},
+		{"xyz", nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := suggestApps(test.name, candidates); !reflect.DeepEqual(got, test.expect) {
+				t.Errorf("wrong suggestions: got %v, want %v", got, test.expect)
+			}
+		})
+	}
+}
+
+func TestCheckAppExists(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+
+	viper.Set("apps.prod.provider", "okta")
+	viper.Set("aliases.staging", "prod")
+
+	if app, err := checkAppExists("prod", false); err != nil || app != "prod" {
+		t.Errorf("existing app: got %q, %v", app, err)
+	}
+
+	_, err := checkAppExists("stagign", false)
+	if err == nil || !strings.Contains(err.Error(), "Did you mean: staging?") {
+		t.Errorf("expected suggestion of alias, got %v", err)
+	}
+
+	_, err = checkAppExists("unrelated", false)
+	if err == nil || strings.Contains(err.Error(), "Did you mean") {
+		t.Errorf("expected error without suggestions, got %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/allcloud-io/clisso/aws"
+	"github.com/allcloud-io/clisso/saml"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var whoamiProfile string
+var whoamiFile string
+var whoamiAlias bool
+
+func init() {
+	RootCmd.AddCommand(cmdWhoami)
+	cmdWhoami.Flags().StringVar(
+		&whoamiProfile, "profile", "",
+		"Profile whose credentials are used (default is $AWS_PROFILE or \"default\")",
+	)
+	cmdWhoami.Flags().StringVarP(
+		&whoamiFile, "read-from-file", "r", "",
+		"Read credentials from this file instead of the default ($AWS_SHARED_CREDENTIALS_FILE or $HOME/.aws/credentials)",
+	)
+	cmdWhoami.Flags().BoolVar(
+		&whoamiAlias, "alias", false,
+		"Look up the IAM account alias (requires iam:ListAccountAliases)",
+	)
+}
+
+var cmdWhoami = &cobra.Command{
+	Use:   "whoami",
+	Short: "Print the identity of the credentials of a profile",
+	Long: `Print the account and ARN of the identity the credentials of a profile belong to on a single
+line, e.g. "prod (123456789012) arn:aws:sts::123456789012:assumed-role/Admin/clisso". The account
+is named using global.accounts, or using its IAM account alias if --alias is specified. Only STS
+(and IAM for --alias) is contacted. See 'clisso inspect' for more details about the credentials.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		profile := targetProfile(whoamiProfile)
+		path, err := credentialsPath(whoamiFile, "")
+		if err != nil {
+			fatalf(codeConfig, "Failed to expand home: %s", err)
+		}
+		hc, err := newHTTPClient("")
+		if err != nil {
+			fatalf(codeConfig, "%v", err)
+		}
+
+		creds, id, err := inspectCredentials(path, profile, hc)
+		if err != nil {
+			fatalf(codeOf(err, codeError), "Could not inspect profile '%s': %v", profile, err)
+		}
+
+		fmt.Println(whoami(id, accountLabel(creds, id, hc)))
+	},
+}
+
+// accountLabel returns the name of the account of id, which is its IAM account alias if --alias is
+// specified or its name in global.accounts otherwise. If the account has no name, an empty string
+// is returned.
+func accountLabel(creds *aws.Credentials, id *aws.CallerIdentity, hc *http.Client) string {
+	if !whoamiAlias {
+		return saml.AccountName(id.Account)
+	}
+
+	alias, err := aws.AccountAlias(creds, hc)
+	if err != nil {
+		log.Printf(color.YellowString("Could not look up the account alias: %v"), err)
+		return saml.AccountName(id.Account)
+	}
+	return alias
+}
+
+// whoami formats the identity id whose account is named name.
+func whoami(id *aws.CallerIdentity, name string) string {
+	account := id.Account
+	if name != "" {
+		account = fmt.Sprintf("%s (%s)", name, id.Account)
+	}
+	return fmt.Sprintf("%s %s", account, id.ARN)
+}
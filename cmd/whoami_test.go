@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/allcloud-io/clisso/aws"
+	"github.com/allcloud-io/clisso/internal/testserver"
+	"github.com/spf13/viper"
+)
+
+func TestWhoami(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	defer func() { whoamiAlias = false }()
+
+	sts := testserver.NewSTS()
+	defer sts.Close()
+	setupTestSTS(t, sts)
+	aws.IAMEndpoint = sts.URL
+	defer func() { aws.IAMEndpoint = "" }()
+
+	path := filepath.Join(t.TempDir(), "credentials")
+	creds := &aws.Credentials{AccessKeyID: testserver.AccessKeyID, SecretAccessKey: testserver.SecretAccessKey,
+		SessionToken: testserver.SessionToken, Expiration: time.Now().Add(time.Hour)}
+	if err := aws.WriteToFile(creds, path, "prod"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name     string
+		accounts map[string]interface{}
+		alias    bool
+		expect   string
+	}{
+		{"Unnamed", nil, false, "123456789012 " + testserver.CallerARN},
+		{"global.accounts", map[string]interface{}{"123456789012": "prod"}, false,
+			"prod (123456789012) " + testserver.CallerARN},
+		{"Account alias", map[string]interface{}{"123456789012": "prod"}, true,
+			testserver.AccountAlias + " (123456789012) " + testserver.CallerARN},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			viper.Set("global.accounts", test.accounts)
+			whoamiAlias = test.alias
+
+			stored, id, err := inspectCredentials(path, "prod", nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := whoami(id, accountLabel(stored, id, nil)); got != test.expect {
+				t.Errorf("wrong output: got %q, want %q", got, test.expect)
+			}
+		})
+	}
+}
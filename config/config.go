@@ -1,20 +1,383 @@
 package config
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"net/url"
+	"os"
+	"os/user"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
+const (
+	// DefaultMFAPollInterval is the default interval at which push MFA verification is polled.
+	DefaultMFAPollInterval = 2 * time.Second
+
+	// DefaultMFAPollAttempts is the default number of times push MFA verification is polled
+	// before giving up.
+	DefaultMFAPollAttempts = 30
+
+	// DefaultHTTPTimeout is the default maximum time an HTTP request may take.
+	DefaultHTTPTimeout = 30 * time.Second
+
+	// DefaultTLSMinVersion is the default minimum TLS version of HTTPS connections.
+	DefaultTLSMinVersion = "1.2"
+
+	// DefaultOneLoginAPIVersion is the default version of the OneLogin API used to generate SAML
+	// assertions.
+	DefaultOneLoginAPIVersion = 2
+
+	// DefaultExpiryBuffer is the default time before their expiration at which stored credentials
+	// are no longer used.
+	DefaultExpiryBuffer = 5 * time.Minute
+
+	// DefaultKeychainRetries is the default number of times a keychain operation which failed
+	// with a transient error is retried.
+	DefaultKeychainRetries = 2
+
+	// DefaultKeychainRetryDelay is the default time waited before retrying a keychain operation.
+	DefaultKeychainRetryDelay = 200 * time.Millisecond
+)
+
+// Overrides are settings which take precedence over the configuration of providers and apps, e.g.
+// because they were given on the command line. Empty fields don't override anything. Overrides
+// are passed along with each request for credentials rather than stored in the configuration, so
+// that they are never written to the config file and don't leak between concurrent requests.
+type Overrides struct {
+	Username     string
+	PasswordFile string
+	// MFACode is a one-time password used instead of prompting for one.
+	MFACode string
+	// ReuseSession overrides reuse-session if it isn't nil.
+	ReuseSession *bool
+	// ReuseOktaSessions enables session reuse for Okta providers unless ReuseSession disables it,
+	// so that obtaining credentials for several apps or for an app again only authenticates once.
+	ReuseOktaSessions bool
+	MFAPollInterval   time.Duration
+	MFAPollAttempts   int
+	// SessionName and STSEndpoint override the role session name and the STS endpoint of the app.
+	SessionName string
+	STSEndpoint string
+	// SAMLOutput is the path of a file the SAML assertion is written to instead of assuming a role,
+	// if set. The credentials returned then only hold the ARNs of the role and the SAML provider.
+	SAMLOutput string
+}
+
+// apply overrides the given provider settings with those of o.
+func (o Overrides) apply(username, passwordFile, mfaCode *string, interval *time.Duration, attempts *int) {
+	for _, s := range []struct {
+		dst *string
+		v   string
+	}{
+		{username, o.Username},
+		{passwordFile, o.PasswordFile},
+		{mfaCode, o.MFACode},
+	} {
+		if s.v != "" {
+			*s.dst = s.v
+		}
+	}
+	if o.MFAPollInterval > 0 {
+		*interval = o.MFAPollInterval
+	}
+	if o.MFAPollAttempts > 0 {
+		*attempts = o.MFAPollAttempts
+	}
+}
+
+// tlsVersions maps the supported values of global.tls-min-version to TLS versions.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// GetTLSMinVersion returns the minimum TLS version of HTTPS connections configured using
+// global.tls-min-version, or DefaultTLSMinVersion if it isn't set.
+func GetTLSMinVersion() (uint16, error) {
+	v := viper.GetString("global.tls-min-version")
+	if v == "" {
+		v = DefaultTLSMinVersion
+	}
+
+	version, ok := tlsVersions[v]
+	if !ok {
+		return 0, fmt.Errorf("invalid global.tls-min-version '%s': must be one of 1.0, 1.1, 1.2 or 1.3", v)
+	}
+	return version, nil
+}
+
+// GetHTTPTimeout returns the HTTP timeout for requests made on behalf of provider p using the
+// following order of preference: providers.<p>.http-timeout -> global.http-timeout ->
+// DefaultHTTPTimeout. If p is empty, the provider setting is skipped.
+func GetHTTPTimeout(p string) (time.Duration, error) {
+	keys := []string{"global.http-timeout"}
+	if p != "" {
+		keys = append([]string{fmt.Sprintf("providers.%s.http-timeout", p)}, keys...)
+	}
+
+	for _, k := range keys {
+		if !viper.IsSet(k) {
+			continue
+		}
+		timeout := viper.GetDuration(k)
+		if timeout <= 0 {
+			return 0, fmt.Errorf("invalid %s '%s': must be a positive duration such as 30s", k,
+				viper.GetString(k))
+		}
+		return timeout, nil
+	}
+
+	return DefaultHTTPTimeout, nil
+}
+
+// GetSTSEndpoint returns the URL of the STS endpoint credentials for app are obtained from using
+// the following order of preference: override -> apps.<app>.sts-endpoint -> global.sts-endpoint.
+// If app is empty, the app setting is skipped. If none is set, an empty string is returned, which
+// causes the default endpoint to be used. Endpoints must be HTTPS URLs without a path, e.g.
+// https://sts-fips.us-east-1.amazonaws.com.
+func GetSTSEndpoint(app, override string) (string, error) {
+	keys := []string{"global.sts-endpoint"}
+	if app != "" {
+		keys = append([]string{fmt.Sprintf("apps.%s.sts-endpoint", app)}, keys...)
+	}
+	if override != "" {
+		keys = append([]string{"--sts-endpoint"}, keys...)
+	}
+
+	for _, k := range keys {
+		v := viper.GetString(k)
+		if k == "--sts-endpoint" {
+			v = override
+		}
+		if v == "" {
+			continue
+		}
+		u, err := url.Parse(v)
+		if err != nil || u.Scheme != "https" || u.Host == "" || strings.TrimSuffix(u.Path, "/") != "" ||
+			u.RawQuery != "" || u.User != nil {
+			return "", fmt.Errorf("invalid %s '%s': must be an HTTPS URL without a path such as "+
+				"https://sts-fips.us-east-1.amazonaws.com", k, v)
+		}
+		return u.Scheme + "://" + u.Host, nil
+	}
+
+	return "", nil
+}
+
+// GetExpiryBuffer returns global.expiry-buffer, or DefaultExpiryBuffer if it isn't set. Stored
+// credentials which expire within the buffer are considered unusable, so that they are refreshed
+// before they expire in the middle of a long operation.
+func GetExpiryBuffer() (time.Duration, error) {
+	if !viper.IsSet("global.expiry-buffer") {
+		return DefaultExpiryBuffer, nil
+	}
+
+	v := viper.GetString("global.expiry-buffer")
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid global.expiry-buffer '%s': must be a non-negative duration such as 5m", v)
+	}
+	return d, nil
+}
+
+// GetKeychainRetry returns global.keychain-retries and global.keychain-retry-delay, falling back to
+// the defaults for unset values.
+func GetKeychainRetry() (int, time.Duration, error) {
+	retries := DefaultKeychainRetries
+	delay := DefaultKeychainRetryDelay
+
+	if viper.IsSet("global.keychain-retries") {
+		v := viper.GetString("global.keychain-retries")
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 10 {
+			return 0, 0, fmt.Errorf("invalid global.keychain-retries '%s': must be an integer between 0 and 10", v)
+		}
+		retries = n
+	}
+
+	if viper.IsSet("global.keychain-retry-delay") {
+		v := viper.GetString("global.keychain-retry-delay")
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 || d > 5*time.Second {
+			return 0, 0, fmt.Errorf("invalid global.keychain-retry-delay '%s': must be a duration "+
+				"between 0 and 5s such as 200ms", v)
+		}
+		delay = d
+	}
+
+	return retries, delay, nil
+}
+
+// Keychain backends which global.keychain-backend can be set to.
+const (
+	// KeychainBackendAuto uses the keychain of the OS. On Linux, the Secret Service is only used
+	// if a D-Bus session bus is found.
+	KeychainBackendAuto = "auto"
+	// KeychainBackendSecretService always uses the Secret Service, letting D-Bus start a session
+	// bus if none is found.
+	KeychainBackendSecretService = "secretservice"
+)
+
+// GetKeychainBackend returns global.keychain-backend, or KeychainBackendAuto if it isn't set. The
+// Secret Service is only supported on Linux.
+func GetKeychainBackend() (string, error) {
+	switch b := viper.GetString("global.keychain-backend"); b {
+	case "", KeychainBackendAuto:
+		return KeychainBackendAuto, nil
+	case KeychainBackendSecretService:
+		if runtime.GOOS != "linux" {
+			return "", fmt.Errorf("invalid global.keychain-backend '%s': only supported on Linux", b)
+		}
+		return b, nil
+	default:
+		return "", fmt.Errorf("invalid global.keychain-backend '%s': must be %s or %s", b,
+			KeychainBackendAuto, KeychainBackendSecretService)
+	}
+}
+
+// MFA types which apps.<app>.mfa-type can be set to.
+const (
+	MFATypePush = "push"
+	MFATypeTOTP = "totp"
+)
+
+// GetMFAType returns the type of MFA factor which is used for app without prompting, or an empty
+// string if apps.<app>.mfa-type isn't set. WebAuthn factors are rejected since clisso can't verify
+// them, which would otherwise only be noticed after the password was sent.
+func GetMFAType(app string) (string, error) {
+	switch t := viper.GetString(fmt.Sprintf("apps.%s.mfa-type", app)); t {
+	case "", MFATypePush, MFATypeTOTP:
+		return t, nil
+	case "webauthn":
+		return "", fmt.Errorf("mfa-type '%s' isn't supported: clisso can't verify WebAuthn factors", t)
+	default:
+		return "", fmt.Errorf("invalid mfa-type '%s': must be %s or %s", t, MFATypePush, MFATypeTOTP)
+	}
+}
+
+// GetMFAPolling returns the push MFA polling settings of provider p, falling back to the defaults
+// for unset values.
+func GetMFAPolling(p string) (time.Duration, int, error) {
+	interval := DefaultMFAPollInterval
+	attempts := DefaultMFAPollAttempts
+
+	if k := fmt.Sprintf("providers.%s.mfa-poll-interval", p); viper.IsSet(k) {
+		interval = viper.GetDuration(k)
+		if interval <= 0 {
+			return 0, 0, fmt.Errorf("invalid mfa-poll-interval '%s': must be a positive duration such as 2s",
+				viper.GetString(k))
+		}
+	}
+
+	if k := fmt.Sprintf("providers.%s.mfa-poll-attempts", p); viper.IsSet(k) {
+		attempts = viper.GetInt(k)
+		if attempts <= 0 {
+			return 0, 0, fmt.Errorf("invalid mfa-poll-attempts '%s': must be a positive integer",
+				viper.GetString(k))
+		}
+	}
+
+	return interval, attempts, nil
+}
+
+// AddUsernameSuffix returns username with suffix appended unless suffix is empty or username
+// already ends with it. A suffix starting with "@" isn't appended to a username which already
+// contains a domain.
+func AddUsernameSuffix(username, suffix string) string {
+	if suffix == "" || username == "" || strings.HasSuffix(username, suffix) {
+		return username
+	}
+	if strings.HasPrefix(suffix, "@") && strings.Contains(username, "@") {
+		return username
+	}
+	return username + suffix
+}
+
+// SessionNameFields represents the fields available to global.session-name-template.
+type SessionNameFields struct {
+	// Username is the name of the local user, without a Windows domain.
+	Username string
+	// Hostname is the short host name of the local machine.
+	Hostname string
+	// App is the name of the app credentials are obtained for.
+	App string
+}
+
+// sessionNameEnv is the environment variable the AWS SDKs read the role session name from.
+const sessionNameEnv = "AWS_ROLE_SESSION_NAME"
+
+// GetSessionName returns the role session name for the given app using the following order of
+// preference: override -> apps.<app>.session-name -> AWS_ROLE_SESSION_NAME ->
+// global.session-name-template. If none of them is set, an empty string is returned, which causes
+// the default session name to be used. The result isn't sanitized.
+func GetSessionName(app, override string) (string, error) {
+	if override != "" {
+		return override, nil
+	}
+	if name := viper.GetString(fmt.Sprintf("apps.%s.session-name", app)); name != "" {
+		return name, nil
+	}
+	if name := os.Getenv(sessionNameEnv); name != "" {
+		return name, nil
+	}
+
+	text := viper.GetString("global.session-name-template")
+	if text == "" {
+		return "", nil
+	}
+
+	tmpl, err := template.New("session-name").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("parsing global.session-name-template: %v", err)
+	}
+
+	f := SessionNameFields{App: app}
+	if u, err := user.Current(); err == nil {
+		f.Username = u.Username[strings.LastIndex(u.Username, `\`)+1:]
+	}
+	if h, err := os.Hostname(); err == nil {
+		f.Hostname = strings.SplitN(h, ".", 2)[0]
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, f); err != nil {
+		return "", fmt.Errorf("rendering global.session-name-template: %v", err)
+	}
+
+	return b.String(), nil
+}
+
 // OneLoginProviderConfig represents a OneLogin provider configuration.
 type OneLoginProviderConfig struct {
-	ClientID     string
-	ClientSecret string
-	Subdomain    string
-	Type         string
-	Username     string
-	Region       string
+	ClientID        string
+	ClientSecret    string
+	Subdomain       string
+	Type            string
+	Username        string
+	Region          string
+	PasswordFile    string
+	MFAPollInterval time.Duration
+	MFAPollAttempts int
+	// MFACode is a one-time password supplied on the command line. It is only set by Override.
+	MFACode string
+	// TOTPSecretRef is the name of the keychain item holding the TOTP secret used to generate
+	// one-time passwords instead of asking for them, if set.
+	TOTPSecretRef string
+	// ReuseSession enables reusing a stored identity provider session instead of authenticating.
+	ReuseSession bool
+	// UsernameSuffix is appended to usernames which don't include it, e.g. "@example.com".
+	UsernameSuffix string
+	// APIVersion is the version of the OneLogin API used to generate SAML assertions (1 or 2).
+	APIVersion int
 }
 
 // GetOneLoginProvider returns a OneLoginProviderConfig struct containing the configuration for
@@ -24,7 +387,12 @@ func GetOneLoginProvider(p string) (*OneLoginProviderConfig, error) {
 	clientID := viper.GetString(fmt.Sprintf("providers.%s.client-id", p))
 	subdomain := viper.GetString(fmt.Sprintf("providers.%s.subdomain", p))
 	username := viper.GetString(fmt.Sprintf("providers.%s.username", p))
+	usernameSuffix := viper.GetString(fmt.Sprintf("providers.%s.username-suffix", p))
 	region := viper.GetString(fmt.Sprintf("providers.%s.region", p))
+	passwordFile := viper.GetString(fmt.Sprintf("providers.%s.password-file", p))
+	totpSecretRef := viper.GetString(fmt.Sprintf("providers.%s.totp-secret-ref", p))
+	reuseSession := viper.GetBool(fmt.Sprintf("providers.%s.reuse-session", p))
+	apiVersion := viper.GetInt(fmt.Sprintf("providers.%s.api-version", p))
 
 	if clientSecret == "" {
 		return nil, errors.New("client-secret config value must bet set")
@@ -40,36 +408,120 @@ func GetOneLoginProvider(p string) (*OneLoginProviderConfig, error) {
 		region = "US"
 	}
 
+	switch apiVersion {
+	case 0:
+		apiVersion = DefaultOneLoginAPIVersion
+	case 1, 2:
+	default:
+		return nil, fmt.Errorf("invalid api-version %d: must be 1 or 2", apiVersion)
+	}
+
+	interval, attempts, err := GetMFAPolling(p)
+	if err != nil {
+		return nil, err
+	}
+
 	c := OneLoginProviderConfig{
-		ClientID:     clientID,
-		ClientSecret: clientSecret,
-		Subdomain:    subdomain,
-		Username:     username,
-		Region:       region,
+		ClientID:        clientID,
+		ClientSecret:    clientSecret,
+		Subdomain:       subdomain,
+		Username:        username,
+		UsernameSuffix:  usernameSuffix,
+		Region:          region,
+		PasswordFile:    passwordFile,
+		MFAPollInterval: interval,
+		MFAPollAttempts: attempts,
+		TOTPSecretRef:   totpSecretRef,
+		ReuseSession:    reuseSession,
+		APIVersion:      apiVersion,
 	}
 
 	return &c, nil
 }
 
+// Override applies the overrides o to c.
+func (c *OneLoginProviderConfig) Override(o Overrides) {
+	o.apply(&c.Username, &c.PasswordFile, &c.MFACode, &c.MFAPollInterval, &c.MFAPollAttempts)
+	if o.ReuseSession != nil {
+		c.ReuseSession = *o.ReuseSession
+	}
+}
+
 // OneLoginAppConfig represents a OneLogin app configuration.
 type OneLoginAppConfig struct {
 	ID       string
 	Provider string
+	// MFAType is the type of MFA device used without prompting, if set.
+	MFAType string
+}
+
+// ParseAppURL parses the URL of an app at an identity provider, which must be an absolute HTTPS
+// URL since the session of the user is sent to it.
+func ParseAppURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url '%s': %v", raw, err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("invalid url '%s': must be an absolute HTTPS URL", raw)
+	}
+	return u, nil
+}
+
+// oneLoginAppID returns the app ID in a URL of a OneLogin app such as its issuer URL
+// (https://app.onelogin.com/saml/metadata/123456), which is the last numeric path segment. The URL
+// must point to app.onelogin.com or to the OneLogin subdomain of the provider.
+func oneLoginAppID(raw, subdomain string) (string, error) {
+	u, err := ParseAppURL(raw)
+	if err != nil {
+		return "", err
+	}
+	host := strings.ToLower(u.Hostname())
+	if host != "app.onelogin.com" && host != strings.ToLower(subdomain)+".onelogin.com" {
+		return "", fmt.Errorf("invalid url '%s': must point to app.onelogin.com or %s.onelogin.com", raw, subdomain)
+	}
+
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i := len(segments) - 1; i >= 0; i-- {
+		if _, err := strconv.ParseUint(segments[i], 10, 64); err == nil {
+			return segments[i], nil
+		}
+	}
+	return "", fmt.Errorf("invalid url '%s': doesn't contain an app ID", raw)
 }
 
-// GetOneLoginApp returns a OneLoginAppConfig struct containing the configuration for app.
-func GetOneLoginApp(app string) (*OneLoginAppConfig, error) {
+// GetOneLoginApp returns a OneLoginAppConfig struct containing the configuration for app when
+// using provider. If the url of the app is set, the app ID is taken from the URL, in which case
+// app-id must either be unset or match it.
+func GetOneLoginApp(app, provider string) (*OneLoginAppConfig, error) {
 	config := viper.GetStringMapString("apps." + app)
 	appID := config["app-id"]
-	provider := config["provider"]
+
+	if u := config["url"]; u != "" {
+		subdomain := viper.GetString(fmt.Sprintf("providers.%s.subdomain", provider))
+		id, err := oneLoginAppID(u, subdomain)
+		if err != nil {
+			return nil, err
+		}
+		if appID != "" && appID != id {
+			return nil, fmt.Errorf("app-id '%s' doesn't match the app ID %s in url '%s'", appID, id, u)
+		}
+		appID = id
+	}
 
 	if appID == "" {
-		return nil, errors.New("app-id config value must be set")
+		return nil, errors.New("app-id or url config value must be set")
+	}
+
+	mfaType, err := GetMFAType(app)
+	if err != nil {
+		return nil, err
 	}
 
 	c := OneLoginAppConfig{
 		ID:       appID,
 		Provider: provider,
+		MFAType:  mfaType,
 	}
 
 	return &c, nil
@@ -77,26 +529,105 @@ func GetOneLoginApp(app string) (*OneLoginAppConfig, error) {
 
 // OktaProviderConfig represents an Okta provider configuration.
 type OktaProviderConfig struct {
-	BaseURL  string
-	Username string
+	BaseURL         string
+	Username        string
+	PasswordFile    string
+	MFAPollInterval time.Duration
+	MFAPollAttempts int
+	// MFACode is a one-time password supplied on the command line. It is only set by Override.
+	MFACode string
+	// TOTPSecretRef is the name of the keychain item holding the TOTP secret used to generate
+	// one-time passwords instead of asking for them, if set.
+	TOTPSecretRef string
+	// ReuseSession enables reusing a stored identity provider session instead of authenticating.
+	ReuseSession bool
+	// UsernameSuffix is appended to usernames which don't include it, e.g. "@example.com".
+	UsernameSuffix string
+	// AuthType is the way users authenticate: OktaAuthTypePassword or OktaAuthTypeDevice.
+	AuthType string
+	// ClientID is the client ID of the OIDC app used for device authorization.
+	ClientID string
+	// AuthServer is the ID of the custom authorization server used for device
+	// authorization. If empty, the org authorization server is used.
+	AuthServer string
 }
 
+// Authentication types of Okta providers.
+const (
+	// OktaAuthTypePassword authenticates using a username, a password and optionally MFA, and
+	// exchanges a SAML assertion for credentials.
+	OktaAuthTypePassword = "password"
+	// OktaAuthTypeDevice authenticates using the OAuth 2.0 device authorization grant (RFC 8628)
+	// and exchanges the resulting ID token for credentials.
+	OktaAuthTypeDevice = "device"
+)
+
 // GetOktaProvider returns a OktaProviderConfig struct containing the configuration for provider p.
 func GetOktaProvider(p string) (*OktaProviderConfig, error) {
 	baseURL := viper.GetString(fmt.Sprintf("providers.%s.base-url", p))
 	username := viper.GetString(fmt.Sprintf("providers.%s.username", p))
+	usernameSuffix := viper.GetString(fmt.Sprintf("providers.%s.username-suffix", p))
+	passwordFile := viper.GetString(fmt.Sprintf("providers.%s.password-file", p))
+	totpSecretRef := viper.GetString(fmt.Sprintf("providers.%s.totp-secret-ref", p))
+	reuseSession := viper.GetBool(fmt.Sprintf("providers.%s.reuse-session", p))
+	authType := viper.GetString(fmt.Sprintf("providers.%s.auth-type", p))
+	clientID := viper.GetString(fmt.Sprintf("providers.%s.client-id", p))
+	authServer := viper.GetString(fmt.Sprintf("providers.%s.authorization-server", p))
 
 	if baseURL == "" {
 		return nil, errors.New("base-url config value must bet set")
 	}
 
-	return &OktaProviderConfig{BaseURL: baseURL, Username: username}, nil
+	switch authType {
+	case "":
+		authType = OktaAuthTypePassword
+	case OktaAuthTypePassword:
+	case OktaAuthTypeDevice:
+		if clientID == "" {
+			return nil, errors.New("client-id config value must bet set for device authorization")
+		}
+	default:
+		return nil, fmt.Errorf("invalid auth-type '%s'. Valid values: %s, %s", authType,
+			OktaAuthTypePassword, OktaAuthTypeDevice)
+	}
+
+	interval, attempts, err := GetMFAPolling(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OktaProviderConfig{
+		BaseURL:         baseURL,
+		Username:        username,
+		UsernameSuffix:  usernameSuffix,
+		PasswordFile:    passwordFile,
+		MFAPollInterval: interval,
+		MFAPollAttempts: attempts,
+		TOTPSecretRef:   totpSecretRef,
+		ReuseSession:    reuseSession,
+		AuthType:        authType,
+		ClientID:        clientID,
+		AuthServer:      authServer,
+	}, nil
+}
+
+// Override applies the overrides o to c.
+func (c *OktaProviderConfig) Override(o Overrides) {
+	o.apply(&c.Username, &c.PasswordFile, &c.MFACode, &c.MFAPollInterval, &c.MFAPollAttempts)
+	if o.ReuseOktaSessions {
+		c.ReuseSession = true
+	}
+	if o.ReuseSession != nil {
+		c.ReuseSession = *o.ReuseSession
+	}
 }
 
 // OktaAppConfig represents an Okta app configuration.
 type OktaAppConfig struct {
 	Provider string
 	URL      string
+	// MFAType is the type of MFA factor used without prompting, if set.
+	MFAType string
 }
 
 // GetOktaApp returns an OktaAppConfig struct containing the configuration for app.
@@ -106,16 +637,209 @@ func GetOktaApp(app string) (*OktaAppConfig, error) {
 	provider := config["provider"]
 	url := config["url"]
 
-	if provider == "" {
+	if provider == "" && !viper.IsSet(fmt.Sprintf("apps.%s.providers", app)) {
 		return nil, errors.New("provider config value must be set")
 	}
 
 	if url == "" {
 		return nil, errors.New("url config value must be set")
 	}
+	if _, err := ParseAppURL(url); err != nil {
+		return nil, err
+	}
+
+	mfaType, err := GetMFAType(app)
+	if err != nil {
+		return nil, err
+	}
 
 	return &OktaAppConfig{
 		Provider: provider,
 		URL:      url,
+		MFAType:  mfaType,
+	}, nil
+}
+
+// OktaDeviceAppConfig represents the configuration of an app of an Okta provider which uses
+// device authorization.
+type OktaDeviceAppConfig struct {
+	Provider string
+	RoleARN  string
+}
+
+// GetOktaDeviceApp returns an OktaDeviceAppConfig struct containing the configuration for app.
+func GetOktaDeviceApp(app string) (*OktaDeviceAppConfig, error) {
+	config := viper.GetStringMapString("apps." + app)
+
+	provider := config["provider"]
+	roleARN := config["arn"]
+
+	if provider == "" && !viper.IsSet(fmt.Sprintf("apps.%s.providers", app)) {
+		return nil, errors.New("provider config value must be set")
+	}
+
+	if roleARN == "" {
+		return nil, errors.New("arn config value must be set")
+	}
+
+	return &OktaDeviceAppConfig{
+		Provider: provider,
+		RoleARN:  roleARN,
+	}, nil
+}
+
+// RolesAnywhereProviderConfig represents an IAM Roles Anywhere provider configuration.
+type RolesAnywhereProviderConfig struct {
+	TrustAnchorARN string
+	ProfileARN     string
+	// Certificate and PrivateKey are the paths of the PEM-encoded X.509 certificate and private
+	// key used to authenticate against the trust anchor.
+	Certificate string
+	PrivateKey  string
+}
+
+// GetRolesAnywhereProvider returns a RolesAnywhereProviderConfig struct containing the
+// configuration for provider p.
+func GetRolesAnywhereProvider(p string) (*RolesAnywhereProviderConfig, error) {
+	trustAnchorARN := viper.GetString(fmt.Sprintf("providers.%s.trust-anchor-arn", p))
+	profileARN := viper.GetString(fmt.Sprintf("providers.%s.profile-arn", p))
+	certificate := viper.GetString(fmt.Sprintf("providers.%s.certificate", p))
+	privateKey := viper.GetString(fmt.Sprintf("providers.%s.private-key", p))
+
+	if trustAnchorARN == "" {
+		return nil, errors.New("trust-anchor-arn config value must bet set")
+	}
+	if profileARN == "" {
+		return nil, errors.New("profile-arn config value must bet set")
+	}
+	if certificate == "" {
+		return nil, errors.New("certificate config value must bet set")
+	}
+	if privateKey == "" {
+		return nil, errors.New("private-key config value must bet set")
+	}
+
+	return &RolesAnywhereProviderConfig{
+		TrustAnchorARN: trustAnchorARN,
+		ProfileARN:     profileARN,
+		Certificate:    certificate,
+		PrivateKey:     privateKey,
+	}, nil
+}
+
+// RolesAnywhereAppConfig represents an IAM Roles Anywhere app configuration.
+type RolesAnywhereAppConfig struct {
+	Provider string
+	RoleARN  string
+}
+
+// GetRolesAnywhereApp returns a RolesAnywhereAppConfig struct containing the configuration for
+// app.
+func GetRolesAnywhereApp(app string) (*RolesAnywhereAppConfig, error) {
+	config := viper.GetStringMapString("apps." + app)
+
+	provider := config["provider"]
+	roleARN := config["arn"]
+
+	if provider == "" && !viper.IsSet(fmt.Sprintf("apps.%s.providers", app)) {
+		return nil, errors.New("provider config value must be set")
+	}
+
+	if roleARN == "" {
+		return nil, errors.New("arn config value must be set")
+	}
+
+	return &RolesAnywhereAppConfig{
+		Provider: provider,
+		RoleARN:  roleARN,
+	}, nil
+}
+
+// DefaultJumpCloudBaseURL is the base URL of the JumpCloud user console, against which users
+// authenticate.
+const DefaultJumpCloudBaseURL = "https://console.jumpcloud.com"
+
+// JumpCloudProviderConfig represents a JumpCloud provider configuration.
+type JumpCloudProviderConfig struct {
+	BaseURL         string
+	Username        string
+	PasswordFile    string
+	MFAPollInterval time.Duration
+	MFAPollAttempts int
+	// MFACode is a one-time password supplied on the command line. It is only set by Override.
+	MFACode string
+	// TOTPSecretRef is the name of the keychain item holding the TOTP secret used to generate
+	// one-time passwords instead of asking for them, if set.
+	TOTPSecretRef string
+}
+
+// GetJumpCloudProvider returns a JumpCloudProviderConfig struct containing the configuration for
+// provider p.
+func GetJumpCloudProvider(p string) (*JumpCloudProviderConfig, error) {
+	baseURL := viper.GetString(fmt.Sprintf("providers.%s.base-url", p))
+	username := viper.GetString(fmt.Sprintf("providers.%s.username", p))
+	passwordFile := viper.GetString(fmt.Sprintf("providers.%s.password-file", p))
+	totpSecretRef := viper.GetString(fmt.Sprintf("providers.%s.totp-secret-ref", p))
+
+	if baseURL == "" {
+		baseURL = DefaultJumpCloudBaseURL
+	}
+
+	interval, attempts, err := GetMFAPolling(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return &JumpCloudProviderConfig{
+		BaseURL:         strings.TrimSuffix(baseURL, "/"),
+		Username:        username,
+		PasswordFile:    passwordFile,
+		MFAPollInterval: interval,
+		MFAPollAttempts: attempts,
+		TOTPSecretRef:   totpSecretRef,
+	}, nil
+}
+
+// Override applies the overrides o to c.
+func (c *JumpCloudProviderConfig) Override(o Overrides) {
+	o.apply(&c.Username, &c.PasswordFile, &c.MFACode, &c.MFAPollInterval, &c.MFAPollAttempts)
+}
+
+// JumpCloudAppConfig represents a JumpCloud app configuration.
+type JumpCloudAppConfig struct {
+	Provider string
+	// URL is the IdP-initiated SSO URL of the AWS app, e.g. https://sso.jumpcloud.com/saml2/aws.
+	URL string
+	// MFAType is the type of MFA factor used without prompting, if set.
+	MFAType string
+}
+
+// GetJumpCloudApp returns a JumpCloudAppConfig struct containing the configuration for app.
+func GetJumpCloudApp(app string) (*JumpCloudAppConfig, error) {
+	config := viper.GetStringMapString("apps." + app)
+
+	provider := config["provider"]
+	u := config["url"]
+
+	if provider == "" && !viper.IsSet(fmt.Sprintf("apps.%s.providers", app)) {
+		return nil, errors.New("provider config value must be set")
+	}
+
+	if u == "" {
+		return nil, errors.New("url config value must be set")
+	}
+	if _, err := ParseAppURL(u); err != nil {
+		return nil, err
+	}
+
+	mfaType, err := GetMFAType(app)
+	if err != nil {
+		return nil, err
+	}
+
+	return &JumpCloudAppConfig{
+		Provider: provider,
+		URL:      u,
+		MFAType:  mfaType,
 	}, nil
 }
@@ -0,0 +1,446 @@
+package config
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestAddUsernameSuffix(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		username string
+		suffix   string
+		expect   string
+	}{
+		{"No suffix", "user", "", "user"},
+		{"Bare username", "user", "@example.com", "user@example.com"},
+		{"Suffix already present", "user@example.com", "@example.com", "user@example.com"},
+		{"Different domain", "user@other.com", "@example.com", "user@other.com"},
+		{"Suffix without at sign", "user", ".corp", "user.corp"},
+		{"Empty username", "", "@example.com", ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := AddUsernameSuffix(test.username, test.suffix); got != test.expect {
+				t.Errorf("wrong username: got %q, want %q", got, test.expect)
+			}
+		})
+	}
+}
+
+func TestGetSessionName(t *testing.T) {
+	defer viper.Reset()
+
+	env, hasEnv := os.LookupEnv(sessionNameEnv)
+	defer func() {
+		if hasEnv {
+			os.Setenv(sessionNameEnv, env)
+		} else {
+			os.Unsetenv(sessionNameEnv)
+		}
+	}()
+
+	for _, test := range []struct {
+		name        string
+		template    string
+		appName     string
+		override    string
+		env         string
+		expect      string
+		expectError bool
+	}{
+		{"No template", "", "", "", "", "", false},
+		{"Static template", "clisso", "", "", "", "clisso", false},
+		{"App field", "clisso-{{.App}}", "", "", "", "clisso-test-app", false},
+		{"Unknown field", "{{.Foo}}", "", "", "", "", true},
+		{"Invalid template", "{{.App", "", "", "", "", true},
+		{"Environment overrides template", "clisso-{{.App}}", "", "", "alice", "alice", false},
+		{"App overrides environment", "clisso-{{.App}}", "ci", "", "alice", "ci", false},
+		{"Override overrides app", "clisso-{{.App}}", "ci", "flag", "alice", "flag", false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			viper.Set("global.session-name-template", test.template)
+			viper.Set("apps.test-app.session-name", test.appName)
+			os.Setenv(sessionNameEnv, test.env)
+
+			got, err := GetSessionName("test-app", test.override)
+			if test.expectError {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.expect {
+				t.Errorf("wrong session name: got %q, want %q", got, test.expect)
+			}
+		})
+	}
+}
+
+func TestGetOneLoginApp(t *testing.T) {
+	defer viper.Reset()
+
+	for _, test := range []struct {
+		name        string
+		appID       string
+		url         string
+		expectID    string
+		expectError bool
+	}{
+		{"App ID", "123456", "", "123456", false},
+		{"Issuer URL", "", "https://app.onelogin.com/saml/metadata/654321", "654321", false},
+		{"Admin URL", "", "https://example.onelogin.com/apps/654321/edit", "654321", false},
+		{"Matching app ID", "654321", "https://app.onelogin.com/saml/metadata/654321/", "654321", false},
+		{"Conflicting app ID", "123456", "https://app.onelogin.com/saml/metadata/654321", "", true},
+		{"Other subdomain", "", "https://other.onelogin.com/apps/654321/edit", "", true},
+		{"Other host", "", "https://sso.example.com/saml/metadata/654321", "", true},
+		{"HTTP URL", "", "http://app.onelogin.com/saml/metadata/654321", "", true},
+		{"URL without app ID", "", "https://example.onelogin.com/portal", "", true},
+		{"Relative URL", "", "trust/saml2/launch/654321", "", true},
+		{"Neither", "", "", "", true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			viper.Reset()
+			viper.Set("providers.test-provider.subdomain", "example")
+			viper.Set("apps.test-app.provider", "test-provider")
+			viper.Set("apps.test-app.app-id", test.appID)
+			viper.Set("apps.test-app.url", test.url)
+
+			a, err := GetOneLoginApp("test-app", "test-provider")
+			if test.expectError {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if a.ID != test.expectID {
+				t.Errorf("wrong app ID: got %q, want %q", a.ID, test.expectID)
+			}
+		})
+	}
+}
+
+func TestGetOktaApp(t *testing.T) {
+	defer viper.Reset()
+
+	for _, test := range []struct {
+		name        string
+		url         string
+		expectError bool
+	}{
+		{"Embed URL", "https://example.okta.com/home/amazon_aws/0oa1/272", false},
+		{"Custom domain", "https://sso.example.com/home/amazon_aws/0oa1/272", false},
+		{"Missing URL", "", true},
+		{"Relative URL", "home/amazon_aws/0oa1/272", true},
+		{"HTTP URL", "http://example.okta.com/home/amazon_aws/0oa1/272", true},
+		{"Unsupported scheme", "ftp://example.okta.com/app", true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			viper.Reset()
+			viper.Set("apps.test-app.provider", "test-provider")
+			viper.Set("apps.test-app.url", test.url)
+
+			a, err := GetOktaApp("test-app")
+			if test.expectError {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if a.URL != test.url {
+				t.Errorf("wrong URL: got %q, want %q", a.URL, test.url)
+			}
+		})
+	}
+}
+
+func TestGetJumpCloudApp(t *testing.T) {
+	defer viper.Reset()
+
+	for _, test := range []struct {
+		name        string
+		url         string
+		expectError bool
+	}{
+		{"SSO URL", "https://sso.jumpcloud.com/saml2/aws", false},
+		{"Missing URL", "", true},
+		{"Relative URL", "saml2/aws", true},
+		{"HTTP URL", "http://sso.jumpcloud.com/saml2/aws", true},
+		{"Unsupported scheme", "ftp://sso.jumpcloud.com/saml2/aws", true},
+		{"File URL", "file://host/saml2/aws", true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			viper.Reset()
+			viper.Set("apps.test-app.provider", "test-provider")
+			viper.Set("apps.test-app.url", test.url)
+
+			a, err := GetJumpCloudApp("test-app")
+			if test.expectError {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if a.URL != test.url {
+				t.Errorf("wrong URL: got %q, want %q", a.URL, test.url)
+			}
+		})
+	}
+}
+
+func TestGetOneLoginProviderAPIVersion(t *testing.T) {
+	defer viper.Reset()
+
+	for _, test := range []struct {
+		name        string
+		apiVersion  interface{}
+		expect      int
+		expectError bool
+	}{
+		{"Default", nil, DefaultOneLoginAPIVersion, false},
+		{"v1", 1, 1, false},
+		{"v2 as string", "2", 2, false},
+		{"Unsupported", 3, 0, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			viper.Reset()
+			viper.Set("providers.test-provider.client-id", "id")
+			viper.Set("providers.test-provider.client-secret", "secret")
+			viper.Set("providers.test-provider.subdomain", "test")
+			if test.apiVersion != nil {
+				viper.Set("providers.test-provider.api-version", test.apiVersion)
+			}
+
+			p, err := GetOneLoginProvider("test-provider")
+			if test.expectError {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if p.APIVersion != test.expect {
+				t.Errorf("wrong API version: got %d, want %d", p.APIVersion, test.expect)
+			}
+		})
+	}
+}
+
+func TestGetKeychainRetry(t *testing.T) {
+	defer viper.Reset()
+
+	for _, test := range []struct {
+		name        string
+		retries     interface{}
+		delay       interface{}
+		expectRetry int
+		expectDelay time.Duration
+		expectError bool
+	}{
+		{"Default", nil, nil, DefaultKeychainRetries, DefaultKeychainRetryDelay, false},
+		{"Custom", 5, "1s", 5, time.Second, false},
+		{"Disabled", "0", nil, 0, DefaultKeychainRetryDelay, false},
+		{"Negative retries", -1, nil, 0, 0, true},
+		{"Too many retries", 100, nil, 0, 0, true},
+		{"Not a number", "twice", nil, 0, 0, true},
+		{"Delay too long", nil, "1m", 0, 0, true},
+		{"Not a duration", nil, "soon", 0, 0, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			viper.Reset()
+			if test.retries != nil {
+				viper.Set("global.keychain-retries", test.retries)
+			}
+			if test.delay != nil {
+				viper.Set("global.keychain-retry-delay", test.delay)
+			}
+
+			retries, delay, err := GetKeychainRetry()
+			if test.expectError {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if retries != test.expectRetry || delay != test.expectDelay {
+				t.Errorf("wrong settings: got %d and %v, want %d and %v", retries, delay,
+					test.expectRetry, test.expectDelay)
+			}
+		})
+	}
+}
+
+func TestGetKeychainBackend(t *testing.T) {
+	defer viper.Reset()
+
+	for _, test := range []struct {
+		name        string
+		backend     string
+		expect      string
+		expectError bool
+	}{
+		{"Default", "", KeychainBackendAuto, false},
+		{"Auto", "auto", KeychainBackendAuto, false},
+		{"Secret Service", "secretservice", KeychainBackendSecretService, runtime.GOOS != "linux"},
+		{"Unknown", "kwallet", "", true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			viper.Reset()
+			if test.backend != "" {
+				viper.Set("global.keychain-backend", test.backend)
+			}
+
+			got, err := GetKeychainBackend()
+			if test.expectError {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.expect {
+				t.Errorf("wrong backend: got %s, want %s", got, test.expect)
+			}
+		})
+	}
+}
+
+func TestGetSTSEndpoint(t *testing.T) {
+	defer viper.Reset()
+
+	for _, test := range []struct {
+		name        string
+		global      string
+		app         string
+		override    string
+		expect      string
+		expectError bool
+	}{
+		{"Default", "", "", "", "", false},
+		{"Global", "https://sts-fips.us-east-1.amazonaws.com", "", "", "https://sts-fips.us-east-1.amazonaws.com", false},
+		{"App overrides global", "https://sts.amazonaws.com", "https://sts-fips.us-east-2.amazonaws.com/", "",
+			"https://sts-fips.us-east-2.amazonaws.com", false},
+		{"Override overrides app", "", "https://sts.amazonaws.com", "https://sts-fips.us-east-2.amazonaws.com",
+			"https://sts-fips.us-east-2.amazonaws.com", false},
+		{"HTTP", "", "http://sts.amazonaws.com", "", "", true},
+		{"HTTP override", "", "", "http://sts.amazonaws.com", "", true},
+		{"Path", "", "https://sts.amazonaws.com/sts", "", "", true},
+		{"No host", "", "sts.amazonaws.com", "", "", true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			viper.Reset()
+			viper.Set("global.sts-endpoint", test.global)
+			viper.Set("apps.app.sts-endpoint", test.app)
+
+			got, err := GetSTSEndpoint("app", test.override)
+			if test.expectError {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.expect {
+				t.Errorf("wrong endpoint: got %s, want %s", got, test.expect)
+			}
+		})
+	}
+}
+
+func TestGetExpiryBuffer(t *testing.T) {
+	defer viper.Reset()
+
+	for _, test := range []struct {
+		name        string
+		buffer      interface{}
+		expect      time.Duration
+		expectError bool
+	}{
+		{"Default", nil, DefaultExpiryBuffer, false},
+		{"Custom", "10m", 10 * time.Minute, false},
+		{"Disabled", "0s", 0, false},
+		{"Negative", "-1m", 0, true},
+		{"Not a duration", "soon", 0, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			viper.Reset()
+			if test.buffer != nil {
+				viper.Set("global.expiry-buffer", test.buffer)
+			}
+
+			got, err := GetExpiryBuffer()
+			if test.expectError {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.expect {
+				t.Errorf("wrong buffer: got %v, want %v", got, test.expect)
+			}
+		})
+	}
+}
+
+func TestGetMFAType(t *testing.T) {
+	defer viper.Reset()
+
+	for _, test := range []struct {
+		name        string
+		mfaType     string
+		expectError string
+	}{
+		{"Unset", "", ""},
+		{"Push", MFATypePush, ""},
+		{"TOTP", MFATypeTOTP, ""},
+		{"WebAuthn", "webauthn", "isn't supported"},
+		{"Unknown", "sms", "invalid mfa-type"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			viper.Reset()
+			viper.Set("apps.test-app.mfa-type", test.mfaType)
+
+			got, err := GetMFAType("test-app")
+			if test.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expectError) {
+					t.Fatalf("expected error containing %q, got %v", test.expectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.mfaType {
+				t.Errorf("wrong MFA type: got %q, want %q", got, test.mfaType)
+			}
+		})
+	}
+}
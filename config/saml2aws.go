@@ -0,0 +1,171 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-ini/ini"
+)
+
+// saml2awsDefaults are the values saml2aws writes for settings which aren't used. Settings with
+// these values aren't reported as unmapped.
+var saml2awsDefaults = map[string]string{
+	"mfa":                     "Auto",
+	"skip_verify":             "false",
+	"timeout":                 "0",
+	"aws_urn":                 "urn:amazon:webservices",
+	"saml_cache":              "false",
+	"disable_remember_device": "false",
+	"disable_sessions":        "false",
+	"http_attempts_count":     "0",
+	"http_retry_delay":        "0",
+}
+
+// SAML2AWSImport represents the providers and apps translated from the accounts in a saml2aws
+// config file. Settings which couldn't be translated are described in Warnings.
+type SAML2AWSImport struct {
+	Providers map[string]map[string]interface{}
+	Apps      map[string]map[string]interface{}
+	Warnings  []string
+}
+
+// ParseSAML2AWS translates the accounts in the saml2aws config file at path to Clisso providers
+// and apps. Each account becomes an app named after the account which uses a provider named
+// after the first account with the same identity provider settings. Accounts of identity
+// providers other than Okta and OneLogin are skipped with a warning.
+func ParseSAML2AWS(path string) (*SAML2AWSImport, error) {
+	cfg, err := ini.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading saml2aws config: %v", err)
+	}
+
+	imp := SAML2AWSImport{
+		Providers: make(map[string]map[string]interface{}),
+		Apps:      make(map[string]map[string]interface{}),
+	}
+	for _, s := range cfg.Sections() {
+		if len(s.Keys()) == 0 {
+			continue
+		}
+		if err := imp.addAccount(s); err != nil {
+			imp.warnf(s.Name(), "skipped: %v", err)
+		}
+	}
+
+	return &imp, nil
+}
+
+func (imp *SAML2AWSImport) warnf(account, format string, v ...interface{}) {
+	imp.Warnings = append(imp.Warnings, fmt.Sprintf("account '%s': %s", account, fmt.Sprintf(format, v...)))
+}
+
+// addAccount translates the saml2aws account in section s.
+func (imp *SAML2AWSImport) addAccount(s *ini.Section) error {
+	name := s.Name()
+	values := make(map[string]string)
+	for _, k := range s.Keys() {
+		if v := strings.TrimSpace(k.String()); v != "" {
+			values[k.Name()] = v
+		}
+	}
+	// take returns the value of key and marks it as mapped.
+	take := func(key string) string {
+		v := values[key]
+		delete(values, key)
+		return v
+	}
+	delete(values, "name")
+
+	provider := make(map[string]interface{})
+	app := make(map[string]interface{})
+
+	rawURL := take("url")
+	switch idp := take("provider"); strings.ToLower(idp) {
+	case "okta":
+		u, err := ParseAppURL(rawURL)
+		if err != nil {
+			return err
+		}
+		provider["type"] = "okta"
+		provider["base-url"] = fmt.Sprintf("%s://%s", u.Scheme, u.Host)
+		app["url"] = rawURL
+	case "onelogin":
+		provider["type"] = "onelogin"
+		provider["region"] = "US"
+		if u, err := url.Parse(rawURL); err == nil && strings.HasPrefix(u.Host, "api.eu.") {
+			provider["region"] = "EU"
+		}
+		for _, k := range []string{"client_id", "client_secret", "subdomain"} {
+			if v := take(k); v != "" {
+				provider[strings.Replace(k, "_", "-", -1)] = v
+			}
+		}
+		appID := take("app_id")
+		if appID == "" {
+			return fmt.Errorf("app_id isn't set")
+		}
+		app["app-id"] = appID
+	case "":
+		return fmt.Errorf("provider isn't set")
+	default:
+		return fmt.Errorf("identity provider %s isn't supported", idp)
+	}
+
+	if v := take("username"); v != "" {
+		provider["username"] = v
+	}
+	if v := take("role_arn"); v != "" {
+		app["arn"] = v
+	}
+	if v := take("aws_session_duration"); v != "" {
+		d, err := strconv.Atoi(v)
+		if err != nil {
+			imp.warnf(name, "invalid aws_session_duration %q ignored", v)
+		} else if d != 0 {
+			app["duration"] = d
+		}
+	}
+	if v := take("credentials_file"); v != "" {
+		app["credentials-path"] = v
+	}
+	if v := take("aws_profile"); v != "" && v != name {
+		imp.warnf(name, "credentials are written to profile '%s' instead of '%s' (aws_profile); use "+
+			"'clisso get %s --credentials-section %s' to keep using the old profile", name, v, name, v)
+	}
+
+	for _, k := range sortedKeys(values) {
+		if saml2awsDefaults[k] == values[k] {
+			continue
+		}
+		imp.warnf(name, "%s = %s isn't supported by Clisso and was ignored", k, values[k])
+	}
+
+	app["provider"] = imp.addProvider(name, provider)
+	imp.Apps[name] = app
+
+	return nil
+}
+
+// addProvider adds the provider p named name unless an identical provider was added already, and
+// returns the name of the provider.
+func (imp *SAML2AWSImport) addProvider(name string, p map[string]interface{}) string {
+	for existing, q := range imp.Providers {
+		if fmt.Sprint(p) == fmt.Sprint(q) {
+			return existing
+		}
+	}
+	imp.Providers[name] = p
+	return name
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
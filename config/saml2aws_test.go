@@ -0,0 +1,114 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testSAML2AWSConfig = `[default]
+name                    = default
+app_id                  =
+url                     = https://example.okta.com/home/amazon_aws/0oa1/272
+username                = user@example.com
+provider                = Okta
+mfa                     = Auto
+skip_verify             = false
+timeout                 = 0
+aws_urn                 = urn:amazon:webservices
+aws_session_duration    = 7200
+aws_profile             = saml
+role_arn                = arn:aws:iam::123456789012:role/Dev
+region                  =
+
+[prod]
+name                    = prod
+url                     = https://example.okta.com/home/amazon_aws/0oa2/272
+username                = user@example.com
+provider                = Okta
+mfa                     = PUSH
+aws_profile             = prod
+
+[onelogin]
+name                    = onelogin
+app_id                  = 123456
+url                     = https://api.eu.onelogin.com
+username                = user@example.com
+provider                = OneLogin
+client_id               = id
+client_secret           = secret
+subdomain               = example
+
+[adfs]
+name                    = adfs
+url                     = https://adfs.example.com
+provider                = ADFS
+`
+
+func TestParseSAML2AWS(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "saml2aws")
+	if err := ioutil.WriteFile(path, []byte(testSAML2AWSConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	imp, err := ParseSAML2AWS(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectProviders := map[string]map[string]interface{}{
+		"default": {
+			"type":     "okta",
+			"base-url": "https://example.okta.com",
+			"username": "user@example.com",
+		},
+		"onelogin": {
+			"type":          "onelogin",
+			"region":        "EU",
+			"client-id":     "id",
+			"client-secret": "secret",
+			"subdomain":     "example",
+			"username":      "user@example.com",
+		},
+	}
+	if !reflect.DeepEqual(imp.Providers, expectProviders) {
+		t.Errorf("wrong providers: got %v, want %v", imp.Providers, expectProviders)
+	}
+
+	expectApps := map[string]map[string]interface{}{
+		"default": {
+			"provider": "default",
+			"url":      "https://example.okta.com/home/amazon_aws/0oa1/272",
+			"arn":      "arn:aws:iam::123456789012:role/Dev",
+			"duration": 7200,
+		},
+		// Accounts with the same identity provider settings share a provider.
+		"prod": {
+			"provider": "default",
+			"url":      "https://example.okta.com/home/amazon_aws/0oa2/272",
+		},
+		"onelogin": {
+			"provider": "onelogin",
+			"app-id":   "123456",
+		},
+	}
+	if !reflect.DeepEqual(imp.Apps, expectApps) {
+		t.Errorf("wrong apps: got %v, want %v", imp.Apps, expectApps)
+	}
+
+	warnings := strings.Join(imp.Warnings, "\n")
+	for _, want := range []string{
+		"account 'default': credentials are written to profile 'default' instead of 'saml'",
+		"account 'prod': mfa = PUSH isn't supported",
+		"account 'adfs': skipped: identity provider ADFS isn't supported",
+	} {
+		if !strings.Contains(warnings, want) {
+			t.Errorf("missing warning %q in:\n%s", want, warnings)
+		}
+	}
+	if len(imp.Warnings) != 3 {
+		t.Errorf("wrong number of warnings: got %d, want 3:\n%s", len(imp.Warnings), warnings)
+	}
+}
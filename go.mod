@@ -3,6 +3,7 @@ module github.com/allcloud-io/clisso
 go 1.12
 
 require (
+	filippo.io/age v1.0.0
 	github.com/PuerkitoBio/goquery v1.5.0
 	github.com/aws/aws-sdk-go v1.37.8
 	github.com/briandowns/spinner v1.12.0
@@ -18,7 +19,7 @@ require (
 	github.com/spf13/jwalterweatherman v1.1.0 // indirect
 	github.com/spf13/viper v1.7.1
 	github.com/zalando/go-keyring v0.1.1
-	golang.org/x/net v0.0.0-20201110031124-69a78807bb2b
-	golang.org/x/term v0.0.0-20201117132131-f5c789dd3221
+	golang.org/x/net v0.0.0-20210226172049-e18ecbb05110
+	golang.org/x/term v0.0.0-20210615171337-6886f2dfbf5b
 	gopkg.in/ini.v1 v1.62.0 // indirect
 )
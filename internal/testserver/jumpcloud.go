@@ -0,0 +1,162 @@
+package testserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+const (
+	jumpCloudXSRF      = "testxsrf"
+	jumpCloudSessionID = "testjumpcloudsession"
+	jumpCloudPushID    = "testpush"
+	jumpCloudAppPath   = "/saml2/aws"
+)
+
+// JumpCloud is a fake JumpCloud server which supports user console authentication with TOTP or
+// push MFA and launching an AWS app.
+type JumpCloud struct {
+	*httptest.Server
+
+	// Email and Password are the credentials the server accepts.
+	Email    string
+	Password string
+	// MFACode, if set, makes the server require TOTP verification using this code.
+	MFACode string
+	// Push makes the server require push verification. PushPendingPolls is the number of polls
+	// which are answered with a pending status before the push is accepted, or denied if
+	// PushDenied is set.
+	Push             bool
+	PushPendingPolls int
+	PushDenied       bool
+	// PushPollDelay is how long the server takes to answer a poll of the push status.
+	PushPollDelay time.Duration
+	// SAMLAssertion is the assertion returned when the app is launched. If it is empty, the app
+	// returns a page without an assertion.
+	SAMLAssertion string
+}
+
+// NewJumpCloud starts a fake JumpCloud server. The caller must call Close when done.
+func NewJumpCloud() *JumpCloud {
+	j := &JumpCloud{
+		Email:         "user@example.com",
+		Password:      "password",
+		SAMLAssertion: SAMLAssertion(RoleARN, ProviderARN),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/userconsole/xsrf", j.xsrf)
+	mux.HandleFunc("/userconsole/auth", j.auth)
+	mux.HandleFunc("/userconsole/auth/push", j.startPush)
+	mux.HandleFunc("/userconsole/auth/push/"+jumpCloudPushID, j.pushStatus)
+	mux.HandleFunc("/userconsole/auth/push/"+jumpCloudPushID+"/login", j.pushLogin)
+	mux.HandleFunc(jumpCloudAppPath, j.app)
+	j.Server = httptest.NewTLSServer(mux)
+
+	return j
+}
+
+// AppURL returns the SSO URL of the AWS app served by the server.
+func (j *JumpCloud) AppURL() string {
+	return j.URL + jumpCloudAppPath
+}
+
+func (j *JumpCloud) xsrf(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]string{"xsrf": jumpCloudXSRF})
+}
+
+func (j *JumpCloud) auth(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Xsrftoken") != jumpCloudXSRF {
+		writeJumpCloudError(w, http.StatusForbidden, "Invalid XSRF token")
+		return
+	}
+
+	var req struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+		OTP      string `json:"otp"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJumpCloudError(w, http.StatusBadRequest, "Bad request")
+		return
+	}
+
+	if req.Email != j.Email || req.Password != j.Password {
+		writeJumpCloudError(w, http.StatusUnauthorized, "Authentication failed.")
+		return
+	}
+
+	var factors []map[string]string
+	if j.MFACode != "" {
+		factors = append(factors, map[string]string{"type": "totp", "status": "available"})
+	}
+	if j.Push {
+		factors = append(factors, map[string]string{"type": "jc_push", "status": "available"})
+	}
+	if len(factors) > 0 && (j.MFACode == "" || req.OTP != j.MFACode) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"message": "MFA required.", "factors": factors})
+		return
+	}
+
+	j.startSession(w)
+}
+
+func (j *JumpCloud) startPush(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !j.Push {
+		writeJumpCloudError(w, http.StatusBadRequest, "Bad request")
+		return
+	}
+	writeJSON(w, map[string]string{"id": jumpCloudPushID, "status": "pending"})
+}
+
+func (j *JumpCloud) pushStatus(w http.ResponseWriter, r *http.Request) {
+	time.Sleep(j.PushPollDelay)
+	status := "accepted"
+	switch {
+	case j.PushPendingPolls > 0:
+		j.PushPendingPolls--
+		status = "pending"
+	case j.PushDenied:
+		status = "denied"
+	}
+	writeJSON(w, map[string]string{"id": jumpCloudPushID, "status": status})
+}
+
+func (j *JumpCloud) pushLogin(w http.ResponseWriter, r *http.Request) {
+	if j.PushPendingPolls > 0 || j.PushDenied {
+		writeJumpCloudError(w, http.StatusUnauthorized, "Push not accepted")
+		return
+	}
+	j.startSession(w)
+}
+
+// startSession completes an authentication by issuing a session cookie.
+func (j *JumpCloud) startSession(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{Name: "jcsession", Value: jumpCloudSessionID, Path: "/"})
+	writeJSON(w, map[string]string{"redirectTo": "/userconsole"})
+}
+
+func (j *JumpCloud) app(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie("jcsession"); err != nil || c.Value != jumpCloudSessionID {
+		http.Error(w, "not signed in", http.StatusForbidden)
+		return
+	}
+
+	if j.SAMLAssertion == "" {
+		fmt.Fprint(w, `<html><body><div id="root"></div></body></html>`)
+		return
+	}
+	fmt.Fprintf(w, `<html><body><form method="POST" action="https://signin.aws.amazon.com/saml">
+<input type="hidden" name="SAMLResponse" value="%s"/>
+</form></body></html>`, j.SAMLAssertion)
+}
+
+func writeJumpCloudError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
@@ -0,0 +1,244 @@
+package testserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+const (
+	oktaStateToken   = "teststatetoken"
+	oktaSessionToken = "testsessiontoken"
+	oktaFactorID     = "testfactor"
+	oktaAppPath      = "/home/amazon_aws/test/272"
+	oktaSessionID    = "testsessionid"
+	oktaDeviceCode   = "testdevicecode"
+	oktaUserCode     = "ABCD-EFGH"
+
+	// IDToken is the ID token issued by the fake Okta server upon device authorization, which the
+	// fake STS server accepts as a web identity token.
+	IDToken = "testidtoken"
+)
+
+// Okta is a fake Okta server which supports primary authentication, TOTP verification, sessions,
+// launching an AWS app and device authorization.
+type Okta struct {
+	*httptest.Server
+
+	// Username and Password are the credentials the server accepts.
+	Username string
+	Password string
+	// MFACode, if set, makes the server require TOTP verification using this code.
+	MFACode string
+	// SAMLAssertion is the assertion returned when the app is launched.
+	SAMLAssertion string
+	// SessionEnded makes the server reject session cookies, as if the session was ended, until a
+	// new session is started.
+	SessionEnded bool
+	// PasswordExpired makes primary authentication report that the password has expired.
+	PasswordExpired bool
+
+	// ClientID is the client ID of the OIDC app which supports device authorization.
+	ClientID string
+	// DevicePendingPolls is the number of token requests which are answered with
+	// authorization_pending before a device authorization is approved.
+	DevicePendingPolls int
+	// DeviceDenied makes the server deny device authorizations.
+	DeviceDenied bool
+
+	// Authentications is the number of successful primary authentications.
+	Authentications int
+}
+
+// NewOkta starts a fake Okta server. The caller must call Close when done.
+func NewOkta() *Okta {
+	o := &Okta{
+		Username:      "user@example.com",
+		Password:      "password",
+		SAMLAssertion: SAMLAssertion(RoleARN, ProviderARN),
+		ClientID:      "testclientid",
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/authn", o.authn)
+	mux.HandleFunc(fmt.Sprintf("/api/v1/authn/factors/%s/verify", oktaFactorID), o.verify)
+	mux.HandleFunc("/login/sessionCookieRedirect", o.sessionCookieRedirect)
+	mux.HandleFunc("/api/v1/sessions/me", o.currentSession)
+	mux.HandleFunc(oktaAppPath, o.app)
+	mux.HandleFunc("/oauth2/v1/device/authorize", o.deviceAuthorize)
+	mux.HandleFunc("/oauth2/v1/token", o.token)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {})
+	o.Server = httptest.NewTLSServer(mux)
+
+	return o
+}
+
+// AppURL returns the URL of the AWS app served by the server.
+func (o *Okta) AppURL() string {
+	return o.URL + oktaAppPath
+}
+
+func (o *Okta) authn(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeOktaError(w, http.StatusBadRequest, "E0000003", "The request body was not well-formed.")
+		return
+	}
+
+	if req.Username != o.Username || req.Password != o.Password {
+		writeOktaError(w, http.StatusUnauthorized, "E0000004", "Authentication failed")
+		return
+	}
+	o.Authentications++
+
+	if o.PasswordExpired {
+		writeJSON(w, map[string]interface{}{
+			"stateToken": oktaStateToken,
+			"status":     "PASSWORD_EXPIRED",
+			"_links": map[string]interface{}{
+				"next": map[string]interface{}{
+					"name": "changePassword",
+					"href": o.URL + "/api/v1/authn/credentials/change_password",
+				},
+			},
+		})
+		return
+	}
+
+	if o.MFACode != "" {
+		writeJSON(w, map[string]interface{}{
+			"stateToken": oktaStateToken,
+			"status":     "MFA_REQUIRED",
+			"_embedded": map[string]interface{}{
+				"factors": []map[string]interface{}{
+					{"id": oktaFactorID, "factorType": "token:software:totp", "provider": "GOOGLE"},
+				},
+			},
+		})
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{"sessionToken": oktaSessionToken, "status": "SUCCESS"})
+}
+
+func (o *Okta) verify(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		StateToken string `json:"stateToken"`
+		PassCode   string `json:"passCode"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeOktaError(w, http.StatusBadRequest, "E0000003", "The request body was not well-formed.")
+		return
+	}
+
+	if req.StateToken != oktaStateToken || req.PassCode != o.MFACode {
+		writeOktaError(w, http.StatusForbidden, "E0000068", "Invalid Passcode/Answer")
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{"sessionToken": oktaSessionToken, "status": "SUCCESS"})
+}
+
+func (o *Okta) sessionCookieRedirect(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("token") != oktaSessionToken {
+		http.Error(w, "invalid session token", http.StatusForbidden)
+		return
+	}
+
+	o.SessionEnded = false
+	http.SetCookie(w, &http.Cookie{Name: "sid", Value: oktaSessionID, Path: "/"})
+	http.Redirect(w, r, r.URL.Query().Get("redirectUrl"), http.StatusFound)
+}
+
+func (o *Okta) currentSession(w http.ResponseWriter, r *http.Request) {
+	if !o.hasSession(r) {
+		writeOktaError(w, http.StatusNotFound, "E0000007", "Not found: Resource not found: me (Session)")
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"id":        oktaSessionID,
+		"status":    "ACTIVE",
+		"expiresAt": time.Now().Add(2 * time.Hour).UTC().Format(time.RFC3339),
+	})
+}
+
+// hasSession returns true if r carries the cookie of a valid session.
+func (o *Okta) hasSession(r *http.Request) bool {
+	c, err := r.Cookie("sid")
+	return err == nil && c.Value == oktaSessionID && !o.SessionEnded
+}
+
+func (o *Okta) app(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("sessionToken") != oktaSessionToken && !o.hasSession(r) {
+		http.Error(w, "invalid session token", http.StatusForbidden)
+		return
+	}
+
+	fmt.Fprintf(w, `<html><body><form id="appForm" method="POST" action="https://signin.aws.amazon.com/saml">
+<input name="SAMLResponse" type="hidden" value="%s"/>
+</form></body></html>`, o.SAMLAssertion)
+}
+
+func (o *Okta) deviceAuthorize(w http.ResponseWriter, r *http.Request) {
+	if r.FormValue("client_id") != o.ClientID {
+		writeOAuthError(w, "invalid_client", "Invalid value for 'client_id' parameter.")
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"device_code":               oktaDeviceCode,
+		"user_code":                 oktaUserCode,
+		"verification_uri":          o.URL + "/activate",
+		"verification_uri_complete": o.URL + "/activate?user_code=" + oktaUserCode,
+		"expires_in":                600,
+		"interval":                  1,
+	})
+}
+
+func (o *Okta) token(w http.ResponseWriter, r *http.Request) {
+	if r.FormValue("grant_type") != "urn:ietf:params:oauth:grant-type:device_code" ||
+		r.FormValue("device_code") != oktaDeviceCode {
+		writeOAuthError(w, "invalid_grant", "The device code is invalid.")
+		return
+	}
+
+	if o.DeviceDenied {
+		writeOAuthError(w, "access_denied", "The resource owner or authorization server denied the request.")
+		return
+	}
+	if o.DevicePendingPolls > 0 {
+		o.DevicePendingPolls--
+		writeOAuthError(w, "authorization_pending", "The device authorization is pending.")
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"access_token": "testaccesstoken",
+		"id_token":     IDToken,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+	})
+}
+
+func writeOAuthError(w http.ResponseWriter, code, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": code, "error_description": description})
+}
+
+func writeOktaError(w http.ResponseWriter, status int, code, summary string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"errorCode": code, "errorSummary": summary})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,155 @@
+package testserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+const (
+	oneLoginAccessToken = "testaccesstoken"
+	oneLoginStateToken  = "teststatetoken"
+	oneLoginDeviceID    = 123456
+)
+
+// OneLogin is a fake OneLogin server which supports generating access tokens, generating SAML
+// assertions and OTP verification. SAML assertions are served by both the v1 and v2 endpoints,
+// each using the response format of its API version.
+type OneLogin struct {
+	*httptest.Server
+
+	// ClientID and ClientSecret are the API credentials the server accepts.
+	ClientID     string
+	ClientSecret string
+	// Username and Password are the credentials the server accepts.
+	Username string
+	Password string
+	// MFACode, if set, makes the server require OTP verification using this code.
+	MFACode string
+	// SAMLAssertion is the assertion returned upon successful authentication.
+	SAMLAssertion string
+}
+
+// NewOneLogin starts a fake OneLogin server. The caller must call Close when done.
+func NewOneLogin() *OneLogin {
+	o := &OneLogin{
+		ClientID:      "test-client-id",
+		ClientSecret:  "test-client-secret",
+		Username:      "user@example.com",
+		Password:      "password",
+		SAMLAssertion: SAMLAssertion(RoleARN, ProviderARN),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/auth/oauth2/v2/token", o.token)
+	mux.HandleFunc("/api/2/saml_assertion", o.samlAssertion)
+	mux.HandleFunc("/api/2/saml_assertion/verify_factor", o.verifyFactor)
+	mux.HandleFunc("/api/1/saml_assertion", o.samlAssertion)
+	mux.HandleFunc("/api/1/saml_assertion/verify_factor", o.verifyFactor)
+	o.Server = httptest.NewServer(mux)
+
+	return o
+}
+
+func (o *OneLogin) token(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != fmt.Sprintf("client_id:%s, client_secret:%s", o.ClientID, o.ClientSecret) {
+		writeOneLoginError(w, http.StatusUnauthorized, "Invalid client credentials")
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"access_token": oneLoginAccessToken,
+		"token_type":   "bearer",
+		"expires_in":   36000,
+	})
+}
+
+func (o *OneLogin) samlAssertion(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "bearer:"+oneLoginAccessToken {
+		writeOneLoginError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req struct {
+		UsernameOrEmail string `json:"username_or_email"`
+		Password        string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeOneLoginError(w, http.StatusBadRequest, "Bad Request")
+		return
+	}
+
+	if req.UsernameOrEmail != o.Username || req.Password != o.Password {
+		writeOneLoginError(w, http.StatusUnauthorized, "Authentication Failed: Invalid user credentials")
+		return
+	}
+
+	if o.MFACode != "" {
+		mfa := map[string]interface{}{
+			"state_token": oneLoginStateToken,
+			"devices": []map[string]interface{}{
+				{"device_id": oneLoginDeviceID, "device_type": "Google Authenticator"},
+			},
+		}
+		if isV1(r) {
+			writeOneLoginV1(w, "MFA is required for this user", []interface{}{mfa})
+			return
+		}
+		mfa["message"] = "MFA is required for this user"
+		writeJSON(w, mfa)
+		return
+	}
+
+	writeOneLoginSuccess(w, r, o.SAMLAssertion)
+}
+
+func (o *OneLogin) verifyFactor(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		StateToken string `json:"state_token"`
+		OtpToken   string `json:"otp_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeOneLoginError(w, http.StatusBadRequest, "Bad Request")
+		return
+	}
+
+	if req.StateToken != oneLoginStateToken || req.OtpToken != o.MFACode {
+		writeOneLoginError(w, http.StatusUnauthorized, "Failed authentication with this factor")
+		return
+	}
+
+	writeOneLoginSuccess(w, r, o.SAMLAssertion)
+}
+
+// isV1 returns true if r was sent to an endpoint of version 1 of the API.
+func isV1(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/1/")
+}
+
+func writeOneLoginSuccess(w http.ResponseWriter, r *http.Request, assertion string) {
+	if isV1(r) {
+		writeOneLoginV1(w, "Success", assertion)
+		return
+	}
+	writeJSON(w, map[string]interface{}{"message": "Success", "data": assertion})
+}
+
+func writeOneLoginV1(w http.ResponseWriter, message string, data interface{}) {
+	writeJSON(w, map[string]interface{}{
+		"status": map[string]interface{}{
+			"error":   false,
+			"code":    http.StatusOK,
+			"type":    "success",
+			"message": message,
+		},
+		"data": data,
+	})
+}
+
+func writeOneLoginError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"statusCode": status, "message": message})
+}
@@ -0,0 +1,169 @@
+package testserver
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+)
+
+// RolesAnywhere is a fake IAM Roles Anywhere server which supports creating sessions using
+// requests signed with an X.509 certificate. The signature of requests is verified using the
+// public key of the certificate in the request.
+type RolesAnywhere struct {
+	*httptest.Server
+
+	// Region is the region requests must be signed for.
+	Region string
+	// Expiration is the expiration time of issued credentials.
+	Expiration time.Time
+}
+
+// NewRolesAnywhere starts a fake Roles Anywhere server. The caller must call Close when done.
+func NewRolesAnywhere() *RolesAnywhere {
+	s := &RolesAnywhere{
+		Region:     "us-east-1",
+		Expiration: time.Now().Add(time.Hour).UTC().Truncate(time.Second),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sessions", s.createSession)
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+func (s *RolesAnywhere) createSession(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeRolesAnywhereError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := s.verify(r, body); err != nil {
+		writeRolesAnywhereError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	var req struct {
+		DurationSeconds int64  `json:"durationSeconds"`
+		ProfileARN      string `json:"profileArn"`
+		RoleARN         string `json:"roleArn"`
+		TrustAnchorARN  string `json:"trustAnchorArn"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeRolesAnywhereError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.ProfileARN == "" || req.RoleARN == "" || req.TrustAnchorARN == "" {
+		writeRolesAnywhereError(w, http.StatusBadRequest, "Missing required parameter")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"credentialSet": []map[string]interface{}{
+			{
+				"credentials": map[string]interface{}{
+					"accessKeyId":     AccessKeyID,
+					"secretAccessKey": SecretAccessKey,
+					"sessionToken":    SessionToken,
+					"expiration":      s.Expiration.Format(time.RFC3339),
+				},
+				"roleArn": req.RoleARN,
+			},
+		},
+	})
+}
+
+// verify returns an error if r isn't signed using the certificate in its X-Amz-X509 header.
+func (s *RolesAnywhere) verify(r *http.Request, body []byte) error {
+	der, err := base64.StdEncoding.DecodeString(r.Header.Get("X-Amz-X509"))
+	if err != nil {
+		return fmt.Errorf("Invalid certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return fmt.Errorf("Invalid certificate: %v", err)
+	}
+
+	// Authorization: <algorithm> Credential=<serial>/<scope>, SignedHeaders=<headers>, Signature=<sig>
+	parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("Missing authorization")
+	}
+	algorithm := parts[0]
+	fields := make(map[string]string)
+	for _, f := range strings.Split(parts[1], ", ") {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) == 2 {
+			fields[kv[0]] = kv[1]
+		}
+	}
+
+	date := r.Header.Get("X-Amz-Date")
+	if len(date) < 8 {
+		return fmt.Errorf("Invalid date")
+	}
+	scope := fmt.Sprintf("%s/%s/rolesanywhere/aws4_request", date[:8], s.Region)
+	if fields["Credential"] != fmt.Sprintf("%s/%s", cert.SerialNumber, scope) {
+		return fmt.Errorf("Invalid credential %s", fields["Credential"])
+	}
+
+	var canonicalHeaders strings.Builder
+	for _, h := range strings.Split(fields["SignedHeaders"], ";") {
+		v := r.Header.Get(h)
+		if h == "host" {
+			v = r.Host
+		}
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", h, strings.TrimSpace(v))
+	}
+	bodyHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		r.URL.RawQuery,
+		canonicalHeaders.String(),
+		fields["SignedHeaders"],
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{algorithm, date, scope, hex.EncodeToString(requestHash[:])}, "\n")
+	digest := sha256.Sum256([]byte(stringToSign))
+
+	sig, err := hex.DecodeString(fields["Signature"])
+	if err != nil {
+		return fmt.Errorf("Invalid signature: %v", err)
+	}
+
+	var valid bool
+	switch k := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		valid = algorithm == "AWS4-X509-RSA-SHA256" &&
+			rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig) == nil
+	case *ecdsa.PublicKey:
+		valid = algorithm == "AWS4-X509-ECDSA-SHA256" && ecdsa.VerifyASN1(k, digest[:], sig)
+	}
+	if !valid {
+		return fmt.Errorf("Signature validation failed")
+	}
+
+	return nil
+}
+
+func writeRolesAnywhereError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
@@ -0,0 +1,60 @@
+// Package testserver provides fake identity provider and STS servers which allow testing the
+// complete flow of obtaining credentials without talking to real endpoints.
+package testserver
+
+import (
+	"encoding/base64"
+	"fmt"
+	"time"
+)
+
+const (
+	// RoleARN is the IAM role included in assertions returned by the fake identity providers.
+	RoleARN = "arn:aws:iam::123456789012:role/TestRole"
+	// ProviderARN is the SAML provider included in assertions returned by the fake identity
+	// providers.
+	ProviderARN = "arn:aws:iam::123456789012:saml-provider/TestProvider"
+)
+
+// SAMLAssertion returns a base64-encoded SAML response which contains a single AWS role made of
+// roleARN and providerARN.
+func SAMLAssertion(roleARN, providerARN string) string {
+	return SAMLAssertionWithSession(roleARN, providerARN, time.Time{})
+}
+
+// SAMLAssertionWithSession is like SAMLAssertion, but the response also contains an authentication
+// statement whose session expires at notOnOrAfter unless notOnOrAfter is zero.
+func SAMLAssertionWithSession(roleARN, providerARN string, notOnOrAfter time.Time) string {
+	authn := ""
+	if !notOnOrAfter.IsZero() {
+		authn = fmt.Sprintf(`
+        <saml:AuthnStatement SessionNotOnOrAfter="%s"/>`, notOnOrAfter.UTC().Format(time.RFC3339))
+	}
+
+	return samlResponse(roleARN, providerARN, authn)
+}
+
+// SAMLAssertionValidUntil is like SAMLAssertion, but STS rejects the response from notOnOrAfter
+// according to its conditions.
+func SAMLAssertionValidUntil(roleARN, providerARN string, notOnOrAfter time.Time) string {
+	conditions := fmt.Sprintf(`
+        <saml:Conditions NotOnOrAfter="%s"/>`, notOnOrAfter.UTC().Format(time.RFC3339))
+
+	return samlResponse(roleARN, providerARN, conditions)
+}
+
+// samlResponse returns a base64-encoded SAML response which contains a single AWS role made of
+// roleARN and providerARN. The elements in extra are added to its assertion.
+func samlResponse(roleARN, providerARN, extra string) string {
+	resp := fmt.Sprintf(`<samlp:Response xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol">
+    <saml:Assertion>%s
+        <saml:AttributeStatement>
+            <saml:Attribute Name="https://aws.amazon.com/SAML/Attributes/Role">
+                <saml:AttributeValue>%s,%s</saml:AttributeValue>
+            </saml:Attribute>
+        </saml:AttributeStatement>
+    </saml:Assertion>
+</samlp:Response>`, extra, roleARN, providerARN)
+
+	return base64.StdEncoding.EncodeToString([]byte(resp))
+}
@@ -0,0 +1,152 @@
+package testserver
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+)
+
+const (
+	// AccessKeyID is the access key ID of credentials issued by the fake STS server.
+	AccessKeyID = "ASIATESTACCESSKEY"
+	// SecretAccessKey is the secret access key of credentials issued by the fake STS server.
+	SecretAccessKey = "testsecretaccesskey"
+	// SessionToken is the session token of credentials issued by the fake STS server.
+	SessionToken = "testsessiontoken"
+)
+
+// CallerARN is the ARN of the identity returned by GetCallerIdentity of the fake STS server.
+const CallerARN = "arn:aws:sts::123456789012:assumed-role/TestRole/clisso"
+
+// AccountAlias is the account alias returned by ListAccountAliases of the fake STS server.
+const AccountAlias = "test-account"
+
+// STS is a fake STS server which supports AssumeRoleWithSAML, AssumeRoleWithWebIdentity and
+// GetCallerIdentity. GetCallerIdentity only accepts the credentials the server issues. The server
+// also answers the IAM action ListAccountAliases.
+type STS struct {
+	*httptest.Server
+
+	// Expired makes the server reject SAML assertions and credentials as expired.
+	Expired bool
+	// Expiration is the expiration time of issued credentials.
+	Expiration time.Time
+}
+
+// NewSTS starts a fake STS server. The caller must call Close when done.
+func NewSTS() *STS {
+	s := &STS{Expiration: time.Now().Add(time.Hour).UTC().Truncate(time.Second)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+
+	return s
+}
+
+func (s *STS) handle(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeSTSError(w, "InvalidParameterValue", err.Error())
+		return
+	}
+
+	action := r.FormValue("Action")
+	switch action {
+	case "AssumeRoleWithSAML":
+		if s.Expired {
+			writeSTSError(w, "ExpiredTokenException", "Token must be redeemed within 5 minutes of issuance")
+			return
+		}
+		if !hasRole(r.FormValue("SAMLAssertion"), r.FormValue("RoleArn"), r.FormValue("PrincipalArn")) {
+			writeSTSError(w, "InvalidIdentityToken", "Invalid SAML assertion")
+			return
+		}
+	case "GetCallerIdentity":
+		s.getCallerIdentity(w, r)
+		return
+	case "ListAccountAliases":
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprintf(w, `<ListAccountAliasesResponse xmlns="https://iam.amazonaws.com/doc/2010-05-08/">
+  <ListAccountAliasesResult>
+    <IsTruncated>false</IsTruncated>
+    <AccountAliases>
+      <member>%s</member>
+    </AccountAliases>
+  </ListAccountAliasesResult>
+  <ResponseMetadata>
+    <RequestId>test</RequestId>
+  </ResponseMetadata>
+</ListAccountAliasesResponse>`, AccountAlias)
+		return
+	case "AssumeRoleWithWebIdentity":
+		if r.FormValue("WebIdentityToken") != IDToken {
+			writeSTSError(w, "InvalidIdentityToken", "Couldn't retrieve verification key from your identity provider")
+			return
+		}
+	default:
+		writeSTSError(w, "InvalidAction", fmt.Sprintf("Could not find operation %s", action))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/xml")
+	fmt.Fprintf(w, `<%[1]sResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <%[1]sResult>
+    <Credentials>
+      <AccessKeyId>%[2]s</AccessKeyId>
+      <SecretAccessKey>%[3]s</SecretAccessKey>
+      <SessionToken>%[4]s</SessionToken>
+      <Expiration>%[5]s</Expiration>
+    </Credentials>
+  </%[1]sResult>
+  <ResponseMetadata>
+    <RequestId>test</RequestId>
+  </ResponseMetadata>
+</%[1]sResponse>`, action, AccessKeyID, SecretAccessKey, SessionToken, s.Expiration.Format(time.RFC3339))
+}
+
+func (s *STS) getCallerIdentity(w http.ResponseWriter, r *http.Request) {
+	if !strings.Contains(r.Header.Get("Authorization"), "Credential="+AccessKeyID+"/") ||
+		r.Header.Get("X-Amz-Security-Token") != SessionToken {
+		writeSTSError(w, "InvalidClientTokenId", "The security token included in the request is invalid.")
+		return
+	}
+	if s.Expired {
+		writeSTSError(w, "ExpiredToken", "The security token included in the request is expired")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/xml")
+	fmt.Fprintf(w, `<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <GetCallerIdentityResult>
+    <Arn>%s</Arn>
+    <UserId>AROATESTROLEID:clisso</UserId>
+    <Account>123456789012</Account>
+  </GetCallerIdentityResult>
+  <ResponseMetadata>
+    <RequestId>test</RequestId>
+  </ResponseMetadata>
+</GetCallerIdentityResponse>`, CallerARN)
+}
+
+func writeSTSError(w http.ResponseWriter, code, message string) {
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(http.StatusBadRequest)
+	fmt.Fprintf(w, `<ErrorResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <Error>
+    <Type>Sender</Type>
+    <Code>%s</Code>
+    <Message>%s</Message>
+  </Error>
+  <RequestId>test</RequestId>
+</ErrorResponse>`, code, message)
+}
+
+// hasRole reports whether the base64-encoded SAML response assertion contains the AWS role made
+// of roleARN and providerARN.
+func hasRole(assertion, roleARN, providerARN string) bool {
+	b, err := base64.StdEncoding.DecodeString(assertion)
+	if err != nil {
+		return false
+	}
+	return strings.Contains(string(b), fmt.Sprintf("<saml:AttributeValue>%s,%s</saml:AttributeValue>", roleARN, providerARN))
+}
@@ -0,0 +1,40 @@
+package testserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// IgnoreCABundle unsets AWS_CA_BUNDLE until the test ends. The AWS SDK replaces the trusted
+// certificates of the HTTP client it is given with the bundle, after which the client rejects the
+// TLS servers started by this package.
+func IgnoreCABundle(t *testing.T) {
+	bundle, hasBundle := os.LookupEnv("AWS_CA_BUNDLE")
+	os.Unsetenv("AWS_CA_BUNDLE")
+
+	t.Cleanup(func() {
+		if hasBundle {
+			os.Setenv("AWS_CA_BUNDLE", bundle)
+		}
+	})
+}
+
+// TrustTLS makes http.DefaultTransport, and the clients clisso builds from it, trust the
+// certificate of the TLS servers started by this package until the test ends. It is meant for
+// tests which can't inject the client of a server.
+func TrustTLS(t *testing.T) {
+	IgnoreCABundle(t)
+
+	// All servers started by httptest use the same certificate.
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	ts.Close()
+
+	orig := http.DefaultTransport
+	http.DefaultTransport = ts.Client().Transport
+
+	t.Cleanup(func() {
+		http.DefaultTransport = orig
+	})
+}
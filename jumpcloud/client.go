@@ -0,0 +1,249 @@
+// Package jumpcloud obtains temporary AWS credentials using JumpCloud SSO. Users authenticate
+// against the JumpCloud user console, optionally using TOTP or JumpCloud Protect push MFA, after
+// which the SSO URL of the AWS app returns a SAML assertion.
+package jumpcloud
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/publicsuffix"
+)
+
+// MFA factor types returned by the user console.
+const (
+	FactorTOTP = "totp"
+	FactorPush = "jc_push"
+)
+
+// Statuses of push MFA requests.
+const (
+	PushStatusPending  = "pending"
+	PushStatusAccepted = "accepted"
+)
+
+// ErrNoSAMLResponse is returned by LaunchApp if the page returned by the SSO URL of an app doesn't
+// contain a SAML response, e.g. because JumpCloud changed its login flow.
+var ErrNoSAMLResponse = errors.New("no SAMLResponse found in the response of the SSO URL")
+
+// Client represents a JumpCloud user console client. The client keeps the session cookies issued
+// upon authentication, which authorize launching apps.
+type Client struct {
+	http.Client
+	BaseURL string
+
+	// xsrf is the XSRF token which must accompany requests which change state.
+	xsrf string
+}
+
+// NewClient creates a new Client for the user console at baseURL which sends requests using hc
+// and returns a pointer to it. If hc is nil, http.DefaultClient is used.
+func NewClient(baseURL string, hc *http.Client) (*Client, error) {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+
+	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	if err != nil {
+		return nil, fmt.Errorf("creating cookie jar: %v", err)
+	}
+
+	// The jar is set on a copy of hc to avoid sharing cookies with other users of hc.
+	c := &Client{Client: *hc, BaseURL: baseURL}
+	c.Jar = jar
+
+	return c, nil
+}
+
+// AuthParams represents the parameters for Authenticate.
+type AuthParams struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	OTP      string `json:"otp,omitempty"`
+}
+
+// Factor represents an MFA factor available to the user.
+type Factor struct {
+	Type   string `json:"type"`
+	Status string `json:"status"`
+}
+
+// AuthResponse represents the result of a call to Authenticate. If Factors is non-empty, MFA is
+// required to complete the authentication.
+type AuthResponse struct {
+	Message string   `json:"message"`
+	Factors []Factor `json:"factors"`
+}
+
+// HasFactor returns true if the factor of type t is available to complete the authentication.
+func (r *AuthResponse) HasFactor(t string) bool {
+	for _, f := range r.Factors {
+		if f.Type == t && f.Status == "available" {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticate authenticates the user using the credentials in p. If the user must complete MFA,
+// the returned response lists the available factors. The authentication is then completed by
+// calling Authenticate again with the one-time password in p, or using the push functions.
+func (c *Client) Authenticate(p *AuthParams) (*AuthResponse, error) {
+	if err := c.fetchXSRF(); err != nil {
+		return nil, err
+	}
+
+	var resp AuthResponse
+	status, err := c.doJSON(http.MethodPost, "/userconsole/auth", p, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case status == http.StatusOK:
+		return &resp, nil
+	case status == http.StatusUnauthorized && len(resp.Factors) > 0 && p.OTP == "":
+		return &resp, nil
+	case resp.Message != "":
+		return nil, fmt.Errorf("%d %s: %s", status, http.StatusText(status), resp.Message)
+	default:
+		return nil, fmt.Errorf("%d %s", status, http.StatusText(status))
+	}
+}
+
+// PushResponse represents a push MFA request.
+type PushResponse struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+// StartPush sends a push notification to the JumpCloud Protect app of the user.
+func (c *Client) StartPush() (*PushResponse, error) {
+	var resp PushResponse
+	if err := c.expectOK(http.MethodPost, "/userconsole/auth/push", struct{}{}, &resp); err != nil {
+		return nil, fmt.Errorf("starting push MFA: %v", err)
+	}
+	return &resp, nil
+}
+
+// PushStatus returns the current state of the push MFA request with the given ID.
+func (c *Client) PushStatus(id string) (*PushResponse, error) {
+	var resp PushResponse
+	if err := c.expectOK(http.MethodGet, "/userconsole/auth/push/"+id, nil, &resp); err != nil {
+		return nil, fmt.Errorf("polling push MFA: %v", err)
+	}
+	return &resp, nil
+}
+
+// CompletePush completes the authentication once the push MFA request with the given ID was
+// accepted.
+func (c *Client) CompletePush(id string) error {
+	if err := c.expectOK(http.MethodPost, "/userconsole/auth/push/"+id+"/login", struct{}{}, nil); err != nil {
+		return fmt.Errorf("completing push MFA: %v", err)
+	}
+	return nil
+}
+
+// LaunchApp opens the SSO URL of an app using the session of the client and returns the SAML
+// assertion it offers. If the returned page doesn't contain an assertion, ErrNoSAMLResponse is
+// returned.
+func (c *Client) LaunchApp(url string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("constructing HTTP request: %v", err)
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("sending HTTP request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("HTTP error: %s", resp.Status)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("loading HTML document: %v", err)
+	}
+
+	assertion, _ := doc.Find("input[name=SAMLResponse]").First().Attr("value")
+	if assertion == "" {
+		return "", ErrNoSAMLResponse
+	}
+	return assertion, nil
+}
+
+// fetchXSRF obtains the XSRF token of the user console.
+func (c *Client) fetchXSRF() error {
+	var resp struct {
+		XSRF string `json:"xsrf"`
+	}
+	if err := c.expectOK(http.MethodGet, "/userconsole/xsrf", nil, &resp); err != nil {
+		return fmt.Errorf("getting XSRF token: %v", err)
+	}
+	c.xsrf = resp.XSRF
+	return nil
+}
+
+// expectOK is like doJSON, but returns an error if the response status isn't 200 OK.
+func (c *Client) expectOK(method, path string, body, v interface{}) error {
+	status, err := c.doJSON(method, path, body, v)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("%d %s", status, http.StatusText(status))
+	}
+	return nil
+}
+
+// doJSON sends a request with the JSON encoding of body, if not nil, to path and decodes the JSON
+// response into v, if not nil, regardless of the response status, which is returned.
+func (c *Client) doJSON(method, path string, body, v interface{}) (int, error) {
+	var b []byte
+	if body != nil {
+		var err error
+		if b, err = json.Marshal(body); err != nil {
+			return 0, fmt.Errorf("serializing request: %v", err)
+		}
+	}
+
+	req, err := http.NewRequest(method, c.BaseURL+path, bytes.NewReader(b))
+	if err != nil {
+		return 0, fmt.Errorf("constructing HTTP request: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Requested-With", "XMLHttpRequest")
+	if c.xsrf != "" {
+		req.Header.Set("X-Xsrftoken", c.xsrf)
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("sending HTTP request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, fmt.Errorf("reading HTTP response: %v", err)
+	}
+
+	if v != nil && len(bytes.TrimSpace(data)) > 0 && strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		if err := json.Unmarshal(data, v); err != nil {
+			return 0, fmt.Errorf("parsing HTTP response: %v", err)
+		}
+	}
+
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,253 @@
+package jumpcloud
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/allcloud-io/clisso/aws"
+	"github.com/allcloud-io/clisso/config"
+	"github.com/allcloud-io/clisso/keychain"
+	"github.com/allcloud-io/clisso/prompt"
+	"github.com/allcloud-io/clisso/saml"
+	"github.com/allcloud-io/clisso/spinner"
+	"github.com/fatih/color"
+	homedir "github.com/mitchellh/go-homedir"
+)
+
+// pollProgressEvery is the number of MFA push polling attempts between progress messages.
+const pollProgressEvery = 5
+
+var (
+	keyChain = keychain.DefaultKeychain{}
+)
+
+// Get gets temporary credentials for the given app. If the SAML assertion contains multiple roles,
+// filter narrows down the roles the user is asked to choose from. The given session tags, if any,
+// are attached to the resulting session. All HTTP requests are sent using hc, or a default client
+// if hc is nil. If the SSO URL of the app doesn't return a SAML assertion, the user is asked for a
+// file containing the SAMLResponse obtained using a browser instead.
+// The overrides o take precedence over the configuration of the provider and the app.
+func Get(app, provider string, filter saml.RoleFilter, duration int64, tags map[string]string, o config.Overrides, hc *http.Client) (*aws.Credentials, error) {
+	p, err := config.GetJumpCloudProvider(provider)
+	if err != nil {
+		return nil, fmt.Errorf("reading provider config: %v", err)
+	}
+	p.Override(o)
+
+	a, err := config.GetJumpCloudApp(app)
+	if err != nil {
+		return nil, fmt.Errorf("reading config for app %s: %v", app, err)
+	}
+
+	c, err := NewClient(p.BaseURL, hc)
+	if err != nil {
+		return nil, fmt.Errorf("initializing JumpCloud client: %v", err)
+	}
+
+	s := spinner.New()
+
+	if err := authenticate(c, p, provider, a.MFAType, s); err != nil {
+		return nil, err
+	}
+
+	s.Start()
+	assertion, err := c.LaunchApp(a.URL)
+	s.Stop()
+	if err == ErrNoSAMLResponse {
+		log.Println(color.YellowString("Could not find a SAML assertion for the app"))
+		assertion, err = manualSAMLResponse()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("launching app: %v", err)
+	}
+
+	arn, err := saml.Get(assertion, filter)
+	if err != nil {
+		return nil, err
+	}
+	if o.SAMLOutput != "" {
+		if err := aws.WriteSAMLAssertion(o.SAMLOutput, assertion); err != nil {
+			return nil, err
+		}
+		return &aws.Credentials{RoleARN: arn.Role, PrincipalARN: arn.Provider}, nil
+	}
+	duration, err = saml.RoleDuration(arn.Role, duration)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionName, err := config.GetSessionName(app, o.SessionName)
+	if err != nil {
+		return nil, err
+	}
+	stsEndpoint, err := config.GetSTSEndpoint(app, o.STSEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Start()
+	creds, err := aws.AssumeSAMLRole(arn.Provider, arn.Role, assertion, duration, tags, sessionName, stsEndpoint, hc)
+	s.Stop()
+	if err != nil && err.Error() == aws.ErrDurationExceeded {
+		log.Println(color.YellowString(aws.DurationExceededMessage))
+		s.Start()
+		creds, err = aws.AssumeSAMLRole(arn.Provider, arn.Role, assertion, 3600, tags, sessionName, stsEndpoint, hc)
+		s.Stop()
+	}
+
+	return creds, err
+}
+
+// authenticate authenticates the user against the user console of c, including MFA if required.
+// Push MFA is preferred over TOTP unless a one-time password was supplied or mfaType is set to TOTP,
+// and TOTP is used if a push isn't approved in time.
+func authenticate(c *Client, p *config.JumpCloudProviderConfig, provider, mfaType string, s spinner.SpinnerWrapper) error {
+	var err error
+	user := p.Username
+	if user == "" {
+		user, err = prompt.Username("JumpCloud email", "use --username to specify the email")
+		if err != nil {
+			return err
+		}
+	}
+
+	pass, err := keychain.Password(keyChain, provider, user, p.PasswordFile)
+	if err != nil {
+		return fmt.Errorf("getting password: %w", err)
+	}
+
+	params := &AuthParams{Email: user, Password: string(pass)}
+	s.Start()
+	resp, err := c.Authenticate(params)
+	s.Stop()
+	if err != nil {
+		return fmt.Errorf("authenticating: %v", err)
+	}
+	if len(resp.Factors) == 0 {
+		return nil
+	}
+
+	if mfaType != "" && !resp.HasFactor(jumpCloudFactorTypes[mfaType]) {
+		return fmt.Errorf("no enrolled MFA factor of type %s", mfaType)
+	}
+
+	usePush := mfaType == config.MFATypePush || mfaType == "" && p.MFACode == ""
+	if usePush && resp.HasFactor(FactorPush) {
+		ok, err := verifyPush(c, p, s)
+		if err != nil || ok {
+			return err
+		}
+		if !resp.HasFactor(FactorTOTP) {
+			return fmt.Errorf("MFA push was not approved within %s",
+				time.Duration(p.MFAPollAttempts)*p.MFAPollInterval)
+		}
+		fmt.Fprintln(os.Stderr, "MFA verification timed out - falling back to manual OTP input")
+	}
+
+	if !resp.HasFactor(FactorTOTP) {
+		types := make([]string, len(resp.Factors))
+		for i, f := range resp.Factors {
+			types[i] = f.Type
+		}
+		return fmt.Errorf("none of the available MFA factors (%s) is supported", strings.Join(types, ", "))
+	}
+
+	params.OTP = p.MFACode
+	if params.OTP == "" && p.TOTPSecretRef != "" {
+		params.OTP, err = keychain.TOTPCode(p.TOTPSecretRef)
+		if err != nil {
+			return fmt.Errorf("generating OTP using TOTP secret '%s': %v", p.TOTPSecretRef, err)
+		}
+	}
+	if params.OTP == "" {
+		params.OTP, err = prompt.MFACode("use --mfa-code to specify the OTP")
+		if err != nil {
+			return err
+		}
+	}
+
+	s.Start()
+	_, err = c.Authenticate(params)
+	s.Stop()
+	if err != nil {
+		return fmt.Errorf("verifying MFA: %v", err)
+	}
+
+	return nil
+}
+
+// jumpCloudFactorTypes maps the MFA types of apps to JumpCloud factor types.
+var jumpCloudFactorTypes = map[string]string{
+	config.MFATypePush: FactorPush,
+	config.MFATypeTOTP: FactorTOTP,
+}
+
+// verifyPush sends a push notification to the user and waits for its approval. It returns false if
+// the push wasn't approved in time.
+func verifyPush(c *Client, p *config.JumpCloudProviderConfig, s spinner.SpinnerWrapper) (bool, error) {
+	push, err := c.StartPush()
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Fprintln(os.Stderr, "Please approve the request in the JumpCloud Protect app")
+	s.Start()
+	defer s.Stop()
+	// Slow responses count towards the time the user has to approve the push.
+	deadline := time.Now().Add(time.Duration(p.MFAPollAttempts) * p.MFAPollInterval)
+	for attempt := 1; push.Status == PushStatusPending; attempt++ {
+		if attempt > p.MFAPollAttempts || !time.Now().Before(deadline) {
+			return false, nil
+		}
+
+		if attempt%pollProgressEvery == 0 {
+			s.Stop()
+			remaining := time.Until(deadline).Round(time.Second)
+			fmt.Fprintf(os.Stderr, "Waiting for MFA push approval (%s remaining)\n", remaining)
+			s.Start()
+		}
+
+		time.Sleep(p.MFAPollInterval)
+		if push, err = c.PushStatus(push.ID); err != nil {
+			return false, err
+		}
+	}
+
+	if push.Status != PushStatusAccepted {
+		return false, fmt.Errorf("MFA verification failed: %s", push.Status)
+	}
+
+	return true, c.CompletePush(push.ID)
+}
+
+// manualSAMLResponse asks the user for a file containing a SAMLResponse and returns its contents.
+// A file is used since terminals truncate pasted lines which are as long as SAML responses.
+func manualSAMLResponse() (string, error) {
+	path, err := prompt.Line(
+		"Sign in to the app using a browser, save the SAMLResponse form value sent to AWS to a file "+
+			"and enter the path of the file: ",
+		"run the command in a terminal to supply the SAMLResponse manually",
+	)
+	if err != nil {
+		return "", err
+	}
+
+	path, err = homedir.Expand(path)
+	if err != nil {
+		return "", err
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading SAMLResponse: %v", err)
+	}
+
+	// The value may have been copied URL-encoded from a form submission.
+	assertion := strings.TrimSpace(string(b))
+	assertion = strings.NewReplacer("%2B", "+", "%2F", "/", "%3D", "=").Replace(assertion)
+	return assertion, nil
+}
@@ -0,0 +1,131 @@
+package jumpcloud
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/allcloud-io/clisso/aws"
+	"github.com/allcloud-io/clisso/config"
+	"github.com/allcloud-io/clisso/internal/testserver"
+	"github.com/allcloud-io/clisso/saml"
+	"github.com/allcloud-io/clisso/spinner"
+	"github.com/spf13/viper"
+)
+
+func TestGet(t *testing.T) {
+	spinner.Disable()
+
+	for _, test := range []struct {
+		name         string
+		password     string
+		mfaCode      string
+		inputCode    string
+		push         bool
+		pendingPolls int
+		pushDenied   bool
+		slowPolls    bool
+		noAssertion  bool
+		mfaType      string
+		expectError  string
+	}{
+		{name: "Success", password: "password"},
+		{name: "Wrong password", password: "wrong", expectError: "Authentication failed"},
+		{name: "TOTP", password: "password", mfaCode: "123456", inputCode: "123456"},
+		{name: "Wrong TOTP", password: "password", mfaCode: "123456", inputCode: "654321",
+			expectError: "MFA required"},
+		{name: "Push", password: "password", push: true, pendingPolls: 2},
+		{name: "Push denied", password: "password", push: true, pushDenied: true,
+			expectError: "MFA verification failed: denied"},
+		{name: "Push not approved in time", password: "password", push: true, pendingPolls: 10,
+			expectError: "not approved within"},
+		{name: "Push polls too slow", password: "password", push: true, pendingPolls: 2, slowPolls: true,
+			expectError: "not approved within"},
+		{name: "TOTP preferred over push if supplied", password: "password", push: true,
+			pushDenied: true, mfaCode: "123456", inputCode: "123456"},
+		{name: "Push selected by MFA type", password: "password", push: true, pendingPolls: 1,
+			mfaCode: "123456", inputCode: "654321", mfaType: "push"},
+		{name: "TOTP selected by MFA type", password: "password", push: true, pushDenied: true,
+			mfaCode: "123456", mfaType: "totp", expectError: "--mfa-code"},
+		{name: "No factor of MFA type", password: "password", mfaCode: "123456", mfaType: "push",
+			expectError: "no enrolled MFA factor of type push"},
+		{name: "No assertion", password: "password", noAssertion: true,
+			expectError: "supply the SAMLResponse manually"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			idp := testserver.NewJumpCloud()
+			defer idp.Close()
+			idp.MFACode = test.mfaCode
+			idp.Push = test.push
+			idp.PushPendingPolls = test.pendingPolls
+			idp.PushDenied = test.pushDenied
+			if test.slowPolls {
+				// Each poll takes longer than all attempts are allowed to take together.
+				idp.PushPollDelay = 20 * time.Millisecond
+			}
+			if test.noAssertion {
+				idp.SAMLAssertion = ""
+			}
+
+			sts := testserver.NewSTS()
+			defer sts.Close()
+
+			setupTestConfig(t, idp, sts, test.password)
+			viper.Set("apps.test-app.mfa-type", test.mfaType)
+
+			creds, err := Get("test-app", "test-provider", saml.RoleFilter{}, 3600, nil, config.Overrides{MFACode: test.inputCode}, idp.Client())
+			if test.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expectError) {
+					t.Fatalf("expected error containing %q, got %v", test.expectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if creds.AccessKeyID != testserver.AccessKeyID {
+				t.Errorf("wrong access key ID: got %q, want %q", creds.AccessKeyID, testserver.AccessKeyID)
+			}
+			if !creds.Expiration.Equal(sts.Expiration) {
+				t.Errorf("wrong expiration: got %v, want %v", creds.Expiration, sts.Expiration)
+			}
+		})
+	}
+}
+
+// setupTestConfig configures a JumpCloud provider and app backed by idp and points the aws package
+// at sts for the duration of a test.
+func setupTestConfig(t *testing.T, idp *testserver.JumpCloud, sts *testserver.STS, password string) {
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := ioutil.WriteFile(passwordFile, []byte(password+"\n"), 0600); err != nil {
+		t.Fatalf("writing password file: %v", err)
+	}
+
+	viper.Set("providers.test-provider.type", "jumpcloud")
+	viper.Set("providers.test-provider.base-url", idp.URL)
+	viper.Set("providers.test-provider.username", idp.Email)
+	viper.Set("providers.test-provider.password-file", passwordFile)
+	viper.Set("providers.test-provider.mfa-poll-interval", "1ms")
+	viper.Set("providers.test-provider.mfa-poll-attempts", 5)
+	viper.Set("apps.test-app.provider", "test-provider")
+	viper.Set("apps.test-app.url", idp.AppURL())
+
+	aws.STSEndpoint = sts.URL
+	testserver.IgnoreCABundle(t)
+	region, hasRegion := os.LookupEnv("AWS_REGION")
+	os.Setenv("AWS_REGION", "us-east-1")
+
+	t.Cleanup(func() {
+		viper.Reset()
+		aws.STSEndpoint = ""
+		if hasRegion {
+			os.Setenv("AWS_REGION", region)
+		} else {
+			os.Unsetenv("AWS_REGION")
+		}
+	})
+}
@@ -1,9 +1,22 @@
 package keychain
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
-	"syscall"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/allcloud-io/clisso/prompt"
+	"github.com/allcloud-io/clisso/redact"
+	"github.com/allcloud-io/clisso/totp"
+	"github.com/fatih/color"
 	keyring "github.com/zalando/go-keyring"
 	"golang.org/x/term"
 )
@@ -12,8 +25,125 @@ const (
 	// KeyChainName is the name of the keychain used to store
 	// passwords
 	KeyChainName = "clisso"
+
+	// CredentialsKeyChainName is the name of the keychain used to store
+	// temporary credentials
+	CredentialsKeyChainName = "clisso-credentials"
+
+	// SessionKeyChainName is the name of the keychain used to store
+	// identity provider sessions
+	SessionKeyChainName = "clisso-sessions"
+
+	// TOTPKeyChainName is the name of the keychain used to store
+	// TOTP secrets
+	TOTPKeyChainName = "clisso-totp"
+
+	// UsernameKeyChainName is the name of the keychain used to store
+	// the usernames stored passwords belong to
+	UsernameKeyChainName = "clisso-usernames"
 )
 
+// ErrNotFound is returned when the requested item doesn't exist in the keychain.
+var ErrNotFound = errors.New("not found in keychain")
+
+// ErrUnavailable is returned instead of accessing the keychain if no keychain is available.
+var ErrUnavailable = errors.New("no keychain available")
+
+// AutoDetect controls whether the keychain is only accessed if it is detected to be available. On
+// Linux, the Secret Service is then only used if a D-Bus session bus is found, since connecting to
+// the Secret Service otherwise tries to start a session bus and fails slowly with an obscure error
+// on headless systems.
+var AutoDetect = false
+
+// available returns ErrUnavailable if AutoDetect is set and the keychain isn't available.
+func available() error {
+	if !AutoDetect || runtime.GOOS != "linux" {
+		return nil
+	}
+	// These are the places the D-Bus library looks for a session bus before trying to start one.
+	if a := os.Getenv("DBUS_SESSION_BUS_ADDRESS"); a != "" && a != "autolaunch:" {
+		return nil
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		if _, err := os.Stat(filepath.Join(dir, "bus")); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: no D-Bus session bus found for the Secret Service; set "+
+		"global.keychain-backend to secretservice to start one", ErrUnavailable)
+}
+
+// mu serializes access to the keychain, since keychain backends aren't necessarily safe for
+// concurrent use, e.g. when several apps are refreshed at once.
+var mu sync.Mutex
+
+// Retries is how many times a keychain operation which failed with a transient error, e.g.
+// because the macOS keychain is locked and the user hasn't been prompted to unlock it yet, is
+// retried. RetryDelay is the time waited before each retry. They are bounded by
+// global.keychain-retries and global.keychain-retry-delay, so that a keychain which stays locked
+// doesn't make clisso hang.
+var (
+	Retries    = 2
+	RetryDelay = 200 * time.Millisecond
+)
+
+// retry calls f until it succeeds, fails with an error which can't be transient or has been
+// retried Retries times, and returns the last error. The keychain isn't locked while waiting.
+func retry(f func() error) error {
+	err := f()
+	for i := 0; i < Retries && err != nil; i++ {
+		if err == keyring.ErrNotFound || err == keyring.ErrUnsupportedPlatform {
+			break
+		}
+		time.Sleep(RetryDelay)
+		err = f()
+	}
+	return err
+}
+
+func keyringGet(service, user string) (secret string, err error) {
+	if err := available(); err != nil {
+		return "", err
+	}
+	err = retry(func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		secret, err = keyring.Get(service, user)
+		return err
+	})
+	return secret, err
+}
+
+// maxSecretSize is the maximum size of secrets in bytes which the keychain can store, or 0 if
+// the size isn't limited.
+var maxSecretSize = 0
+
+func keyringSet(service, user, password string) error {
+	if err := available(); err != nil {
+		return err
+	}
+	if maxSecretSize > 0 && len(password) > maxSecretSize {
+		return fmt.Errorf("the secret is %d bytes long, but the keychain stores at most %d bytes",
+			len(password), maxSecretSize)
+	}
+	return retry(func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		return keyring.Set(service, user, password)
+	})
+}
+
+func keyringDelete(service, user string) error {
+	if err := available(); err != nil {
+		return err
+	}
+	return retry(func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		return keyring.Delete(service, user)
+	})
+}
+
 // Keychain provides an interface to allow for the easy testing
 // of this package
 type Keychain interface {
@@ -31,30 +161,260 @@ func (DefaultKeychain) Set(provider string, password []byte) (err error) {
 	return set(provider, password)
 }
 
-// Get will, once given a valid provider, return the password associated
-// in order for logins to happen.
-// If any error occours while talking to the keychain provider, we silently swallow it
-// and just ask the user for the password instead. Error could be anything from access denied to
-// password not found.
+// Get returns the password stored for provider. Use Password to fall back to the other sources
+// of passwords if none is stored.
 func (DefaultKeychain) Get(provider string) (pw []byte, err error) {
 	pass, err := get(provider)
 	if err != nil {
-		// If we ever implement a logfile we might want to log what error occurred.
-		fmt.Printf("Please enter %s password: ", provider)
-		pass, err = term.ReadPassword(int(syscall.Stdin))
+		return nil, err
+	}
+	redact.Add(string(pass))
+	return pass, nil
+}
+
+// PasswordEnv is the environment variable the password is read from if no password file is given
+// and no password is stored in the keychain.
+const PasswordEnv = "CLISSO_PASSWORD"
+
+// Password returns the password of username at provider from the first of the following sources
+// which has one:
+//
+//  1. The password file at path, if path is set. A password file is given explicitly, so it takes
+//     precedence. If path is "-", the password is read from stdin, which mustn't be a terminal.
+//  2. The password stored in kc, unless the user declines to use the password of a different user
+//     (see CheckUsername).
+//  3. The PasswordEnv environment variable.
+//  4. A prompt, if stdin is a terminal.
+//
+// If stdin isn't a terminal and none of the sources has a password, an error which wraps
+// prompt.ErrNonInteractive and lists the options for supplying the password is returned.
+func Password(kc Keychain, provider, username, path string) ([]byte, error) {
+	if path != "" {
+		pass, err := ReadPasswordFile(path)
 		if err != nil {
-			return nil, fmt.Errorf("couldn't read password from terminal: %w", err)
+			return nil, fmt.Errorf("reading password file: %v", err)
 		}
+		return pass, nil
+	}
+
+	if err := CheckUsername(provider, username); err != nil {
+		return nil, err
+	}
+	pass, kcErr := kc.Get(provider)
+	if kcErr == nil {
+		return pass, nil
+	}
+
+	if env := os.Getenv(PasswordEnv); env != "" {
+		redact.Add(env)
+		return []byte(env), nil
+	}
+
+	hint := fmt.Sprintf("use --password-file (or '--password-file -' to read the password from "+
+		"stdin), set $%s or store the password using 'clisso providers passwd %s'", PasswordEnv, provider)
+	if kcErr != keyring.ErrNotFound {
+		hint += fmt.Sprintf(" (reading the keychain failed: %v)", kcErr)
 	}
+	pass, err := prompt.Password(provider, hint)
+	if err != nil {
+		return nil, err
+	}
+	redact.Add(string(pass))
 	return pass, nil
 }
 
 func set(provider string, password []byte) (err error) {
-	return keyring.Set(KeyChainName, provider, string(password))
+	return keyringSet(KeyChainName, provider, string(password))
 }
 
 func get(provider string) (pw []byte, err error) {
-	pwString, err := keyring.Get(KeyChainName, provider)
+	pwString, err := keyringGet(KeyChainName, provider)
 	pw = []byte(pwString)
 	return
 }
+
+// SetUsername records that the password stored for provider belongs to username.
+func SetUsername(provider, username string) error {
+	return keyringSet(UsernameKeyChainName, provider, username)
+}
+
+// GetUsername returns the username the password stored for provider belongs to. If the password
+// was stored without a username, ErrNotFound is returned.
+func GetUsername(provider string) (string, error) {
+	username, err := keyringGet(UsernameKeyChainName, provider)
+	if err == keyring.ErrNotFound {
+		return "", ErrNotFound
+	}
+	return username, err
+}
+
+// CheckUsername warns if the password stored for provider belongs to a different user than
+// username, e.g. because the password of another account was saved, and asks whether to use it
+// anyway. An error is returned if the user declines. If stdin isn't a terminal, only the warning
+// is printed. Usernames are compared case-insensitively.
+func CheckUsername(provider, username string) error {
+	stored, err := GetUsername(provider)
+	if err != nil || stored == "" || strings.EqualFold(stored, username) {
+		return nil
+	}
+
+	log.Printf(color.YellowString("The password stored for provider '%s' belongs to '%s', not '%s'"),
+		provider, stored, username)
+	answer, err := prompt.Line("Use the stored password anyway? [y/N]: ", "")
+	if errors.Is(err, prompt.ErrNonInteractive) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(strings.TrimSpace(answer), "y") {
+		return fmt.Errorf("not using the password of '%s'; store the password of '%s' using "+
+			"'clisso providers passwd %s'", stored, username, provider)
+	}
+	return nil
+}
+
+// checkUser is the item looked up by Check. It isn't expected to exist.
+const checkUser = "selftest"
+
+// Check verifies that the keychain can be accessed by looking up an item, which isn't expected to
+// exist. Nothing is written to the keychain.
+func Check() error {
+	_, err := keyringGet(KeyChainName, checkUser)
+	if err == keyring.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// SetCredentials stores serialized temporary credentials for app in the keychain.
+func SetCredentials(app string, creds []byte) error {
+	return keyringSet(CredentialsKeyChainName, app, string(creds))
+}
+
+// GetCredentials returns the serialized temporary credentials stored for app in the keychain. If
+// no credentials are stored for app, ErrNotFound is returned.
+func GetCredentials(app string) ([]byte, error) {
+	creds, err := keyringGet(CredentialsKeyChainName, app)
+	if err == keyring.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []byte(creds), nil
+}
+
+// DeleteCredentials deletes the temporary credentials stored for app from the keychain. If no
+// credentials are stored for app, ErrNotFound is returned.
+func DeleteCredentials(app string) error {
+	err := keyringDelete(CredentialsKeyChainName, app)
+	if err == keyring.ErrNotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+// SetSession stores a serialized identity provider session for provider in the keychain.
+func SetSession(provider string, session []byte) error {
+	return keyringSet(SessionKeyChainName, provider, string(session))
+}
+
+// GetSession returns the serialized identity provider session stored for provider in the keychain.
+// If no session is stored for provider, ErrNotFound is returned.
+func GetSession(provider string) ([]byte, error) {
+	session, err := keyringGet(SessionKeyChainName, provider)
+	if err == keyring.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []byte(session), nil
+}
+
+// DeleteSession deletes the identity provider session stored for provider from the keychain. If no
+// session is stored for provider, ErrNotFound is returned.
+func DeleteSession(provider string) error {
+	err := keyringDelete(SessionKeyChainName, provider)
+	if err == keyring.ErrNotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+// SetTOTPSecret stores the TOTP secret named ref in the keychain.
+func SetTOTPSecret(ref string, secret []byte) error {
+	return keyringSet(TOTPKeyChainName, ref, string(secret))
+}
+
+// TOTPCode generates the current one-time password from the TOTP secret named ref in the
+// keychain. If no secret named ref is stored, ErrNotFound is returned. Neither the secret nor the
+// code are included in errors.
+func TOTPCode(ref string) (string, error) {
+	secret, err := keyringGet(TOTPKeyChainName, ref)
+	if err == keyring.ErrNotFound {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	redact.Add(secret)
+
+	return totp.Code(secret, time.Now())
+}
+
+// ReadPasswordFile reads a password from the file at path, or from stdin if path is "-", and
+// removes a trailing newline. Files which are readable by all users are refused since they expose
+// the password to other users.
+func ReadPasswordFile(path string) ([]byte, error) {
+	if path == "-" {
+		return readPasswordStdin()
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// File permissions aren't meaningful on Windows.
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0004 != 0 {
+		return nil, fmt.Errorf("password file %s is readable by all users - please restrict its "+
+			"permissions (e.g. chmod 600 %s)", path, path)
+	}
+
+	pass, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pass = trimNewline(pass)
+	redact.Add(string(pass))
+	return pass, nil
+}
+
+// readPasswordStdin reads a password piped to stdin and removes a trailing newline. Passwords
+// typed into a terminal would be echoed, so stdin mustn't be a terminal.
+func readPasswordStdin() ([]byte, error) {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, errors.New("stdin is a terminal - pipe the password to clisso or omit " +
+			"--password-file to be prompted for it")
+	}
+
+	pass, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, fmt.Errorf("reading stdin: %v", err)
+	}
+	pass = trimNewline(pass)
+	if len(pass) == 0 {
+		return nil, errors.New("no password on stdin")
+	}
+	redact.Add(string(pass))
+	return pass, nil
+}
+
+// trimNewline removes a trailing LF or CRLF from b.
+func trimNewline(b []byte) []byte {
+	b = bytes.TrimSuffix(b, []byte("\n"))
+	return bytes.TrimSuffix(b, []byte("\r"))
+}
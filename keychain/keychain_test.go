@@ -0,0 +1,322 @@
+package keychain
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/allcloud-io/clisso/prompt"
+	"github.com/allcloud-io/clisso/totp"
+	keyring "github.com/zalando/go-keyring"
+)
+
+func TestReadPasswordFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clisso")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, test := range []struct {
+		name        string
+		content     string
+		perm        os.FileMode
+		expect      string
+		expectError bool
+	}{
+		{"Trailing newline", "secret\n", 0600, "secret", false},
+		{"Trailing CRLF", "secret\r\n", 0600, "secret", false},
+		{"No trailing newline", "secret", 0600, "secret", false},
+		{"Only trailing newline removed", "  secret \n\n", 0600, "  secret \n", false},
+		{"World-readable", "secret\n", 0644, "", true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if test.expectError && runtime.GOOS == "windows" {
+				t.Skip("file permissions aren't enforced on Windows")
+			}
+
+			path := filepath.Join(dir, "password")
+			if err := ioutil.WriteFile(path, []byte(test.content), test.perm); err != nil {
+				t.Fatal(err)
+			}
+			// Make sure the permissions aren't affected by the umask.
+			if err := os.Chmod(path, test.perm); err != nil {
+				t.Fatal(err)
+			}
+
+			pass, err := ReadPasswordFile(path)
+			if test.expectError && err == nil {
+				t.Errorf("expected error")
+			}
+			if !test.expectError && err != nil {
+				t.Errorf("unexpected error %+v", err)
+			}
+			if string(pass) != test.expect {
+				t.Errorf("expected %q, received %q", test.expect, pass)
+			}
+		})
+	}
+
+	if _, err := ReadPasswordFile(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("expected error for missing file")
+	}
+}
+
+func TestTOTPCode(t *testing.T) {
+	keyring.MockInit()
+
+	if _, err := TOTPCode("okta"); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	if err := SetTOTPSecret("okta", []byte(secret)); err != nil {
+		t.Fatal(err)
+	}
+	code, err := TOTPCode("okta")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want, _ := totp.Code(secret, time.Now()); code != want {
+		t.Errorf("wrong code: got %s, want %s", code, want)
+	}
+}
+
+// answeringPrompter answers every line prompt with answer.
+type answeringPrompter struct {
+	prompt.Terminal
+	answer string
+}
+
+func (p answeringPrompter) Line(msg, hint string) (string, error) {
+	return p.answer, nil
+}
+
+func TestCheckUsername(t *testing.T) {
+	keyring.MockInit()
+
+	if err := CheckUsername("okta", "alice"); err != nil {
+		t.Fatalf("unexpected error without stored username: %v", err)
+	}
+	if err := SetUsername("okta", "Alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name        string
+		username    string
+		answer      string
+		expectError bool
+	}{
+		{"Same user", "alice@example.com", "", false},
+		{"Different user confirmed", "bob@example.com", "y", false},
+		{"Different user declined", "bob@example.com", "n", true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			prompt.SetPrompter(answeringPrompter{answer: test.answer})
+			defer prompt.SetPrompter(nil)
+
+			err := CheckUsername("okta", test.username)
+			if test.expectError && err == nil {
+				t.Errorf("expected error")
+			}
+			if !test.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	defer func(r int, d time.Duration) { Retries, RetryDelay = r, d }(Retries, RetryDelay)
+	Retries, RetryDelay = 2, time.Millisecond
+
+	transient := errors.New("keychain locked")
+	for _, test := range []struct {
+		name        string
+		errs        []error
+		expectCalls int
+		expectError error
+	}{
+		{"Success", nil, 1, nil},
+		{"Transient error", []error{transient}, 2, nil},
+		{"Persistent error", []error{transient, transient, transient, transient}, 3, transient},
+		{"Not found", []error{keyring.ErrNotFound}, 1, keyring.ErrNotFound},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			calls := 0
+			err := retry(func() error {
+				calls++
+				if calls <= len(test.errs) {
+					return test.errs[calls-1]
+				}
+				return nil
+			})
+			if err != test.expectError {
+				t.Errorf("wrong error: got %v, want %v", err, test.expectError)
+			}
+			if calls != test.expectCalls {
+				t.Errorf("wrong number of calls: got %d, want %d", calls, test.expectCalls)
+			}
+		})
+	}
+}
+
+func TestMaxSecretSize(t *testing.T) {
+	keyring.MockInit()
+	defer func(s int) { maxSecretSize = s }(maxSecretSize)
+	maxSecretSize = 8
+
+	if err := SetCredentials("small", []byte("12345678")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := SetCredentials("large", []byte("123456789")); err == nil {
+		t.Errorf("expected error")
+	}
+	if _, err := GetCredentials("large"); err != ErrNotFound {
+		t.Errorf("wrong error: got %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestAvailable(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("only the Secret Service is detected")
+	}
+	keyring.MockInit()
+	defer func() { AutoDetect = false }()
+	for _, name := range []string{"DBUS_SESSION_BUS_ADDRESS", "XDG_RUNTIME_DIR"} {
+		defer os.Setenv(name, os.Getenv(name))
+	}
+	dir, err := ioutil.TempDir("", "clisso")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "bus"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name       string
+		autoDetect bool
+		address    string
+		runtimeDir string
+		expectErr  bool
+	}{
+		{"Detection disabled", false, "", "", false},
+		{"No session bus", true, "", "", true},
+		{"Autolaunch", true, "autolaunch:", "", true},
+		{"Address", true, "unix:path=/run/user/1000/bus", "", false},
+		{"Runtime directory", true, "", dir, false},
+		{"Runtime directory without bus", true, "", os.TempDir(), true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			AutoDetect = test.autoDetect
+			os.Setenv("DBUS_SESSION_BUS_ADDRESS", test.address)
+			os.Setenv("XDG_RUNTIME_DIR", test.runtimeDir)
+
+			err := Check()
+			if test.expectErr && !errors.Is(err, ErrUnavailable) {
+				t.Errorf("wrong error: got %v, want %v", err, ErrUnavailable)
+			}
+			if !test.expectErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+// withStdin replaces stdin with a pipe holding input for the duration of a test.
+func withStdin(t *testing.T, input string) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.WriteString(input); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	stdin := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		r.Close()
+	})
+}
+
+func TestPassword(t *testing.T) {
+	defer os.Setenv(PasswordEnv, os.Getenv(PasswordEnv))
+	path := filepath.Join(t.TempDir(), "password")
+	if err := ioutil.WriteFile(path, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name        string
+		stored      string
+		env         string
+		path        string
+		stdin       string
+		expect      string
+		expectError bool
+	}{
+		{"Password file", "stored", "from-env", path, "", "from-file", false},
+		{"Stdin", "stored", "", "-", "from-stdin\n", "from-stdin", false},
+		{"Empty stdin", "", "", "-", "", "", true},
+		{"Keychain", "stored", "from-env", "", "", "stored", false},
+		{"Environment", "", "from-env", "", "", "from-env", false},
+		{"No TTY and no saved password", "", "", "", "", "", true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			keyring.MockInit()
+			if test.stored != "" {
+				if err := (DefaultKeychain{}).Set("okta", []byte(test.stored)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			os.Setenv(PasswordEnv, test.env)
+			withStdin(t, test.stdin)
+
+			pass, err := Password(DefaultKeychain{}, "okta", "alice", test.path)
+			if test.expectError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(pass) != test.expect {
+				t.Errorf("wrong password: got %q, want %q", pass, test.expect)
+			}
+		})
+	}
+}
+
+func TestPasswordNonInteractive(t *testing.T) {
+	defer os.Setenv(PasswordEnv, os.Getenv(PasswordEnv))
+	os.Unsetenv(PasswordEnv)
+	keyring.MockInit()
+	withStdin(t, "")
+
+	_, err := Password(DefaultKeychain{}, "okta", "alice", "")
+	if !errors.Is(err, prompt.ErrNonInteractive) {
+		t.Fatalf("expected prompt.ErrNonInteractive, got %v", err)
+	}
+	// The error must list every way of supplying the password non-interactively.
+	for _, option := range []string{"--password-file", "$" + PasswordEnv, "clisso providers passwd okta"} {
+		if !strings.Contains(err.Error(), option) {
+			t.Errorf("error doesn't mention %s: %v", option, err)
+		}
+	}
+	if strings.Contains(err.Error(), "reading the keychain failed") {
+		t.Errorf("a missing password was reported as a keychain failure: %v", err)
+	}
+}
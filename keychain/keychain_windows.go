@@ -0,0 +1,9 @@
+// +build windows
+
+package keychain
+
+// The Windows Credential Manager, which DefaultKeychain uses on Windows, rejects secrets larger
+// than CRED_MAX_CREDENTIAL_BLOB_SIZE with an unhelpful error.
+func init() {
+	maxSecretSize = 5 * 512
+}
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"io"
 	"log"
+	"os"
 	"runtime"
 
 	"github.com/mattn/go-colorable"
 
 	"github.com/allcloud-io/clisso/cmd"
+	"github.com/allcloud-io/clisso/redact"
 )
 
 // This variable is used by the "version" command and is set during build.
@@ -16,9 +19,11 @@ func main() {
 	log.SetFlags(log.Flags() &^ (log.Ldate | log.Ltime))
 
 	// Handle terminal colors on Windows machines.
+	var out io.Writer = os.Stderr
 	if runtime.GOOS == "windows" {
-		log.SetOutput(colorable.NewColorableStdout())
+		out = colorable.NewColorableStdout()
 	}
+	log.SetOutput(redact.NewWriter(out))
 
 	cmd.Execute(version)
 }
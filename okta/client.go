@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/cookiejar"
+	"net/url"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
@@ -17,6 +18,12 @@ import (
 const (
 	StatusSuccess     = "SUCCESS"
 	StatusMFARequired = "MFA_REQUIRED"
+	// StatusPasswordExpired is returned by primary authentication if the password of the user has
+	// expired and must be changed before the user can sign in.
+	StatusPasswordExpired = "PASSWORD_EXPIRED"
+
+	// sessionCookieName is the name of the cookie which holds the ID of an Okta session.
+	sessionCookieName = "sid"
 )
 
 // Client represents an Okta API client.
@@ -38,18 +45,23 @@ type GetSessionTokenResponse struct {
 	StateToken   string    `json:"stateToken"`
 	Status       string    `json:"status"`
 	Embedded     struct {
-		Factors []struct {
-			ID    string `json:"id"`
-			Links struct {
-				Verify struct {
-					Href string `json:"href"`
-				} `json:"verify"`
-			} `json:"_links"`
-			FactorType string `json:"factorType"`
-		} `json:"factors"`
+		Factors []Factor `json:"factors"`
 	} `json:"_embedded"`
 }
 
+// Factor represents an MFA factor enrolled by the user.
+type Factor struct {
+	ID    string `json:"id"`
+	Links struct {
+		Verify struct {
+			Href string `json:"href"`
+		} `json:"verify"`
+	} `json:"_links"`
+	FactorType string `json:"factorType"`
+	// Provider is the vendor of the factor, e.g. OKTA or GOOGLE.
+	Provider string `json:"provider"`
+}
+
 // GetSessionToken performs a login operation against the Okta API and returns a session token upon
 // successful login.
 //
@@ -99,6 +111,23 @@ type VerifyFactorResponse struct {
 	SessionToken string    `json:"sessionToken"`
 	Status       string    `json:"status"`
 	FactorResult string    `json:"factorResult,omitempty"`
+	Embedded     struct {
+		Factor struct {
+			Embedded struct {
+				// Challenge is set while a push verification with number matching is pending:
+				// https://developer.okta.com/docs/reference/api/authn/#response-example-waiting-for-3-number-verification-challenge-response
+				Challenge struct {
+					CorrectAnswer int `json:"correctAnswer"`
+				} `json:"challenge"`
+			} `json:"_embedded"`
+		} `json:"factor"`
+	} `json:"_embedded"`
+}
+
+// CorrectAnswer returns the number the user has to select in Okta Verify to approve a push
+// verification, or 0 if the verification doesn't involve a number challenge.
+func (r *VerifyFactorResponse) CorrectAnswer() int {
+	return r.Embedded.Factor.Embedded.Challenge.CorrectAnswer
 }
 
 // VerifyFactor performs MFA verification.
@@ -129,6 +158,7 @@ func (c *Client) VerifyFactor(p *VerifyFactorParams) (*VerifyFactorResponse, err
 
 // LaunchAppParams represents the parameters for LaunchApp.
 type LaunchAppParams struct {
+	// SessionToken authenticates the request. If empty, the session cookie of the client is used.
 	SessionToken string
 	URL          string
 }
@@ -136,7 +166,10 @@ type LaunchAppParams struct {
 // LaunchApp launches an Okta app and returns a SAML assertion.
 // TODO Error handling
 func (c *Client) LaunchApp(p *LaunchAppParams) (*string, error) {
-	url := fmt.Sprintf("%s?sessionToken=%s", p.URL, p.SessionToken)
+	url := p.URL
+	if p.SessionToken != "" {
+		url = fmt.Sprintf("%s?sessionToken=%s", p.URL, p.SessionToken)
+	}
 	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("constructing HTTP request: %v", err)
@@ -167,6 +200,113 @@ func (c *Client) LaunchApp(p *LaunchAppParams) (*string, error) {
 	return &saml, nil
 }
 
+// StartSession exchanges a session token for an Okta session cookie, which is stored in the
+// client's cookie jar and authenticates subsequent requests on behalf of the user:
+// https://developer.okta.com/docs/guides/session-cookie/main/#retrieve-a-session-cookie-by-visiting-a-session-redirect-link
+func (c *Client) StartSession(sessionToken string) error {
+	q := url.Values{"token": {sessionToken}, "redirectUrl": {c.BaseURL}}
+	req, err := http.NewRequest(http.MethodGet, c.BaseURL+"/login/sessionCookieRedirect?"+q.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("constructing HTTP request: %v", err)
+	}
+
+	if _, err := c.doRequest(req); err != nil {
+		return fmt.Errorf("doing HTTP request: %v", err)
+	}
+
+	return nil
+}
+
+// Session represents an Okta session.
+type Session struct {
+	ID        string    `json:"id"`
+	Status    string    `json:"status"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// GetCurrentSession returns the session identified by the session cookie of the client:
+// https://developer.okta.com/docs/reference/api/sessions/#get-current-session
+// An error is returned if the session doesn't exist or has expired.
+func (c *Client) GetCurrentSession() (*Session, error) {
+	req, err := http.NewRequest(http.MethodGet, c.BaseURL+"/api/v1/sessions/me", nil)
+	if err != nil {
+		return nil, fmt.Errorf("constructing HTTP request: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	data, err := c.doRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("doing HTTP request: %v", err)
+	}
+
+	var resp Session
+	err = json.Unmarshal([]byte(data), &resp)
+	if err != nil {
+		return nil, fmt.Errorf("parsing HTTP response: %v", err)
+	}
+
+	return &resp, nil
+}
+
+// SessionCookie returns the value of the session cookie of the client, or an empty string if the
+// client has no session cookie.
+func (c *Client) SessionCookie() string {
+	u, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return ""
+	}
+	for _, cookie := range c.Jar.Cookies(u) {
+		if cookie.Name == sessionCookieName {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+// SetSessionCookie sets the session cookie of the client, which authenticates subsequent requests
+// using an existing session.
+func (c *Client) SetSessionCookie(value string) error {
+	u, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return fmt.Errorf("parsing base URL: %v", err)
+	}
+	c.Jar.SetCookies(u, []*http.Cookie{{Name: sessionCookieName, Value: value, Path: "/"}})
+	return nil
+}
+
+// AppLink represents an app assigned to the user.
+type AppLink struct {
+	ID            string `json:"id"`
+	Label         string `json:"label"`
+	LinkURL       string `json:"linkUrl"`
+	AppName       string `json:"appName"`
+	AppInstanceID string `json:"appInstanceId"`
+}
+
+// GetAppLinks returns the apps assigned to the user of the current session:
+// https://developer.okta.com/docs/reference/api/users/#get-assigned-app-links
+// StartSession must be called before calling this function.
+func (c *Client) GetAppLinks() ([]AppLink, error) {
+	req, err := http.NewRequest(http.MethodGet, c.BaseURL+"/api/v1/users/me/appLinks", nil)
+	if err != nil {
+		return nil, fmt.Errorf("constructing HTTP request: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	data, err := c.doRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("doing HTTP request: %v", err)
+	}
+
+	var resp []AppLink
+	err = json.Unmarshal([]byte(data), &resp)
+	if err != nil {
+		return nil, fmt.Errorf("parsing HTTP response: %v", err)
+	}
+
+	return resp, nil
+}
+
 // doRequest gets a pointer to an HTTP request and an HTTP client, executes the request
 // using the client, handles any HTTP-related errors and returns any data as a string.
 func (c *Client) doRequest(r *http.Request) (string, error) {
@@ -186,8 +326,14 @@ func (c *Client) doRequest(r *http.Request) (string, error) {
 	return string(b), err
 }
 
-// NewClient creates a new Client and returns a pointer to it.
-func NewClient(url string) (*Client, error) {
+// NewClient creates a new Client which sends requests using hc and returns a pointer to it. If hc
+// is nil, http.DefaultClient is used. Requests rejected due to rate limiting are retried once the
+// rate limit has reset.
+func NewClient(url string, hc *http.Client) (*Client, error) {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+
 	// A cookie jar is required since the client needs to follow redirects with a session cookie.
 	options := cookiejar.Options{PublicSuffixList: publicsuffix.List}
 	jar, err := cookiejar.New(&options)
@@ -195,8 +341,14 @@ func NewClient(url string) (*Client, error) {
 		return nil, fmt.Errorf("creating cookie jar: %v", err)
 	}
 
-	c := &Client{BaseURL: url}
+	// The jar is set on a copy of hc to avoid sharing cookies with other users of hc.
+	c := &Client{Client: *hc, BaseURL: url}
 	c.Jar = jar
+	base := hc.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	c.Transport = &rateLimitTransport{base: base}
 
 	return c, nil
 }
@@ -20,6 +20,32 @@ func getTestServer(data string) *httptest.Server {
 
 var c = Client{}
 
+func TestNewClient(t *testing.T) {
+	hc := &http.Client{Timeout: 5 * time.Second}
+
+	c, err := NewClient("https://example.okta.com", hc)
+	if err != nil {
+		t.Fatalf("unexpected error %+v", err)
+	}
+	if c.Timeout != hc.Timeout {
+		t.Errorf("wrong timeout: got %v, want %v", c.Timeout, hc.Timeout)
+	}
+	if c.Jar == nil {
+		t.Error("cookie jar wasn't set")
+	}
+	if hc.Jar != nil {
+		t.Error("cookie jar was set on the given HTTP client")
+	}
+
+	c, err = NewClient("https://example.okta.com", nil)
+	if err != nil {
+		t.Fatalf("unexpected error %+v", err)
+	}
+	if c.Jar == nil {
+		t.Error("cookie jar wasn't set")
+	}
+}
+
 func TestGetSessionToken(t *testing.T) {
 	data := `{
 		"expiresAt": "2018-11-03T10:15:57.000Z",
@@ -117,3 +143,82 @@ func TestVerifyFactor(t *testing.T) {
 		t.Errorf("Wrong response, got: %v, want: %v", resp.ExpiresAt, exp)
 	}
 }
+
+func TestVerifyFactorNumberChallenge(t *testing.T) {
+	data := `{
+		"expiresAt": "2015-11-03T10:15:57.000Z",
+		"status": "MFA_CHALLENGE",
+		"factorResult": "WAITING",
+		"_embedded": {
+			"factor": {
+				"id": "fake_id",
+				"factorType": "push",
+				"_embedded": {
+					"challenge": {
+						"correctAnswer": 92
+					}
+				}
+			}
+		}
+	}`
+
+	ts := getTestServer(data)
+	defer ts.Close()
+
+	c.BaseURL = ts.URL
+
+	resp, err := c.VerifyFactor(&VerifyFactorParams{
+		FactorID:   "fake_id",
+		StateToken: "fake_state_token",
+	})
+	if err != nil {
+		t.Errorf("verifying factor: %v", err)
+	}
+
+	if resp.FactorResult != VerifyFactorStatusWaiting {
+		t.Errorf("Wrong response, got: %v, want: %v", resp.FactorResult, VerifyFactorStatusWaiting)
+	}
+	if resp.CorrectAnswer() != 92 {
+		t.Errorf("Wrong correct answer, got: %v, want: %v", resp.CorrectAnswer(), 92)
+	}
+}
+
+func TestGetAppLinks(t *testing.T) {
+	data := `[
+		{
+			"id": "fake_link_id",
+			"label": "AWS Production",
+			"linkUrl": "https://test.okta.com/home/amazon_aws/fake_instance_id/272",
+			"appName": "amazon_aws",
+			"appInstanceId": "fake_instance_id"
+		},
+		{
+			"id": "other_link_id",
+			"label": "Slack",
+			"linkUrl": "https://test.okta.com/home/slack/other_instance_id/19",
+			"appName": "slack",
+			"appInstanceId": "other_instance_id"
+		}
+	]`
+
+	ts := getTestServer(data)
+	defer ts.Close()
+
+	c.BaseURL = ts.URL
+
+	links, err := c.GetAppLinks()
+	if err != nil {
+		t.Errorf("getting app links: %v", err)
+	}
+
+	if len(links) != 2 {
+		t.Fatalf("Wrong number of app links, got: %v, want: %v", len(links), 2)
+	}
+	if links[0].AppName != AWSAppName {
+		t.Errorf("Wrong response, got: %v, want: %v", links[0].AppName, AWSAppName)
+	}
+	want := "https://test.okta.com/home/amazon_aws/fake_instance_id/272"
+	if links[0].LinkURL != want {
+		t.Errorf("Wrong response, got: %v, want: %v", links[0].LinkURL, want)
+	}
+}
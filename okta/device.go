@@ -0,0 +1,227 @@
+package okta
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/allcloud-io/clisso/aws"
+	"github.com/allcloud-io/clisso/config"
+	"github.com/allcloud-io/clisso/spinner"
+	"github.com/fatih/color"
+)
+
+const (
+	// deviceGrantType is the grant type of token requests of the device authorization grant.
+	deviceGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+	// Errors returned by the token endpoint while a device authorization is in progress:
+	// https://www.rfc-editor.org/rfc/rfc8628#section-3.5
+	deviceErrorPending  = "authorization_pending"
+	deviceErrorSlowDown = "slow_down"
+
+	// defaultDevicePollInterval is the polling interval used if the authorization server doesn't
+	// specify one.
+	defaultDevicePollInterval = 5
+)
+
+// devicePollUnit is the unit of the polling interval returned by the authorization server. It is
+// a variable to allow tests to poll faster.
+var devicePollUnit = time.Second
+
+// DeviceAuthorization represents the response of the device authorization endpoint.
+type DeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// TokenResponse represents a successful response of the token endpoint.
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	IDToken     string `json:"id_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// tokenError represents an error response of the token endpoint.
+type tokenError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *tokenError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+// oauthURL returns the URL of the given endpoint of the authorization server authServer. If
+// authServer is empty, the org authorization server is used.
+func (c *Client) oauthURL(authServer, endpoint string) string {
+	if authServer == "" {
+		return fmt.Sprintf("%s/oauth2/v1/%s", c.BaseURL, endpoint)
+	}
+	return fmt.Sprintf("%s/oauth2/%s/v1/%s", c.BaseURL, authServer, endpoint)
+}
+
+// AuthorizeDevice starts a device authorization for the OIDC app clientID at the authorization
+// server authServer. The user must visit the verification URI of the returned authorization and
+// enter the user code, after which PollDeviceToken returns a token.
+func (c *Client) AuthorizeDevice(clientID, authServer string) (*DeviceAuthorization, error) {
+	form := url.Values{"client_id": {clientID}, "scope": {"openid"}}
+
+	var resp DeviceAuthorization
+	if err := c.postForm(c.oauthURL(authServer, "device/authorize"), form, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// PollDeviceToken polls the token endpoint of the authorization server authServer until the user
+// has approved the given device authorization, and returns the issued tokens.
+func (c *Client) PollDeviceToken(clientID, authServer string, a *DeviceAuthorization) (*TokenResponse, error) {
+	form := url.Values{
+		"client_id":   {clientID},
+		"device_code": {a.DeviceCode},
+		"grant_type":  {deviceGrantType},
+	}
+
+	interval := a.Interval
+	if interval <= 0 {
+		interval = defaultDevicePollInterval
+	}
+	deadline := time.Now().Add(time.Duration(a.ExpiresIn) * devicePollUnit)
+
+	for {
+		var resp TokenResponse
+		err := c.postForm(c.oauthURL(authServer, "token"), form, &resp)
+		if err == nil {
+			return &resp, nil
+		}
+
+		var te *tokenError
+		if !errors.As(err, &te) {
+			return nil, err
+		}
+		switch te.Code {
+		case deviceErrorPending:
+		case deviceErrorSlowDown:
+			interval += 5
+		default:
+			return nil, err
+		}
+
+		if a.ExpiresIn > 0 && time.Now().After(deadline) {
+			return nil, errors.New("device authorization expired")
+		}
+		time.Sleep(time.Duration(interval) * devicePollUnit)
+	}
+}
+
+// postForm sends form to the OAuth endpoint at u and decodes the JSON response into v. Error
+// responses are returned as a *tokenError.
+func (c *Client) postForm(u string, form url.Values, v interface{}) error {
+	req, err := http.NewRequest(http.MethodPost, u, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("creating request: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return fmt.Errorf("sending HTTP request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading HTTP response: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var te tokenError
+		if json.Unmarshal(body, &te) == nil && te.Code != "" {
+			return &te
+		}
+		return errors.New(resp.Status)
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("parsing HTTP response: %v", err)
+	}
+
+	return nil
+}
+
+// getWithDeviceAuthorization gets temporary credentials for the given app by authenticating the
+// user using device authorization and exchanging the resulting ID token for credentials of the
+// role of the app.
+func getWithDeviceAuthorization(c *Client, p *config.OktaProviderConfig, app string, duration int64, tags map[string]string, o config.Overrides, hc *http.Client) (*aws.Credentials, error) {
+	a, err := config.GetOktaDeviceApp(app)
+	if err != nil {
+		return nil, fmt.Errorf("reading config for app %s: %v", app, err)
+	}
+
+	if len(tags) > 0 {
+		log.Println(color.YellowString("Session tags aren't supported with device authorization; ignoring them"))
+	}
+
+	s := spinner.New()
+
+	s.Start()
+	auth, err := c.AuthorizeDevice(p.ClientID, p.AuthServer)
+	s.Stop()
+	if err != nil {
+		return nil, fmt.Errorf("starting device authorization: %v", err)
+	}
+
+	log.Printf("To sign in, visit %s and enter the code:\n\n    %s\n",
+		color.CyanString(auth.VerificationURI), color.New(color.Bold).Sprint(auth.UserCode))
+	if auth.VerificationURIComplete != "" {
+		log.Printf("Alternatively, visit %s", color.CyanString(auth.VerificationURIComplete))
+	}
+
+	s.Start()
+	token, err := c.PollDeviceToken(p.ClientID, p.AuthServer, auth)
+	s.Stop()
+	if err != nil {
+		return nil, fmt.Errorf("waiting for device authorization: %v", err)
+	}
+	if token.IDToken == "" {
+		return nil, errors.New("no ID token returned by Okta")
+	}
+
+	sessionName, err := config.GetSessionName(app, o.SessionName)
+	if err != nil {
+		return nil, err
+	}
+	stsEndpoint, err := config.GetSTSEndpoint(app, o.STSEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Start()
+	creds, err := aws.AssumeRoleWithWebIdentity(token.IDToken, a.RoleARN, sessionName, duration, stsEndpoint, hc)
+	s.Stop()
+	if err != nil && err.Error() == aws.ErrDurationExceeded {
+		log.Println(color.YellowString(aws.DurationExceededMessage))
+		s.Start()
+		creds, err = aws.AssumeRoleWithWebIdentity(token.IDToken, a.RoleARN, sessionName, 3600, stsEndpoint, hc)
+		s.Stop()
+	}
+
+	return creds, err
+}
@@ -0,0 +1,72 @@
+package okta
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/allcloud-io/clisso/config"
+	"github.com/allcloud-io/clisso/internal/testserver"
+	"github.com/allcloud-io/clisso/saml"
+	"github.com/allcloud-io/clisso/spinner"
+	"github.com/spf13/viper"
+)
+
+func TestGetDeviceAuthorization(t *testing.T) {
+	spinner.Disable()
+	devicePollUnit = time.Millisecond
+	defer func() { devicePollUnit = time.Second }()
+
+	for _, test := range []struct {
+		name         string
+		clientID     string
+		pendingPolls int
+		denied       bool
+		expectError  string
+	}{
+		{name: "Approved immediately", clientID: "testclientid"},
+		{name: "Approved after polling", clientID: "testclientid", pendingPolls: 3},
+		{name: "Denied", clientID: "testclientid", denied: true, expectError: "access_denied"},
+		{name: "Wrong client ID", clientID: "wrong", expectError: "invalid_client"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			idp := testserver.NewOkta()
+			defer idp.Close()
+			idp.DevicePendingPolls = test.pendingPolls
+			idp.DeviceDenied = test.denied
+
+			sts := testserver.NewSTS()
+			defer sts.Close()
+
+			setupTestConfig(t, idp, sts, "")
+			viper.Set("providers.test-provider.auth-type", "device")
+			viper.Set("providers.test-provider.client-id", test.clientID)
+			viper.Set("apps.test-app.url", "")
+			viper.Set("apps.test-app.arn", testserver.RoleARN)
+
+			creds, err := Get("test-app", "test-provider", saml.RoleFilter{}, 3600, nil, config.Overrides{}, idp.Client())
+			if test.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expectError) {
+					t.Fatalf("expected error containing %q, got %v", test.expectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if creds.AccessKeyID != testserver.AccessKeyID {
+				t.Errorf("wrong access key ID: got %q, want %q", creds.AccessKeyID, testserver.AccessKeyID)
+			}
+			if creds.RoleARN != testserver.RoleARN {
+				t.Errorf("wrong role ARN: got %q, want %q", creds.RoleARN, testserver.RoleARN)
+			}
+			if idp.DevicePendingPolls != 0 {
+				t.Errorf("polling stopped early with %d pending polls left", idp.DevicePendingPolls)
+			}
+			if idp.Authentications != 0 {
+				t.Errorf("unexpected primary authentication")
+			}
+		})
+	}
+}
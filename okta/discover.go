@@ -0,0 +1,54 @@
+package okta
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/allcloud-io/clisso/config"
+	"github.com/allcloud-io/clisso/spinner"
+)
+
+// AWSAppName is the app name Okta uses for AWS SAML apps.
+const AWSAppName = "amazon_aws"
+
+// Discover authenticates against the given Okta provider and returns the AWS apps assigned to the
+// user. The LinkURL of each returned app can be used as the URL of a clisso app. All HTTP requests
+// are sent using hc, or a default client if hc is nil.
+func Discover(provider string, hc *http.Client) ([]AppLink, error) {
+	p, err := config.GetOktaProvider(provider)
+	if err != nil {
+		return nil, fmt.Errorf("reading provider config: %v", err)
+	}
+
+	c, err := NewClient(p.BaseURL, hc)
+	if err != nil {
+		return nil, fmt.Errorf("initializing Okta client: %v", err)
+	}
+
+	var s = spinner.New()
+
+	st, err := authenticate(c, p, provider, "", s)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Start()
+	defer s.Stop()
+	if err := c.StartSession(st); err != nil {
+		return nil, fmt.Errorf("starting Okta session: %v", err)
+	}
+
+	links, err := c.GetAppLinks()
+	if err != nil {
+		return nil, fmt.Errorf("getting assigned apps: %v", err)
+	}
+
+	var apps []AppLink
+	for _, l := range links {
+		if l.AppName == AWSAppName {
+			apps = append(apps, l)
+		}
+	}
+
+	return apps, nil
+}
@@ -3,11 +3,14 @@ package okta
 import (
 	"fmt"
 	"log"
+	"net/http"
+	"os"
 	"time"
 
 	"github.com/allcloud-io/clisso/aws"
 	"github.com/allcloud-io/clisso/config"
 	"github.com/allcloud-io/clisso/keychain"
+	"github.com/allcloud-io/clisso/prompt"
 	"github.com/allcloud-io/clisso/saml"
 	"github.com/allcloud-io/clisso/spinner"
 	"github.com/fatih/color"
@@ -19,19 +22,40 @@ const (
 
 	VerifyFactorStatusSuccess = "SUCCESS"
 	VerifyFactorStatusWaiting = "WAITING"
+
+	// pollProgressEvery is the number of MFA push polling attempts between progress messages.
+	pollProgressEvery = 5
 )
 
 var (
 	keyChain = keychain.DefaultKeychain{}
 )
 
-// Get gets temporary credentials for the given app.
-func Get(app, provider, pArn string, duration int64) (*aws.Credentials, error) {
+// Get gets temporary credentials for the given app. If the SAML assertion contains multiple roles,
+// filter narrows down the roles the user is asked to choose from. The given session tags, if any,
+// are attached to the resulting session. All HTTP requests are sent using hc, or a default client if hc is nil.
+// If the provider is configured to reuse sessions, a stored Okta session is used instead of
+// authenticating as long as it is valid. If the provider uses device authorization, the user
+// authenticates on another device instead and the role of the app is assumed using the resulting
+// ID token.
+// The overrides o take precedence over the configuration of the provider and the app.
+func Get(app, provider string, filter saml.RoleFilter, duration int64, tags map[string]string, o config.Overrides, hc *http.Client) (*aws.Credentials, error) {
 	// Get provider config
 	p, err := config.GetOktaProvider(provider)
 	if err != nil {
 		return nil, fmt.Errorf("reading provider config: %v", err)
 	}
+	p.Override(o)
+
+	// Initialize Okta client
+	c, err := NewClient(p.BaseURL, hc)
+	if err != nil {
+		return nil, fmt.Errorf("initializing Okta client: %v", err)
+	}
+
+	if p.AuthType == config.OktaAuthTypeDevice {
+		return getWithDeviceAuthorization(c, p, app, duration, tags, o, hc)
+	}
 
 	// Get app config
 	a, err := config.GetOktaApp(app)
@@ -39,37 +63,109 @@ func Get(app, provider, pArn string, duration int64) (*aws.Credentials, error) {
 		return nil, fmt.Errorf("reading config for app %s: %v", app, err)
 	}
 
-	// Initialize Okta client
-	c, err := NewClient(p.BaseURL)
+	// Initialize spinner
+	var s = spinner.New()
+
+	// Reuse a stored Okta session if requested, which avoids prompting for a password and MFA.
+	resumed := false
+	if p.ReuseSession {
+		s.Start()
+		resumed, err = resumeSession(c, provider)
+		s.Stop()
+		if err != nil {
+			// Not fatal - we can still authenticate.
+			log.Printf(color.YellowString("Could not reuse Okta session: %v"), err)
+		}
+	}
+
+	var st string
+	if !resumed {
+		st, err = authenticate(c, p, provider, a.MFAType, s)
+		if err != nil {
+			return nil, err
+		}
+
+		if p.ReuseSession {
+			// The session token can only be used once. Exchange it for a session which can be
+			// reused by later invocations.
+			s.Start()
+			err = c.StartSession(st)
+			s.Stop()
+			if err != nil {
+				return nil, fmt.Errorf("starting Okta session: %v", err)
+			}
+			st = ""
+		}
+	}
+
+	// Launch Okta app with session token, or with the session cookie if there is no token
+	s.Start()
+	samlAssertion, err := c.LaunchApp(&LaunchAppParams{SessionToken: st, URL: a.URL})
+	s.Stop()
 	if err != nil {
-		return nil, fmt.Errorf("initializing Okta client: %v", err)
+		return nil, fmt.Errorf("Error launching app: %v", err)
 	}
 
-	// Get user credentials
-	user := p.Username
-	if user == "" {
-		// Get credentials from the user
-		fmt.Print("Okta username: ")
-		fmt.Scanln(&user)
+	// Okta extends sessions while they are used, so the session is stored again after resuming it
+	// to keep its expiration up to date. The stored session doesn't outlive the session the
+	// assertion was issued for.
+	if p.ReuseSession {
+		notAfter, err := saml.SessionNotOnOrAfter(*samlAssertion)
+		if err != nil {
+			log.Printf(color.YellowString("Could not read session expiration from SAML assertion: %v"), err)
+		}
+		if err := saveSession(c, provider, notAfter); err != nil {
+			log.Printf(color.YellowString("Could not store Okta session: %v"), err)
+		}
 	}
 
-	pass, err := keyChain.Get(provider)
+	arn, err := saml.Get(*samlAssertion, filter)
 	if err != nil {
-		return nil, fmt.Errorf("getting key chain: %v", err)
+		return nil, err
+	}
+	if o.SAMLOutput != "" {
+		if err := aws.WriteSAMLAssertion(o.SAMLOutput, *samlAssertion); err != nil {
+			return nil, err
+		}
+		return &aws.Credentials{RoleARN: arn.Role, PrincipalARN: arn.Provider}, nil
+	}
+	duration, err = saml.RoleDuration(arn.Role, duration)
+	if err != nil {
+		return nil, err
 	}
 
-	// Initialize spinner
-	var s = spinner.New()
+	sessionName, err := config.GetSessionName(app, o.SessionName)
+	if err != nil {
+		return nil, err
+	}
+	stsEndpoint, err := config.GetSTSEndpoint(app, o.STSEndpoint)
+	if err != nil {
+		return nil, err
+	}
 
-	// Get session token
 	s.Start()
-	resp, err := c.GetSessionToken(&GetSessionTokenParams{
-		Username: user,
-		Password: string(pass),
-	})
+	creds, err := aws.AssumeSAMLRole(arn.Provider, arn.Role, *samlAssertion, duration, tags, sessionName, stsEndpoint, hc)
 	s.Stop()
+
 	if err != nil {
-		return nil, fmt.Errorf("getting session token: %v", err)
+		if err.Error() == aws.ErrDurationExceeded {
+			log.Println(color.YellowString(aws.DurationExceededMessage))
+			s.Start()
+			creds, err = aws.AssumeSAMLRole(arn.Provider, arn.Role, *samlAssertion, 3600, tags, sessionName, stsEndpoint, hc)
+			s.Stop()
+		}
+	}
+
+	return creds, err
+}
+
+// authenticate performs primary authentication and MFA verification (if required) against Okta
+// using the credentials of the user and returns a session token. If mfaType is set, the enrolled
+// factor of that type is used for MFA.
+func authenticate(c *Client, p *config.OktaProviderConfig, provider, mfaType string, s spinner.SpinnerWrapper) (string, error) {
+	resp, err := primaryAuth(c, p, provider, s)
+	if err != nil {
+		return "", err
 	}
 
 	var st string
@@ -79,7 +175,10 @@ func Get(app, provider, pArn string, duration int64) (*aws.Credentials, error) {
 	case StatusSuccess:
 		st = resp.SessionToken
 	case StatusMFARequired:
-		factor := resp.Embedded.Factors[0]
+		factor, err := selectFactor(resp.Embedded.Factors, mfaType)
+		if err != nil {
+			return "", err
+		}
 		stateToken := resp.StateToken
 
 		var vfResp *VerifyFactorResponse
@@ -90,28 +189,68 @@ func Get(app, provider, pArn string, duration int64) (*aws.Credentials, error) {
 			// https://developer.okta.com/docs/api/resources/authn/#verify-push-factor
 			// Keep polling authentication transactions with WAITING result until the challenge
 			// completes or expires.
-			fmt.Println("Please approve request on Okta Verify app")
+			fmt.Fprintln(os.Stderr, "Please approve request on Okta Verify app")
 			s.Start()
 			vfResp, err = c.VerifyFactor(&VerifyFactorParams{
 				FactorID:   factor.ID,
 				StateToken: stateToken,
 			})
 			if err != nil {
-				return nil, fmt.Errorf("verifying MFA: %v", err)
+				s.Stop()
+				return "", fmt.Errorf("verifying MFA: %v", err)
 			}
 
-			for vfResp.FactorResult == VerifyFactorStatusWaiting {
+			// With number matching enabled, Okta Verify asks the user to select the number shown
+			// here before the push can be approved.
+			shownAnswer := 0
+			// Slow responses count towards the time the user has to approve the push.
+			deadline := time.Now().Add(time.Duration(p.MFAPollAttempts) * p.MFAPollInterval)
+			for attempt := 1; vfResp.FactorResult == VerifyFactorStatusWaiting; attempt++ {
+				if attempt > p.MFAPollAttempts || !time.Now().Before(deadline) {
+					s.Stop()
+					return "", fmt.Errorf("MFA push was not approved within %s",
+						time.Duration(p.MFAPollAttempts)*p.MFAPollInterval)
+				}
+
+				if a := vfResp.CorrectAnswer(); a != 0 && a != shownAnswer {
+					s.Stop()
+					fmt.Fprintf(os.Stderr, "Please select %d in the Okta Verify app\n", a)
+					shownAnswer = a
+					s.Start()
+				}
+
+				if attempt%pollProgressEvery == 0 {
+					s.Stop()
+					remaining := time.Until(deadline).Round(time.Second)
+					fmt.Fprintf(os.Stderr, "Waiting for MFA push approval (%s remaining)\n", remaining)
+					s.Start()
+				}
+
+				time.Sleep(p.MFAPollInterval)
 				vfResp, err = c.VerifyFactor(&VerifyFactorParams{
 					FactorID:   factor.ID,
 					StateToken: stateToken,
 				})
-				time.Sleep(2 * time.Second)
+				if err != nil {
+					s.Stop()
+					return "", fmt.Errorf("verifying MFA: %v", err)
+				}
 			}
 			s.Stop()
 		case MFATypeTOTP:
-			fmt.Print("Please enter the OTP from your MFA device: ")
-			var otp string
-			fmt.Scanln(&otp)
+			otp := p.MFACode
+			if otp == "" && p.TOTPSecretRef != "" {
+				otp, err = keychain.TOTPCode(p.TOTPSecretRef)
+				if err != nil {
+					return "", fmt.Errorf("generating OTP using TOTP secret '%s': %v", p.TOTPSecretRef, err)
+				}
+			}
+			if otp == "" {
+				otp, err = prompt.MFACode("use --mfa-code to specify the OTP")
+				if err != nil {
+					return "", err
+				}
+			}
 
 			s.Start()
 			vfResp, err = c.VerifyFactor(&VerifyFactorParams{
@@ -121,48 +260,88 @@ func Get(app, provider, pArn string, duration int64) (*aws.Credentials, error) {
 			})
 			s.Stop()
 		default:
-			return nil, fmt.Errorf("unsupported MFA type '%s'", factor.FactorType)
+			return "", fmt.Errorf("unsupported MFA type '%s'", factor.FactorType)
 		}
 
 		if err != nil {
-			return nil, fmt.Errorf("verifying MFA: %v", err)
+			return "", fmt.Errorf("verifying MFA: %v", err)
 		}
 
 		// Handle failed MFA verification (verification rejected or timed out)
 		if vfResp.Status != VerifyFactorStatusSuccess {
-			return nil, fmt.Errorf("MFA verification failed")
+			if vfResp.FactorResult != "" {
+				return "", fmt.Errorf("MFA verification failed: %s", vfResp.FactorResult)
+			}
+			return "", fmt.Errorf("MFA verification failed")
 		}
 
 		st = vfResp.SessionToken
+	case StatusPasswordExpired:
+		// Changing the password requires entering it twice and possibly complying with a password
+		// policy, which is better left to the Okta sign-in page.
+		return "", fmt.Errorf("your Okta password has expired - sign in at %s using a browser to "+
+			"change it and then try again", c.BaseURL)
 	default:
-		return nil, fmt.Errorf("Invalid status %s", resp.Status)
+		return "", fmt.Errorf("Invalid status %s", resp.Status)
 	}
 
-	// Launch Okta app with session token
-	s.Start()
-	samlAssertion, err := c.LaunchApp(&LaunchAppParams{SessionToken: st, URL: a.URL})
-	s.Stop()
-	if err != nil {
-		return nil, fmt.Errorf("Error launching app: %v", err)
+	return st, nil
+}
+
+// oktaFactorTypes maps the MFA types of apps to Okta factor types.
+var oktaFactorTypes = map[string]string{
+	config.MFATypePush: MFATypePush,
+	config.MFATypeTOTP: MFATypeTOTP,
+}
+
+// selectFactor returns the first of factors with MFA type mfaType, or the first factor if mfaType
+// is empty.
+func selectFactor(factors []Factor, mfaType string) (Factor, error) {
+	if len(factors) == 0 {
+		return Factor{}, fmt.Errorf("no MFA factors returned by Okta")
+	}
+	if mfaType == "" {
+		return factors[0], nil
+	}
+
+	for _, f := range factors {
+		if f.FactorType == oktaFactorTypes[mfaType] {
+			return f, nil
+		}
+	}
+	return Factor{}, fmt.Errorf("no enrolled MFA factor of type %s", mfaType)
+}
+
+// primaryAuth performs primary authentication against Okta using the credentials of the user. The
+// returned response contains either a session token or the factors available for MFA.
+func primaryAuth(c *Client, p *config.OktaProviderConfig, provider string, s spinner.SpinnerWrapper) (*GetSessionTokenResponse, error) {
+	// Get user credentials
+	var err error
+	user := p.Username
+	if user == "" {
+		// Get credentials from the user
+		user, err = prompt.Username("Okta username", "use --username to specify the username")
+		if err != nil {
+			return nil, err
+		}
 	}
+	user = config.AddUsernameSuffix(user, p.UsernameSuffix)
 
-	arn, err := saml.Get(*samlAssertion, pArn)
+	pass, err := keychain.Password(keyChain, provider, user, p.PasswordFile)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("getting password: %w", err)
 	}
 
+	// Get session token
 	s.Start()
-	creds, err := aws.AssumeSAMLRole(arn.Provider, arn.Role, *samlAssertion, duration)
+	resp, err := c.GetSessionToken(&GetSessionTokenParams{
+		Username: user,
+		Password: string(pass),
+	})
 	s.Stop()
-
 	if err != nil {
-		if err.Error() == aws.ErrDurationExceeded {
-			log.Println(color.YellowString(aws.DurationExceededMessage))
-			s.Start()
-			creds, err = aws.AssumeSAMLRole(arn.Provider, arn.Role, *samlAssertion, 3600)
-			s.Stop()
-		}
+		return nil, fmt.Errorf("getting session token: %v", err)
 	}
 
-	return creds, err
+	return resp, nil
 }
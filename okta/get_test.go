@@ -0,0 +1,259 @@
+package okta
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/allcloud-io/clisso/aws"
+	"github.com/allcloud-io/clisso/config"
+	"github.com/allcloud-io/clisso/internal/testserver"
+	"github.com/allcloud-io/clisso/keychain"
+	"github.com/allcloud-io/clisso/saml"
+	"github.com/allcloud-io/clisso/spinner"
+	"github.com/allcloud-io/clisso/totp"
+	"github.com/spf13/viper"
+	"github.com/zalando/go-keyring"
+)
+
+func TestGet(t *testing.T) {
+	spinner.Disable()
+
+	for _, test := range []struct {
+		name        string
+		password    string
+		mfaCode     string
+		inputCode   string
+		expired     bool
+		pwExpired   bool
+		mfaType     string
+		expectError string
+	}{
+		{name: "Success", password: "password"},
+		{name: "Wrong password", password: "wrong", expectError: "401 Unauthorized"},
+		{name: "MFA required", password: "password", mfaCode: "123456", inputCode: "123456"},
+		{name: "Wrong MFA code", password: "password", mfaCode: "123456", inputCode: "654321",
+			expectError: "403 Forbidden"},
+		{name: "MFA type", password: "password", mfaCode: "123456", inputCode: "123456",
+			mfaType: "totp"},
+		{name: "No factor of MFA type", password: "password", mfaCode: "123456", mfaType: "push",
+			expectError: "no enrolled MFA factor of type push"},
+		{name: "Expired assertion", password: "password", expired: true,
+			expectError: "ExpiredTokenException"},
+		{name: "Expired password", password: "password", pwExpired: true,
+			expectError: "your Okta password has expired"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			idp := testserver.NewOkta()
+			defer idp.Close()
+			idp.MFACode = test.mfaCode
+			idp.PasswordExpired = test.pwExpired
+
+			sts := testserver.NewSTS()
+			defer sts.Close()
+			sts.Expired = test.expired
+
+			setupTestConfig(t, idp, sts, test.password)
+			viper.Set("apps.test-app.mfa-type", test.mfaType)
+
+			creds, err := Get("test-app", "test-provider", saml.RoleFilter{}, 3600, nil, config.Overrides{MFACode: test.inputCode}, idp.Client())
+			if test.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expectError) {
+					t.Fatalf("expected error containing %q, got %v", test.expectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if creds.AccessKeyID != testserver.AccessKeyID {
+				t.Errorf("wrong access key ID: got %q, want %q", creds.AccessKeyID, testserver.AccessKeyID)
+			}
+			if creds.SessionToken != testserver.SessionToken {
+				t.Errorf("wrong session token: got %q, want %q", creds.SessionToken, testserver.SessionToken)
+			}
+			if !creds.Expiration.Equal(sts.Expiration) {
+				t.Errorf("wrong expiration: got %v, want %v", creds.Expiration, sts.Expiration)
+			}
+		})
+	}
+}
+
+func TestSelectFactor(t *testing.T) {
+	factors := []Factor{
+		{ID: "totp", FactorType: MFATypeTOTP},
+		{ID: "push", FactorType: MFATypePush},
+	}
+
+	for _, test := range []struct {
+		name        string
+		factors     []Factor
+		mfaType     string
+		expectID    string
+		expectError bool
+	}{
+		{name: "First factor by default", factors: factors, expectID: "totp"},
+		{name: "Push", factors: factors, mfaType: "push", expectID: "push"},
+		{name: "TOTP", factors: factors, mfaType: "totp", expectID: "totp"},
+		{name: "Not enrolled", factors: factors[:1], mfaType: "push", expectError: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := selectFactor(test.factors, test.mfaType)
+			if test.expectError {
+				if err == nil {
+					t.Fatalf("expected error, got factor %s", f.ID)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if f.ID != test.expectID {
+				t.Errorf("wrong factor: got %s, want %s", f.ID, test.expectID)
+			}
+		})
+	}
+}
+
+func TestGetReuseSession(t *testing.T) {
+	spinner.Disable()
+	keyring.MockInit()
+
+	idp := testserver.NewOkta()
+	defer idp.Close()
+	idp.MFACode = "123456"
+
+	sts := testserver.NewSTS()
+	defer sts.Close()
+
+	setupTestConfig(t, idp, sts, "password")
+	viper.Set("providers.test-provider.reuse-session", true)
+
+	for _, step := range []struct {
+		name                  string
+		endSession            bool
+		expectAuthentications int
+	}{
+		{name: "No stored session", expectAuthentications: 1},
+		{name: "Stored session", expectAuthentications: 1},
+		{name: "Stored session ended", endSession: true, expectAuthentications: 2},
+		{name: "New stored session", expectAuthentications: 2},
+	} {
+		idp.SessionEnded = step.endSession
+
+		if _, err := Get("test-app", "test-provider", saml.RoleFilter{}, 3600, nil, config.Overrides{MFACode: "123456"}, idp.Client()); err != nil {
+			t.Fatalf("%s: unexpected error: %v", step.name, err)
+		}
+		if idp.Authentications != step.expectAuthentications {
+			t.Errorf("%s: expected %d authentications, got %d", step.name, step.expectAuthentications,
+				idp.Authentications)
+		}
+		if _, err := keychain.GetSession("test-provider"); err != nil {
+			t.Errorf("%s: expected a stored session, got %v", step.name, err)
+		}
+	}
+}
+
+func TestGetReuseSessionSAMLExpiry(t *testing.T) {
+	spinner.Disable()
+	keyring.MockInit()
+
+	idp := testserver.NewOkta()
+	defer idp.Close()
+	idp.MFACode = "123456"
+
+	sts := testserver.NewSTS()
+	defer sts.Close()
+
+	setupTestConfig(t, idp, sts, "password")
+	viper.Set("providers.test-provider.reuse-session", true)
+
+	for _, step := range []struct {
+		name                  string
+		notOnOrAfter          time.Time
+		expectAuthentications int
+	}{
+		{"SAML session expired", time.Now().Add(-time.Minute), 1},
+		{"Stored session expired with SAML session", time.Now().Add(time.Hour), 2},
+		{"SAML session valid", time.Now().Add(time.Hour), 2},
+	} {
+		idp.SAMLAssertion = testserver.SAMLAssertionWithSession(testserver.RoleARN,
+			testserver.ProviderARN, step.notOnOrAfter)
+
+		if _, err := Get("test-app", "test-provider", saml.RoleFilter{}, 3600, nil, config.Overrides{MFACode: "123456"}, idp.Client()); err != nil {
+			t.Fatalf("%s: unexpected error: %v", step.name, err)
+		}
+		if idp.Authentications != step.expectAuthentications {
+			t.Errorf("%s: expected %d authentications, got %d", step.name, step.expectAuthentications,
+				idp.Authentications)
+		}
+	}
+}
+
+// setupTestConfig configures an Okta provider and app backed by idp and points the aws package at
+// sts for the duration of a test.
+func setupTestConfig(t *testing.T, idp *testserver.Okta, sts *testserver.STS, password string) {
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := ioutil.WriteFile(passwordFile, []byte(password+"\n"), 0600); err != nil {
+		t.Fatalf("writing password file: %v", err)
+	}
+
+	viper.Set("providers.test-provider.type", "okta")
+	viper.Set("providers.test-provider.base-url", idp.URL)
+	viper.Set("providers.test-provider.username", idp.Username)
+	viper.Set("providers.test-provider.password-file", passwordFile)
+	viper.Set("apps.test-app.provider", "test-provider")
+	viper.Set("apps.test-app.url", idp.AppURL())
+
+	aws.STSEndpoint = sts.URL
+	testserver.IgnoreCABundle(t)
+	region, hasRegion := os.LookupEnv("AWS_REGION")
+	os.Setenv("AWS_REGION", "us-east-1")
+
+	t.Cleanup(func() {
+		viper.Reset()
+		aws.STSEndpoint = ""
+		if hasRegion {
+			os.Setenv("AWS_REGION", region)
+		} else {
+			os.Unsetenv("AWS_REGION")
+		}
+	})
+}
+
+func TestGetTOTPSecret(t *testing.T) {
+	spinner.Disable()
+	keyring.MockInit()
+
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	if err := keychain.SetTOTPSecret("okta-totp", []byte(secret)); err != nil {
+		t.Fatal(err)
+	}
+	code, err := totp.Code(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := testserver.NewOkta()
+	defer idp.Close()
+	idp.MFACode = code
+	sts := testserver.NewSTS()
+	defer sts.Close()
+
+	setupTestConfig(t, idp, sts, "password")
+	viper.Set("providers.test-provider.totp-secret-ref", "okta-totp")
+
+	if _, err := Get("test-app", "test-provider", saml.RoleFilter{}, 3600, nil, config.Overrides{}, idp.Client()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	viper.Set("providers.test-provider.totp-secret-ref", "missing")
+	_, err = Get("test-app", "test-provider", saml.RoleFilter{}, 3600, nil, config.Overrides{}, idp.Client())
+	if err == nil || !strings.Contains(err.Error(), "TOTP secret 'missing'") {
+		t.Fatalf("expected error about the missing TOTP secret, got %v", err)
+	}
+}
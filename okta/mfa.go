@@ -0,0 +1,38 @@
+package okta
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/allcloud-io/clisso/config"
+	"github.com/allcloud-io/clisso/spinner"
+)
+
+// Factors performs primary authentication against the given Okta provider and returns the MFA
+// factors the user may verify. If MFA isn't required, no factors are returned. All HTTP requests
+// are sent using hc, or a default client if hc is nil.
+func Factors(provider string, hc *http.Client) ([]Factor, error) {
+	p, err := config.GetOktaProvider(provider)
+	if err != nil {
+		return nil, fmt.Errorf("reading provider config: %v", err)
+	}
+
+	c, err := NewClient(p.BaseURL, hc)
+	if err != nil {
+		return nil, fmt.Errorf("initializing Okta client: %v", err)
+	}
+
+	resp, err := primaryAuth(c, p, provider, spinner.New())
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.Status {
+	case StatusSuccess:
+		return nil, nil
+	case StatusMFARequired:
+		return resp.Embedded.Factors, nil
+	default:
+		return nil, fmt.Errorf("Invalid status %s", resp.Status)
+	}
+}
@@ -0,0 +1,46 @@
+package okta
+
+import (
+	"testing"
+
+	"github.com/allcloud-io/clisso/internal/testserver"
+	"github.com/allcloud-io/clisso/spinner"
+)
+
+func TestFactors(t *testing.T) {
+	spinner.Disable()
+
+	for _, test := range []struct {
+		name          string
+		mfaCode       string
+		expectFactors int
+	}{
+		{"MFA not required", "", 0},
+		{"MFA required", "123456", 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			idp := testserver.NewOkta()
+			defer idp.Close()
+			idp.MFACode = test.mfaCode
+
+			sts := testserver.NewSTS()
+			defer sts.Close()
+
+			setupTestConfig(t, idp, sts, idp.Password)
+
+			factors, err := Factors("test-provider", idp.Client())
+			if err != nil {
+				t.Fatalf("unexpected error %+v", err)
+			}
+			if len(factors) != test.expectFactors {
+				t.Fatalf("wrong number of factors: got %d, want %d", len(factors), test.expectFactors)
+			}
+			if test.expectFactors > 0 {
+				f := factors[0]
+				if f.FactorType != MFATypeTOTP || f.Provider != "GOOGLE" || f.ID == "" {
+					t.Errorf("wrong factor: %+v", f)
+				}
+			}
+		})
+	}
+}
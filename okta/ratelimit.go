@@ -0,0 +1,104 @@
+package okta
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// rateLimitResetHeader is the header of Okta responses which holds the time at which the rate
+// limit of the endpoint resets, in seconds since the epoch:
+// https://developer.okta.com/docs/reference/rl-best-practices/
+const rateLimitResetHeader = "X-Rate-Limit-Reset"
+
+var (
+	// rateLimitRetries is how many times a request is retried after being rejected due to rate
+	// limiting.
+	rateLimitRetries = 3
+	// maxRateLimitWait is the longest time clisso waits for a rate limit to reset. Okta rate
+	// limits are per minute, so longer waits indicate a problem on which the request fails.
+	maxRateLimitWait = time.Minute
+	// sleep pauses the current goroutine for d or until ctx is done. It is a variable to avoid
+	// waiting in tests.
+	sleep = sleepContext
+)
+
+// sleepContext pauses the current goroutine for d. It returns the error of ctx if ctx is done
+// before d has passed.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// rateLimitTransport is an http.RoundTripper which sends requests using base and retries requests
+// rejected by Okta with a 429 response once the rate limit has reset, which happens e.g. when
+// refreshing the credentials of many apps in parallel. Waiting stops when the context of the
+// request is done.
+type rateLimitTransport struct {
+	base http.RoundTripper
+}
+
+func (t *rateLimitTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := t.base.RoundTrip(r)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests || attempt == rateLimitRetries {
+			return resp, err
+		}
+		wait, ok := rateLimitWait(resp.Header, time.Now())
+		if !ok || wait > maxRateLimitWait || (r.Body != nil && r.GetBody == nil) {
+			return resp, nil
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+
+		log.Printf(color.YellowString("Okta rate limit exceeded, retrying in %v"), wait.Round(time.Second))
+		if err := sleep(r.Context(), wait); err != nil {
+			return nil, err
+		}
+
+		if r.Body != nil {
+			body, err := r.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = r.Clone(r.Context())
+			r.Body = body
+		}
+	}
+}
+
+// Unwrap returns the RoundTripper t sends requests with.
+func (t *rateLimitTransport) Unwrap() http.RoundTripper {
+	return t.base
+}
+
+// rateLimitWait returns how long to wait before retrying a request rejected with a response with
+// the headers h, or false if h has no valid reset time. The wait is computed relative to the Date
+// header of the response if it has one, so that a skewed local clock doesn't matter, and is at
+// least a second since the reset time is only precise to the second.
+func rateLimitWait(h http.Header, now time.Time) (time.Duration, bool) {
+	secs, err := strconv.ParseInt(h.Get(rateLimitResetHeader), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	if date, err := http.ParseTime(h.Get("Date")); err == nil {
+		now = date
+	}
+	wait := time.Unix(secs, 0).Sub(now)
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return wait, true
+}
@@ -0,0 +1,139 @@
+package okta
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimitWait(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	date := now.Add(-time.Hour).UTC().Format(http.TimeFormat)
+
+	for _, test := range []struct {
+		name       string
+		reset      string
+		date       string
+		expectWait time.Duration
+		expectOK   bool
+	}{
+		{"Future reset", "1600000010", "", 10 * time.Second, true},
+		{"Past reset", "1599999990", "", time.Second, true},
+		{"Relative to date", "1599996430", date, 30 * time.Second, true},
+		{"Missing reset", "", "", 0, false},
+		{"Invalid reset", "soon", "", 0, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			h := http.Header{}
+			if test.reset != "" {
+				h.Set(rateLimitResetHeader, test.reset)
+			}
+			if test.date != "" {
+				h.Set("Date", test.date)
+			}
+			wait, ok := rateLimitWait(h, now)
+			if ok != test.expectOK || wait != test.expectWait {
+				t.Errorf("wrong wait: got %v and %t, want %v and %t", wait, ok, test.expectWait, test.expectOK)
+			}
+		})
+	}
+}
+
+func TestRateLimitRetry(t *testing.T) {
+	var slept []time.Duration
+	sleep = func(ctx context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+	defer func() { sleep = sleepContext }()
+
+	for _, test := range []struct {
+		name          string
+		limited       int
+		reset         time.Duration
+		expectError   bool
+		expectSleeps  int
+		expectRequest int
+	}{
+		{"Not limited", 0, 0, false, 0, 1},
+		{"Limited once", 1, 5 * time.Second, false, 1, 2},
+		{"Limited too often", rateLimitRetries + 1, 5 * time.Second, true, rateLimitRetries, rateLimitRetries + 1},
+		{"Reset too late", 1, maxRateLimitWait + time.Minute, true, 0, 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			slept = nil
+			requests := 0
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				var p GetSessionTokenParams
+				if err := json.NewDecoder(r.Body).Decode(&p); err != nil || p.Username != "user" {
+					t.Errorf("wrong request body: got %+v (%v)", p, err)
+				}
+				if requests <= test.limited {
+					w.Header().Set(rateLimitResetHeader, fmt.Sprint(time.Now().Add(test.reset).Unix()))
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				fmt.Fprint(w, `{"status": "SUCCESS", "sessionToken": "fake_token"}`)
+			}))
+			defer ts.Close()
+
+			c, err := NewClient(ts.URL, ts.Client())
+			if err != nil {
+				t.Fatalf("unexpected error %+v", err)
+			}
+			resp, err := c.GetSessionToken(&GetSessionTokenParams{Username: "user", Password: "password"})
+			if test.expectError {
+				if err == nil {
+					t.Error("expected an error")
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error %+v", err)
+			} else if resp.SessionToken != "fake_token" {
+				t.Errorf("wrong session token: got %s", resp.SessionToken)
+			}
+			if len(slept) != test.expectSleeps {
+				t.Errorf("wrong number of waits: got %d, want %d", len(slept), test.expectSleeps)
+			}
+			for _, d := range slept {
+				if d < test.reset-2*time.Second || d > test.reset {
+					t.Errorf("wrong wait: got %v, want about %v", d, test.reset)
+				}
+			}
+			if requests != test.expectRequest {
+				t.Errorf("wrong number of requests: got %d, want %d", requests, test.expectRequest)
+			}
+		})
+	}
+}
+
+func TestRateLimitCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The request is cancelled while waiting for the rate limit to reset.
+		cancel()
+		w.Header().Set(rateLimitResetHeader, fmt.Sprint(time.Now().Add(30*time.Second).Unix()))
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, err = (&rateLimitTransport{base: http.DefaultTransport}).RoundTrip(r)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("waited %v although the request was cancelled", d)
+	}
+}
@@ -0,0 +1,79 @@
+package okta
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/allcloud-io/clisso/keychain"
+)
+
+// storedSession is an Okta session stored in the keychain for reuse by later invocations.
+type storedSession struct {
+	Cookie     string    `json:"cookie"`
+	Expiration time.Time `json:"expiration"`
+}
+
+// resumeSession authenticates c using the session stored for provider. It returns false if no
+// session is stored or the stored session is no longer valid.
+func resumeSession(c *Client, provider string) (bool, error) {
+	b, err := keychain.GetSession(provider)
+	if err == keychain.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("reading session from keychain: %v", err)
+	}
+
+	var ss storedSession
+	if err := json.Unmarshal(b, &ss); err != nil {
+		return false, fmt.Errorf("parsing stored session: %v", err)
+	}
+	if !ss.Expiration.After(time.Now()) {
+		return false, nil
+	}
+
+	if err := c.SetSessionCookie(ss.Cookie); err != nil {
+		return false, err
+	}
+
+	// The session may have been ended before its expiration, e.g. by signing out of Okta or due
+	// to inactivity.
+	if _, err := c.GetCurrentSession(); err != nil {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// saveSession stores the session of c in the keychain for reuse by later invocations. If notAfter
+// isn't zero and is earlier than the expiration of the session, the stored session expires at
+// notAfter instead.
+func saveSession(c *Client, provider string, notAfter time.Time) error {
+	session, err := c.GetCurrentSession()
+	if err != nil {
+		return fmt.Errorf("getting session: %v", err)
+	}
+
+	cookie := c.SessionCookie()
+	if cookie == "" {
+		return errors.New("no session cookie was set by Okta")
+	}
+
+	expiration := session.ExpiresAt
+	if !notAfter.IsZero() && notAfter.Before(expiration) {
+		expiration = notAfter
+	}
+
+	b, err := json.Marshal(storedSession{Cookie: cookie, Expiration: expiration})
+	if err != nil {
+		return fmt.Errorf("serializing session: %v", err)
+	}
+
+	if err := keychain.SetSession(provider, b); err != nil {
+		return fmt.Errorf("storing session in keychain: %v", err)
+	}
+
+	return nil
+}
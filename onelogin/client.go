@@ -36,7 +36,9 @@ type GenerateSamlAssertionParams struct {
 	Subdomain       string `json:"subdomain"`
 }
 
-// TODO This one assumes MFA is enabled. Need to handle all cases.
+// GenerateSamlAssertionResponse contains either the SAML assertion in Data if no MFA is required,
+// e.g. because the user signs in from an IP address trusted by OneLogin, or the state token and MFA
+// devices of the user otherwise.
 type GenerateSamlAssertionResponse struct {
 	StateToken  string `json:"state_token"`
 	Message     string `json:"message"`
@@ -178,6 +180,10 @@ func (c *Client) GenerateSamlAssertion(token string, p *GenerateSamlAssertionPar
 		return nil, fmt.Errorf("doing HTTP request: %v", err)
 	}
 
+	if c.Endpoints.APIVersion == 1 {
+		return parseSamlAssertionV1(data)
+	}
+
 	var resp GenerateSamlAssertionResponse
 	if err := json.Unmarshal([]byte(data), &resp); err != nil {
 		return nil, fmt.Errorf("parsing HTTP response: %v", err)
@@ -206,6 +212,10 @@ func (c *Client) VerifyFactor(token string, p *VerifyFactorParams) (*VerifyFacto
 		return nil, fmt.Errorf("doing HTTP request: %v", err)
 	}
 
+	if c.Endpoints.APIVersion == 1 {
+		return parseVerifyFactorV1(data)
+	}
+
 	var resp VerifyFactorResponse
 	if err := json.Unmarshal([]byte(data), &resp); err != nil {
 		return nil, fmt.Errorf("parsing HTTP response: %v", err)
@@ -214,9 +224,14 @@ func (c *Client) VerifyFactor(token string, p *VerifyFactorParams) (*VerifyFacto
 	return &resp, nil
 }
 
-// NewClient creates a new Client and returns a pointer to it.
-func NewClient(region string) (c *Client, err error) {
-	c = new(Client)
+// NewClient creates a new Client which sends requests using hc and returns a pointer to it. If hc
+// is nil, http.DefaultClient is used.
+func NewClient(region string, hc *http.Client) (c *Client, err error) {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+
+	c = &Client{Client: *hc}
 
 	c.Endpoints = Endpoints{Region: region}
 	err = c.Endpoints.setBase()
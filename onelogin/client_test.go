@@ -30,7 +30,7 @@ func TestNewClient(t *testing.T) {
 		{"Invalid region", "invalid", true},
 	} {
 		t.Run(test.name, func(t *testing.T) {
-			_, err := NewClient(test.region)
+			_, err := NewClient(test.region, nil)
 			if test.expectError && err == nil {
 				t.Errorf("expected error")
 			}
@@ -143,3 +143,107 @@ func TestVerifyFactor(t *testing.T) {
 		)
 	}
 }
+
+func TestGenerateSamlAssertionV1(t *testing.T) {
+	for _, test := range []struct {
+		name             string
+		data             string
+		expectMessage    string
+		expectStateToken string
+		expectData       string
+		expectError      bool
+	}{
+		{
+			name:          "Success",
+			data:          `{"status": {"type": "success", "message": "Success", "code": 200, "error": false}, "data": "abcd"}`,
+			expectMessage: "Success",
+			expectData:    "abcd",
+		},
+		{
+			name: "MFA required",
+			data: `{
+	"status": {"type": "success", "message": "MFA is required for this user", "code": 200, "error": false},
+	"data": [
+		{
+			"state_token": "fake_state_token",
+			"devices": [{"device_id": 666666, "device_type": "Google Authenticator"}],
+			"callback_url": "https://api.us.onelogin.com/api/1/saml_assertion/verify_factor",
+			"user": {"username": "test", "id": 88888888}
+		}
+	]
+}`,
+			expectMessage:    "MFA is required for this user",
+			expectStateToken: "fake_state_token",
+		},
+		{
+			name:        "Error",
+			data:        `{"status": {"type": "bad request", "message": "Invalid app_id", "code": 400, "error": true}}`,
+			expectError: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ts := getTestServer(test.data)
+			defer ts.Close()
+
+			c := Client{Endpoints: Endpoints{APIVersion: 1}}
+			c.Endpoints.base, _ = url.Parse(ts.URL)
+
+			resp, err := c.GenerateSamlAssertion("test", &GenerateSamlAssertionParams{})
+			if test.expectError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateSamlAssertion: %s", err)
+			}
+
+			if resp.Message != test.expectMessage {
+				t.Errorf("wrong message: got %q, want %q", resp.Message, test.expectMessage)
+			}
+			if resp.StateToken != test.expectStateToken {
+				t.Errorf("wrong state token: got %q, want %q", resp.StateToken, test.expectStateToken)
+			}
+			if resp.Data != test.expectData {
+				t.Errorf("wrong data: got %q, want %q", resp.Data, test.expectData)
+			}
+			if test.expectStateToken != "" && (len(resp.Devices) != 1 || resp.Devices[0].DeviceID != 666666) {
+				t.Errorf("wrong devices: %+v", resp.Devices)
+			}
+		})
+	}
+}
+
+func TestVerifyFactorV1(t *testing.T) {
+	for _, test := range []struct {
+		name          string
+		data          string
+		expectMessage string
+		expectData    string
+	}{
+		{"Success", `{"status": {"type": "success", "message": "Success", "code": 200, "error": false}, "data": "abcd"}`,
+			"Success", "abcd"},
+		{"Push pending", `{"status": {"type": "pending", "message": "Authentication pending on OL Protect", "code": 200, "error": false}}`,
+			"Authentication pending on OL Protect", ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ts := getTestServer(test.data)
+			defer ts.Close()
+
+			c := Client{Endpoints: Endpoints{APIVersion: 1}}
+			c.Endpoints.base, _ = url.Parse(ts.URL)
+
+			resp, err := c.VerifyFactor("test", &VerifyFactorParams{})
+			if err != nil {
+				t.Fatalf("VerifyFactor: %s", err)
+			}
+			if resp.Message != test.expectMessage {
+				t.Errorf("wrong message: got %q, want %q", resp.Message, test.expectMessage)
+			}
+			if resp.Data != test.expectData {
+				t.Errorf("wrong data: got %q, want %q", resp.Data, test.expectData)
+			}
+		})
+	}
+}
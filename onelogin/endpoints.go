@@ -20,25 +20,42 @@ const (
 
 	// VerifyFactorPath - OneLogin API endpoint to verify a one-time password (OTP) value
 	VerifyFactorPath string = "/api/2/saml_assertion/verify_factor"
+
+	// GenerateSamlAssertionV1Path - OneLogin API v1 endpoint to generate a SAML assertions
+	GenerateSamlAssertionV1Path string = "/api/1/saml_assertion"
+
+	// VerifyFactorV1Path - OneLogin API v1 endpoint to verify a one-time password (OTP) value
+	VerifyFactorV1Path string = "/api/1/saml_assertion/verify_factor"
 )
 
+// bases maps OneLogin regions to API base URLs. It is a variable to allow pointing the client at
+// a fake OneLogin server in tests.
+var bases = map[string]string{
+	"US": usBase,
+	"EU": euBase,
+}
+
+// BaseURL returns the base URL of the OneLogin API in region.
+func BaseURL(region string) (string, error) {
+	e := Endpoints{Region: region}
+	if err := e.setBase(); err != nil {
+		return "", err
+	}
+	return e.base.String(), nil
+}
+
 // Endpoints represent the OneLogin API HTTP endpoints.
 type Endpoints struct {
 	Region string
+	// APIVersion is the version of the SAML assertion endpoints. Version 2 is used unless it is 1.
+	APIVersion int
 
 	base *url.URL
 }
 
 func (e *Endpoints) setBase() (err error) {
-	var base string
-	switch e.Region {
-	case "US":
-		base = usBase
-
-	case "EU":
-		base = euBase
-
-	default:
+	base, ok := bases[e.Region]
+	if !ok {
 		return fmt.Errorf("Region %q is an invalid OneLogin region. Valid values are EU or US.", e.Region)
 	}
 
@@ -50,6 +67,9 @@ func (e *Endpoints) setBase() (err error) {
 // GenerateSamlAssertion will return a the relevant Generate SAML Assertion
 // endpoint for a given base URL
 func (e Endpoints) GenerateSamlAssertion() string {
+	if e.APIVersion == 1 {
+		return e.doURL(GenerateSamlAssertionV1Path, make(url.Values))
+	}
 	return e.doURL(GenerateSamlAssertionPath, make(url.Values))
 }
 
@@ -67,6 +87,9 @@ func (e Endpoints) GetUserByEmail(email string) string {
 
 // VerifyFactor will return a valid URL for requests to check MFA tokens
 func (e Endpoints) VerifyFactor() string {
+	if e.APIVersion == 1 {
+		return e.doURL(VerifyFactorV1Path, make(url.Values))
+	}
 	return e.doURL(VerifyFactorPath, make(url.Values))
 }
 
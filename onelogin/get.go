@@ -4,13 +4,15 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"strconv"
+	"net/http"
+	"os"
 	"strings"
 	"time"
 
 	"github.com/allcloud-io/clisso/aws"
 	"github.com/allcloud-io/clisso/config"
 	"github.com/allcloud-io/clisso/keychain"
+	"github.com/allcloud-io/clisso/prompt"
 	"github.com/allcloud-io/clisso/saml"
 	"github.com/allcloud-io/clisso/spinner"
 	"github.com/fatih/color"
@@ -21,36 +23,47 @@ const (
 	// notifications. More info here: https://developers.onelogin.com/api-docs/1/saml-assertions/verify-factor
 	MFADeviceOneLoginProtect = "OneLogin Protect"
 
-	// MFAPushTimeout represents the number of seconds to wait for a successful push attempt before
-	// falling back to OTP input.
-	MFAPushTimeout = 30
+	// MFADeviceGoogleAuthenticator and MFADeviceWebAuthn are the device types of Google
+	// Authenticator and of security keys and platform authenticators.
+	MFADeviceGoogleAuthenticator = "Google Authenticator"
+	MFADeviceWebAuthn            = "WebAuthn"
 
-	// MFAInterval represents the interval at which we check for an accepted push message.
-	MFAInterval = 1
+	// pollProgressEvery is the number of MFA push polling attempts between progress messages.
+	pollProgressEvery = 5
 )
 
 var (
 	keyChain = keychain.DefaultKeychain{}
 )
 
-// Get gets temporary credentials for the given app.
+// Get gets temporary credentials for the given app. If the SAML assertion contains multiple roles,
+// filter narrows down the roles the user is asked to choose from. The given session tags, if any,
+// are attached to the resulting session. All HTTP requests are sent using hc, or a default client if hc is nil.
+// The overrides o take precedence over the configuration of the provider and the app.
 // TODO Move AWS logic outside this function.
-func Get(app, provider, pArn string, duration int64) (*aws.Credentials, error) {
+func Get(app, provider string, filter saml.RoleFilter, duration int64, tags map[string]string, o config.Overrides, hc *http.Client) (*aws.Credentials, error) {
 	// Read config
 	p, err := config.GetOneLoginProvider(provider)
 	if err != nil {
 		return nil, fmt.Errorf("reading provider config: %v", err)
 	}
+	p.Override(o)
 
-	a, err := config.GetOneLoginApp(app)
+	a, err := config.GetOneLoginApp(app, provider)
 	if err != nil {
 		return nil, fmt.Errorf("reading config for app %s: %v", app, err)
 	}
 
-	c, err := NewClient(p.Region)
+	c, err := NewClient(p.Region, hc)
 	if err != nil {
 		return nil, err
 	}
+	c.Endpoints.APIVersion = p.APIVersion
+
+	if p.ReuseSession {
+		// The OneLogin API requires the credentials of the user for every SAML assertion.
+		log.Println(color.YellowString("OneLogin doesn't support reusing sessions; authenticating"))
+	}
 
 	// Initialize spinner
 	var s = spinner.New()
@@ -66,13 +79,16 @@ func Get(app, provider, pArn string, duration int64) (*aws.Credentials, error) {
 	user := p.Username
 	if user == "" {
 		// Get credentials from the user
-		fmt.Print("OneLogin username: ")
-		fmt.Scanln(&user)
+		user, err = prompt.Username("OneLogin username", "use --username to specify the username")
+		if err != nil {
+			return nil, err
+		}
 	}
+	user = config.AddUsernameSuffix(user, p.UsernameSuffix)
 
-	pass, err := keyChain.Get(provider)
+	pass, err := keychain.Password(keyChain, provider, user, p.PasswordFile)
 	if err != nil {
-		return nil, fmt.Errorf("error getting keychain: %s", err)
+		return nil, fmt.Errorf("getting password: %w", err)
 	}
 
 	// Generate SAML assertion
@@ -92,21 +108,30 @@ func Get(app, provider, pArn string, duration int64) (*aws.Credentials, error) {
 		return nil, fmt.Errorf("generating SAML assertion: %v", err)
 	}
 
+	mfa, err := mfaRequired(rSaml)
+	if err != nil {
+		return nil, err
+	}
+
 	var rData string
-	if rSaml.Message != "Success" {
+	if mfa {
 		st := rSaml.StateToken
 
 		devices := rSaml.Devices
-		device, err := getDevice(devices)
+		device, err := getDevice(devices, a.MFAType)
 		if err != nil {
 			return nil, fmt.Errorf("error getting devices: %s", err)
 		}
+		if device.DeviceType == MFADeviceWebAuthn {
+			return nil, fmt.Errorf("unsupported MFA device type '%s'", device.DeviceType)
+		}
 
 		var rMfa *VerifyFactorResponse
 
 		var pushOK = false
 
-		if device.DeviceType == MFADeviceOneLoginProtect {
+		// Skip push if the user supplied an OTP or the app uses TOTP.
+		if device.DeviceType == MFADeviceOneLoginProtect && p.MFACode == "" && a.MFAType != config.MFATypeTOTP {
 			// Push is supported by the selected MFA device - try pushing and fall back to manual input
 			pushOK = true
 			pMfa := VerifyFactorParams{
@@ -126,33 +151,51 @@ func Get(app, provider, pArn string, duration int64) (*aws.Credentials, error) {
 
 			pMfa.DoNotNotify = true
 
-			fmt.Println(rMfa.Message)
+			// The message comes from OneLogin, so it is printed using the redacting logger.
+			log.Println(rMfa.Message)
 
-			timeout := MFAPushTimeout
 			s.Start()
-			for strings.Contains(rMfa.Message, "pending") && timeout > 0 {
-				time.Sleep(time.Duration(MFAInterval) * time.Second)
+			// Slow responses count towards the time the user has to approve the push.
+			deadline := time.Now().Add(time.Duration(p.MFAPollAttempts) * p.MFAPollInterval)
+			for attempt := 1; strings.Contains(rMfa.Message, "pending") && attempt <= p.MFAPollAttempts &&
+				time.Now().Before(deadline); attempt++ {
+				if attempt%pollProgressEvery == 0 {
+					s.Stop()
+					remaining := time.Until(deadline).Round(time.Second)
+					fmt.Fprintf(os.Stderr, "Waiting for MFA push approval (%s remaining)\n", remaining)
+					s.Start()
+				}
+
+				time.Sleep(p.MFAPollInterval)
 				rMfa, err = c.VerifyFactor(token, &pMfa)
 				if err != nil {
 					s.Stop()
 					return nil, err
 				}
-
-				timeout -= MFAInterval
 			}
 			s.Stop()
 
 			if strings.Contains(rMfa.Message, "pending") {
-				fmt.Println("MFA verification timed out - falling back to manual OTP input")
+				fmt.Fprintln(os.Stderr, "MFA verification timed out - falling back to manual OTP input")
 				pushOK = false
 			}
 		}
 
 		if !pushOK {
 			// Push failed or not supported by the selected MFA device
-			fmt.Print("Please enter the OTP from your MFA device: ")
-			var otp string
-			fmt.Scanln(&otp)
+			otp := p.MFACode
+			if otp == "" && p.TOTPSecretRef != "" {
+				otp, err = keychain.TOTPCode(p.TOTPSecretRef)
+				if err != nil {
+					return nil, fmt.Errorf("generating OTP using TOTP secret '%s': %v", p.TOTPSecretRef, err)
+				}
+			}
+			if otp == "" {
+				otp, err = prompt.MFACode("use --mfa-code to specify the OTP")
+				if err != nil {
+					return nil, err
+				}
+			}
 
 			// Verify MFA
 			pMfa := VerifyFactorParams{
@@ -175,20 +218,39 @@ func Get(app, provider, pArn string, duration int64) (*aws.Credentials, error) {
 		rData = rSaml.Data
 	}
 
-	arn, err := saml.Get(rData, pArn)
+	arn, err := saml.Get(rData, filter)
+	if err != nil {
+		return nil, err
+	}
+	if o.SAMLOutput != "" {
+		if err := aws.WriteSAMLAssertion(o.SAMLOutput, rData); err != nil {
+			return nil, err
+		}
+		return &aws.Credentials{RoleARN: arn.Role, PrincipalARN: arn.Provider}, nil
+	}
+	duration, err = saml.RoleDuration(arn.Role, duration)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionName, err := config.GetSessionName(app, o.SessionName)
+	if err != nil {
+		return nil, err
+	}
+	stsEndpoint, err := config.GetSTSEndpoint(app, o.STSEndpoint)
 	if err != nil {
 		return nil, err
 	}
 
 	s.Start()
-	creds, err := aws.AssumeSAMLRole(arn.Provider, arn.Role, rData, duration)
+	creds, err := aws.AssumeSAMLRole(arn.Provider, arn.Role, rData, duration, tags, sessionName, stsEndpoint, hc)
 	s.Stop()
 
 	if err != nil {
 		if err.Error() == aws.ErrDurationExceeded {
 			log.Println(color.YellowString(aws.DurationExceededMessage))
 			s.Start()
-			creds, err = aws.AssumeSAMLRole(arn.Provider, arn.Role, rData, 3600)
+			creds, err = aws.AssumeSAMLRole(arn.Provider, arn.Role, rData, 3600, tags, sessionName, stsEndpoint, hc)
 			s.Stop()
 			if err != nil {
 				return nil, err
@@ -199,48 +261,65 @@ func Get(app, provider, pArn string, duration int64) (*aws.Credentials, error) {
 	return creds, err
 }
 
+// oneLoginDeviceTypes maps the MFA types of apps to the types of the OneLogin MFA devices which
+// support them.
+var oneLoginDeviceTypes = map[string][]string{
+	config.MFATypePush: {MFADeviceOneLoginProtect},
+	config.MFATypeTOTP: {MFADeviceGoogleAuthenticator, MFADeviceOneLoginProtect},
+}
+
+// mfaRequired returns true if r is an MFA challenge rather than a SAML assertion. OneLogin skips
+// MFA in some cases, e.g. for trusted IP addresses, so r is checked for an assertion instead of
+// relying on its message.
+func mfaRequired(r *GenerateSamlAssertionResponse) (bool, error) {
+	switch {
+	case r.Data != "":
+		return false, nil
+	case r.StateToken != "":
+		return true, nil
+	default:
+		return false, fmt.Errorf("OneLogin returned neither a SAML assertion nor an MFA challenge: %s", r.Message)
+	}
+}
+
 // getDevice gets a slice of MFA devices, prompts the user to select one and returns the selected device.
 // If the slice contains only a single device, that device is returned. If the slice is empty, an error is returned.
-func getDevice(devices []Device) (device *Device, err error) {
+// If mfaType is set, the first device supporting it is returned without prompting.
+func getDevice(devices []Device, mfaType string) (device *Device, err error) {
 	if len(devices) == 0 {
 		// This should never happen
 		err = errors.New("No MFA device returned by Onelogin")
 		return
 	}
 
+	if mfaType != "" {
+		for _, d := range devices {
+			for _, t := range oneLoginDeviceTypes[mfaType] {
+				if d.DeviceType == t {
+					return &Device{DeviceID: d.DeviceID, DeviceType: d.DeviceType}, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("no enrolled MFA device of type %s", mfaType)
+	}
+
 	if len(devices) == 1 {
 		device = &Device{DeviceID: devices[0].DeviceID, DeviceType: devices[0].DeviceType}
 		return
 	}
 
-	var selection int
-	for {
-		for i, d := range devices {
-			fmt.Printf("%d. %d - %s\n", i+1, d.DeviceID, d.DeviceType)
-		}
-
-		fmt.Printf("Please choose an MFA device to authenticate with (1-%d): ", len(devices))
-		var input string
-		_, err := fmt.Scanln(&input)
-		if err != nil {
-			fmt.Printf("Error reading input: %v\n", err)
-			continue
-		}
-
-		// Verify we got an integer.
-		selection, err = strconv.Atoi(input)
-		if err != nil {
-			fmt.Printf("Invalid input '%s'\n", input)
-			continue
-		}
-
-		// Verify selection is within range.
-		if selection < 1 || selection > len(devices) {
-			fmt.Printf("Invalid value %d. Valid values: 1-%d\n", selection, len(devices))
-			continue
-		}
-		break
+	options := make([]string, len(devices))
+	for i, d := range devices {
+		options[i] = fmt.Sprintf("%d - %s", d.DeviceID, d.DeviceType)
+	}
+	selection, err := prompt.Select(
+		fmt.Sprintf("Please choose an MFA device to authenticate with (1-%d): ", len(devices)),
+		options,
+		"multiple MFA devices are enrolled; run clisso in a terminal to choose one",
+	)
+	if err != nil {
+		return nil, err
 	}
-	device = &Device{DeviceID: devices[selection-1].DeviceID, DeviceType: devices[selection-1].DeviceType}
+	device = &Device{DeviceID: devices[selection].DeviceID, DeviceType: devices[selection].DeviceType}
 	return
 }
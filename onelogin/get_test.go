@@ -0,0 +1,228 @@
+package onelogin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/allcloud-io/clisso/aws"
+	"github.com/allcloud-io/clisso/config"
+	"github.com/allcloud-io/clisso/internal/testserver"
+	"github.com/allcloud-io/clisso/saml"
+	"github.com/allcloud-io/clisso/spinner"
+	"github.com/spf13/viper"
+)
+
+func TestGet(t *testing.T) {
+	spinner.Disable()
+
+	for _, test := range []struct {
+		name        string
+		password    string
+		mfaCode     string
+		inputCode   string
+		expired     bool
+		expectError string
+	}{
+		{name: "Success", password: "password"},
+		{name: "Wrong password", password: "wrong", expectError: "401 Unauthorized"},
+		{name: "MFA required", password: "password", mfaCode: "123456", inputCode: "123456"},
+		{name: "Wrong MFA code", password: "password", mfaCode: "123456", inputCode: "654321",
+			expectError: "401 Unauthorized"},
+		{name: "Expired assertion", password: "password", expired: true,
+			expectError: "ExpiredTokenException"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			idp := testserver.NewOneLogin()
+			defer idp.Close()
+			idp.MFACode = test.mfaCode
+
+			sts := testserver.NewSTS()
+			defer sts.Close()
+			sts.Expired = test.expired
+
+			setupTestConfig(t, idp, sts, test.password)
+
+			creds, err := Get("test-app", "test-provider", saml.RoleFilter{}, 3600, nil, config.Overrides{MFACode: test.inputCode}, nil)
+			if test.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expectError) {
+					t.Fatalf("expected error containing %q, got %v", test.expectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if creds.AccessKeyID != testserver.AccessKeyID {
+				t.Errorf("wrong access key ID: got %q, want %q", creds.AccessKeyID, testserver.AccessKeyID)
+			}
+			if creds.SessionToken != testserver.SessionToken {
+				t.Errorf("wrong session token: got %q, want %q", creds.SessionToken, testserver.SessionToken)
+			}
+			if !creds.Expiration.Equal(sts.Expiration) {
+				t.Errorf("wrong expiration: got %v, want %v", creds.Expiration, sts.Expiration)
+			}
+		})
+	}
+}
+
+// TestGetAPIVersion verifies that both versions of the OneLogin SAML assertion API are supported.
+func TestGetAPIVersion(t *testing.T) {
+	spinner.Disable()
+
+	for _, test := range []struct {
+		name       string
+		apiVersion int
+		mfaCode    string
+	}{
+		{"v1", 1, ""},
+		{"v1 with MFA", 1, "123456"},
+		{"v2", 2, ""},
+		{"v2 with MFA", 2, "123456"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			idp := testserver.NewOneLogin()
+			defer idp.Close()
+			idp.MFACode = test.mfaCode
+
+			sts := testserver.NewSTS()
+			defer sts.Close()
+
+			setupTestConfig(t, idp, sts, idp.Password)
+			viper.Set("providers.test-provider.api-version", test.apiVersion)
+
+			creds, err := Get("test-app", "test-provider", saml.RoleFilter{}, 3600, nil, config.Overrides{MFACode: test.mfaCode}, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if creds.AccessKeyID != testserver.AccessKeyID {
+				t.Errorf("wrong access key ID: got %q, want %q", creds.AccessKeyID, testserver.AccessKeyID)
+			}
+		})
+	}
+}
+
+// TestGetMultipleProviders verifies that each OneLogin provider authenticates using its own API
+// credentials when several providers are configured.
+func TestGetMultipleProviders(t *testing.T) {
+	spinner.Disable()
+
+	sts := testserver.NewSTS()
+	defer sts.Close()
+	setupTestSTS(t, sts)
+
+	first := testserver.NewOneLogin()
+	defer first.Close()
+	first.ClientID, first.ClientSecret = "first-id", "first-secret"
+	setupTestProvider(t, "first", "first-app", first, first.Password)
+
+	second := testserver.NewOneLogin()
+	defer second.Close()
+	second.ClientID, second.ClientSecret = "second-id", "second-secret"
+	second.Password = "second-password"
+	setupTestProvider(t, "second", "second-app", second, second.Password)
+
+	for _, p := range []string{"first", "second"} {
+		cfg, err := config.GetOneLoginProvider(p)
+		if err != nil {
+			t.Fatalf("unexpected error %+v", err)
+		}
+		if cfg.ClientID != p+"-id" || cfg.ClientSecret != p+"-secret" {
+			t.Errorf("wrong API credentials for provider %s: %s/%s", p, cfg.ClientID, cfg.ClientSecret)
+		}
+	}
+
+	// Each server rejects the API credentials and the password of the other provider, so
+	// credentials can only be obtained if nothing leaks between providers.
+	for _, app := range []string{"first-app", "second-app", "first-app"} {
+		provider := viper.GetString("apps." + app + ".provider")
+		if _, err := Get(app, provider, saml.RoleFilter{}, 3600, nil, config.Overrides{}, nil); err != nil {
+			t.Errorf("getting credentials for app %s: %v", app, err)
+		}
+	}
+}
+
+// setupTestConfig configures a OneLogin provider and app backed by idp and points the aws package at
+// sts for the duration of a test.
+func setupTestConfig(t *testing.T, idp *testserver.OneLogin, sts *testserver.STS, password string) {
+	setupTestSTS(t, sts)
+	setupTestProvider(t, "test-provider", "test-app", idp, password)
+}
+
+// setupTestProvider configures a OneLogin provider named provider which is backed by idp and uses
+// the API credentials of idp, as well as an app of the provider, for the duration of a test.
+func setupTestProvider(t *testing.T, provider, app string, idp *testserver.OneLogin, password string) {
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := ioutil.WriteFile(passwordFile, []byte(password+"\n"), 0600); err != nil {
+		t.Fatalf("writing password file: %v", err)
+	}
+
+	// Use a dedicated region per provider to point each provider at its own server.
+	region := strings.ToUpper(provider)
+	bases[region] = idp.URL
+
+	p := "providers." + provider
+	viper.Set(p+".type", "onelogin")
+	viper.Set(p+".client-id", idp.ClientID)
+	viper.Set(p+".client-secret", idp.ClientSecret)
+	viper.Set(p+".subdomain", "test")
+	viper.Set(p+".region", region)
+	viper.Set(p+".username", idp.Username)
+	viper.Set(p+".password-file", passwordFile)
+	viper.Set("apps."+app+".provider", provider)
+	viper.Set("apps."+app+".app-id", "123456")
+
+	t.Cleanup(func() {
+		viper.Reset()
+		delete(bases, region)
+	})
+}
+
+// setupTestSTS points the aws package at sts for the duration of a test.
+func setupTestSTS(t *testing.T, sts *testserver.STS) {
+	aws.STSEndpoint = sts.URL
+	region, hasRegion := os.LookupEnv("AWS_REGION")
+	os.Setenv("AWS_REGION", "us-east-1")
+
+	t.Cleanup(func() {
+		aws.STSEndpoint = ""
+		if hasRegion {
+			os.Setenv("AWS_REGION", region)
+		} else {
+			os.Unsetenv("AWS_REGION")
+		}
+	})
+}
+
+func TestMFARequired(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		resp        GenerateSamlAssertionResponse
+		expect      bool
+		expectError bool
+	}{
+		{"Assertion", GenerateSamlAssertionResponse{Message: "Success", Data: "assertion"}, false, false},
+		{"MFA skipped for trusted IP", GenerateSamlAssertionResponse{Message: "Authenticated", Data: "assertion"}, false, false},
+		{"MFA challenge", GenerateSamlAssertionResponse{Message: "MFA is required for this user", StateToken: "token"}, true, false},
+		{"Neither", GenerateSamlAssertionResponse{Message: "Unexpected"}, false, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := mfaRequired(&test.resp)
+			if test.expectError {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.expect {
+				t.Errorf("wrong result: got %t, want %t", got, test.expect)
+			}
+		})
+	}
+}
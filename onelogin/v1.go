@@ -0,0 +1,74 @@
+package onelogin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// v1Response represents a response of version 1 of the OneLogin API, which wraps the data of the
+// response in an envelope containing the status of the request.
+type v1Response struct {
+	Status struct {
+		Error   bool   `json:"error"`
+		Code    int    `json:"code"`
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"status"`
+	Data json.RawMessage `json:"data"`
+}
+
+func parseV1Response(data string) (*v1Response, error) {
+	var r v1Response
+	if err := json.Unmarshal([]byte(data), &r); err != nil {
+		return nil, fmt.Errorf("parsing HTTP response: %v", err)
+	}
+	if r.Status.Error {
+		return nil, errors.New(r.Status.Message)
+	}
+
+	return &r, nil
+}
+
+// dataString returns the data of r if it is a string, or an empty string otherwise.
+func (r *v1Response) dataString() string {
+	var s string
+	if json.Unmarshal(r.Data, &s) != nil {
+		return ""
+	}
+	return s
+}
+
+// parseSamlAssertionV1 converts a v1 Generate SAML Assertion response to a
+// GenerateSamlAssertionResponse. The data of the response is the SAML assertion if no MFA is
+// required, or a list containing the MFA state token and devices of the user otherwise.
+func parseSamlAssertionV1(data string) (*GenerateSamlAssertionResponse, error) {
+	r, err := parseV1Response(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if s := r.dataString(); s != "" {
+		return &GenerateSamlAssertionResponse{Message: "Success", Data: s}, nil
+	}
+
+	var mfa []GenerateSamlAssertionResponse
+	if err := json.Unmarshal(r.Data, &mfa); err != nil || len(mfa) == 0 {
+		return nil, fmt.Errorf("unexpected response: %s", r.Status.Message)
+	}
+	resp := mfa[0]
+	resp.Message = r.Status.Message
+
+	return &resp, nil
+}
+
+// parseVerifyFactorV1 converts a v1 Verify Factor response to a VerifyFactorResponse. While a
+// push notification is pending, the message of the response says so and there is no data.
+func parseVerifyFactorV1(data string) (*VerifyFactorResponse, error) {
+	r, err := parseV1Response(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &VerifyFactorResponse{Message: r.Status.Message, Data: r.dataString()}, nil
+}
@@ -0,0 +1,214 @@
+// Package prompt reads input from the user. Since clisso may run without a terminal, e.g. in a
+// misconfigured CI job, reading fails immediately when stdin isn't a terminal instead of blocking
+// forever on input which never comes.
+package prompt
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+// ErrNonInteractive is returned when input is required but stdin isn't a terminal.
+var ErrNonInteractive = errors.New("input required but stdin is not a terminal")
+
+// isTerminal returns true if stdin is a terminal. It is a variable to allow simulating a terminal
+// in tests.
+var isTerminal = func() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// Prompter asks the user for the input clisso needs. hint tells the user how to supply the input
+// non-interactively, for implementations which may be unable to ask for it.
+type Prompter interface {
+	// Username asks for a username, e.g. the email of a JumpCloud user. label names what is asked
+	// for, e.g. "Okta username".
+	Username(label, hint string) (string, error)
+	// Password asks for the password of the user at provider.
+	Password(provider, hint string) ([]byte, error)
+	// MFACode asks for a one-time password from the MFA device of the user.
+	MFACode(hint string) (string, error)
+	// Select asks the user to select one of options, e.g. a role to assume, using msg and returns
+	// the zero-based index of the selected option.
+	Select(msg string, options []string, hint string) (int, error)
+	// Line asks for any other input using msg, e.g. a confirmation, and returns the input.
+	Line(msg, hint string) (string, error)
+}
+
+var (
+	// mu serializes prompts, so that prompts of concurrent operations don't interleave. It also
+	// guards prompter.
+	mu       sync.Mutex
+	prompter Prompter = Terminal{}
+)
+
+// SetPrompter makes the functions of this package ask for input using p instead of the terminal,
+// e.g. when clisso is used as a library by a program with its own user interface. If p is nil, the
+// terminal is used again.
+func SetPrompter(p Prompter) {
+	mu.Lock()
+	defer mu.Unlock()
+	if p == nil {
+		p = Terminal{}
+	}
+	prompter = p
+}
+
+// Username asks for a username using the current Prompter.
+func Username(label, hint string) (string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	return prompter.Username(label, hint)
+}
+
+// Password asks for the password of the user at provider using the current Prompter.
+func Password(provider, hint string) ([]byte, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	return prompter.Password(provider, hint)
+}
+
+// MFACode asks for a one-time password using the current Prompter.
+func MFACode(hint string) (string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	return prompter.MFACode(hint)
+}
+
+// Select asks the user to select one of options using the current Prompter and returns the
+// zero-based index of the selected option. An error is returned if the Prompter returns an index
+// which isn't one of options.
+func Select(msg string, options []string, hint string) (int, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	i, err := prompter.Select(msg, options, hint)
+	if err != nil {
+		return 0, err
+	}
+	if i < 0 || i >= len(options) {
+		return 0, fmt.Errorf("invalid selection %d: must be between 0 and %d", i, len(options)-1)
+	}
+	return i, nil
+}
+
+// Line asks for input using msg and the current Prompter.
+func Line(msg, hint string) (string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	return prompter.Line(msg, hint)
+}
+
+// Secret prints msg and reads a secret other than a password, e.g. a TOTP secret, from stdin
+// without echoing it. Unlike the other functions of this package, it always uses the terminal since
+// only the commands of clisso ask for such secrets.
+func Secret(msg, hint string) ([]byte, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if err := check(hint); err != nil {
+		return nil, err
+	}
+
+	fmt.Fprint(os.Stderr, msg)
+	secret, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read secret from terminal: %w", err)
+	}
+
+	return secret, nil
+}
+
+// check returns an error wrapping ErrNonInteractive which includes hint if stdin isn't a terminal.
+// hint tells the user how to supply the input non-interactively.
+func check(hint string) error {
+	if isTerminal() {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrNonInteractive, hint)
+}
+
+// Terminal is the default Prompter. It prints prompts to stderr and reads input from stdin. If
+// stdin isn't a terminal, an error wrapping ErrNonInteractive which includes the hint is returned
+// without reading.
+type Terminal struct{}
+
+// Username prints "<label>: " and returns a line read from stdin.
+func (t Terminal) Username(label, hint string) (string, error) {
+	return t.Line(label+": ", hint)
+}
+
+// Password asks for the password of provider without echoing the input.
+func (Terminal) Password(provider, hint string) ([]byte, error) {
+	if err := check(hint); err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(os.Stderr, "Please enter the password for the '%s' provider: ", provider)
+	pass, err := term.ReadPassword(int(os.Stdin.Fd()))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read password from terminal: %w", err)
+	}
+
+	return pass, nil
+}
+
+// MFACode asks for the OTP from the MFA device of the user.
+func (t Terminal) MFACode(hint string) (string, error) {
+	return t.Line("Please enter the OTP from your MFA device: ", hint)
+}
+
+// Select prints the options numbered from 1 and asks for the number of one of them until a valid
+// number is entered.
+func (t Terminal) Select(msg string, options []string, hint string) (int, error) {
+	for {
+		for i, o := range options {
+			// Use one-based indexing for human-friendliness.
+			fmt.Fprintf(os.Stderr, "%d. %s\n", i+1, o)
+		}
+
+		input, err := t.Line(msg, hint)
+		if errors.Is(err, ErrNonInteractive) || errors.Is(err, io.EOF) {
+			return 0, err
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+			continue
+		}
+
+		// Verify we got an integer.
+		selected, err := strconv.Atoi(input)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid input '%s'\n", input)
+			continue
+		}
+
+		// Verify selection is within range.
+		if selected < 1 || selected > len(options) {
+			fmt.Fprintf(os.Stderr, "Invalid value %d. Valid values: 1-%d\n", selected, len(options))
+			continue
+		}
+
+		// Translate user-selected index back to zero-based index.
+		return selected - 1, nil
+	}
+}
+
+// Line prints msg and returns a line read from stdin.
+func (Terminal) Line(msg, hint string) (string, error) {
+	if err := check(hint); err != nil {
+		return "", err
+	}
+
+	fmt.Fprint(os.Stderr, msg)
+	var input string
+	if _, err := fmt.Scanln(&input); err != nil {
+		return "", fmt.Errorf("reading input: %w", err)
+	}
+
+	return input, nil
+}
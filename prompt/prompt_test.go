@@ -0,0 +1,160 @@
+package prompt
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// withClosedStdin replaces stdin with the read end of a closed pipe for the duration of a test.
+func withClosedStdin(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	stdin := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		r.Close()
+	})
+}
+
+func TestNonInteractive(t *testing.T) {
+	withClosedStdin(t)
+
+	_, err := Line("Username: ", "use --username")
+	if !errors.Is(err, ErrNonInteractive) {
+		t.Fatalf("expected ErrNonInteractive, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "use --username") {
+		t.Errorf("expected error to contain the hint, got %q", err)
+	}
+
+	if _, err := Password("Password: ", "use --password-file"); !errors.Is(err, ErrNonInteractive) {
+		t.Fatalf("expected ErrNonInteractive, got %v", err)
+	}
+	if _, err := Secret("TOTP secret: ", "run the command in a terminal"); !errors.Is(err, ErrNonInteractive) {
+		t.Fatalf("expected ErrNonInteractive, got %v", err)
+	}
+}
+
+func TestClosedTerminal(t *testing.T) {
+	withClosedStdin(t)
+
+	orig := isTerminal
+	isTerminal = func() bool { return true }
+	defer func() { isTerminal = orig }()
+
+	// Reading from a closed stdin must fail rather than block.
+	if _, err := Line("Username: ", "use --username"); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
+
+// fakePrompter answers prompts with fixed input and records what was asked for.
+type fakePrompter struct {
+	input  string
+	asked  []string
+	choice int
+}
+
+func (p *fakePrompter) Username(label, hint string) (string, error) {
+	p.asked = append(p.asked, "username "+label)
+	return p.input, nil
+}
+
+func (p *fakePrompter) Password(provider, hint string) ([]byte, error) {
+	p.asked = append(p.asked, "password "+provider)
+	return []byte(p.input), nil
+}
+
+func (p *fakePrompter) MFACode(hint string) (string, error) {
+	p.asked = append(p.asked, "mfa code")
+	return p.input, nil
+}
+
+func (p *fakePrompter) Select(msg string, options []string, hint string) (int, error) {
+	p.asked = append(p.asked, "select "+strings.Join(options, ","))
+	return p.choice, nil
+}
+
+func (p *fakePrompter) Line(msg, hint string) (string, error) {
+	p.asked = append(p.asked, "line "+msg)
+	return p.input, nil
+}
+
+func TestSetPrompter(t *testing.T) {
+	withClosedStdin(t)
+	p := &fakePrompter{input: "input", choice: 1}
+	SetPrompter(p)
+	defer SetPrompter(nil)
+
+	if got, err := Username("Okta username", "use --username"); err != nil || got != "input" {
+		t.Errorf("wrong username: got %q (%v), want %q", got, err, "input")
+	}
+	if got, err := Password("okta", "use --password-file"); err != nil || string(got) != "input" {
+		t.Errorf("wrong password: got %q (%v), want %q", got, err, "input")
+	}
+	if got, err := MFACode("use --mfa-code"); err != nil || got != "input" {
+		t.Errorf("wrong MFA code: got %q (%v), want %q", got, err, "input")
+	}
+	if got, err := Select("Role: ", []string{"a", "b"}, "use --role"); err != nil || got != 1 {
+		t.Errorf("wrong selection: got %d (%v), want 1", got, err)
+	}
+	if _, err := Select("Role: ", []string{"a"}, "use --role"); err == nil {
+		t.Error("expected an error for a selection out of range")
+	}
+	if got, err := Line("Continue? ", "use --yes"); err != nil || got != "input" {
+		t.Errorf("wrong line: got %q (%v), want %q", got, err, "input")
+	}
+
+	want := "username Okta username;password okta;mfa code;select a,b;select a;line Continue? "
+	if got := strings.Join(p.asked, ";"); got != want {
+		t.Errorf("wrong prompts: got %q, want %q", got, want)
+	}
+
+	SetPrompter(nil)
+	if _, err := Line("Username: ", "use --username"); !errors.Is(err, ErrNonInteractive) {
+		t.Fatalf("expected ErrNonInteractive after restoring the terminal, got %v", err)
+	}
+}
+
+func TestTerminalSelect(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Invalid input and out of range values are rejected until a valid value is entered.
+	if _, err := io.WriteString(w, "first\n5\n2\n"); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() {
+		os.Stdin = stdin
+		r.Close()
+	}()
+
+	orig := isTerminal
+	isTerminal = func() bool { return true }
+	defer func() { isTerminal = orig }()
+
+	got, err := Terminal{}.Select("Role: ", []string{"a", "b", "c"}, "use --role")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != 1 {
+		t.Errorf("wrong selection: got %d, want 1", got)
+	}
+
+	// Running out of input must fail rather than loop forever.
+	if _, err := (Terminal{}).Select("Role: ", []string{"a", "b"}, "use --role"); !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+// Package redact removes secrets such as passwords, SAML assertions and AWS credentials from text
+// before it is logged, so that log output is safe to share, e.g. when reporting a bug.
+//
+// All packages log using the standard logger, so its output is wrapped using NewWriter once in
+// main rather than in each package.
+package redact
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces secrets in redacted text.
+const Redacted = "[REDACTED]"
+
+// minSecretLength is the length below which secrets passed to Add are ignored, since redacting
+// every occurrence of a very short string would make log output unreadable.
+const minSecretLength = 4
+
+var (
+	// keyValue matches the values of secret fields in JSON documents, URL-encoded forms, INI
+	// files and YAML.
+	keyValue = regexp.MustCompile(`(?i)("?\b(?:aws_secret_access_key|secretaccesskey|aws_session_token|` +
+		`sessiontoken|statetoken|token|access_token|id_token|device_code|password|passwd|client[-_]?secret|` +
+		`samlresponse|saml_response)\b"?\s*[:=]\s*"?)[^"\s,&}]+`)
+
+	// blob matches long base64 strings such as SAML assertions and STS session tokens.
+	blob = regexp.MustCompile(`[A-Za-z0-9+/]{120,}={0,2}`)
+)
+
+var (
+	mu      sync.RWMutex
+	secrets []string
+)
+
+// Add registers secret, e.g. a password entered by the user, so that all of its occurrences are
+// redacted.
+func Add(secret string) {
+	if len(secret) < minSecretLength {
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, s := range secrets {
+		if s == secret {
+			return
+		}
+	}
+	secrets = append(secrets, secret)
+}
+
+// String returns s with the secrets registered using Add, the values of secret fields and long
+// base64 strings replaced by Redacted.
+func String(s string) string {
+	mu.RLock()
+	for _, secret := range secrets {
+		s = strings.Replace(s, secret, Redacted, -1)
+	}
+	mu.RUnlock()
+
+	s = keyValue.ReplaceAllString(s, "${1}"+Redacted)
+	return blob.ReplaceAllString(s, Redacted)
+}
+
+// writer redacts everything written to it before writing it to w.
+type writer struct {
+	w io.Writer
+}
+
+// NewWriter returns a writer which redacts secrets using String before writing to w. The standard
+// logger writes each message using a single call, so secrets aren't split across writes.
+func NewWriter(w io.Writer) io.Writer {
+	return &writer{w: w}
+}
+
+func (rw *writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(rw.w, String(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
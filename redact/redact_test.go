@@ -0,0 +1,54 @@
+package redact
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestString(t *testing.T) {
+	assertion := strings.Repeat("PHNhbWxwOlJlc3BvbnNlIHhtbG5zOnNhbWxwPSJ1cm46b2FzaXM6", 4) + "=="
+
+	for _, test := range []struct {
+		name   string
+		in     string
+		expect string
+	}{
+		{"JSON", `{"AccessKeyId":"AKIA","SecretAccessKey":"abc/def","SessionToken":"tok"}`,
+			`{"AccessKeyId":"AKIA","SecretAccessKey":"[REDACTED]","SessionToken":"[REDACTED]"}`},
+		{"Form", "username=user&password=hunter22&x=1", "username=user&password=[REDACTED]&x=1"},
+		{"INI", "aws_secret_access_key = abc\naws_session_token = def",
+			"aws_secret_access_key = [REDACTED]\naws_session_token = [REDACTED]"},
+		{"YAML", "  client-secret: abc\n  client_secret: def", "  client-secret: [REDACTED]\n  client_secret: [REDACTED]"},
+		{"SAML assertion", "got " + assertion + " from IdP", "got [REDACTED] from IdP"},
+		{"Nothing secret", "Credentials written successfully to '/home/user/.aws/credentials'",
+			"Credentials written successfully to '/home/user/.aws/credentials'"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := String(test.in); got != test.expect {
+				t.Errorf("wrong output:\ngot  %q\nwant %q", got, test.expect)
+			}
+		})
+	}
+}
+
+func TestAdd(t *testing.T) {
+	Add("s3cr3t-passw0rd")
+	Add("abc")
+
+	got := String("authentication with s3cr3t-passw0rd failed for abc")
+	if want := "authentication with [REDACTED] failed for abc"; got != want {
+		t.Errorf("wrong output: got %q, want %q", got, want)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var b bytes.Buffer
+	l := log.New(NewWriter(&b), "", 0)
+
+	l.Printf("response: %s", `{"sessionToken":"20111ABCDEF"}`)
+	if got, want := b.String(), "response: {\"sessionToken\":\"[REDACTED]\"}\n"; got != want {
+		t.Errorf("wrong output: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,59 @@
+package rolesanywhere
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// LoadCertificate reads the PEM-encoded X.509 certificate at path.
+func LoadCertificate(path string) (*x509.Certificate, error) {
+	b, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return x509.ParseCertificate(b.Bytes)
+}
+
+// LoadPrivateKey reads the PEM-encoded RSA or ECDSA private key at path. PKCS #1, PKCS #8 and SEC 1
+// encodings are supported.
+func LoadPrivateKey(path string) (crypto.Signer, error) {
+	b, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if k, err := x509.ParsePKCS8PrivateKey(b.Bytes); err == nil {
+		if s, ok := k.(crypto.Signer); ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("unsupported private key type %T", k)
+	}
+	if k, err := x509.ParsePKCS1PrivateKey(b.Bytes); err == nil {
+		return k, nil
+	}
+	if k, err := x509.ParseECPrivateKey(b.Bytes); err == nil {
+		return k, nil
+	}
+
+	return nil, errors.New("unsupported private key format")
+}
+
+// readPEM returns the first PEM block of the file at path.
+func readPEM(path string) (*pem.Block, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	b, _ := pem.Decode(data)
+	if b == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
+	}
+
+	return b, nil
+}
@@ -0,0 +1,201 @@
+// Package rolesanywhere obtains temporary AWS credentials using IAM Roles Anywhere, which issues
+// credentials for a role in exchange for a request signed using an X.509 certificate trusted by a
+// trust anchor.
+package rolesanywhere
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	service = "rolesanywhere"
+
+	// Signing algorithms of requests signed using X.509 certificates. See
+	// https://docs.aws.amazon.com/rolesanywhere/latest/userguide/authentication-sign-process.html
+	algorithmRSA   = "AWS4-X509-RSA-SHA256"
+	algorithmECDSA = "AWS4-X509-ECDSA-SHA256"
+
+	amzDateFormat = "20060102T150405Z"
+	dateFormat    = "20060102"
+)
+
+// Endpoint overrides the endpoint Roles Anywhere requests are sent to if set. This allows using a
+// fake Roles Anywhere server in tests.
+var Endpoint string
+
+// EndpointURL returns the URL of the Roles Anywhere endpoint of region, which is Endpoint if it is
+// set.
+func EndpointURL(region string) string {
+	if Endpoint != "" {
+		return Endpoint
+	}
+	return fmt.Sprintf("https://%s.%s.amazonaws.com", service, region)
+}
+
+// Client represents an IAM Roles Anywhere API client which signs requests using an X.509
+// certificate and its private key.
+type Client struct {
+	http.Client
+	Region      string
+	Certificate *x509.Certificate
+	Key         crypto.Signer
+}
+
+// NewClient creates a new Client for the given region which sends requests using hc and returns a
+// pointer to it. If hc is nil, http.DefaultClient is used.
+func NewClient(region string, cert *x509.Certificate, key crypto.Signer, hc *http.Client) *Client {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+
+	return &Client{Client: *hc, Region: region, Certificate: cert, Key: key}
+}
+
+// CreateSessionParams represents the parameters for CreateSession.
+type CreateSessionParams struct {
+	DurationSeconds int64  `json:"durationSeconds"`
+	ProfileARN      string `json:"profileArn"`
+	RoleARN         string `json:"roleArn"`
+	TrustAnchorARN  string `json:"trustAnchorArn"`
+	RoleSessionName string `json:"roleSessionName,omitempty"`
+}
+
+// CreateSessionResponse represents the result of a call to CreateSession.
+type CreateSessionResponse struct {
+	CredentialSet []struct {
+		Credentials struct {
+			AccessKeyID     string    `json:"accessKeyId"`
+			SecretAccessKey string    `json:"secretAccessKey"`
+			SessionToken    string    `json:"sessionToken"`
+			Expiration      time.Time `json:"expiration"`
+		} `json:"credentials"`
+	} `json:"credentialSet"`
+}
+
+// CreateSession exchanges the certificate of the client for temporary credentials of the role in
+// p.
+func (c *Client) CreateSession(p *CreateSessionParams) (*CreateSessionResponse, error) {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return nil, fmt.Errorf("serializing request: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, EndpointURL(c.Region)+"/sessions", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if err := c.sign(req, body, time.Now()); err != nil {
+		return nil, fmt.Errorf("signing request: %v", err)
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("sending HTTP request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading HTTP response: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		var e struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &e) == nil && e.Message != "" {
+			return nil, fmt.Errorf("%s: %s", resp.Status, e.Message)
+		}
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+
+	var r CreateSessionResponse
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("parsing HTTP response: %v", err)
+	}
+
+	return &r, nil
+}
+
+// sign adds the headers of a request signed using the certificate of the client at time now to r.
+// body must be the body of r.
+func (c *Client) sign(r *http.Request, body []byte, now time.Time) error {
+	var algorithm string
+	switch c.Key.Public().(type) {
+	case *rsa.PublicKey:
+		algorithm = algorithmRSA
+	case *ecdsa.PublicKey:
+		algorithm = algorithmECDSA
+	default:
+		return fmt.Errorf("unsupported private key type %T", c.Key.Public())
+	}
+
+	now = now.UTC()
+	r.Header.Set("Host", r.URL.Host)
+	r.Header.Set("X-Amz-Date", now.Format(amzDateFormat))
+	r.Header.Set("X-Amz-X509", base64.StdEncoding.EncodeToString(c.Certificate.Raw))
+
+	headers := make([]string, 0, len(r.Header))
+	for h := range r.Header {
+		headers = append(headers, strings.ToLower(h))
+	}
+	sort.Strings(headers)
+
+	var canonicalHeaders strings.Builder
+	for _, h := range headers {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", h, strings.TrimSpace(r.Header.Get(h)))
+	}
+	signedHeaders := strings.Join(headers, ";")
+
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		r.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hexSHA256(body),
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", now.Format(dateFormat), c.Region, service)
+	stringToSign := strings.Join([]string{
+		algorithm,
+		now.Format(amzDateFormat),
+		scope,
+		hexSHA256([]byte(canonicalRequest)),
+	}, "\n")
+
+	digest := sha256.Sum256([]byte(stringToSign))
+	// RSA keys produce PKCS #1 v1.5 signatures and ECDSA keys produce ASN.1 signatures, which is
+	// what Roles Anywhere expects.
+	sig, err := c.Key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return err
+	}
+
+	r.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		algorithm, c.Certificate.SerialNumber, scope, signedHeaders, hex.EncodeToString(sig)))
+
+	return nil
+}
+
+func hexSHA256(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,90 @@
+package rolesanywhere
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/allcloud-io/clisso/aws"
+	"github.com/allcloud-io/clisso/config"
+	"github.com/allcloud-io/clisso/spinner"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	homedir "github.com/mitchellh/go-homedir"
+)
+
+// Get gets temporary credentials for the given app by exchanging the certificate of the provider
+// for credentials of the role of the app. All HTTP requests are sent using hc, or a default
+// client if hc is nil.
+// The overrides o take precedence over the configuration of the provider and the app.
+func Get(app, provider string, duration int64, o config.Overrides, hc *http.Client) (*aws.Credentials, error) {
+	p, err := config.GetRolesAnywhereProvider(provider)
+	if err != nil {
+		return nil, fmt.Errorf("reading provider config: %v", err)
+	}
+
+	a, err := config.GetRolesAnywhereApp(app)
+	if err != nil {
+		return nil, fmt.Errorf("reading config for app %s: %v", app, err)
+	}
+
+	// Roles Anywhere is a regional service. Sessions are created in the region of the trust anchor.
+	ta, err := arn.Parse(p.TrustAnchorARN)
+	if err != nil {
+		return nil, fmt.Errorf("parsing trust anchor ARN: %v", err)
+	}
+
+	certPath, err := homedir.Expand(p.Certificate)
+	if err != nil {
+		return nil, fmt.Errorf("expanding certificate path: %v", err)
+	}
+	cert, err := LoadCertificate(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("loading certificate: %v", err)
+	}
+
+	keyPath, err := homedir.Expand(p.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("expanding private key path: %v", err)
+	}
+	key, err := LoadPrivateKey(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("loading private key: %v", err)
+	}
+
+	sessionName, err := config.GetSessionName(app, o.SessionName)
+	if err != nil {
+		return nil, err
+	}
+	if sessionName != "" {
+		sessionName = aws.SanitizeSessionName(sessionName)
+	}
+
+	c := NewClient(ta.Region, cert, key, hc)
+
+	s := spinner.New()
+	s.Start()
+	resp, err := c.CreateSession(&CreateSessionParams{
+		DurationSeconds: duration,
+		ProfileARN:      p.ProfileARN,
+		RoleARN:         a.RoleARN,
+		TrustAnchorARN:  p.TrustAnchorARN,
+		RoleSessionName: sessionName,
+	})
+	s.Stop()
+	if err != nil {
+		return nil, fmt.Errorf("creating Roles Anywhere session: %v", err)
+	}
+
+	if len(resp.CredentialSet) == 0 {
+		return nil, errors.New("no credentials returned by Roles Anywhere")
+	}
+	rc := resp.CredentialSet[0].Credentials
+
+	return &aws.Credentials{
+		AccessKeyID:     rc.AccessKeyID,
+		SecretAccessKey: rc.SecretAccessKey,
+		SessionToken:    rc.SessionToken,
+		Expiration:      rc.Expiration,
+		RoleARN:         a.RoleARN,
+	}, nil
+}
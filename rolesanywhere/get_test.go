@@ -0,0 +1,130 @@
+package rolesanywhere
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/allcloud-io/clisso/config"
+	"github.com/allcloud-io/clisso/internal/testserver"
+	"github.com/allcloud-io/clisso/spinner"
+	"github.com/spf13/viper"
+)
+
+func TestGet(t *testing.T) {
+	spinner.Disable()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec1, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name        string
+		certKey     crypto.Signer
+		keyType     string
+		keyDER      []byte
+		region      string
+		expectError string
+	}{
+		{"RSA PKCS #1", rsaKey, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey), "us-east-1", ""},
+		{"ECDSA SEC 1", ecKey, "EC PRIVATE KEY", sec1, "us-east-1", ""},
+		{"ECDSA PKCS #8", ecKey, "PRIVATE KEY", pkcs8, "us-east-1", ""},
+		{"Key doesn't match certificate", ecKey, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey),
+			"us-east-1", "Signature validation failed"},
+		{"Wrong region", ecKey, "EC PRIVATE KEY", sec1, "eu-west-1", "Invalid credential"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ra := testserver.NewRolesAnywhere()
+			defer ra.Close()
+			ra.Region = test.region
+
+			setupTestConfig(t, ra, test.certKey, &pem.Block{Type: test.keyType, Bytes: test.keyDER})
+
+			creds, err := Get("test-app", "test-provider", 3600, config.Overrides{}, nil)
+			if test.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expectError) {
+					t.Fatalf("expected error containing %q, got %v", test.expectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if creds.AccessKeyID != testserver.AccessKeyID {
+				t.Errorf("wrong access key ID: got %q, want %q", creds.AccessKeyID, testserver.AccessKeyID)
+			}
+			if creds.SessionToken != testserver.SessionToken {
+				t.Errorf("wrong session token: got %q, want %q", creds.SessionToken, testserver.SessionToken)
+			}
+			if !creds.Expiration.Equal(ra.Expiration) {
+				t.Errorf("wrong expiration: got %v, want %v", creds.Expiration, ra.Expiration)
+			}
+		})
+	}
+}
+
+// setupTestConfig configures a provider which uses a self-signed certificate of certKey and the
+// private key in key, and an app of the provider.
+func setupTestConfig(t *testing.T, ra *testserver.RolesAnywhere, certKey crypto.Signer, key *pem.Block) {
+	dir := t.TempDir()
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(123456789),
+		Subject:      pkix.Name{CommonName: "clisso-test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, certKey.Public(), certKey)
+	if err != nil {
+		t.Fatalf("creating certificate: %v", err)
+	}
+
+	certPath := filepath.Join(dir, "cert.pem")
+	if err := ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("writing certificate: %v", err)
+	}
+	keyPath := filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(keyPath, pem.EncodeToMemory(key), 0600); err != nil {
+		t.Fatalf("writing private key: %v", err)
+	}
+
+	viper.Set("providers.test-provider.type", "rolesanywhere")
+	viper.Set("providers.test-provider.trust-anchor-arn", "arn:aws:rolesanywhere:us-east-1:123456789012:trust-anchor/test")
+	viper.Set("providers.test-provider.profile-arn", "arn:aws:rolesanywhere:us-east-1:123456789012:profile/test")
+	viper.Set("providers.test-provider.certificate", certPath)
+	viper.Set("providers.test-provider.private-key", keyPath)
+	viper.Set("apps.test-app.provider", "test-provider")
+	viper.Set("apps.test-app.arn", testserver.RoleARN)
+
+	Endpoint = ra.URL
+
+	t.Cleanup(func() {
+		viper.Reset()
+		Endpoint = ""
+	})
+}
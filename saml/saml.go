@@ -5,10 +5,12 @@ import (
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"os"
 	"regexp"
-	"strconv"
 	"strings"
+	"time"
 
+	"github.com/allcloud-io/clisso/prompt"
 	"github.com/edaniels/go-saml"
 	"github.com/spf13/viper"
 )
@@ -19,7 +21,72 @@ type ARN struct {
 	Name     string
 }
 
-func Get(data, pArn string) (a ARN, err error) {
+// RoleFilter narrows down the roles offered for selection when a SAML assertion contains more than
+// one role. Empty fields match any role.
+type RoleFilter struct {
+	// ARN is the ARN of the role to assume. Only this role is considered if it is set.
+	ARN string
+	// Reselect makes Get ask the user to select another role instead of failing if ARN isn't in
+	// the assertion, e.g. because access to the configured role was removed.
+	Reselect bool
+	// Account is the ID of an AWS account or its human friendly name from global.accounts.
+	Account string
+	// RoleName is the name of an IAM role without its path, e.g. "MyRole".
+	RoleName string
+	// Allowed restricts the roles which may be assumed to the roles matching one of its patterns.
+	// Patterns starting with "arn:" are matched against role ARNs and other patterns against role
+	// names without their path. "*" matches any sequence of characters. All roles are allowed if
+	// Allowed is empty.
+	Allowed []string
+}
+
+// allowed reports whether the role of a matches one of the patterns in f.Allowed.
+func (f RoleFilter) allowed(a ARN) bool {
+	if len(f.Allowed) == 0 {
+		return true
+	}
+	for _, p := range f.Allowed {
+		if matchRole(p, a.Role) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchRole reports whether the role with the given ARN matches pattern. Patterns starting with
+// "arn:" are matched against the ARN and other patterns against the role name without its path.
+func matchRole(pattern, role string) bool {
+	s := roleName(role)
+	if strings.HasPrefix(pattern, "arn:") {
+		s = role
+	}
+	return globMatch(pattern, s)
+}
+
+// globMatch reports whether s matches pattern, in which "*" matches any sequence of characters,
+// including "/".
+func globMatch(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$").MatchString(s)
+}
+
+func (f RoleFilter) match(a ARN) bool {
+	if f.Account != "" {
+		id := accountID(a.Role)
+		if id != f.Account && !strings.EqualFold(AccountName(id), f.Account) {
+			return false
+		}
+	}
+	if f.RoleName != "" && roleName(a.Role) != f.RoleName {
+		return false
+	}
+	return true
+}
+
+func Get(data string, f RoleFilter) (a ARN, err error) {
 	samlBody, err := decode(data)
 	if err != nil {
 		return
@@ -31,26 +98,339 @@ func Get(data, pArn string) (a ARN, err error) {
 		return
 	}
 
-	arns := extractArns(x.Assertion.AttributeStatement.Attributes, pArn)
+	arns := extractArns(x.Assertion.AttributeStatement.Attributes, f.ARN)
+	// unavailable is set if the role given by f.ARN is gone and another one is selected instead.
+	var unavailable error
+	if len(arns) == 0 && f.ARN != "" {
+		if available := extractArns(x.Assertion.AttributeStatement.Attributes, ""); len(available) > 0 {
+			roles := make([]string, len(available))
+			for i, arn := range available {
+				roles[i] = arn.Role
+			}
+			err = fmt.Errorf("role %s isn't available; available roles: %s", f.ARN, strings.Join(roles, ", "))
+			if !f.Reselect {
+				return
+			}
+
+			fmt.Fprintf(os.Stderr, "Role %s is no longer available - selecting another role\n", f.ARN)
+			unavailable, err = err, nil
+			arns = available
+			f.ARN = ""
+		}
+	}
+	if unavailable != nil {
+		// If the user can't be asked, the unavailable role is the more useful error.
+		defer func() {
+			if errors.Is(err, prompt.ErrNonInteractive) {
+				err = unavailable
+			}
+		}()
+	}
+	if len(arns) == 0 {
+		err = errors.New("no valid AWS roles were returned")
+
+		return
+	}
+
+	allowed := make([]ARN, 0, len(arns))
+	for _, arn := range arns {
+		if f.allowed(arn) {
+			allowed = append(allowed, arn)
+		}
+	}
+	if len(allowed) == 0 {
+		if f.ARN != "" {
+			err = fmt.Errorf("role %s isn't allowed; allowed roles: %s", f.ARN, strings.Join(f.Allowed, ", "))
+		} else {
+			err = fmt.Errorf("none of the returned AWS roles are allowed; allowed roles: %s", strings.Join(f.Allowed, ", "))
+		}
+
+		return
+	}
+	arns = allowed
 
-	switch len(arns) {
+	matching := make([]ARN, 0, len(arns))
+	for _, arn := range arns {
+		if f.match(arn) {
+			matching = append(matching, arn)
+		}
+	}
+
+	switch len(matching) {
 	case 0:
-		err = errors.New("no valid AWS roles were returned")
+		err = fmt.Errorf("none of the returned AWS roles match account '%s' and role name '%s'", f.Account, f.RoleName)
 
 		return
 
 	case 1:
-		a = arns[0]
+		a = matching[0]
 
 		return
 	}
 
-	// Multiple ARNs returned - ask user which one to use.
-	a = arns[ask(arns)]
+	// Multiple ARNs returned - ask user which one to use. If the ARNs span multiple accounts, ask
+	// for the account first and then for a role in that account.
+	accounts := groupByAccount(matching)
+	var idx int
+	if len(accounts) == 1 {
+		idx, err = prompt.Select("Please select an IAM role to assume: ", roleLabels(matching), selectHint)
+		if err != nil {
+			return
+		}
+		a = matching[idx]
+
+		return
+	}
+
+	labels := make([]string, len(accounts))
+	for i, acc := range accounts {
+		roles := "roles"
+		if len(acc.arns) == 1 {
+			roles = "role"
+		}
+		labels[i] = fmt.Sprintf("%s (%d %s)", acc.label(), len(acc.arns), roles)
+	}
+	idx, err = prompt.Select("Please select an AWS account: ", labels, selectHint)
+	if err != nil {
+		return
+	}
+	acc := accounts[idx]
+
+	if len(acc.arns) == 1 {
+		a = acc.arns[0]
+
+		return
+	}
+
+	labels = make([]string, len(acc.arns))
+	for i, arn := range acc.arns {
+		labels[i] = roleName(arn.Role)
+		if viper.GetBool("global.show-role-arns") {
+			labels[i] = arn.Role
+		}
+	}
+	msg := fmt.Sprintf("Please select an IAM role to assume in %s: ", acc.label())
+	idx, err = prompt.Select(msg, labels, selectHint)
+	if err != nil {
+		return
+	}
+	a = acc.arns[idx]
 
 	return
 }
 
+// account is a group of roles which belong to the same AWS account.
+type account struct {
+	id   string
+	name string
+	arns []ARN
+}
+
+// label returns a human friendly representation of the account.
+func (a account) label() string {
+	if a.name != "" {
+		return fmt.Sprintf("%s - %s", a.name, a.id)
+	}
+	return a.id
+}
+
+// groupByAccount groups arns by AWS account. Accounts are ordered by their first appearance in
+// arns.
+func groupByAccount(arns []ARN) []account {
+	var accounts []account
+	idx := map[string]int{}
+	for _, arn := range arns {
+		id := accountID(arn.Role)
+		i, ok := idx[id]
+		if !ok {
+			i = len(accounts)
+			idx[id] = i
+			accounts = append(accounts, account{id: id, name: AccountName(id)})
+		}
+		accounts[i].arns = append(accounts[i].arns, arn)
+	}
+	return accounts
+}
+
+// accountID returns the ID of the AWS account in the given IAM ARN.
+func accountID(arn string) string {
+	// arn:aws:iam::123456789012:role/MyRole
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 {
+		return ""
+	}
+	return parts[4]
+}
+
+// roleName returns the name of the IAM role in the given role ARN without its path.
+func roleName(arn string) string {
+	return arn[strings.LastIndex(arn, "/")+1:]
+}
+
+// Bounds of the session durations STS accepts.
+const (
+	minRoleDuration = 15 * time.Minute
+	maxRoleDuration = 12 * time.Hour
+)
+
+// RoleDurations returns the session durations in seconds configured for role patterns in
+// global.role-durations, which are matched like RoleFilter.Allowed. Since the config keys are
+// case-insensitive, the patterns are lowercase.
+func RoleDurations() (map[string]int64, error) {
+	durations := make(map[string]int64)
+	for pattern, v := range viper.GetStringMapString("global.role-durations") {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < minRoleDuration || d > maxRoleDuration {
+			return nil, fmt.Errorf("invalid duration '%s' of role pattern '%s' in global.role-durations: "+
+				"must be a duration between %v and %v such as 1h", v, pattern, minRoleDuration, maxRoleDuration)
+		}
+		durations[pattern] = int64(d / time.Second)
+	}
+	return durations, nil
+}
+
+// RoleDuration returns the session duration in seconds configured in global.role-durations for
+// the role with the given ARN, or duration if no pattern matches. Patterns are matched
+// case-insensitively, and the longest matching pattern takes precedence.
+func RoleDuration(role string, duration int64) (int64, error) {
+	durations, err := RoleDurations()
+	if err != nil {
+		return 0, err
+	}
+
+	// Patterns of equal length are compared lexically so that the result doesn't depend on the
+	// order of the map.
+	var match string
+	for pattern, d := range durations {
+		preferred := len(pattern) > len(match) || (len(pattern) == len(match) && pattern < match)
+		if (match == "" || preferred) && matchRole(pattern, strings.ToLower(role)) {
+			match, duration = pattern, d
+		}
+	}
+	return duration, nil
+}
+
+// AccountName returns the human friendly name configured in global.accounts for the AWS account
+// with the given ID, or an empty string if no name is configured.
+func AccountName(id string) string {
+	name, _ := viper.GetStringMap("global.accounts")[id].(string)
+	return name
+}
+
+// roleLabels returns the text displayed for each of the given ARNs when asking the user to select
+// a role: the human friendly name of the role if available, or else its account and name, e.g.
+// "123456789012  MyRole". If global.show-role-arns is true, ARNs are displayed instead of accounts
+// and names.
+func roleLabels(arns []ARN) []string {
+	showARNs := viper.GetBool("global.show-role-arns")
+
+	labels := make([]string, len(arns))
+	for i, a := range arns {
+		id := accountID(a.Role)
+		switch {
+		case a.Name != "":
+			// Add the human friendly name if available
+			labels[i] = a.Name
+		case showARNs || id == "":
+			labels[i] = a.Role
+		default:
+			acc := account{id: id, name: AccountName(id)}
+			labels[i] = acc.label() + "  " + roleName(a.Role)
+		}
+	}
+	return labels
+}
+
+// authnStatements represents the authentication statements of a SAML response. The AuthnStatement
+// type of go-saml lacks the SessionNotOnOrAfter attribute.
+type authnStatements struct {
+	Assertion struct {
+		AuthnStatement []struct {
+			SessionNotOnOrAfter string `xml:",attr"`
+		}
+	}
+}
+
+// SessionNotOnOrAfter returns the time at which the session established by the base64-encoded SAML
+// response data expires according to the SessionNotOnOrAfter attribute of its authentication
+// statement. If the attribute is missing, the zero time is returned.
+func SessionNotOnOrAfter(data string) (time.Time, error) {
+	samlBody, err := decode(data)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var x authnStatements
+	if err := xml.Unmarshal(samlBody, &x); err != nil {
+		return time.Time{}, err
+	}
+
+	for _, st := range x.Assertion.AuthnStatement {
+		if st.SessionNotOnOrAfter == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, st.SessionNotOnOrAfter)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid SessionNotOnOrAfter: %v", err)
+		}
+		return t, nil
+	}
+
+	return time.Time{}, nil
+}
+
+// validityConditions represents the times after which a SAML assertion is rejected.
+type validityConditions struct {
+	Assertion struct {
+		Conditions struct {
+			NotOnOrAfter string `xml:",attr"`
+		}
+		Subject struct {
+			SubjectConfirmation []struct {
+				SubjectConfirmationData struct {
+					NotOnOrAfter string `xml:",attr"`
+				}
+			}
+		}
+	}
+}
+
+// NotOnOrAfter returns the time from which the base64-encoded SAML response data is no longer
+// accepted by STS, i.e. the earliest NotOnOrAfter attribute of its conditions and subject
+// confirmations. If no such attribute is set, the zero time is returned.
+func NotOnOrAfter(data string) (time.Time, error) {
+	samlBody, err := decode(data)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var x validityConditions
+	if err := xml.Unmarshal(samlBody, &x); err != nil {
+		return time.Time{}, err
+	}
+
+	values := []string{x.Assertion.Conditions.NotOnOrAfter}
+	for _, sc := range x.Assertion.Subject.SubjectConfirmation {
+		values = append(values, sc.SubjectConfirmationData.NotOnOrAfter)
+	}
+
+	var earliest time.Time
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid NotOnOrAfter: %v", err)
+		}
+		if earliest.IsZero() || t.Before(earliest) {
+			earliest = t
+		}
+	}
+
+	return earliest, nil
+}
+
 func decode(in string) (b []byte, err error) {
 	return base64.StdEncoding.DecodeString(in)
 }
@@ -71,7 +451,8 @@ func extractArns(attrs []saml.Attribute, pArn string) (arns []ARN) {
 				// Verify we have one of the following formats:
 				// 1. arn:aws:iam::xxxxxxxxxxxx:role/MyRole,arn:aws:iam::xxxxxxxxxxxx:saml-provider/MyProvider
 				// 2. arn:aws:iam::xxxxxxxxxxxx:saml-provider/MyProvider,arn:aws:iam::xxxxxxxxxxxx:role/MyRole
-				// Error otherwise.
+				// Error otherwise. The SAML provider may be in a different account than the role,
+				// e.g. in a management account, so the account IDs aren't compared.
 				components := strings.Split(strings.TrimSpace(av.Value), ",")
 				if len(components) != 2 {
 					// Wrong number of components - move on
@@ -132,44 +513,6 @@ func extractArns(attrs []saml.Attribute, pArn string) (arns []ARN) {
 	return
 }
 
-func ask(arns []ARN) (idx int) {
-	for {
-		for i, a := range arns {
-			name := a.Role
-			// Add the human friendly name if available
-			if a.Name != "" {
-				name = a.Name
-			}
-
-			// Use one-based indexing for human-friendliness.
-			fmt.Printf("%d. %s\n", i+1, name)
-		}
-
-		var input string
-		fmt.Print("Please select an IAM role to assume: ")
-		_, err := fmt.Scanln(&input)
-		if err != nil {
-			fmt.Printf("Error reading input: %v\n", err)
-			continue
-		}
-
-		// Verify we got an integer.
-		selected, err := strconv.Atoi(input)
-		if err != nil {
-			fmt.Printf("Invalid input '%s'\n", input)
-			continue
-		}
-
-		// Verify selection is within range.
-		if selected < 1 || selected > len(arns) {
-			fmt.Printf("Invalid value %d. Valid values: 1-%d\n", selected, len(arns))
-			continue
-		}
-
-		// Translate user-selected index back to zero-based index.
-		idx = selected - 1
-		break
-	}
-
-	return
-}
+// selectHint tells the user how to select a role when stdin isn't a terminal.
+const selectHint = "multiple roles are available; use --account and --role-name or the arn " +
+	"setting of the app to select one"
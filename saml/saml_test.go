@@ -1,8 +1,15 @@
 package saml
 
 import (
+	"errors"
 	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/allcloud-io/clisso/prompt"
+	"github.com/spf13/viper"
 )
 
 func TestDecode(t *testing.T) {
@@ -59,7 +66,7 @@ func TestGet(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			b, _ := ioutil.ReadFile(test.path)
 
-			arn, err := Get(string(b), "")
+			arn, err := Get(string(b), RoleFilter{})
 			if test.expectError && err == nil {
 				t.Errorf("expected error")
 			}
@@ -76,3 +83,366 @@ func TestGet(t *testing.T) {
 		})
 	}
 }
+
+func TestSessionNotOnOrAfter(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		path        string
+		expect      time.Time
+		expectError bool
+	}{
+		{
+			"With SessionNotOnOrAfter",
+			"testdata/session-not-on-or-after",
+			time.Date(2021, 2, 8, 18, 0, 0, 0, time.UTC),
+			false,
+		},
+		{"Without SessionNotOnOrAfter", "testdata/single-arn-response", time.Time{}, false},
+		{"Bad XML", "testdata/invalid-response", time.Time{}, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			b, _ := ioutil.ReadFile(test.path)
+
+			got, err := SessionNotOnOrAfter(string(b))
+			if test.expectError && err == nil {
+				t.Errorf("expected error")
+			}
+			if !test.expectError && err != nil {
+				t.Errorf("unexpected error %+v", err)
+			}
+
+			if !got.Equal(test.expect) {
+				t.Errorf("expected %v, received %v", test.expect, got)
+			}
+		})
+	}
+}
+
+func TestNotOnOrAfter(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		path        string
+		expect      time.Time
+		expectError bool
+	}{
+		{
+			"Earliest of conditions and subject confirmation",
+			"testdata/not-on-or-after",
+			time.Date(2021, 2, 8, 10, 5, 0, 0, time.UTC),
+			false,
+		},
+		{"Without NotOnOrAfter", "testdata/single-arn-response", time.Time{}, false},
+		{"Bad XML", "testdata/invalid-response", time.Time{}, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			b, _ := ioutil.ReadFile(test.path)
+
+			got, err := NotOnOrAfter(string(b))
+			if test.expectError && err == nil {
+				t.Errorf("expected error")
+			}
+			if !test.expectError && err != nil {
+				t.Errorf("unexpected error %+v", err)
+			}
+
+			if !got.Equal(test.expect) {
+				t.Errorf("expected %v, received %v", test.expect, got)
+			}
+		})
+	}
+}
+
+func TestGetWithFilter(t *testing.T) {
+	viper.Set("global.accounts", map[string]interface{}{"222222222222": "Production"})
+	defer viper.Set("global.accounts", nil)
+
+	b, _ := ioutil.ReadFile("testdata/multi-account-response")
+
+	for _, test := range []struct {
+		name        string
+		filter      RoleFilter
+		expectRole  string
+		expectError bool
+	}{
+		{
+			"Account and role name",
+			RoleFilter{Account: "111111111111", RoleName: "Admin"},
+			"arn:aws:iam::111111111111:role/Admin",
+			false,
+		},
+		{
+			"Role name only",
+			RoleFilter{RoleName: "ReadOnly"},
+			"arn:aws:iam::111111111111:role/ReadOnly",
+			false,
+		},
+		{
+			"Account name",
+			RoleFilter{Account: "production"},
+			"arn:aws:iam::222222222222:role/path/Admin",
+			false,
+		},
+		{
+			"Role with path",
+			RoleFilter{Account: "222222222222", RoleName: "Admin"},
+			"arn:aws:iam::222222222222:role/path/Admin",
+			false,
+		},
+		{
+			"Preferred ARN",
+			RoleFilter{ARN: "arn:aws:iam::111111111111:role/ReadOnly"},
+			"arn:aws:iam::111111111111:role/ReadOnly",
+			false,
+		},
+		{
+			"Allowed role name",
+			RoleFilter{Allowed: []string{"Read*"}},
+			"arn:aws:iam::111111111111:role/ReadOnly",
+			false,
+		},
+		{
+			"Allowed ARN pattern",
+			RoleFilter{Allowed: []string{"arn:aws:iam::222222222222:role/*"}},
+			"arn:aws:iam::222222222222:role/path/Admin",
+			false,
+		},
+		{
+			"Allowed preferred ARN",
+			RoleFilter{ARN: "arn:aws:iam::111111111111:role/Admin", Allowed: []string{"Admin"}},
+			"arn:aws:iam::111111111111:role/Admin",
+			false,
+		},
+		{
+			"Preferred ARN not allowed",
+			RoleFilter{ARN: "arn:aws:iam::111111111111:role/ReadOnly", Allowed: []string{"Admin"}},
+			"",
+			true,
+		},
+		{"No allowed roles", RoleFilter{Allowed: []string{"PowerUser"}}, "", true},
+		{"Unknown account", RoleFilter{Account: "333333333333"}, "", true},
+		{"Unknown role name", RoleFilter{RoleName: "PowerUser"}, "", true},
+		{"Role in another account", RoleFilter{Account: "222222222222", RoleName: "ReadOnly"}, "", true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			arn, err := Get(string(b), test.filter)
+			if test.expectError && err == nil {
+				t.Errorf("expected error")
+			}
+			if !test.expectError && err != nil {
+				t.Errorf("unexpected error %+v", err)
+			}
+
+			if test.expectRole != arn.Role {
+				t.Errorf("expected %q, received %q", test.expectRole, arn.Role)
+			}
+		})
+	}
+}
+
+func TestGetUnavailableARN(t *testing.T) {
+	b, _ := ioutil.ReadFile("testdata/multi-account-response")
+
+	_, err := Get(string(b), RoleFilter{ARN: "arn:aws:iam::333333333333:role/Admin"})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, role := range []string{"arn:aws:iam::111111111111:role/Admin", "arn:aws:iam::222222222222:role/path/Admin"} {
+		if !strings.Contains(err.Error(), role) {
+			t.Errorf("available role %s missing from error %q", role, err)
+		}
+	}
+}
+
+// selectingPrompter selects the options at the given indexes in turn.
+type selectingPrompter struct {
+	prompt.Terminal
+	choices []int
+}
+
+func (p *selectingPrompter) Select(msg string, options []string, hint string) (int, error) {
+	c := p.choices[0]
+	p.choices = p.choices[1:]
+	return c, nil
+}
+
+func TestGetReselect(t *testing.T) {
+	b, _ := ioutil.ReadFile("testdata/multi-account-response")
+	removed := "arn:aws:iam::333333333333:role/Admin"
+
+	// The removed role falls back to selecting the account and then the role.
+	prompt.SetPrompter(&selectingPrompter{choices: []int{1}})
+	arn, err := Get(string(b), RoleFilter{ARN: removed, Reselect: true})
+	prompt.SetPrompter(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if arn.Role != "arn:aws:iam::222222222222:role/path/Admin" {
+		t.Errorf("wrong role: got %s", arn.Role)
+	}
+
+	// If the user can't be asked, the role is reported as unavailable.
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	defer r.Close()
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = stdin }()
+
+	_, err = Get(string(b), RoleFilter{ARN: removed, Reselect: true})
+	if err == nil || !strings.Contains(err.Error(), "isn't available") {
+		t.Fatalf("expected unavailable role error, got %v", err)
+	}
+}
+
+func TestGetCrossAccount(t *testing.T) {
+	// The SAML provider is in the management account while the roles are in member accounts.
+	b, _ := ioutil.ReadFile("testdata/cross-account-response")
+	provider := "arn:aws:iam::111111111111:saml-provider/MyProvider"
+
+	for _, test := range []struct {
+		name       string
+		filter     RoleFilter
+		expectRole string
+	}{
+		{"Role before IdP", RoleFilter{ARN: "arn:aws:iam::222222222222:role/Admin"}, "arn:aws:iam::222222222222:role/Admin"},
+		{"IdP before role", RoleFilter{ARN: "arn:aws:iam::333333333333:role/ReadOnly"}, "arn:aws:iam::333333333333:role/ReadOnly"},
+		{"Account of role", RoleFilter{Account: "333333333333"}, "arn:aws:iam::333333333333:role/ReadOnly"},
+		{"Same account", RoleFilter{Account: "111111111111"}, "arn:aws:iam::111111111111:role/Admin"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			arn, err := Get(string(b), test.filter)
+			if err != nil {
+				t.Fatalf("unexpected error %+v", err)
+			}
+			if arn.Provider != provider {
+				t.Errorf("expected provider %q, received %q", provider, arn.Provider)
+			}
+			if arn.Role != test.expectRole {
+				t.Errorf("expected role %q, received %q", test.expectRole, arn.Role)
+			}
+		})
+	}
+}
+
+func TestGroupByAccount(t *testing.T) {
+	viper.Set("global.accounts", map[string]interface{}{"222222222222": "Production"})
+	defer viper.Set("global.accounts", nil)
+
+	arns := []ARN{
+		{Role: "arn:aws:iam::111111111111:role/Admin"},
+		{Role: "arn:aws:iam::222222222222:role/Admin"},
+		{Role: "arn:aws:iam::111111111111:role/ReadOnly"},
+	}
+
+	accounts := groupByAccount(arns)
+	if len(accounts) != 2 {
+		t.Fatalf("expected 2 accounts, received %d", len(accounts))
+	}
+
+	for i, expect := range []struct {
+		label string
+		roles int
+	}{
+		{"111111111111", 2},
+		{"Production - 222222222222", 1},
+	} {
+		if accounts[i].label() != expect.label {
+			t.Errorf("expected label %q, received %q", expect.label, accounts[i].label())
+		}
+		if len(accounts[i].arns) != expect.roles {
+			t.Errorf("expected %d roles for %s, received %d", expect.roles, accounts[i].id, len(accounts[i].arns))
+		}
+	}
+}
+
+func TestGetNonInteractive(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	defer r.Close()
+
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = stdin }()
+
+	b, _ := ioutil.ReadFile("testdata/multi-account-response")
+
+	// Multiple roles match, so the user would have to be asked.
+	_, err = Get(string(b), RoleFilter{RoleName: "Admin"})
+	if !errors.Is(err, prompt.ErrNonInteractive) {
+		t.Fatalf("expected prompt.ErrNonInteractive, got %v", err)
+	}
+}
+
+func TestRoleLabels(t *testing.T) {
+	defer viper.Reset()
+	viper.Set("global.accounts", map[string]interface{}{"222222222222": "prod"})
+
+	arns := []ARN{
+		{Role: "arn:aws:iam::111111111111:role/Admin"},
+		{Role: "arn:aws:iam::222222222222:role/path/ReadOnly"},
+		{Role: "arn:aws:iam::111111111111:role/Dev", Name: "Developer"},
+	}
+	for _, test := range []struct {
+		name     string
+		showARNs bool
+		expect   []string
+	}{
+		{"Accounts and names", false, []string{"111111111111  Admin", "prod - 222222222222  ReadOnly", "Developer"}},
+		{"ARNs", true, []string{arns[0].Role, arns[1].Role, "Developer"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			viper.Set("global.show-role-arns", test.showARNs)
+			got := roleLabels(arns)
+			if strings.Join(got, ",") != strings.Join(test.expect, ",") {
+				t.Errorf("wrong labels: got %q, want %q", got, test.expect)
+			}
+		})
+	}
+}
+
+func TestRoleDuration(t *testing.T) {
+	defer viper.Reset()
+
+	for _, test := range []struct {
+		name        string
+		durations   map[string]interface{}
+		role        string
+		expect      int64
+		expectError bool
+	}{
+		{"Not configured", nil, "arn:aws:iam::111111111111:role/Admin", 43200, false},
+		{"No match", map[string]interface{}{"readonly": "8h"}, "arn:aws:iam::111111111111:role/Admin", 43200, false},
+		{"Role name", map[string]interface{}{"admin": "1h"}, "arn:aws:iam::111111111111:role/path/Admin", 3600, false},
+		{"Longest pattern wins", map[string]interface{}{"*": "8h", "*admin": "1h"}, "arn:aws:iam::111111111111:role/Admin", 3600, false},
+		{"ARN", map[string]interface{}{"arn:aws:iam::111111111111:role/*": "2h"}, "arn:aws:iam::111111111111:role/Admin", 7200, false},
+		{"Too long", map[string]interface{}{"admin": "24h"}, "arn:aws:iam::111111111111:role/Admin", 0, true},
+		{"Not a duration", map[string]interface{}{"other": "long"}, "arn:aws:iam::111111111111:role/Admin", 0, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			viper.Reset()
+			if test.durations != nil {
+				viper.Set("global.role-durations", test.durations)
+			}
+
+			got, err := RoleDuration(test.role, 43200)
+			if test.expectError {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.expect {
+				t.Errorf("wrong duration: got %d, want %d", got, test.expect)
+			}
+		})
+	}
+}
@@ -1,9 +1,29 @@
 package spinner
 
+import (
+	"os"
+
+	"golang.org/x/term"
+)
+
 // This is a wrapper around spinner to disable unsupported operation systems transparently until upstream is fixed.
 // See https://github.com/briandowns/spinner/issues/52
 
+// disabled indicates that New should return a spinner which doesn't do anything.
+var disabled bool
+
+// Disable makes all spinners created afterwards no-ops. This is used when the output of clisso is
+// consumed by other programs.
+func Disable() {
+	disabled = true
+}
+
+// New returns a spinner which writes to stderr. The spinner doesn't do anything if spinners were
+// disabled or stderr isn't a terminal, e.g. when running in CI.
 func New() SpinnerWrapper {
+	if disabled || !term.IsTerminal(int(os.Stderr.Fd())) {
+		return &noopSpinner{}
+	}
 	return new()
 }
 
@@ -12,3 +32,11 @@ type SpinnerWrapper interface {
 	Start()
 	Stop()
 }
+
+// noopSpinner is a mock spinner which doesn't do anything. It is used to centrally disable the
+// spinner on Windows (because it isn't supported by the Windows terminal) or when requested.
+// See https://github.com/briandowns/spinner/issues/52
+type noopSpinner struct{}
+
+func (s *noopSpinner) Start() {}
+func (s *noopSpinner) Stop()  {}
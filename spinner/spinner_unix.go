@@ -3,11 +3,13 @@
 package spinner
 
 import (
+	"os"
 	"time"
 
 	"github.com/briandowns/spinner"
 )
 
 func new() SpinnerWrapper {
-	return spinner.New(spinner.CharSets[14], 50*time.Millisecond)
+	// Write to stderr to keep stdout free for output such as credentials.
+	return spinner.New(spinner.CharSets[14], 50*time.Millisecond, spinner.WithWriter(os.Stderr))
 }
@@ -0,0 +1,67 @@
+// Package totp generates time-based one-time passwords as specified in RFC 6238, as used by
+// authenticator apps.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// step is the period for which a code is valid.
+	step = 30 * time.Second
+	// digits is the number of digits of a code.
+	digits = 6
+)
+
+// Code returns the code which is valid at time t for secret, a base32 encoded seed as shown by
+// identity providers when enrolling an authenticator app. The secret may be lowercase and contain
+// spaces, and its padding may be omitted.
+func Code(secret string, t time.Time) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return generate(key, t, digits), nil
+}
+
+// decodeSecret decodes a base32 encoded secret.
+func decodeSecret(secret string) ([]byte, error) {
+	s := strings.ToUpper(strings.Replace(strings.TrimSpace(secret), " ", "", -1))
+	s = strings.TrimRight(s, "=")
+	if s == "" {
+		return nil, errors.New("empty TOTP secret")
+	}
+
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(s)
+	if err != nil {
+		// The error includes the offending input, which is secret.
+		return nil, errors.New("TOTP secret is not valid base32")
+	}
+	return key, nil
+}
+
+// generate computes the HOTP value (RFC 4226) of key for the time step containing t.
+func generate(key []byte, t time.Time, n int) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(t.Unix()/int64(step/time.Second)))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < n; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", n, value%mod)
+}
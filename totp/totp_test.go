@@ -0,0 +1,65 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcKey is the SHA-1 key of the test vectors in RFC 6238.
+var rfcKey = []byte("12345678901234567890")
+
+func TestGenerate(t *testing.T) {
+	// Test vectors from RFC 6238, appendix B.
+	for _, test := range []struct {
+		unix   int64
+		expect string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	} {
+		if got := generate(rfcKey, time.Unix(test.unix, 0), 8); got != test.expect {
+			t.Errorf("wrong code at %d: got %s, want %s", test.unix, got, test.expect)
+		}
+	}
+}
+
+func TestCode(t *testing.T) {
+	// rfcKey encoded using base32.
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	for _, test := range []struct {
+		name        string
+		secret      string
+		expect      string
+		expectError bool
+	}{
+		{"Standard", secret, "287082", false},
+		{"Lowercase with spaces", "gezd gnbv gy3t qojq gezd gnbv gy3t qojq", "287082", false},
+		{"Padded", "GEZDGNBVGY======", "", false},
+		{"Invalid", "not base32!", "", true},
+		{"Empty", "", "", true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			code, err := Code(test.secret, time.Unix(59, 0))
+			if test.expectError {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(code) != digits {
+				t.Errorf("wrong length of code %q: want %d digits", code, digits)
+			}
+			if test.expect != "" && code != test.expect {
+				t.Errorf("wrong code: got %s, want %s", code, test.expect)
+			}
+		})
+	}
+}